@@ -0,0 +1,235 @@
+/*
+Copyright 2018 Mirantis
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// rename-proto-package makes a copy of gogo-generated api.pb.go
+// with the proto package and the go package renamed. It's used to
+// produce CRI v1 (runtime.v1) types from CRI v1alpha2 ones, as the
+// former is wire compatible with the latter. The messages in the
+// copy get XXX_unrecognized fields that keep the fields unknown to
+// v1alpha2, such as the seccomp and AppArmor security profiles,
+// so they aren't lost when the messages are passed through.
+//
+// Usage: rename-proto-package OLD_PROTO_PKG NEW_PROTO_PKG NEW_GO_PKG < in.pb.go > out.pb.go
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/gogo/protobuf/proto"
+	"github.com/gogo/protobuf/protoc-gen-gogo/descriptor"
+)
+
+var (
+	descriptorRx = regexp.MustCompile(`(?s)(var fileDescriptor\w+ = \[\]byte\{\n)\t// \d+ bytes of a gzipped FileDescriptorProto\n(.*?)\n\}`)
+	unmarshalRx  = regexp.MustCompile(`(?m)^func \(m \*(\w+)\) Unmarshal\(dAtA \[\]byte\) error \{$`)
+)
+
+const unrecognizedField = "\tXXX_unrecognized []byte `json:\"-\"`\n"
+
+func renameType(name *string, oldPkg, newPkg string) {
+	if name != nil && strings.HasPrefix(*name, "."+oldPkg+".") {
+		*name = "." + newPkg + "." + strings.TrimPrefix(*name, "."+oldPkg+".")
+	}
+}
+
+func renameInMessages(msgs []*descriptor.DescriptorProto, oldPkg, newPkg string) {
+	for _, msg := range msgs {
+		for _, field := range msg.Field {
+			renameType(field.TypeName, oldPkg, newPkg)
+			renameType(field.Extendee, oldPkg, newPkg)
+		}
+		renameInMessages(msg.NestedType, oldPkg, newPkg)
+	}
+}
+
+func parseBytes(s string) ([]byte, error) {
+	var r []byte
+	for _, item := range strings.FieldsFunc(s, func(c rune) bool { return c == ',' || c == ' ' || c == '\t' || c == '\n' }) {
+		b, err := strconv.ParseUint(item, 0, 8)
+		if err != nil {
+			return nil, fmt.Errorf("bad descriptor byte %q: %v", item, err)
+		}
+		r = append(r, byte(b))
+	}
+	return r, nil
+}
+
+func formatBytes(data []byte) string {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "\t// %d bytes of a gzipped FileDescriptorProto\n", len(data))
+	for len(data) > 0 {
+		n := 16
+		if n > len(data) {
+			n = len(data)
+		}
+		s := ""
+		for _, b := range data[:n] {
+			s += fmt.Sprintf("0x%02x, ", b)
+		}
+		fmt.Fprintf(&buf, "\t%s\n", strings.TrimSuffix(s, " "))
+		data = data[n:]
+	}
+	return buf.String()
+}
+
+func renameDescriptor(gzipped []byte, oldPkg, newPkg, goPkg string) ([]byte, error) {
+	r, err := gzip.NewReader(bytes.NewReader(gzipped))
+	if err != nil {
+		return nil, err
+	}
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	var fd descriptor.FileDescriptorProto
+	if err := proto.Unmarshal(data, &fd); err != nil {
+		return nil, err
+	}
+	if fd.GetPackage() != oldPkg {
+		return nil, fmt.Errorf("unexpected proto package %q", fd.GetPackage())
+	}
+	fd.Package = proto.String(newPkg)
+	if fd.Options != nil && fd.Options.GoPackage != nil {
+		fd.Options.GoPackage = proto.String(goPkg)
+	}
+	renameInMessages(fd.MessageType, oldPkg, newPkg)
+	for _, svc := range fd.Service {
+		for _, method := range svc.Method {
+			renameType(method.InputType, oldPkg, newPkg)
+			renameType(method.OutputType, oldPkg, newPkg)
+		}
+	}
+	data, err = proto.Marshal(&fd)
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	w, err := gzip.NewWriterLevel(&buf, gzip.BestCompression)
+	if err != nil {
+		return nil, err
+	}
+	w.Write(data)
+	w.Close()
+	return buf.Bytes(), nil
+}
+
+// patchFunc applies patch to the body of the method of the message
+// type that has the specified header, e.g. "MarshalTo(dAtA []byte)".
+func patchFunc(src, typeName, header string, patch func(body string) (string, error)) (string, error) {
+	start := strings.Index(src, fmt.Sprintf("\nfunc (m *%s) %s", typeName, header))
+	if start < 0 {
+		return "", fmt.Errorf("%s.%s not found", typeName, header)
+	}
+	end := strings.Index(src[start:], "\n}\n")
+	if end < 0 {
+		return "", fmt.Errorf("end of %s.%s not found", typeName, header)
+	}
+	end += start + 3
+	body, err := patch(src[start:end])
+	if err != nil {
+		return "", fmt.Errorf("%s.%s: %v", typeName, header, err)
+	}
+	return src[:start] + body + src[end:], nil
+}
+
+func replaceOnce(s, old, new string) (string, error) {
+	if strings.Count(s, old) != 1 {
+		return "", fmt.Errorf("expected exactly one %q", old)
+	}
+	return strings.Replace(s, old, new, 1), nil
+}
+
+// keepUnrecognized adds XXX_unrecognized field to each message,
+// making Unmarshal store the unknown fields there and Marshal
+// write them back, the same way as gogo does it with
+// goproto_unrecognized option.
+func keepUnrecognized(src string) (string, error) {
+	for _, m := range unmarshalRx.FindAllStringSubmatch(src, -1) {
+		typeName := m[1]
+		var err error
+		src, err = patchFunc(src, typeName, "Unmarshal(dAtA []byte) error {", func(body string) (string, error) {
+			return replaceOnce(body, "\t\t\tiNdEx += skippy\n", "\t\t\tm.XXX_unrecognized = append(m.XXX_unrecognized, dAtA[iNdEx:iNdEx+skippy]...)\n\t\t\tiNdEx += skippy\n")
+		})
+		if err != nil {
+			return "", err
+		}
+		src, err = patchFunc(src, typeName, "MarshalTo(dAtA []byte) (int, error) {", func(body string) (string, error) {
+			return replaceOnce(body, "\treturn i, nil\n}\n", "\tif m.XXX_unrecognized != nil {\n\t\ti += copy(dAtA[i:], m.XXX_unrecognized)\n\t}\n\treturn i, nil\n}\n")
+		})
+		if err != nil {
+			return "", err
+		}
+		src, err = patchFunc(src, typeName, "Size() (n int) {", func(body string) (string, error) {
+			return replaceOnce(body, "\treturn n\n}\n", "\tif m.XXX_unrecognized != nil {\n\t\tn += len(m.XXX_unrecognized)\n\t}\n\treturn n\n}\n")
+		})
+		if err != nil {
+			return "", err
+		}
+		structRx := regexp.MustCompile(`(?ms)^type ` + typeName + ` struct \{\n.*?^\}\n`)
+		loc := structRx.FindStringIndex(src)
+		if loc == nil {
+			return "", fmt.Errorf("struct %s not found", typeName)
+		}
+		src = src[:loc[1]-2] + unrecognizedField + src[loc[1]-2:]
+	}
+	return src, nil
+}
+
+func run(oldPkg, newPkg, goPkg string) error {
+	src, err := ioutil.ReadAll(os.Stdin)
+	if err != nil {
+		return err
+	}
+	m := descriptorRx.FindSubmatchIndex(src)
+	if m == nil {
+		return fmt.Errorf("file descriptor not found")
+	}
+	gzipped, err := parseBytes(string(src[m[4]:m[5]]))
+	if err != nil {
+		return err
+	}
+	gzipped, err = renameDescriptor(gzipped, oldPkg, newPkg, goPkg)
+	if err != nil {
+		return err
+	}
+	out := string(src[:m[3]]) + formatBytes(gzipped) + "}" + string(src[m[1]:])
+	out = regexp.MustCompile(`(?m)^package \w+$`).ReplaceAllString(out, "package "+goPkg)
+	out = strings.Replace(out, "Package "+strings.TrimPrefix(oldPkg, "runtime.")+" is", "Package "+goPkg+" is", 1)
+	out = strings.Replace(out, oldPkg+".", newPkg+".", -1)
+	if out, err = keepUnrecognized(out); err != nil {
+		return err
+	}
+	_, err = os.Stdout.WriteString(out)
+	return err
+}
+
+func main() {
+	if len(os.Args) != 4 {
+		fmt.Fprintf(os.Stderr, "usage: %s OLD_PROTO_PKG NEW_PROTO_PKG NEW_GO_PKG < in.pb.go > out.pb.go\n", os.Args[0])
+		os.Exit(1)
+	}
+	if err := run(os.Args[1], os.Args[2], os.Args[3]); err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		os.Exit(1)
+	}
+}
@@ -34,6 +34,20 @@ cd "${top_dir}"
 sed -i 's@^\(type StorageIdentifier struct\)@/* +k8s:conversion-gen=false */ \1@' pkg/runtimeapis/v1_9/api.pb.go
 go fmt pkg/runtimeapis/v1_9/api.pb.go
 
+# CRI v1 is wire compatible with v1alpha2, so the v1 package is
+# produced by renaming the proto package of v1alpha2 one. The
+# fields that were added later are kept as unrecognized ones, so
+# they're passed through to CRI v1 runtimes as-is
+mkdir -p pkg/runtimeapis/v1
+go run hack/rename-proto-package/main.go runtime.v1alpha2 runtime.v1 v1 \
+   <pkg/runtimeapis/v1_12/api.pb.go >pkg/runtimeapis/v1/api.pb.go
+go fmt pkg/runtimeapis/v1/api.pb.go
+sed -e 's/^package runtime\.v1alpha2;/package runtime.v1;/' \
+    -e 's/^option go_package = "v1alpha2";/option go_package = "v1";/' \
+    pkg/runtimeapis/v1_12/api.proto >pkg/runtimeapis/v1/api.proto
+sed 's/^package v1alpha2/package v1/' \
+    pkg/runtimeapis/v1_12/constants.go >pkg/runtimeapis/v1/constants.go
+
 tar --exclude='vendor' --exclude='.git' -c . |
     docker run --rm -i ishvedunov/criproxy-build:0.0.6 \
            /bin/bash -c 'cd /go/src/github.com/Mirantis/criproxy && tar -x && hack/generate.sh && tar -c $(find . -name "*_generated.go")' | tar -xv
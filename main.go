@@ -17,11 +17,15 @@ limitations under the License.
 package main
 
 import (
+	"errors"
 	"flag"
 	"fmt"
-	"net/url"
+	"net/http"
 	"os"
+	"os/signal"
 	"strings"
+	"syscall"
+	"text/tabwriter"
 	"time"
 
 	"github.com/golang/glog"
@@ -30,47 +34,241 @@ import (
 	"github.com/elotl/criproxy/pkg/utils"
 )
 
-const (
-	// XXX: don't hardcode
-	connectionTimeout = 30 * time.Second
-)
-
 var (
+	configFile = flag.String("config", "",
+		"path to the YAML or JSON config file (the flags below that are set explicitly override the values from the config)")
+	configCheckInterval = flag.Duration("configCheckInterval", 10*time.Second,
+		"interval for checking the config file for changes (0 disables the checks, the config can still be reloaded using SIGHUP)")
 	listen = flag.String("listen", "/run/criproxy.sock",
-		"The unix socket to listen on, e.g. /run/virtlet.sock")
+		"The unix socket to listen on, e.g. /run/virtlet.sock (overrides the listeners from the config)")
 	connect = flag.String("connect", "/var/run/dockershim.sock",
-		"CRI runtime ids and unix socket(s) to connect to, e.g. /var/run/dockershim.sock,alt:/var/run/another.sock")
-	streamPort    = flag.Int("streamPort", 11250, "streaming port of the default runtime")
-	streamUrl     = flag.String("streamUrl", "", "streaming url of the default runtime (-streamPort is ignored if this value is set)")
-	apiServerHost = flag.String("apiserver", "", "apiserver URL")
-	criVersions   = []proxy.CRIVersion{&proxy.CRI19{}, &proxy.CRI112{}}
+		"CRI runtime ids and endpoints to connect to, e.g. /var/run/dockershim.sock,alt:/var/run/another.sock,vm:tcp://10.0.0.2:9000")
+	connectionTimeout = flag.Duration("connectionTimeout", proxy.DefaultConnectionTimeout, "timeout for connecting to CRI runtimes")
+	streamPort        = flag.Int("streamPort", proxy.DefaultStreamPort, "streaming port of the default runtime")
+	streamUrl         = flag.String("streamUrl", "", "streaming url of the default runtime (-streamPort is ignored if this value is set)")
+	apiServerHost     = flag.String("apiserver", "", "apiserver URL")
+	handlers          = flag.String("runtimeHandlers", "",
+		"comma-separated list of RuntimeClass handler to runtime id mappings, e.g. kata=kata,vm=virtlet.cloud (empty id denotes the primary runtime)")
+	imageCacheFile = flag.String("imageCacheFile", "",
+		"path to the file for keeping the image id to image name mapping across restarts (empty to keep it only in memory)")
+	logFormat = flag.String("logFormat", "",
+		"format of the logged CRI requests and responses: yaml or json (default: yaml)")
+	adminListen = flag.String("adminListen", "",
+		"address to serve HTTP metrics, status and health checks on, either host:port or a unix socket path (empty to disable)")
+	criVersions = []proxy.CRIVersion{&proxy.CRI19{}, &proxy.CRI112{}, &proxy.CRI1{}}
 )
 
-// runCriProxy starts CRI proxy
-func runCriProxy(connect, listen string) error {
-	addrs := strings.Split(connect, ",")
-	var err error
-	var realStreamUrl *url.URL
-	if *streamUrl == "" {
-		if realStreamUrl, err = utils.GetStreamUrl(*streamPort); err != nil {
-			return fmt.Errorf("can't get stream url: %v", err)
+// addRuntimeHandlers adds runtime handler mappings in the
+// handler=id,handler=id format to the config
+func addRuntimeHandlers(config *proxy.Config, spec string) error {
+	if spec == "" {
+		return nil
+	}
+	for _, item := range strings.Split(spec, ",") {
+		parts := strings.SplitN(item, "=", 2)
+		if len(parts) != 2 || parts[0] == "" {
+			return fmt.Errorf("bad runtime handler mapping %q", item)
+		}
+		found := false
+		for n := range config.Backends {
+			if b := &config.Backends[n]; b.ID == parts[1] {
+				b.RuntimeHandlers = append(b.RuntimeHandlers, parts[0])
+				found = true
+				break
+			}
+		}
+		if !found {
+			return fmt.Errorf("runtime handler %q refers to unknown runtime %q", parts[0], parts[1])
+		}
+	}
+	return nil
+}
+
+// buildConfig loads the config file if it's specified and
+// applies the command line flags to it
+func buildConfig() (*proxy.Config, error) {
+	setFlags := make(map[string]bool)
+	flag.Visit(func(f *flag.Flag) {
+		setFlags[f.Name] = true
+	})
+
+	config := &proxy.Config{}
+	if *configFile != "" {
+		var err error
+		if config, err = proxy.LoadConfig(*configFile); err != nil {
+			return nil, err
+		}
+	}
+
+	if *configFile == "" || setFlags["connect"] {
+		config.Backends = nil
+		for _, spec := range strings.Split(*connect, ",") {
+			config.Backends = append(config.Backends, proxy.ParseBackendSpec(spec))
+		}
+	}
+	if *configFile == "" || setFlags["connectionTimeout"] {
+		for n := range config.Backends {
+			config.Backends[n].ConnectionTimeout.Duration = *connectionTimeout
+		}
+	}
+	if *configFile == "" || setFlags["streamUrl"] || setFlags["streamPort"] {
+		config.StreamUrl = *streamUrl
+		config.StreamPort = *streamPort
+	}
+	if *configFile == "" || setFlags["imageCacheFile"] {
+		config.ImageCacheFile = *imageCacheFile
+	}
+	if *configFile == "" || setFlags["logFormat"] {
+		config.Log.Format = *logFormat
+	}
+	if len(config.Listeners) == 0 || setFlags["listen"] {
+		config.Listeners = []proxy.ListenerConfig{{Address: *listen}}
+	}
+	if err := addRuntimeHandlers(config, *handlers); err != nil {
+		return nil, err
+	}
+
+	config.SetDefaults()
+	if err := config.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid configuration: %v", err)
+	}
+	return config, nil
+}
+
+// reloadConfig rebuilds the config and applies it to the proxies
+func reloadConfig(proxies []*proxy.RuntimeProxy) {
+	glog.V(1).Info("Reloading the configuration")
+	config, err := buildConfig()
+	if err != nil {
+		glog.Errorf("Failed to reload the configuration: %v", err)
+		return
+	}
+	for _, p := range proxies {
+		if err := p.Reload(config); err != nil {
+			glog.Errorf("Failed to reload the configuration: %v", err)
+		}
+	}
+}
+
+// handleReloads reloads the configuration upon SIGHUP and, if
+// the config file is used and -configCheckInterval is non-zero,
+// when the config file changes
+func handleReloads(proxies []*proxy.RuntimeProxy) {
+	reloadCh := make(chan struct{}, 1)
+	requestReload := func() {
+		select {
+		case reloadCh <- struct{}{}:
+		default:
+		}
+	}
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, syscall.SIGHUP)
+	go func() {
+		for range sigCh {
+			requestReload()
+		}
+	}()
+	if *configFile != "" && *configCheckInterval > 0 {
+		go utils.WatchFile(*configFile, *configCheckInterval, nil, requestReload)
+	}
+	for range reloadCh {
+		reloadConfig(proxies)
+	}
+}
+
+// startAdminServer starts HTTP server that exports the metrics
+// and the status of the proxies
+func startAdminServer(addr string, proxies []*proxy.RuntimeProxy) error {
+	ln, err := proxy.ListenAdmin(addr)
+	if err != nil {
+		return fmt.Errorf("can't listen on %q: %v", addr, err)
+	}
+	glog.V(1).Infof("Serving metrics and status on %s", addr)
+	go func() {
+		if err := http.Serve(ln, proxy.NewAdminHandler(proxies)); err != nil {
+			glog.Errorf("Admin server failed: %v", err)
+		}
+	}()
+	return nil
+}
+
+// startStreamServer starts the proxy's streaming endpoint
+// that passes exec, attach and port forwarding requests
+// to the runtimes
+func startStreamServer(config *proxy.StreamingConfig) error {
+	handler, err := proxy.NewStreamHandler(config)
+	if err != nil {
+		return err
+	}
+	ln, err := proxy.ListenStreaming(config)
+	if err != nil {
+		return fmt.Errorf("can't listen on %q: %v", config.Address, err)
+	}
+	glog.V(1).Infof("Serving streaming requests on %s", config.Address)
+	go func() {
+		if err := http.Serve(ln, handler); err != nil {
+			glog.Errorf("Streaming server failed: %v", err)
 		}
-	} else {
-		if realStreamUrl, err = url.Parse(*streamUrl); err != nil {
-			return fmt.Errorf("invalid stream url %q: %v", *streamUrl, err)
+	}()
+	return nil
+}
+
+// printStatus retrieves the status of the running CRI proxy
+// and prints it
+func printStatus(addr string) error {
+	if addr == "" {
+		return errors.New("-adminListen must be specified to get the status")
+	}
+	statuses, err := proxy.GetStatus(addr)
+	if err != nil {
+		return err
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, "CRI\tID\tSOCKET\tSTATE\tPROTO PACKAGE\tCONVERTING\tLAST ERROR")
+	for _, status := range statuses {
+		for _, b := range status.Backends {
+			id := b.ID
+			if id == "" {
+				id = "(primary)"
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%v\t%s\n", status.ProtoPackage, id, b.Socket, b.State, b.ProtoPackage, b.Converting, b.LastError)
 		}
 	}
+	return w.Flush()
+}
+
+// runCriProxy starts CRI proxy
+func runCriProxy() error {
+	config, err := buildConfig()
+	if err != nil {
+		return err
+	}
 	var interceptors []proxy.Interceptor
+	var proxies []*proxy.RuntimeProxy
 	for _, criVersion := range criVersions {
-		proxy, err := proxy.NewRuntimeProxy(criVersion, addrs, connectionTimeout, realStreamUrl)
+		p, err := proxy.NewRuntimeProxy(criVersion, config)
 		if err != nil {
 			return fmt.Errorf("error initializing CRI proxy: %v", err)
 		}
-		interceptors = append(interceptors, proxy)
+		interceptors = append(interceptors, p)
+		proxies = append(proxies, p)
+	}
+	go handleReloads(proxies)
+	if config.Streaming != nil {
+		if err := startStreamServer(config.Streaming); err != nil {
+			return err
+		}
+	}
+	if *adminListen != "" {
+		if err := startAdminServer(*adminListen, proxies); err != nil {
+			return err
+		}
+	}
+	for _, l := range config.Listeners {
+		glog.V(1).Infof("Starting CRI proxy on %s", l.Address)
 	}
-	glog.V(1).Infof("Starting CRI proxy on socket %s", listen)
 	server := proxy.NewServer(interceptors, nil)
-	if err := server.Serve(listen, nil); err != nil {
+	if err := server.ServeListeners(config.Listeners, nil); err != nil {
 		return fmt.Errorf("serving failed: %v", err)
 	}
 	return nil
@@ -78,7 +276,16 @@ func runCriProxy(connect, listen string) error {
 
 func main() {
 	flag.Parse()
-	if err := runCriProxy(*connect, *listen); err != nil {
+	var err error
+	switch flag.Arg(0) {
+	case "":
+		err = runCriProxy()
+	case "status":
+		err = printStatus(*adminListen)
+	default:
+		err = fmt.Errorf("unknown command %q", flag.Arg(0))
+	}
+	if err != nil {
 		glog.Error(err)
 		os.Exit(1)
 	}
@@ -0,0 +1,334 @@
+/*
+Copyright 2018 Mirantis
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package metrics implements a minimal set of metric types that can
+// be exported in Prometheus text exposition format.
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// DefaultBuckets are the default histogram buckets which are
+// suitable for request latencies measured in seconds.
+var DefaultBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// Collector denotes a metric that can be exported.
+type Collector interface {
+	// Write writes the metric in Prometheus text format.
+	Write(w io.Writer) error
+}
+
+// Registry holds a set of metrics that are exported together.
+type Registry struct {
+	sync.Mutex
+	collectors []Collector
+}
+
+// NewRegistry creates a new empty Registry.
+func NewRegistry() *Registry {
+	return &Registry{}
+}
+
+// Register adds the collectors to the registry.
+func (r *Registry) Register(collectors ...Collector) {
+	r.Lock()
+	defer r.Unlock()
+	r.collectors = append(r.collectors, collectors...)
+}
+
+// Write writes all of the registered metrics in Prometheus
+// text format.
+func (r *Registry) Write(w io.Writer) error {
+	r.Lock()
+	collectors := make([]Collector, len(r.collectors))
+	copy(collectors, r.collectors)
+	r.Unlock()
+	bw := bufio.NewWriter(w)
+	for _, c := range collectors {
+		if err := c.Write(bw); err != nil {
+			return err
+		}
+	}
+	return bw.Flush()
+}
+
+// ServeHTTP implements http.Handler interface.
+func (r *Registry) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	r.Write(w)
+}
+
+type desc struct {
+	name, help, metricType string
+	labelNames             []string
+}
+
+func (d *desc) writeHeader(w io.Writer) error {
+	_, err := fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", d.name, escapeHelp(d.help), d.name, d.metricType)
+	return err
+}
+
+func (d *desc) writeSample(w io.Writer, suffix string, labelValues []string, extraLabel, extraValue string, value float64) error {
+	var labels []string
+	for n, name := range d.labelNames {
+		labels = append(labels, fmt.Sprintf("%s=%q", name, labelValues[n]))
+	}
+	if extraLabel != "" {
+		labels = append(labels, fmt.Sprintf("%s=%q", extraLabel, extraValue))
+	}
+	labelStr := ""
+	if len(labels) > 0 {
+		labelStr = "{" + strings.Join(labels, ",") + "}"
+	}
+	_, err := fmt.Fprintf(w, "%s%s%s %s\n", d.name, suffix, labelStr, formatFloat(value))
+	return err
+}
+
+func (d *desc) key(labelValues []string) string {
+	if len(labelValues) != len(d.labelNames) {
+		panic(fmt.Sprintf("metric %s: expected %d label values, got %d", d.name, len(d.labelNames), len(labelValues)))
+	}
+	return strings.Join(labelValues, "\x00")
+}
+
+// CounterVec is a set of counters that differ in label values.
+type CounterVec struct {
+	sync.Mutex
+	desc
+	values map[string]float64
+	labels map[string][]string
+}
+
+var _ Collector = &CounterVec{}
+
+// NewCounterVec creates a new CounterVec.
+func NewCounterVec(name, help string, labelNames ...string) *CounterVec {
+	return &CounterVec{
+		desc:   desc{name, help, "counter", labelNames},
+		values: make(map[string]float64),
+		labels: make(map[string][]string),
+	}
+}
+
+// Add adds the value to the counter with the specified label values.
+func (c *CounterVec) Add(value float64, labelValues ...string) {
+	key := c.key(labelValues)
+	c.Lock()
+	defer c.Unlock()
+	if _, found := c.labels[key]; !found {
+		c.labels[key] = labelValues
+	}
+	c.values[key] += value
+}
+
+// Inc increments the counter with the specified label values.
+func (c *CounterVec) Inc(labelValues ...string) {
+	c.Add(1, labelValues...)
+}
+
+// Get returns the value of the counter with the specified label values.
+func (c *CounterVec) Get(labelValues ...string) float64 {
+	key := c.key(labelValues)
+	c.Lock()
+	defer c.Unlock()
+	return c.values[key]
+}
+
+// Write implements Write method of the Collector interface.
+func (c *CounterVec) Write(w io.Writer) error {
+	c.Lock()
+	defer c.Unlock()
+	if err := c.writeHeader(w); err != nil {
+		return err
+	}
+	for _, key := range sortedKeys(c.labels) {
+		if err := c.writeSample(w, "", c.labels[key], "", "", c.values[key]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type histogram struct {
+	labelValues []string
+	counts      []uint64
+	count       uint64
+	sum         float64
+}
+
+// HistogramVec is a set of histograms that differ in label values.
+type HistogramVec struct {
+	sync.Mutex
+	desc
+	buckets    []float64
+	histograms map[string]*histogram
+}
+
+var _ Collector = &HistogramVec{}
+
+// NewHistogramVec creates a new HistogramVec with the specified
+// upper bounds of the buckets. If buckets is nil, DefaultBuckets
+// are used.
+func NewHistogramVec(name, help string, buckets []float64, labelNames ...string) *HistogramVec {
+	if buckets == nil {
+		buckets = DefaultBuckets
+	}
+	return &HistogramVec{
+		desc:       desc{name, help, "histogram", labelNames},
+		buckets:    buckets,
+		histograms: make(map[string]*histogram),
+	}
+}
+
+// Observe adds the value to the histogram with the specified label values.
+func (h *HistogramVec) Observe(value float64, labelValues ...string) {
+	key := h.key(labelValues)
+	h.Lock()
+	defer h.Unlock()
+	hist, found := h.histograms[key]
+	if !found {
+		hist = &histogram{
+			labelValues: labelValues,
+			counts:      make([]uint64, len(h.buckets)),
+		}
+		h.histograms[key] = hist
+	}
+	for n, upperBound := range h.buckets {
+		if value <= upperBound {
+			hist.counts[n]++
+		}
+	}
+	hist.count++
+	hist.sum += value
+}
+
+// Count returns the number of the observations made for the
+// histogram with the specified label values.
+func (h *HistogramVec) Count(labelValues ...string) uint64 {
+	key := h.key(labelValues)
+	h.Lock()
+	defer h.Unlock()
+	if hist, found := h.histograms[key]; found {
+		return hist.count
+	}
+	return 0
+}
+
+// Write implements Write method of the Collector interface.
+func (h *HistogramVec) Write(w io.Writer) error {
+	h.Lock()
+	defer h.Unlock()
+	if err := h.writeHeader(w); err != nil {
+		return err
+	}
+	keys := make([]string, 0, len(h.histograms))
+	for key := range h.histograms {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		hist := h.histograms[key]
+		for n, upperBound := range h.buckets {
+			if err := h.writeSample(w, "_bucket", hist.labelValues, "le", formatFloat(upperBound), float64(hist.counts[n])); err != nil {
+				return err
+			}
+		}
+		if err := h.writeSample(w, "_bucket", hist.labelValues, "le", "+Inf", float64(hist.count)); err != nil {
+			return err
+		}
+		if err := h.writeSample(w, "_sum", hist.labelValues, "", "", hist.sum); err != nil {
+			return err
+		}
+		if err := h.writeSample(w, "_count", hist.labelValues, "", "", float64(hist.count)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// GaugeFunc is a set of gauges which values are obtained by
+// invoking a function each time the metrics are exported.
+type GaugeFunc struct {
+	desc
+	collect func(set func(value float64, labelValues ...string))
+}
+
+var _ Collector = &GaugeFunc{}
+
+// NewGaugeFunc creates a new GaugeFunc. collect is invoked
+// each time the gauge is exported. It must call set for each
+// combination of the label values that needs to be exported.
+func NewGaugeFunc(name, help string, collect func(set func(value float64, labelValues ...string)), labelNames ...string) *GaugeFunc {
+	return &GaugeFunc{
+		desc:    desc{name, help, "gauge", labelNames},
+		collect: collect,
+	}
+}
+
+// Write implements Write method of the Collector interface.
+func (g *GaugeFunc) Write(w io.Writer) error {
+	values := make(map[string]float64)
+	labels := make(map[string][]string)
+	g.collect(func(value float64, labelValues ...string) {
+		key := g.key(labelValues)
+		labels[key] = labelValues
+		values[key] = value
+	})
+	if err := g.writeHeader(w); err != nil {
+		return err
+	}
+	for _, key := range sortedKeys(labels) {
+		if err := g.writeSample(w, "", labels[key], "", "", values[key]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func sortedKeys(m map[string][]string) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	default:
+		return strconv.FormatFloat(v, 'g', -1, 64)
+	}
+}
+
+func escapeHelp(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "\n", `\n`).Replace(s)
+}
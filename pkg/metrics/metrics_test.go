@@ -0,0 +1,85 @@
+/*
+Copyright 2018 Mirantis
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package metrics
+
+import (
+	"bytes"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/pmezard/go-difflib/difflib"
+)
+
+func TestRegistry(t *testing.T) {
+	counter := NewCounterVec("test_requests_total", "Number of requests.", "method", "code")
+	counter.Inc("Version", "OK")
+	counter.Inc("Version", "OK")
+	counter.Add(3, "Status", "Unavailable")
+	if v := counter.Get("Version", "OK"); v != 2 {
+		t.Errorf("bad counter value: %v instead of 2", v)
+	}
+
+	hist := NewHistogramVec("test_duration_seconds", "Request duration.", []float64{0.1, 1}, "method")
+	hist.Observe(0.05, "Version")
+	hist.Observe(0.5, "Version")
+	hist.Observe(2, "Version")
+	if c := hist.Count("Version"); c != 3 {
+		t.Errorf("bad histogram count: %d instead of 3", c)
+	}
+
+	gauge := NewGaugeFunc("test_state", "Backend state.", func(set func(value float64, labelValues ...string)) {
+		set(1, "b", "connected")
+		set(0, "a", "offline")
+	}, "backend", "state")
+
+	registry := NewRegistry()
+	registry.Register(counter, hist, gauge)
+	expected := `# HELP test_requests_total Number of requests.
+# TYPE test_requests_total counter
+test_requests_total{method="Status",code="Unavailable"} 3
+test_requests_total{method="Version",code="OK"} 2
+# HELP test_duration_seconds Request duration.
+# TYPE test_duration_seconds histogram
+test_duration_seconds_bucket{method="Version",le="0.1"} 1
+test_duration_seconds_bucket{method="Version",le="1"} 2
+test_duration_seconds_bucket{method="Version",le="+Inf"} 3
+test_duration_seconds_sum{method="Version"} 2.55
+test_duration_seconds_count{method="Version"} 3
+# HELP test_state Backend state.
+# TYPE test_state gauge
+test_state{backend="a",state="offline"} 0
+test_state{backend="b",state="connected"} 1
+`
+
+	rec := httptest.NewRecorder()
+	registry.ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	if actual := rec.Body.String(); actual != expected {
+		diff, _ := difflib.GetUnifiedDiffString(difflib.UnifiedDiff{
+			A:        difflib.SplitLines(expected),
+			B:        difflib.SplitLines(actual),
+			FromFile: "expected",
+			ToFile:   "actual",
+			Context:  3,
+		})
+		t.Errorf("bad metrics output:\n%s", diff)
+	}
+
+	var buf bytes.Buffer
+	if err := NewRegistry().Write(&buf); err != nil || buf.Len() != 0 {
+		t.Errorf("empty registry: unexpected output %q, error %v", buf.String(), err)
+	}
+}
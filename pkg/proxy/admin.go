@@ -0,0 +1,184 @@
+/*
+Copyright 2018 Mirantis
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package proxy
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/golang/glog"
+	"golang.org/x/net/context"
+
+	"github.com/elotl/criproxy/pkg/metrics"
+)
+
+const adminRequestTimeout = 10 * time.Second
+
+// BackendStatus describes the state of the connection to a runtime.
+type BackendStatus struct {
+	// ID is the runtime id (empty for the primary runtime).
+	ID string `json:"id"`
+	// Socket is the path to the runtime's socket.
+	Socket string `json:"socket"`
+	// State is the state of the connection: offline, connecting
+	// or connected.
+	State string `json:"state"`
+	// ProtoPackage is the proto package of the CRI version that
+	// was negotiated with the runtime. It's empty if the proxy
+	// didn't connect to the runtime yet.
+	ProtoPackage string `json:"protoPackage,omitempty"`
+	// Converting is true if the requests are converted to another
+	// CRI version before they're passed to the runtime.
+	Converting bool `json:"converting"`
+	// LastError is the last error that happened when connecting
+	// to the runtime or talking to it.
+	LastError string `json:"lastError,omitempty"`
+}
+
+// Status describes the state of a proxy.
+type Status struct {
+	// ProtoPackage is the proto package of the CRI version
+	// served by the proxy.
+	ProtoPackage string `json:"protoPackage"`
+	// Backends lists the states of the runtimes.
+	Backends []BackendStatus `json:"backends"`
+}
+
+// Status returns the current status of the proxy.
+func (r *RuntimeProxy) Status() Status {
+	s := Status{ProtoPackage: r.criVersion.ProtoPackage()}
+	for _, c := range r.clients(context.Background()).clients {
+		s.Backends = append(s.Backends, c.status())
+	}
+	return s
+}
+
+// checkReady verifies that the proxy is connected to all of the
+// runtimes. It initiates the connection to the runtimes that
+// are offline, so the proxy doesn't remain unready just because
+// it didn't receive any requests for these runtimes yet.
+func (r *RuntimeProxy) checkReady() []string {
+	var problems []string
+	for _, c := range r.clients(context.Background()).clients {
+		if c.currentState() == clientStateConnected {
+			continue
+		}
+		c.connect()
+		s := c.status()
+		problem := fmt.Sprintf("CRI %s: runtime %q (%s) is %s", r.criVersion.ProtoPackage(), s.ID, s.Socket, s.State)
+		if s.LastError != "" {
+			problem += ": " + s.LastError
+		}
+		problems = append(problems, problem)
+	}
+	return problems
+}
+
+// NewAdminHandler returns an http.Handler that serves the metrics
+// of the proxies at /metrics, their status at /status and
+// health and readiness checks at /healthz and /readyz,
+// respectively.
+func NewAdminHandler(proxies []*RuntimeProxy) http.Handler {
+	registry := metrics.NewRegistry()
+	RegisterMetrics(registry, proxies)
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", registry)
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, req *http.Request) {
+		fmt.Fprintln(w, "ok")
+	})
+	mux.HandleFunc("/readyz", func(w http.ResponseWriter, req *http.Request) {
+		var problems []string
+		for _, r := range proxies {
+			problems = append(problems, r.checkReady()...)
+		}
+		if len(problems) > 0 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			fmt.Fprintln(w, strings.Join(problems, "\n"))
+			return
+		}
+		fmt.Fprintln(w, "ok")
+	})
+	mux.HandleFunc("/status", func(w http.ResponseWriter, req *http.Request) {
+		var statuses []Status
+		for _, r := range proxies {
+			statuses = append(statuses, r.Status())
+		}
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(statuses); err != nil {
+			glog.Errorf("Error writing status: %v", err)
+		}
+	})
+	return mux
+}
+
+func adminNetwork(addr string) string {
+	if strings.HasPrefix(addr, "/") {
+		return "unix"
+	}
+	return "tcp"
+}
+
+// ListenAdmin starts listening on the specified address which
+// is either host:port or a path to a unix domain socket.
+func ListenAdmin(addr string) (net.Listener, error) {
+	network := adminNetwork(addr)
+	if network == "unix" {
+		if err := syscall.Unlink(addr); err != nil && !os.IsNotExist(err) {
+			return nil, err
+		}
+	}
+	return net.Listen(network, addr)
+}
+
+// GetStatus retrieves the status of the proxies from the admin
+// endpoint at the specified address, which is either host:port
+// or a path to a unix domain socket.
+func GetStatus(addr string) ([]Status, error) {
+	client := &http.Client{
+		Timeout: adminRequestTimeout,
+		Transport: &http.Transport{
+			Dial: func(_, _ string) (net.Conn, error) {
+				return net.Dial(adminNetwork(addr), addr)
+			},
+		},
+	}
+	// the host part doesn't matter because of the custom dialer
+	resp, err := client.Get("http://criproxy/status")
+	if err != nil {
+		return nil, fmt.Errorf("can't get CRI proxy status: %v", err)
+	}
+	defer resp.Body.Close()
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("can't read CRI proxy status: %v", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("can't get CRI proxy status: %s: %s", resp.Status, strings.TrimSpace(string(data)))
+	}
+	var statuses []Status
+	if err := json.Unmarshal(data, &statuses); err != nil {
+		return nil, fmt.Errorf("can't parse CRI proxy status: %v", err)
+	}
+	return statuses, nil
+}
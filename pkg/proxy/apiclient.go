@@ -30,18 +30,25 @@ import (
 	"golang.org/x/net/context"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
 
+	"github.com/elotl/criproxy/pkg/rawcodec"
 	"github.com/elotl/criproxy/pkg/utils"
 )
 
 type clientState int
 
 const (
-	targetRuntimeAnnotationKey = "kubernetes.io/target-runtime"
-	clientStateOffline         = clientState(iota)
+	clientStateOffline clientState = iota
 	clientStateConnecting
 	clientStateConnected
-	versionRequestMethod = "RuntimeService/Version"
+)
+
+const (
+	targetRuntimeAnnotationKey = "kubernetes.io/target-runtime"
+	versionRequestMethod       = "RuntimeService/Version"
+	updateRuntimeConfigMethod  = "RuntimeService/UpdateRuntimeConfig"
 )
 
 var errNotConnected = errors.New("not connected")
@@ -51,6 +58,7 @@ type client interface {
 	getID() string
 	isPrimary() bool
 	currentState() clientState
+	status() BackendStatus
 	connect() chan error
 	stop()
 	handleError(err error, tolerateDisconnect bool) error
@@ -59,27 +67,43 @@ type client interface {
 	annotationsMatch(annotations map[string]string) bool
 	idPrefixMatches(id string) (bool, string)
 	imageMatches(imageName string) (bool, string)
+	mapImage(imageName string) (string, bool)
 	addPrefix(criObject CRIObject) CRIObject
 	invoke(ctx context.Context, method string, req, resp CRIObject) (CRIObject, error)
 	invokeWithErrorHandling(ctx context.Context, method string, req, resp CRIObject) (CRIObject, error)
+	openStream(ctx context.Context, method string, req CRIObject) (grpc.ClientStream, error)
 }
 
 type clientProbeFunc func(conn *grpc.ClientConn, connectionTimeout time.Duration) error
 
 type clientConnection struct {
 	sync.Mutex
+	runtimeId string
+	// addr is the runtime endpoint as it's specified in the config
 	addr              string
+	tlsConfig         BackendTLSConfig
+	keepalive         KeepaliveConfig
 	conn              *grpc.ClientConn
 	probe             clientProbeFunc
 	state             clientState
 	connectionTimeout time.Duration
 	connectErrChs     []chan error
+	lastErr           error
+	// onConnected is called each time the connection to the runtime
+	// is established, after the connect() callers are notified, so
+	// the requests don't wait for it if the runtime is slow to respond
+	onConnected func()
+	// onConnectedCalls tracks the onConnected calls in progress
+	onConnectedCalls sync.WaitGroup
 }
 
-func newClientConnection(addr string, connectionTimeout time.Duration) *clientConnection {
+func newClientConnection(backend BackendConfig) *clientConnection {
 	return &clientConnection{
-		addr:              addr,
-		connectionTimeout: connectionTimeout,
+		runtimeId:         backend.ID,
+		addr:              backend.Socket,
+		tlsConfig:         backend.TLS,
+		keepalive:         backend.Keepalive,
+		connectionTimeout: backend.ConnectionTimeout.Duration,
 	}
 }
 
@@ -89,6 +113,27 @@ func (c *clientConnection) currentState() clientState {
 	return c.state
 }
 
+// status returns the status of the connection. It doesn't fill
+// in the fields that are specific to the client.
+func (c *clientConnection) status() BackendStatus {
+	c.Lock()
+	defer c.Unlock()
+	s := BackendStatus{
+		Socket: c.addr,
+		State:  c.state.String(),
+	}
+	if c.lastErr != nil {
+		s.LastError = c.lastErr.Error()
+	}
+	return s
+}
+
+func (c *clientConnection) setLastError(err error) {
+	c.Lock()
+	defer c.Unlock()
+	c.lastErr = err
+}
+
 func (c *clientConnection) connectNonLocked() chan error {
 	if c.state == clientStateConnected {
 		errCh := make(chan error, 1)
@@ -105,40 +150,82 @@ func (c *clientConnection) connectNonLocked() chan error {
 	c.state = clientStateConnecting
 	go func() {
 		glog.V(1).Infof("Connecting to runtime service %s", c.addr)
-		var conn *grpc.ClientConn
-		if err := utils.WaitForSocket(c.addr, -1, func() error {
-			var err error
-			conn, err = grpc.Dial(c.addr, grpc.WithInsecure(), grpc.WithTimeout(c.connectionTimeout), grpc.WithDialer(utils.Dial))
-			if err == nil && c.probe != nil {
-				err = c.probe(conn, c.connectionTimeout)
-				if err != nil {
-					conn.Close()
-				}
-			}
-			return err
-		}); err != nil {
+		conn, err := c.dial()
+		if err != nil {
 			glog.Errorf("Failed to connect to the socket: %v", err)
 			err = fmt.Errorf("failed to connect to the socket: %v", err)
+			c.Lock()
+			defer c.Unlock()
+			c.state = clientStateOffline
+			c.lastErr = err
 			for _, ch := range c.connectErrChs {
 				ch <- err
 			}
+			c.connectErrChs = nil
 			return
 		}
 
 		c.Lock()
-		defer c.Unlock()
 		glog.V(1).Infof("Connected to runtime service %s", c.addr)
 		c.state = clientStateConnected
 		c.conn = conn
+		connectErrChs := c.connectErrChs
+		c.connectErrChs = nil
+		onConnected := c.onConnected
+		if onConnected != nil {
+			c.onConnectedCalls.Add(1)
+		}
+		c.Unlock()
 
-		for _, ch := range c.connectErrChs {
+		for _, ch := range connectErrChs {
 			ch <- nil
 		}
-		c.connectErrChs = nil
+		if onConnected != nil {
+			defer c.onConnectedCalls.Done()
+			onConnected()
+		}
 	}()
 	return errCh
 }
 
+// dial waits for the runtime endpoint to become available and
+// makes a gRPC connection to it that's checked using the probe.
+func (c *clientConnection) dial() (*grpc.ClientConn, error) {
+	scheme, addr, err := utils.ParseEndpoint(c.addr)
+	if err != nil {
+		return nil, err
+	}
+	network := utils.EndpointNetwork(scheme)
+	opts := []grpc.DialOption{
+		grpc.WithTimeout(c.connectionTimeout),
+		grpc.WithDialer(utils.Dialer(network, c.keepalive.period())),
+		grpc.WithCodec(rawcodec.Codec{}),
+	}
+	if scheme == utils.EndpointSchemeTLS {
+		tlsConfig, err := c.tlsConfig.clientConfig(addr)
+		if err != nil {
+			return nil, fmt.Errorf("bad tls settings: %v", err)
+		}
+		opts = append(opts, grpc.WithTransportCredentials(credentials.NewTLS(tlsConfig)))
+	} else {
+		opts = append(opts, grpc.WithInsecure())
+	}
+
+	var conn *grpc.ClientConn
+	err = utils.WaitForSocket(network, addr, -1, func() error {
+		var err error
+		conn, err = grpc.Dial(addr, opts...)
+		if err == nil && c.probe != nil {
+			err = c.probe(conn, c.connectionTimeout)
+			if err != nil {
+				conn.Close()
+			}
+		}
+		return err
+	}, c.setLastError)
+	return conn, err
+}
+
 func (c *clientConnection) connect() chan error {
 	c.Lock()
 	defer c.Unlock()
@@ -166,24 +253,29 @@ func (c *clientConnection) stop() {
 // 'Unavailable' code in which case it disconnects from the client and
 // starts trying to reestablish the connection. In case if
 // tolerateDisconnect is true, it also returns nil in this case. In
-// other cases, including non-'Unavailable' errors, it returns the
-// original err value
+// other cases, including non-'Unavailable' errors, it returns
+// a *BackendError that keeps the status code of the original error
+// and identifies the runtime
 func (c *clientConnection) handleError(err error, tolerateDisconnect bool) error {
-	if grpc.Code(err) == codes.Unavailable {
+	if errorCode(err) == codes.Unavailable {
 		c.Lock()
 		defer c.Unlock()
+		c.lastErr = err
 		c.stopNonLocked()
 		c.connectNonLocked()
+		backendReconnectCount.Inc(c.runtimeId, c.addr)
 
 		if tolerateDisconnect {
 			return nil
 		}
 	}
-	return fmt.Errorf("%q: %v", c.addr, err)
+	return newBackendError(c.runtimeId, c.addr, err)
 }
 
 type clientBase struct {
 	id string
+	// images are the image mappings of the runtime
+	images []imageMapping
 }
 
 func (c *clientBase) getID() string { return c.id }
@@ -196,6 +288,11 @@ func (c *clientBase) imageName(unprefixedName string) string {
 	if c.isPrimary() {
 		return unprefixedName
 	}
+	for _, m := range c.images {
+		if name, ok := m.fromRuntime(unprefixedName); ok {
+			return name
+		}
+	}
 	return c.id + "/" + unprefixedName
 }
 
@@ -225,7 +322,21 @@ func (c *clientBase) idPrefixMatches(id string) (bool, string) {
 	}
 }
 
+// mapImage returns the runtime's name of the image and true
+// if the image matches one of the image mappings of the runtime.
+func (c *clientBase) mapImage(imageName string) (string, bool) {
+	for _, m := range c.images {
+		if name, ok := m.toRuntime(imageName); ok {
+			return name, true
+		}
+	}
+	return "", false
+}
+
 func (c *clientBase) imageMatches(imageName string) (bool, string) {
+	if name, ok := c.mapImage(imageName); ok {
+		return true, name
+	}
 	switch {
 	case c.isPrimary():
 		return true, imageName
@@ -297,6 +408,21 @@ func (c *clientBase) prefixImage(unprefixedImage Image) Image {
 	return image
 }
 
+func (c *clientBase) prefixContainerEvent(event ContainerEventResponse) ContainerEventResponse {
+	if c.isPrimary() {
+		return event
+	}
+	event.SetContainerId(c.augmentId(event.ContainerId()))
+	if status := event.PodSandboxStatus(); status != nil {
+		status.SetId(c.augmentId(status.Id()))
+	}
+	for _, status := range event.ContainersStatuses() {
+		status.SetId(c.augmentId(status.Id()))
+		status.SetImage(c.imageName(status.Image()))
+	}
+	return event
+}
+
 func (c *clientBase) addPrefix(criObject CRIObject) CRIObject {
 	switch o := criObject.(type) {
 	case PodSandbox:
@@ -307,6 +433,8 @@ func (c *clientBase) addPrefix(criObject CRIObject) CRIObject {
 		return c.prefixContainerStats(o)
 	case Image:
 		return c.prefixImage(o)
+	case ContainerEventResponse:
+		return c.prefixContainerEvent(o)
 	default:
 		return o
 	}
@@ -320,14 +448,21 @@ type apiClient struct {
 
 var _ client = &apiClient{}
 
-func newApiClient(criVersion CRIVersion, clientConn *clientConnection, id string) *apiClient {
+func newApiClient(criVersion CRIVersion, clientConn *clientConnection, base clientBase) *apiClient {
 	return &apiClient{
-		clientBase:       clientBase{id},
+		clientBase:       base,
 		criVersion:       criVersion,
 		clientConnection: clientConn,
 	}
 }
 
+func (c *apiClient) status() BackendStatus {
+	s := c.clientConnection.status()
+	s.ID = c.id
+	s.ProtoPackage = c.criVersion.ProtoPackage()
+	return s
+}
+
 func (c *apiClient) getConn() (*grpc.ClientConn, error) {
 	c.Lock()
 	defer c.Unlock()
@@ -343,121 +478,188 @@ func (c *apiClient) invoke(ctx context.Context, method string, req, resp CRIObje
 		return nil, err
 	}
 
-	if err = grpc.Invoke(ctx, method, req.Unwrap(), resp.Unwrap(), conn); grpc.Code(err) == codes.Unavailable {
+	start := time.Now()
+	var trailer metadata.MD
+	err = grpc.Invoke(ctx, method, req.Unwrap(), resp.Unwrap(), conn, grpc.Trailer(&trailer))
+	observeBackendRequest(c.id, method, start, err)
+	if grpc.Code(err) == codes.Unavailable {
 		c.Lock()
 		defer c.Unlock()
 		if conn != c.conn {
 			// do not close the current connection if the request is related
 			// to a previously closed one
-			err = errOldConnection
+			return resp, errOldConnection
 		}
 	}
+	if err != nil {
+		err = c.backendError(err, trailer)
+	}
 	return resp, err
 }
 
 func (c *apiClient) invokeWithErrorHandling(ctx context.Context, method string, req, resp CRIObject) (CRIObject, error) {
-	err := grpc.Invoke(ctx, method, req.Unwrap(), resp.Unwrap(), c.conn)
+	conn, err := c.getConn()
+	if err != nil {
+		return nil, err
+	}
+	start := time.Now()
+	var trailer metadata.MD
+	err = grpc.Invoke(ctx, method, req.Unwrap(), resp.Unwrap(), conn, grpc.Trailer(&trailer))
+	observeBackendRequest(c.id, method, start, err)
 	if err != nil {
-		err = c.handleError(err, false)
+		err = c.handleError(c.backendError(err, trailer), false)
 	}
 	return resp, err
 }
 
-type upgradingClient struct {
+// backendError converts an error returned by the runtime to
+// *BackendError, keeping the error details from the trailer.
+func (c *apiClient) backendError(err error, trailer metadata.MD) *BackendError {
+	be := newBackendError(c.runtimeId, c.addr, err)
+	if details := trailer[statusDetailsTrailerKey]; len(details) != 0 {
+		be.Details = []byte(details[0])
+	}
+	return be
+}
+
+// openStream starts a server-streaming call on the runtime,
+// sending the request to it.
+func (c *apiClient) openStream(ctx context.Context, method string, req CRIObject) (grpc.ClientStream, error) {
+	conn, err := c.getConn()
+	if err != nil {
+		return nil, err
+	}
+	stream, err := grpc.NewClientStream(ctx, &grpc.StreamDesc{ServerStreams: true}, conn, method)
+	if err != nil {
+		return nil, err
+	}
+	if err := stream.SendMsg(req.Unwrap()); err != nil {
+		return nil, err
+	}
+	if err := stream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return stream, nil
+}
+
+// convertingClient converts the requests to the CRI version used
+// by the runtime and the responses back to the proxy's CRI version
+type convertingClient struct {
 	client
-	legacyVersion CRIVersion
-	newVersion    CRIVersion
+	proxyVersion   CRIVersion
+	backendVersion CRIVersion
 }
 
-var _ client = &upgradingClient{}
+var _ client = &convertingClient{}
 
-func newUpgradingClient(next client, legacyVersion UpgradableCRIVersion) *upgradingClient {
-	return &upgradingClient{
-		client:        next,
-		legacyVersion: legacyVersion,
-		newVersion:    legacyVersion.UpgradesTo(),
+func newConvertingClient(next client, proxyVersion, backendVersion CRIVersion) *convertingClient {
+	return &convertingClient{
+		client:         next,
+		proxyVersion:   proxyVersion,
+		backendVersion: backendVersion,
 	}
 }
 
-func (c *upgradingClient) addPrefix(o CRIObject) CRIObject {
-	return c.downgradeCRIObject(c.client.addPrefix(c.upgradeCRIObject(o)))
+func (c *convertingClient) status() BackendStatus {
+	s := c.client.status()
+	s.Converting = true
+	return s
+}
+
+func (c *convertingClient) addPrefix(o CRIObject) CRIObject {
+	return c.convertCRIObject(c.client.addPrefix(c.convertCRIObject(o, c.backendVersion)), c.proxyVersion)
 }
 
-func (c *upgradingClient) invoke(ctx context.Context, method string, req, resp CRIObject) (CRIObject, error) {
-	method = strings.Replace(method, "runtime.", "runtime.v1alpha2.", 1)
-	r, err := c.client.invoke(ctx, method, c.upgradeCRIObject(req), c.upgradeCRIObject(resp))
+func (c *convertingClient) backendMethod(method string) string {
+	return strings.Replace(method, "/"+c.proxyVersion.ProtoPackage()+".", "/"+c.backendVersion.ProtoPackage()+".", 1)
+}
+
+func (c *convertingClient) invoke(ctx context.Context, method string, req, resp CRIObject) (CRIObject, error) {
+	r, err := c.client.invoke(ctx, c.backendMethod(method), c.convertCRIObject(req, c.backendVersion), c.convertCRIObject(resp, c.backendVersion))
 	if err != nil {
 		return nil, err
 	}
-	return c.downgradeCRIObjectTo(r, resp), err
+	return c.convertCRIObjectTo(r, resp), err
 }
 
-func (c *upgradingClient) invokeWithErrorHandling(ctx context.Context, method string, req, resp CRIObject) (CRIObject, error) {
-	method = strings.Replace(method, "runtime.", "runtime.v1alpha2.", 1)
-	r, err := c.client.invokeWithErrorHandling(ctx, method, c.upgradeCRIObject(req), c.upgradeCRIObject(resp))
+func (c *convertingClient) invokeWithErrorHandling(ctx context.Context, method string, req, resp CRIObject) (CRIObject, error) {
+	r, err := c.client.invokeWithErrorHandling(ctx, c.backendMethod(method), c.convertCRIObject(req, c.backendVersion), c.convertCRIObject(resp, c.backendVersion))
 	if err != nil {
 		return nil, err
 	}
-	return c.downgradeCRIObjectTo(r, resp), nil
+	return c.convertCRIObjectTo(r, resp), nil
 }
 
-func (c *upgradingClient) upgradeCRIObject(o CRIObject) CRIObject {
-	upgraded, err := runtimeapis.Upgrade(o.Unwrap())
-	if err != nil {
-		log.Panicf("Couldn't upgrade %T: %v", o.Unwrap(), err)
-	}
-	r, _, err := c.newVersion.WrapObject(upgraded)
-	if err != nil {
-		log.Panicf("Error wrapping upgraded object %T: %v", upgraded, err)
-	}
-	return r
+// openStream fails with codes.Unimplemented because the streaming
+// methods only exist in the newest CRI version, so there's nothing
+// to convert them to.
+func (c *convertingClient) openStream(ctx context.Context, method string, req CRIObject) (grpc.ClientStream, error) {
+	return nil, grpc.Errorf(codes.Unimplemented, "%s is not supported by CRI version %q", method, c.backendVersion.ProtoPackage())
 }
 
-func (c *upgradingClient) downgradeCRIObject(o CRIObject) CRIObject {
-	downgraded, err := runtimeapis.Downgrade(o.Unwrap())
+func (c *convertingClient) convertCRIObject(o CRIObject, criVersion CRIVersion) CRIObject {
+	if _, ok := o.(*rawObject); ok {
+		// raw objects are passed as-is
+		return o
+	}
+	converted, err := runtimeapis.Convert(o.Unwrap(), criVersion.ProtoPackage())
 	if err != nil {
-		log.Panicf("Couldn't downgrade %T: %v", o.Unwrap(), err)
+		log.Panicf("Couldn't convert %T to %s: %v", o.Unwrap(), criVersion.ProtoPackage(), err)
 	}
-	r, _, err := c.legacyVersion.WrapObject(downgraded)
+	r, _, err := criVersion.WrapObject(converted)
 	if err != nil {
-		log.Panicf("Error wrapping downgraded object %T: %v", downgraded, err)
+		log.Panicf("Error wrapping converted object %T: %v", converted, err)
 	}
 	return r
 }
 
-func (c *upgradingClient) downgradeCRIObjectTo(o CRIObject, resp CRIObject) CRIObject {
-	downgraded, err := runtimeapis.Downgrade(o.Unwrap())
+func (c *convertingClient) convertCRIObjectTo(o CRIObject, resp CRIObject) CRIObject {
+	if _, ok := o.(*rawObject); ok {
+		return o
+	}
+	converted, err := runtimeapis.Convert(o.Unwrap(), c.proxyVersion.ProtoPackage())
 	if err != nil {
-		log.Panicf("Couldn't downgrade %T: %v", o.Unwrap(), err)
+		log.Panicf("Couldn't convert %T to %s: %v", o.Unwrap(), c.proxyVersion.ProtoPackage(), err)
 	}
-	resp.Wrap(downgraded)
+	resp.Wrap(converted)
 	return resp
 }
 
-// autoClient detects server version and chooses upgradingClient
+// autoClient detects server version and chooses convertingClient
 // or plain apiClient depending on it
 type autoClient struct {
 	clientBase
 	*clientConnection
 	proxyCRIVersion CRIVersion
-	next            client
+	// forcedProtoPackage is the proto package of CRI version
+	// to use with the server. If it's empty, the version is
+	// detected automatically.
+	forcedProtoPackage string
+	next               client
+	// middleware is called for each request that's passed
+	// to the runtime
+	middleware []Middleware
 }
 
 var _ client = &autoClient{}
 
-func newAutoClient(proxyCRIVersion CRIVersion, addr string, connectionTimeout time.Duration) *autoClient {
-	id := ""
-	parts := strings.SplitN(addr, ":", 2)
-	if len(parts) == 2 {
-		id, addr = parts[0], parts[1]
-	}
-	conn := newClientConnection(addr, connectionTimeout)
+// newAutoClient makes an autoClient for the backend. If onConnected
+// is not nil, it's called with the client each time the connection
+// to the runtime is established. The requests are passed through
+// the middleware before they're passed to the runtime.
+func newAutoClient(proxyCRIVersion CRIVersion, backend BackendConfig, onConnected func(client), middleware []Middleware) *autoClient {
+	conn := newClientConnection(backend)
 	c := &autoClient{
-		clientBase:       clientBase{id},
-		clientConnection: conn,
-		proxyCRIVersion:  proxyCRIVersion,
+		clientBase:         clientBase{id: backend.ID, images: newImageMappings(backend.Images)},
+		clientConnection:   conn,
+		proxyCRIVersion:    proxyCRIVersion,
+		forcedProtoPackage: backend.CRIVersion,
+		middleware:         middleware,
 	}
 	conn.probe = c.checkConnection
+	if onConnected != nil {
+		conn.onConnected = func() { onConnected(c) }
+	}
 	return c
 }
 
@@ -469,28 +671,40 @@ func (c *autoClient) checkVersion(criVersion CRIVersion, conn *grpc.ClientConn,
 }
 
 func (c *autoClient) checkConnection(conn *grpc.ClientConn, connectionTimeout time.Duration) error {
-	upgrade := []bool{false}
-	toTry := []CRIVersion{c.proxyCRIVersion}
-	upgradableVersion, upgradable := c.proxyCRIVersion.(UpgradableCRIVersion)
-	if upgradable {
-		upgrade = []bool{true, false}
-		toTry = []CRIVersion{upgradableVersion.UpgradesTo(), c.proxyCRIVersion}
-	}
-
-	var err error
-	for n, v := range toTry {
+	err := fmt.Errorf("CRI version %q can't be used with proxy's CRI version %q", c.forcedProtoPackage, c.proxyCRIVersion.ProtoPackage())
+	for _, v := range c.proxyCRIVersion.BackendVersions() {
+		if c.forcedProtoPackage != "" && c.forcedProtoPackage != v.ProtoPackage() {
+			continue
+		}
 		if err = c.checkVersion(v, conn, connectionTimeout); err == nil {
-			var next client = newApiClient(v, c.clientConnection, c.id)
-			if upgrade[n] {
-				next = newUpgradingClient(next, upgradableVersion)
+			var next client = newApiClient(v, c.clientConnection, c.clientBase)
+			if v.ProtoPackage() != c.proxyCRIVersion.ProtoPackage() {
+				next = newConvertingClient(next, c.proxyCRIVersion, v)
 			}
+			c.Lock()
 			c.next = next
+			c.Unlock()
 			break
 		}
 	}
 	return err
 }
 
+// status returns the status of the client, including the CRI
+// version that was chosen during the last successful connection
+// to the runtime.
+func (c *autoClient) status() BackendStatus {
+	c.Lock()
+	next := c.next
+	c.Unlock()
+	if next != nil {
+		return next.status()
+	}
+	s := c.clientConnection.status()
+	s.ID = c.id
+	return s
+}
+
 func (c *autoClient) getNext() (client, error) {
 	c.Lock()
 	defer c.Unlock()
@@ -500,20 +714,59 @@ func (c *autoClient) getNext() (client, error) {
 	return c.next, nil
 }
 
-func (c *autoClient) invoke(ctx context.Context, method string, req, resp CRIObject) (CRIObject, error) {
+// invokeThroughMiddleware checks whether the caller may use the
+// runtime and adds the runtime to the audit log entry of the request,
+// then passes the request through the middleware and to the runtime
+// using the specified method of the next client.
+func (c *autoClient) invokeThroughMiddleware(ctx context.Context, method string, req, resp CRIObject, invoke func(next client, ctx context.Context, method string, req, resp CRIObject) (CRIObject, error)) (CRIObject, error) {
+	if err := checkRuntime(ctx, c.id); err != nil {
+		return nil, err
+	}
+	auditRuntime(ctx, c.id)
 	next, err := c.getNext()
 	if err != nil {
 		return nil, err
 	}
-	return next.invoke(ctx, method, req, resp)
+	if len(c.middleware) == 0 {
+		return invoke(next, ctx, method, req, resp)
+	}
+	br := &BackendRequest{
+		Method:    method,
+		RuntimeID: c.id,
+		Request:   req,
+		Response:  resp,
+	}
+	err = chainMiddleware(c.middleware, func(ctx context.Context, br *BackendRequest) error {
+		r, err := invoke(next, ctx, br.Method, br.Request, br.Response)
+		if err == nil {
+			br.Response = r
+		}
+		return err
+	})(ctx, br)
+	if err != nil {
+		return nil, err
+	}
+	return br.Response, nil
+}
+
+func (c *autoClient) invoke(ctx context.Context, method string, req, resp CRIObject) (CRIObject, error) {
+	return c.invokeThroughMiddleware(ctx, method, req, resp, client.invoke)
 }
 
 func (c *autoClient) invokeWithErrorHandling(ctx context.Context, method string, req, resp CRIObject) (CRIObject, error) {
+	return c.invokeThroughMiddleware(ctx, method, req, resp, client.invokeWithErrorHandling)
+}
+
+func (c *autoClient) openStream(ctx context.Context, method string, req CRIObject) (grpc.ClientStream, error) {
+	if err := checkRuntime(ctx, c.id); err != nil {
+		return nil, err
+	}
+	auditRuntime(ctx, c.id)
 	next, err := c.getNext()
 	if err != nil {
 		return nil, err
 	}
-	return next.invokeWithErrorHandling(ctx, method, req, resp)
+	return next.openStream(ctx, method, req)
 }
 
 // TODO: handle grpc's ClientTransport.Error() to reconnect
@@ -0,0 +1,283 @@
+/*
+Copyright 2018 Mirantis
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package proxy
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc/peer"
+)
+
+// auditedMethods lists the methods that are written to the audit log.
+var auditedMethods = map[string]bool{
+	"RuntimeService/RunPodSandbox":            true,
+	"RuntimeService/StopPodSandbox":           true,
+	"RuntimeService/RemovePodSandbox":         true,
+	"RuntimeService/CreateContainer":          true,
+	"RuntimeService/StartContainer":           true,
+	"RuntimeService/StopContainer":            true,
+	"RuntimeService/RemoveContainer":          true,
+	"RuntimeService/UpdateContainerResources": true,
+	"RuntimeService/ExecSync":                 true,
+	"RuntimeService/Exec":                     true,
+	"RuntimeService/Attach":                   true,
+	"RuntimeService/PortForward":              true,
+	"ImageService/PullImage":                  true,
+	"ImageService/RemoveImage":                true,
+}
+
+// auditCaller identifies the caller in the audit log. The
+// credentials are only known for the callers connected over
+// unix domain sockets, otherwise the remote address is used.
+type auditCaller struct {
+	PID     *int32  `json:"pid,omitempty"`
+	UID     *uint32 `json:"uid,omitempty"`
+	GID     *uint32 `json:"gid,omitempty"`
+	Address string  `json:"address,omitempty"`
+}
+
+// auditEntry is written to the audit log for each audited request
+// and for each request that's denied by the authorization rules.
+// Only the fields that can't hold secrets are taken from the
+// requests, so e.g. environment variables, annotations, commands
+// and registry credentials are never written to the log. Runtimes
+// lists the runtimes the request is actually passed to, or, for the
+// denied requests, the runtimes that aren't allowed.
+type auditEntry struct {
+	// lock guards Runtimes and Reason that are set while
+	// the request is handled
+	lock            *sync.Mutex
+	Time            time.Time    `json:"time"`
+	Caller          *auditCaller `json:"caller,omitempty"`
+	Method          string       `json:"method"`
+	Runtimes        []string     `json:"runtimes"`
+	Pod             *PodMetadata `json:"pod,omitempty"`
+	PodSandboxId    string       `json:"podSandboxId,omitempty"`
+	ContainerId     string       `json:"containerId,omitempty"`
+	Image           string       `json:"image,omitempty"`
+	Code            string       `json:"code"`
+	Reason          string       `json:"reason,omitempty"`
+	DurationSeconds float64      `json:"durationSeconds"`
+}
+
+// addRuntime adds the runtime to the list of the runtimes
+// unless it's already there.
+func (e *auditEntry) addRuntime(id string) {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	for _, r := range e.Runtimes {
+		if r == id {
+			return
+		}
+	}
+	e.Runtimes = append(e.Runtimes, id)
+}
+
+// deny records the denial of the request.
+func (e *auditEntry) deny(runtimes []string, reason string) {
+	for _, id := range runtimes {
+		e.addRuntime(id)
+	}
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	e.Reason = reason
+}
+
+// auditLog appends the audit entries to a file as JSON lines,
+// rotating the file when it reaches the size limit.
+type auditLog struct {
+	sync.Mutex
+	path       string
+	maxSize    int64
+	maxBackups int
+}
+
+var (
+	auditLogsLock sync.Mutex
+	auditLogs     = make(map[string]*auditLog)
+)
+
+// getAuditLog returns the audit log for the config, or nil if the
+// audit log is disabled. The proxies for different CRI versions
+// that use the same file share the audit log, so the file is
+// rotated consistently.
+func getAuditLog(config AuditConfig) *auditLog {
+	if config.File == "" {
+		return nil
+	}
+	auditLogsLock.Lock()
+	defer auditLogsLock.Unlock()
+	l, found := auditLogs[config.File]
+	if !found {
+		l = &auditLog{path: config.File}
+		auditLogs[config.File] = l
+	}
+	// the limits may be changed by reloading the config
+	l.Lock()
+	defer l.Unlock()
+	l.maxSize = int64(config.MaxSizeMB) << 20
+	l.maxBackups = config.MaxBackups
+	return l
+}
+
+// backupPath returns the path of the rotated file number n.
+func (l *auditLog) backupPath(n int) string {
+	return fmt.Sprintf("%s.%d", l.path, n)
+}
+
+// rotate renames the file to path.1, path.1 to path.2 and so
+// on, removing the oldest file if there are too many of them.
+func (l *auditLog) rotate() error {
+	if l.maxBackups == 0 {
+		return os.Remove(l.path)
+	}
+	if err := os.Remove(l.backupPath(l.maxBackups)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	for n := l.maxBackups - 1; n > 0; n-- {
+		if err := os.Rename(l.backupPath(n), l.backupPath(n+1)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return os.Rename(l.path, l.backupPath(1))
+}
+
+func (l *auditLog) write(entry *auditEntry) {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		glog.Errorf("Can't marshal the audit log entry: %v", err)
+		return
+	}
+	data = append(data, '\n')
+	l.Lock()
+	defer l.Unlock()
+	if l.maxSize > 0 {
+		fi, err := os.Stat(l.path)
+		if err == nil && fi.Size() > 0 && fi.Size()+int64(len(data)) > l.maxSize {
+			if err := l.rotate(); err != nil {
+				glog.Errorf("Can't rotate the audit log: %v", err)
+			}
+		}
+	}
+	f, err := os.OpenFile(l.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		glog.Errorf("Can't open the audit log: %v", err)
+		return
+	}
+	defer f.Close()
+	if _, err := f.Write(data); err != nil {
+		glog.Errorf("Can't write to the audit log: %v", err)
+	}
+}
+
+func auditCallerFromContext(ctx context.Context) *auditCaller {
+	if creds, ok := PeerCredentialsFromContext(ctx); ok {
+		return &auditCaller{PID: &creds.PID, UID: &creds.UID, GID: &creds.GID}
+	}
+	if p, ok := peer.FromContext(ctx); ok && p.Addr != nil && p.Addr.String() != "" {
+		return &auditCaller{Address: p.Addr.String()}
+	}
+	return nil
+}
+
+type auditEntryKey struct{}
+
+// withAuditEntry returns the context that makes the clients add
+// their runtimes to the audit log entry when the request is passed
+// to them.
+func withAuditEntry(ctx context.Context, entry *auditEntry) context.Context {
+	return context.WithValue(ctx, auditEntryKey{}, entry)
+}
+
+func auditEntryFromContext(ctx context.Context) *auditEntry {
+	entry, _ := ctx.Value(auditEntryKey{}).(*auditEntry)
+	return entry
+}
+
+// auditRuntime adds the runtime to the audit log entry of the
+// request, if any. The clients call it before passing a request
+// to the runtime.
+func auditRuntime(ctx context.Context, id string) {
+	if entry := auditEntryFromContext(ctx); entry != nil {
+		entry.addRuntime(id)
+	}
+}
+
+// newAuditEntry returns the audit log entry for the request, or nil
+// if the audit log is disabled. The entry is only written if the
+// method is audited or the request is denied. It must be called
+// before the request is passed to the handler, which removes the
+// runtime prefixes from the ids in the request. req is nil for the
+// streaming requests.
+func (cs *clientSet) newAuditEntry(ctx context.Context, method string, req CRIObject) *auditEntry {
+	if cs.auditLog == nil {
+		return nil
+	}
+	entry := &auditEntry{
+		lock:   &sync.Mutex{},
+		Time:   time.Now(),
+		Caller: auditCallerFromContext(ctx),
+		Method: method,
+	}
+	if o, ok := req.(PodMetadataObject); ok {
+		entry.Pod = o.PodMetadata()
+	}
+	if o, ok := req.(PodSandboxIdObject); ok {
+		entry.PodSandboxId = o.PodSandboxId()
+	}
+	if o, ok := req.(ContainerIdObject); ok {
+		entry.ContainerId = o.ContainerId()
+	}
+	if o, ok := req.(ImageObject); ok {
+		entry.Image = o.Image()
+	}
+	return entry
+}
+
+// finishAuditEntry sets the result of the request and writes the
+// entry to the audit log if the method is audited or the request
+// was denied. resp is the response to the request, which is only
+// used if err is nil.
+func (cs *clientSet) finishAuditEntry(entry *auditEntry, resp CRIObject, err error) {
+	entry.lock.Lock()
+	defer entry.lock.Unlock()
+	if !auditedMethods[entry.Method] && entry.Reason == "" {
+		return
+	}
+	if entry.Runtimes == nil {
+		entry.Runtimes = []string{}
+	}
+	if err == nil {
+		// the ids of the new objects are only known
+		// after the request succeeds
+		if o, ok := resp.(PodSandboxIdObject); ok && entry.PodSandboxId == "" {
+			entry.PodSandboxId = o.PodSandboxId()
+		}
+		if o, ok := resp.(ContainerIdObject); ok && entry.ContainerId == "" {
+			entry.ContainerId = o.ContainerId()
+		}
+	}
+	entry.Code = errorCode(err).String()
+	entry.DurationSeconds = time.Since(entry.Time).Seconds()
+	cs.auditLog.write(entry)
+}
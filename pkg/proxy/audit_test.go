@@ -0,0 +1,61 @@
+/*
+Copyright 2018 Mirantis
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package proxy
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestAuditLogRotation(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "criproxy-audit-test-")
+	if err != nil {
+		t.Fatalf("TempDir(): %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+	l := getAuditLog(AuditConfig{File: filepath.Join(tmpDir, "audit.log"), MaxBackups: 2})
+	// use a small size limit so each entry gets its own file
+	l.maxSize = 10
+	for _, method := range []string{"RuntimeService/StartContainer", "RuntimeService/StopContainer", "RuntimeService/RemoveContainer", "ImageService/RemoveImage"} {
+		l.write(&auditEntry{Method: method})
+	}
+	for _, item := range []struct {
+		name, method string
+	}{
+		{"audit.log", "ImageService/RemoveImage"},
+		{"audit.log.1", "RuntimeService/RemoveContainer"},
+		{"audit.log.2", "RuntimeService/StopContainer"},
+	} {
+		data, err := ioutil.ReadFile(filepath.Join(tmpDir, item.name))
+		if err != nil {
+			t.Errorf("can't read %s: %v", item.name, err)
+			continue
+		}
+		var entry auditEntry
+		if err := json.Unmarshal(data, &entry); err != nil {
+			t.Errorf("can't unmarshal the audit log entry %q: %v", data, err)
+		} else if entry.Method != item.method {
+			t.Errorf("bad method in %s: %q instead of %q", item.name, entry.Method, item.method)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(tmpDir, "audit.log.3")); !os.IsNotExist(err) {
+		t.Errorf("audit.log.3 should not exist (err: %v)", err)
+	}
+}
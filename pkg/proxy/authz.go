@@ -0,0 +1,175 @@
+/*
+Copyright 2018 Mirantis
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package proxy
+
+import (
+	"fmt"
+
+	"github.com/golang/glog"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+)
+
+// authorizer checks whether the callers may make the requests
+// according to the authorization rules.
+type authorizer struct {
+	rules []AuthorizationRule
+}
+
+// newAuthorizer makes an authorizer for the config. It returns
+// nil if the config is nil, meaning that all of the requests
+// are allowed.
+func newAuthorizer(config *AuthorizationConfig) *authorizer {
+	if config == nil {
+		return nil
+	}
+	return &authorizer{rules: config.Rules}
+}
+
+func (ar *AuthorizationRule) matches(creds *PeerCredentials) bool {
+	if len(ar.UIDs) == 0 && len(ar.GIDs) == 0 {
+		return true
+	}
+	if creds == nil {
+		return false
+	}
+	for _, uid := range ar.UIDs {
+		if uid == creds.UID {
+			return true
+		}
+	}
+	for _, gid := range ar.GIDs {
+		if gid == creds.GID {
+			return true
+		}
+	}
+	return false
+}
+
+func (ar *AuthorizationRule) allowsRuntime(id string) bool {
+	if len(ar.AllowedRuntimes) == 0 {
+		return true
+	}
+	for _, allowed := range ar.AllowedRuntimes {
+		if allowed == "*" || allowed == id {
+			return true
+		}
+	}
+	return false
+}
+
+// matchRule returns the rule that allows the caller to invoke the
+// method, or the reason for denying the request if there's no such
+// rule. The runtimes are checked separately after the handler
+// chooses them.
+func (a *authorizer) matchRule(creds *PeerCredentials, method string) (*AuthorizationRule, string) {
+	for n := range a.rules {
+		rule := &a.rules[n]
+		if !rule.matches(creds) {
+			continue
+		}
+		if len(rule.AllowedMethods) > 0 && !methodMatchesAny(rule.AllowedMethods, method) {
+			return nil, fmt.Sprintf("method %s is not allowed for the caller", method)
+		}
+		return rule, ""
+	}
+	return nil, "the caller is only allowed to make read-only requests"
+}
+
+// deny logs the denied request, records the denial in the audit log
+// entry of the request if there's one and returns PermissionDenied
+// error. runtimes lists the runtimes that aren't allowed.
+func deny(ctx context.Context, creds *PeerCredentials, method string, runtimes []string, reason string) error {
+	caller := "unknown caller"
+	if creds != nil {
+		caller = creds.String()
+	}
+	glog.Warningf("AUDIT: denied %s for %s (runtimes %q): %s", method, caller, runtimes, reason)
+	if entry := auditEntryFromContext(ctx); entry != nil {
+		entry.deny(runtimes, reason)
+	}
+	authorizationDenialCount.Inc(method)
+	return grpc.Errorf(codes.PermissionDenied, "criproxy: %s", reason)
+}
+
+type runtimeCheckKey struct{}
+
+// runtimeCheck checks the runtimes a request is passed to against
+// the authorization rule that matches the caller.
+type runtimeCheck struct {
+	creds  *PeerCredentials
+	method string
+	rule   *AuthorizationRule
+}
+
+// authorize checks whether the caller may invoke the method,
+// returning PermissionDenied error if it may not. method is the
+// method name without the proto package, e.g.
+// RuntimeService/RunPodSandbox. If the rule that matches the caller
+// limits the runtimes, the returned context makes the clients check
+// each runtime the request is passed to, so the runtimes are checked
+// exactly as they're chosen by the handler.
+func (cs *clientSet) authorize(ctx context.Context, method string) (context.Context, error) {
+	if cs.authorizer == nil || methodMatchesAny(readOnlyMethodPatterns, method) {
+		return ctx, nil
+	}
+	creds, _ := PeerCredentialsFromContext(ctx)
+	rule, reason := cs.authorizer.matchRule(creds, method)
+	if reason != "" {
+		return nil, deny(ctx, creds, method, nil, reason)
+	}
+	if len(rule.AllowedRuntimes) == 0 {
+		return ctx, nil
+	}
+	return context.WithValue(ctx, runtimeCheckKey{}, &runtimeCheck{
+		creds:  creds,
+		method: method,
+		rule:   rule,
+	}), nil
+}
+
+// checkRuntime returns PermissionDenied error if the caller of the
+// request isn't allowed to use the runtime. The clients call it
+// before passing a request to the runtime.
+func checkRuntime(ctx context.Context, id string) error {
+	rc, ok := ctx.Value(runtimeCheckKey{}).(*runtimeCheck)
+	if !ok || rc.rule.allowsRuntime(id) {
+		return nil
+	}
+	return deny(ctx, rc.creds, rc.method, []string{id}, fmt.Sprintf("runtime %q is not allowed for the caller", id))
+}
+
+// checkRuntimes checks all of the runtimes before a request is
+// passed to several of them, so that the request is either passed
+// to all of them or denied.
+func checkRuntimes(ctx context.Context, clients []client) error {
+	for _, c := range clients {
+		if err := checkRuntime(ctx, c.getID()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// runtimeAllowed returns true if the caller of the request is
+// allowed to use the runtime. Unlike checkRuntime, it doesn't
+// log the denials.
+func runtimeAllowed(ctx context.Context, id string) bool {
+	rc, ok := ctx.Value(runtimeCheckKey{}).(*runtimeCheck)
+	return !ok || rc.rule.allowsRuntime(id)
+}
@@ -0,0 +1,346 @@
+/*
+Copyright 2018 Mirantis
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package proxy
+
+import (
+	"fmt"
+	"net/url"
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+	"golang.org/x/net/context"
+)
+
+type clientSetKey struct{}
+
+// clientSet is a set of clients the proxy passes the requests to.
+// The proxy replaces its clientSet when the configuration is
+// reloaded, while the requests that are being handled keep using
+// the set that was current when they started.
+type clientSet struct {
+	clients  []client
+	backends []BackendConfig
+	// runtimeHandlers maps CRI runtime handler names (RuntimeClass
+	// handlers) to runtime ids. Empty id denotes the primary runtime.
+	runtimeHandlers map[string]string
+	// methodPolicies maps the names of the methods that are
+	// passed through as raw protobuf data to their policies
+	methodPolicies map[string]string
+	// streamUrls maps the ids of the runtimes that have their
+	// own streaming urls in the config to these urls. It's set
+	// by the proxy after checking the urls.
+	streamUrls map[string]url.URL
+	// logger formats the logged requests and responses
+	logger *requestLogger
+	// router chooses the runtimes for the pods according to the
+	// routing rules (nil if there are no routing rules)
+	router *router
+	// authorizer checks whether the callers may make the requests
+	// (nil if there are no authorization rules)
+	authorizer *authorizer
+	// auditLog is the log of the requests that change anything
+	// (nil if the audit log is disabled)
+	auditLog *auditLog
+	// listTimeout and failListOnTimeout are the values of
+	// the corresponding config settings
+	listTimeout       time.Duration
+	failListOnTimeout bool
+	// ignoreImageFailures is true if PullImage and RemoveImage
+	// requests succeed if they succeed for some of the runtimes
+	ignoreImageFailures bool
+	// inFlight tracks the requests that use this client set
+	inFlight sync.WaitGroup
+	// drained is closed after the set is replaced by Reload
+	// and the requests that use it complete
+	drained chan struct{}
+}
+
+// newClientSet makes a clientSet for the specified config, reusing
+// the clients from the old set for backends that didn't change.
+// It returns the new set and the list of the old clients that
+// aren't used anymore. The config must be already validated.
+// onConnected and middleware are passed to the new clients.
+func newClientSet(criVersion CRIVersion, config *Config, old *clientSet, onConnected func(client), middleware []Middleware) (*clientSet, []client) {
+	cs := &clientSet{
+		backends:            config.Backends,
+		runtimeHandlers:     config.RuntimeHandlers(),
+		methodPolicies:      config.MethodPolicies(),
+		listTimeout:         config.ListTimeout.Duration,
+		failListOnTimeout:   config.FailListOnTimeout,
+		ignoreImageFailures: config.ImageFailurePolicy == ImageFailurePolicyIgnore,
+		router:              newRouter(config.Routing),
+		authorizer:          newAuthorizer(config.Authorization),
+		auditLog:            getAuditLog(config.Audit),
+		drained:             make(chan struct{}),
+	}
+	// the config is validated, so the logger can be made
+	cs.logger, _ = newRequestLogger(config.Log)
+	reused := make(map[client]bool)
+	for _, backend := range config.Backends {
+		var c client
+		if old != nil {
+			c = old.clientForBackend(backend)
+		}
+		if c == nil {
+			c = newAutoClient(criVersion, backend, onConnected, middleware)
+		} else {
+			reused[c] = true
+		}
+		cs.clients = append(cs.clients, c)
+	}
+	var removed []client
+	if old != nil {
+		for _, c := range old.clients {
+			if !reused[c] {
+				removed = append(removed, c)
+			}
+		}
+	}
+	return cs, removed
+}
+
+// clientForBackend returns the client that corresponds to the
+// specified backend config if it's present in the set and its
+// connection settings are the same, or nil otherwise.
+func (cs *clientSet) clientForBackend(backend BackendConfig) client {
+	backend.RuntimeHandlers = nil
+	backend.StatusPolicy = ""
+	backend.StreamUrl = ""
+	backend.ImagePolicy = ""
+	for n, b := range cs.backends {
+		b.RuntimeHandlers = nil
+		b.StatusPolicy = ""
+		b.StreamUrl = ""
+		b.ImagePolicy = ""
+		if reflect.DeepEqual(b, backend) {
+			return cs.clients[n]
+		}
+	}
+	return nil
+}
+
+func withClientSet(ctx context.Context, cs *clientSet) context.Context {
+	return context.WithValue(ctx, clientSetKey{}, cs)
+}
+
+func clientSetFromContext(ctx context.Context) *clientSet {
+	cs, _ := ctx.Value(clientSetKey{}).(*clientSet)
+	return cs
+}
+
+func (cs *clientSet) primaryClient() (client, error) {
+	if err := <-cs.clients[0].connect(); err != nil {
+		return nil, err
+	}
+	return cs.clients[0], nil
+}
+
+// hasAnyClient returns true if the set contains any
+// of the specified clients.
+func (cs *clientSet) hasAnyClient(clients []client) bool {
+	for _, c := range clients {
+		if cs.clientIndex(c) >= 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// clientIndex returns the index of the client in the set,
+// or -1 if the client isn't in the set.
+func (cs *clientSet) clientIndex(c client) int {
+	for n, client := range cs.clients {
+		if client == c {
+			return n
+		}
+	}
+	return -1
+}
+
+func (cs *clientSet) clientById(id string) client {
+	for _, client := range cs.clients {
+		if client.getID() == id {
+			return client
+		}
+	}
+	return nil
+}
+
+// clientForPodSandbox chooses the client for RunPodSandbox request.
+// If the request specifies a runtime handler that's mapped to a
+// runtime, that runtime is used regardless of target runtime
+// annotation. Otherwise, the annotation is used to choose the
+// runtime, and if the pod doesn't have it, the routing rules
+// are used.
+func (cs *clientSet) clientForPodSandbox(req RunPodSandboxRequest) (client, error) {
+	annotations := req.GetAnnotations()
+	handler := req.RuntimeHandler()
+	id, found := cs.runtimeHandlers[handler]
+	if handler == "" || !found {
+		if id, routed := cs.routePodSandbox(req, true); routed {
+			client := cs.clientById(id)
+			if err := <-client.connect(); err != nil {
+				return nil, err
+			}
+			return client, nil
+		}
+		return cs.clientForAnnotations(annotations)
+	}
+	if targetRuntime, ok := annotations[targetRuntimeAnnotationKey]; ok && targetRuntime != id {
+		glog.Warningf("RunPodSandbox: runtime handler %q overrides target runtime annotation %q (using runtime %q)", handler, targetRuntime, id)
+	}
+	client := cs.clientById(id)
+	if err := <-client.connect(); err != nil {
+		return nil, err
+	}
+	return client, nil
+}
+
+func (cs *clientSet) clientForAnnotations(annotations map[string]string) (client, error) {
+	for _, client := range cs.clients {
+		if client.annotationsMatch(annotations) {
+			if err := <-client.connect(); err != nil {
+				return nil, err
+			}
+			return client, nil
+		}
+	}
+	return nil, fmt.Errorf("criproxy: unknown runtime: %q", annotations[targetRuntimeAnnotationKey])
+}
+
+func (cs *clientSet) clientAtIndex(index int) (client, error) {
+	if index >= len(cs.clients) {
+		return nil, fmt.Errorf("client index %d out of range", index)
+	}
+	c := cs.clients[index]
+	c.connect()
+	if c.currentState() != clientStateConnected {
+		return nil, fmt.Errorf("CRI proxy: target runtime is not available")
+	}
+	client := c
+	if err := <-client.connect(); err != nil {
+		return nil, err
+	}
+	return client, nil
+}
+
+func (cs *clientSet) clientForId(id string) (client, string, error) {
+	client := cs.clients[0]
+	unprefixed := id
+	for _, c := range cs.clients[1:] {
+		if ok, unpref := c.idPrefixMatches(id); ok {
+			c.connect()
+			if c.currentState() != clientStateConnected {
+				return nil, "", fmt.Errorf("CRI proxy: target runtime is not available")
+			}
+			client = c
+			unprefixed = unpref
+			break
+		}
+	}
+	if err := <-client.connect(); err != nil {
+		return nil, "", err
+	}
+	return client, unprefixed, nil
+}
+
+// imageMatchesRuntime returns true if the image matches the runtime
+// with the specified index, i.e. has the runtime id prefix or matches
+// one of the image mappings of the runtime. The images match the
+// primary runtime if they don't match any other runtime.
+func (cs *clientSet) imageMatchesRuntime(index int, image string) bool {
+	if index > 0 {
+		ok, _ := cs.clients[index].imageMatches(image)
+		return ok
+	}
+	for _, c := range cs.clients[1:] {
+		if ok, _ := c.imageMatches(image); ok {
+			return false
+		}
+	}
+	return true
+}
+
+// imageTargets returns the indices of the clients the image
+// requests for the image are passed to according to the image
+// policies of the runtimes.
+func (cs *clientSet) imageTargets(image string) []int {
+	var r []int
+	for n, b := range cs.backends {
+		switch {
+		case b.ImagePolicy == ImagePolicyLazy:
+			continue
+		case b.ImagePolicy == ImagePolicyMatching && !cs.imageMatchesRuntime(n, image):
+			continue
+		}
+		r = append(r, n)
+	}
+	return r
+}
+
+// lazyImageRuntimes returns the indices of the clients for the
+// runtimes with the lazy image policy.
+func (cs *clientSet) lazyImageRuntimes() []int {
+	var r []int
+	for n, b := range cs.backends {
+		if b.ImagePolicy == ImagePolicyLazy {
+			r = append(r, n)
+		}
+	}
+	return r
+}
+
+// imageOwner returns the client for the runtime that owns the image
+// according to the image mappings of the runtimes, along with the
+// runtime's name of the image, or nil if no runtime owns the image.
+func (cs *clientSet) imageOwner(image string) (client, string, error) {
+	for _, c := range cs.clients[1:] {
+		if name, ok := c.mapImage(image); ok {
+			if err := <-c.connect(); err != nil {
+				return nil, "", err
+			}
+			return c, name, nil
+		}
+	}
+	return nil, "", nil
+}
+
+func (cs *clientSet) clientForImage(image string, noErrorIfNotConnected bool) (client, string, error) {
+	client := cs.clients[0]
+	unprefixed := image
+	for _, c := range cs.clients[1:] {
+		if ok, unpref := c.imageMatches(image); ok {
+			c.connect()
+			// don't wait for additional runtimes
+			if c.currentState() != clientStateConnected {
+				if noErrorIfNotConnected {
+					return nil, "", nil
+				}
+				return nil, "", fmt.Errorf("CRI proxy: target runtime is not available")
+			}
+			client = c
+			unprefixed = unpref
+			break
+		}
+	}
+	if err := <-client.connect(); err != nil {
+		return nil, "", err
+	}
+	return client, unprefixed, nil
+}
@@ -0,0 +1,1030 @@
+/*
+Copyright 2018 Mirantis
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package proxy
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/url"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ghodss/yaml"
+
+	"github.com/elotl/criproxy/pkg/utils"
+)
+
+const (
+	// DefaultConnectionTimeout is the backend connection timeout
+	// that's used if none is specified in the config.
+	DefaultConnectionTimeout = 30 * time.Second
+	// DefaultStreamPort is the streaming port of the primary
+	// runtime that's used if neither stream url nor stream port
+	// is specified in the config.
+	DefaultStreamPort = 11250
+	// DefaultStreamTokenTTL is the time the streaming urls
+	// returned by the proxy's streaming endpoint are valid
+	// if none is specified in the config.
+	DefaultStreamTokenTTL = time.Minute
+	// DefaultAuditMaxSizeMB is the size of the audit log file in
+	// megabytes that triggers the rotation if none is specified
+	// in the config.
+	DefaultAuditMaxSizeMB = 100
+	// DefaultAuditMaxBackups is the number of the rotated audit
+	// log files that are kept if none is specified in the config.
+	DefaultAuditMaxBackups = 5
+	// ImagePolicyAll means that image pulls and removals are
+	// passed to the runtime regardless of the image name.
+	ImagePolicyAll = "all"
+	// ImagePolicyMatching means that image pulls and removals
+	// are only passed to the runtime if the image matches it,
+	// i.e. has the runtime id prefix or matches one of the image
+	// mappings of the runtime. For the primary runtime, these are
+	// the images that don't match any other runtime.
+	ImagePolicyMatching = "matching"
+	// ImagePolicyLazy means that image pulls and removals aren't
+	// passed to the runtime. Instead, the image is pulled when
+	// CreateContainer request that uses it goes to the runtime,
+	// unless the runtime already has the image. The registry
+	// credentials are taken from PullImage request for the image
+	// if the proxy got it within the last minute.
+	ImagePolicyLazy = "lazy"
+	// ImageFailurePolicyFail means that PullImage and RemoveImage
+	// requests fail if they fail for any of the runtimes, including
+	// the runtimes that aren't connected.
+	ImageFailurePolicyFail = "fail"
+	// ImageFailurePolicyIgnore means that PullImage and RemoveImage
+	// requests succeed if they succeed for at least one of the
+	// runtimes. The failures are logged.
+	ImageFailurePolicyIgnore = "ignore"
+	// MethodPolicyPrimary means that the requests for a method
+	// that's passed through are passed to the primary runtime.
+	MethodPolicyPrimary = "primary"
+	// MethodPolicyAll means that the requests for a method
+	// that's passed through are passed to all of the runtimes
+	// and the responses are merged.
+	MethodPolicyAll = "all"
+	// MethodPolicyReject means that the requests for a method
+	// are rejected with Unimplemented error.
+	MethodPolicyReject = "reject"
+	// StatusPolicyRequired means that the runtime must be ready
+	// for the proxy to report RuntimeReady and NetworkReady
+	// conditions as true. This is always the case for the primary
+	// runtime.
+	StatusPolicyRequired = "required"
+	// StatusPolicyOptional means that the conditions of the runtime
+	// are only reported prefixed with the runtime id and don't
+	// affect RuntimeReady and NetworkReady conditions reported by
+	// the proxy. This is the default for non-primary runtimes.
+	StatusPolicyOptional = "optional"
+	// LogFormatYAML means that the logged CRI requests and
+	// responses are formatted as YAML.
+	LogFormatYAML = "yaml"
+	// LogFormatJSON means that each logged CRI request or
+	// response is formatted as a single line JSON object.
+	LogFormatJSON = "json"
+)
+
+// defaultMethodPolicies specifies how the methods added in newer
+// CRI versions are handled unless the config says otherwise.
+var defaultMethodPolicies = map[string]string{
+	"RuntimeService/CheckpointContainer":       MethodPolicyPrimary,
+	"RuntimeService/ListMetricDescriptors":     MethodPolicyPrimary,
+	"RuntimeService/ListPodSandboxMetrics":     MethodPolicyPrimary,
+	"RuntimeService/ListPodSandboxStats":       MethodPolicyPrimary,
+	"RuntimeService/PodSandboxStats":           MethodPolicyPrimary,
+	"RuntimeService/RuntimeConfig":             MethodPolicyPrimary,
+	"RuntimeService/UpdatePodSandboxResources": MethodPolicyPrimary,
+}
+
+var methodNameRx = regexp.MustCompile(`^(RuntimeService|ImageService)/[A-Z]\w*$`)
+
+var methodPatternRx = regexp.MustCompile(`^(RuntimeService|ImageService|\*)/[\w*]+$`)
+
+// readOnlyMethodPatterns match the methods that are allowed
+// for the read-only listeners.
+var readOnlyMethodPatterns = []string{
+	"*/List*",
+	"*/*Status",
+	"RuntimeService/Version",
+	"ImageService/ImageFsInfo",
+}
+
+// Duration is a time.Duration that's represented as a string
+// like "30s" or "1m" in the config file.
+type Duration struct {
+	time.Duration
+}
+
+// MarshalJSON implements json.Marshaler interface.
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(d.String())
+}
+
+// UnmarshalJSON implements json.Unmarshaler interface.
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return fmt.Errorf("bad duration %s: must be a string like \"30s\"", string(data))
+	}
+	v, err := time.ParseDuration(s)
+	if err != nil {
+		return fmt.Errorf("bad duration %q: %v", s, err)
+	}
+	d.Duration = v
+	return nil
+}
+
+// BackendConfig describes a CRI runtime the proxy passes the
+// requests to.
+type BackendConfig struct {
+	// ID is the runtime id. It's used as the value of
+	// kubernetes.io/target-runtime annotation, image name prefix
+	// and pod / container id prefix. It must be empty for
+	// the primary runtime.
+	ID string `json:"id,omitempty"`
+	// Socket is the runtime endpoint: either the path to the
+	// runtime's unix domain socket or an URL like
+	// unix:///path/to/socket, tcp://host:port or tls://host:port.
+	Socket string `json:"socket"`
+	// TLS describes the TLS settings for tls:// endpoints.
+	TLS BackendTLSConfig `json:"tls,omitempty"`
+	// Keepalive describes TCP keep-alive settings for tcp://
+	// and tls:// endpoints.
+	Keepalive KeepaliveConfig `json:"keepalive,omitempty"`
+	// ConnectionTimeout is the timeout for connecting to the
+	// runtime.
+	ConnectionTimeout Duration `json:"connectionTimeout,omitempty"`
+	// CRIVersion is the proto package of the CRI version to use
+	// with the runtime, e.g. "runtime" (CRI 1.9), "runtime.v1alpha2"
+	// (CRI 1.12) or "runtime.v1" (CRI v1). If it's empty, the
+	// version is detected upon connecting to the runtime.
+	CRIVersion string `json:"criVersion,omitempty"`
+	// ImagePolicy specifies which image service requests are
+	// passed to the runtime: "all" (default), "matching" or "lazy".
+	// ImageStatus only reports the image as present if all of the
+	// runtimes the image would be pulled on have it.
+	ImagePolicy string `json:"imagePolicy,omitempty"`
+	// RuntimeHandlers lists RuntimeClass handlers that
+	// make pods go to this runtime.
+	RuntimeHandlers []string `json:"runtimeHandlers,omitempty"`
+	// StatusPolicy specifies whether the runtime must be ready
+	// for the node to be ready: "required" or "optional" (default
+	// for non-primary runtimes). The primary runtime is always
+	// required.
+	StatusPolicy string `json:"statusPolicy,omitempty"`
+	// StreamUrl is the streaming url of the runtime that's used
+	// to fix relative urls returned by Exec, Attach and PortForward.
+	// If it's not set, the proxy's StreamUrl is used. The url must
+	// be reachable from the node address unless the proxy's
+	// streaming endpoint is configured.
+	StreamUrl string `json:"streamUrl,omitempty"`
+	// DiscoverStreamUrl makes the proxy take the streaming url of
+	// the runtime from its verbose status info each time it
+	// connects to the runtime. It can't be used with StreamUrl.
+	DiscoverStreamUrl bool `json:"discoverStreamUrl,omitempty"`
+	// Images lists the mappings that make the runtime own the
+	// matching images. The requests for these images only go to
+	// this runtime, with the image names rewritten, and the names
+	// of the runtime's images are mapped back. The primary runtime
+	// can't have image mappings.
+	Images []ImageMapping `json:"images,omitempty"`
+}
+
+// ImageMapping maps the image names used by the clients to the
+// image names of a runtime. The patterns may have a single "*"
+// wildcard that matches any string, including the tag and the
+// digest. As the same wildcard part is used on both sides, the
+// mapping can be reversed to get the names of the images listed
+// by the runtime. Other glob syntax and regular expressions aren't
+// supported because such mappings can't be reversed. Image can't
+// be just "*", as the runtime would then own every image, leaving
+// none for the other runtimes.
+type ImageMapping struct {
+	// Image is the pattern for the image names used by the
+	// clients, e.g. registry.vms.example.com/*.
+	Image string `json:"image"`
+	// RuntimeImage is the pattern for the corresponding image
+	// names of the runtime, e.g. "*" to pass the names without
+	// the registry. It must have a wildcard if Image has one.
+	// It defaults to Image, so the names are passed as-is.
+	RuntimeImage string `json:"runtimeImage,omitempty"`
+}
+
+// BackendTLSConfig describes the TLS settings for a runtime with
+// a tls:// endpoint. The files are read each time the proxy connects
+// to the runtime, so the renewed certificates are picked up upon
+// reconnecting.
+type BackendTLSConfig struct {
+	// CAFile is the path to the PEM file with the CA certificates
+	// that are used to verify the runtime's certificate. If it's
+	// empty, the system CA certificates are used.
+	CAFile string `json:"caFile,omitempty"`
+	// CertFile is the path to the PEM file with the client
+	// certificate for mutual TLS authentication.
+	CertFile string `json:"certFile,omitempty"`
+	// KeyFile is the path to the PEM file with the private key
+	// of the client certificate.
+	KeyFile string `json:"keyFile,omitempty"`
+	// ServerName is the name that's used to verify the runtime's
+	// certificate. It defaults to the host part of the endpoint.
+	ServerName string `json:"serverName,omitempty"`
+}
+
+func (tc *BackendTLSConfig) isEmpty() bool {
+	return *tc == BackendTLSConfig{}
+}
+
+// clientConfig loads the files and returns tls.Config for
+// connecting to the specified host:port address.
+func (tc *BackendTLSConfig) clientConfig(addr string) (*tls.Config, error) {
+	config := &tls.Config{ServerName: tc.ServerName}
+	if config.ServerName == "" {
+		host, _, err := net.SplitHostPort(addr)
+		if err != nil {
+			return nil, err
+		}
+		config.ServerName = host
+	}
+	if tc.CAFile != "" {
+		data, err := ioutil.ReadFile(tc.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("can't read CA file: %v", err)
+		}
+		config.RootCAs = x509.NewCertPool()
+		if !config.RootCAs.AppendCertsFromPEM(data) {
+			return nil, fmt.Errorf("no certificates found in CA file %q", tc.CAFile)
+		}
+	}
+	if tc.CertFile != "" {
+		cert, err := tls.LoadX509KeyPair(tc.CertFile, tc.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("can't load client certificate: %v", err)
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+	return config, nil
+}
+
+// KeepaliveConfig describes TCP keep-alive settings for the
+// connections to tcp:// and tls:// endpoints.
+type KeepaliveConfig struct {
+	// Time is the interval between keep-alive probes. Zero
+	// value means the system default.
+	Time Duration `json:"time,omitempty"`
+	// Disable turns off TCP keep-alives.
+	Disable bool `json:"disable,omitempty"`
+}
+
+// period returns the keep-alive period to use for net.Dialer.
+func (kc *KeepaliveConfig) period() time.Duration {
+	if kc.Disable {
+		return -1
+	}
+	return kc.Time.Duration
+}
+
+// IsPrimary returns true if the backend is the primary one.
+func (bc *BackendConfig) IsPrimary() bool {
+	return bc.ID == ""
+}
+
+// IsRequiredForStatus returns true if the runtime must be
+// ready for the proxy to report the runtime and the network
+// as ready.
+func (bc *BackendConfig) IsRequiredForStatus() bool {
+	return bc.IsPrimary() || bc.StatusPolicy == StatusPolicyRequired
+}
+
+// LogConfig describes how CRI requests and responses are logged.
+// The sensitive data such as registry credentials is redacted
+// before the requests are logged.
+type LogConfig struct {
+	// Format is the format of the logged requests and
+	// responses: "yaml" (default) or "json".
+	Format string `json:"format,omitempty"`
+	// SecretEnvPatterns lists regular expressions that match
+	// the names of the environment variables whose values must
+	// be redacted. If it's not set, the default patterns are used.
+	SecretEnvPatterns []string `json:"secretEnvPatterns,omitempty"`
+	// SecretAnnotationPatterns lists regular expressions that
+	// match the keys of the annotations whose values must be
+	// redacted. If it's not set, the default patterns are used.
+	SecretAnnotationPatterns []string `json:"secretAnnotationPatterns,omitempty"`
+}
+
+// ListenerConfig describes an endpoint the proxy accepts CRI
+// requests on.
+type ListenerConfig struct {
+	// Address is either the path to a unix domain socket or an
+	// URL like unix:///path/to/socket or tls://host:port.
+	// TCP listeners must use TLS with client certificates.
+	Address string `json:"address"`
+	// Mode is the file mode of the unix domain socket as an octal
+	// string, e.g. "0660". If it's empty, the mode is determined
+	// by the umask.
+	Mode string `json:"mode,omitempty"`
+	// Group is the name or the numeric id of the group that
+	// owns the unix domain socket.
+	Group string `json:"group,omitempty"`
+	// TLS describes the TLS settings for tls:// listeners.
+	TLS ListenerTLSConfig `json:"tls,omitempty"`
+	// ReadOnly makes the listener only accept the requests
+	// that don't change anything: List*, *Status, Version
+	// and ImageFsInfo.
+	ReadOnly bool `json:"readOnly,omitempty"`
+	// AllowedMethods lists the methods that are accepted by
+	// the listener as RuntimeService/Method or ImageService/Method.
+	// The wildcards like RuntimeService/List* can be used. If it's
+	// empty and ReadOnly is false, all of the methods are allowed.
+	AllowedMethods []string `json:"allowedMethods,omitempty"`
+}
+
+// ListenerTLSConfig describes the TLS settings for a tls://
+// listener. The clients are required to present a certificate
+// signed by one of the client CAs.
+type ListenerTLSConfig struct {
+	// CertFile is the path to the PEM file with the server
+	// certificate.
+	CertFile string `json:"certFile,omitempty"`
+	// KeyFile is the path to the PEM file with the private key
+	// of the server certificate.
+	KeyFile string `json:"keyFile,omitempty"`
+	// ClientCAFile is the path to the PEM file with the CA
+	// certificates that are used to verify the clients'
+	// certificates.
+	ClientCAFile string `json:"clientCAFile,omitempty"`
+}
+
+// serverConfig loads the files and returns tls.Config for
+// the listener. The client certificates are only required
+// if ClientCAFile is set.
+func (tc *ListenerTLSConfig) serverConfig() (*tls.Config, error) {
+	cert, err := tls.LoadX509KeyPair(tc.CertFile, tc.KeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("can't load server certificate: %v", err)
+	}
+	if tc.ClientCAFile == "" {
+		return &tls.Config{Certificates: []tls.Certificate{cert}}, nil
+	}
+	data, err := ioutil.ReadFile(tc.ClientCAFile)
+	if err != nil {
+		return nil, fmt.Errorf("can't read client CA file: %v", err)
+	}
+	clientCAs := x509.NewCertPool()
+	if !clientCAs.AppendCertsFromPEM(data) {
+		return nil, fmt.Errorf("no certificates found in client CA file %q", tc.ClientCAFile)
+	}
+	return &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		ClientCAs:    clientCAs,
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+	}, nil
+}
+
+// StreamingConfig describes the proxy's own streaming endpoint.
+// If it's set, the urls returned by Exec, Attach and PortForward
+// are replaced with the urls of this endpoint that hold one-time
+// tokens, and the endpoint passes the streaming requests, including
+// SPDY and WebSocket upgrades, to the streaming servers of the
+// runtimes. This way, only the proxy's streaming port needs to be
+// reachable by the clients. Adding or removing the endpoint or
+// changing its address or TLS settings requires restarting the
+// proxy, so such changes are rejected by RuntimeProxy.Reload.
+type StreamingConfig struct {
+	// Address is host:port the endpoint listens on.
+	Address string `json:"address"`
+	// Url is the base url of the endpoint that's returned to the
+	// clients. If it's empty, the url is constructed using the node
+	// address and the port from Address.
+	Url string `json:"url,omitempty"`
+	// TLS describes the TLS settings for the endpoint. If it's
+	// set, the endpoint uses https, and if clientCAFile is set,
+	// the clients must present certificates signed by these CAs.
+	TLS ListenerTLSConfig `json:"tls,omitempty"`
+	// TokenTTL is the time the urls returned to the clients
+	// are valid.
+	TokenTTL Duration `json:"tokenTTL,omitempty"`
+}
+
+// AuditConfig describes the audit log of the requests that change
+// anything: creating, starting, stopping and removing pod sandboxes
+// and containers, exec, attach and port forwarding, updating the
+// container resources, pulling and removing images. The requests
+// are appended to the file as JSON lines holding the caller, the
+// method, the runtimes, the pod and the image along with the result
+// and the duration of the request. Such data as environment
+// variables, annotations, commands and registry credentials is
+// never written to the audit log.
+type AuditConfig struct {
+	// File is the path to the audit log file. If it's empty,
+	// the audit log is disabled.
+	File string `json:"file,omitempty"`
+	// MaxSizeMB is the size of the file in megabytes that
+	// triggers the rotation. The rotated files get .1, .2 and
+	// so on appended to their names.
+	MaxSizeMB int `json:"maxSizeMB,omitempty"`
+	// MaxBackups is the number of the rotated files to keep.
+	MaxBackups int `json:"maxBackups,omitempty"`
+}
+
+// AuthorizationConfig describes which processes connected to the
+// proxy over the unix domain sockets may make the requests that
+// change anything. The read-only requests (List*, *Status, Version
+// and ImageFsInfo) are always allowed. The callers are identified
+// by the credentials of their processes (SO_PEERCRED).
+type AuthorizationConfig struct {
+	// Rules lists the rules for the callers. The first rule
+	// that matches the caller is used. The callers that don't
+	// match any rule can only make read-only requests.
+	Rules []AuthorizationRule `json:"rules"`
+}
+
+// AuthorizationRule specifies what the matching callers are
+// allowed to do.
+type AuthorizationRule struct {
+	// UIDs lists the user ids of the processes the rule applies to.
+	UIDs []uint32 `json:"uids,omitempty"`
+	// GIDs lists the primary group ids of the processes the rule
+	// applies to. If both UIDs and GIDs are empty, the rule applies
+	// to any caller, including the ones that connect over TLS.
+	GIDs []uint32 `json:"gids,omitempty"`
+	// AllowedMethods lists the methods the callers may invoke as
+	// RuntimeService/Method or ImageService/Method. The wildcards
+	// like RuntimeService/* can be used. If it's empty, all of the
+	// methods are allowed.
+	AllowedMethods []string `json:"allowedMethods,omitempty"`
+	// AllowedRuntimes lists the ids of the runtimes the requests
+	// of the callers may go to. Empty id denotes the primary runtime
+	// and "*" denotes any runtime. If it's empty, all of the
+	// runtimes are allowed.
+	AllowedRuntimes []string `json:"allowedRuntimes,omitempty"`
+}
+
+// RoutingConfig describes the rules that choose the runtimes for
+// the pods that specify neither a runtime handler that's mapped to
+// a runtime nor the target runtime annotation.
+type RoutingConfig struct {
+	// Rules lists the routing rules. The first rule that
+	// matches the pod is used.
+	Rules []RoutingRule `json:"rules,omitempty"`
+	// DefaultRuntime is the id of the runtime for the pods that
+	// don't match any rule. Empty id denotes the primary runtime.
+	DefaultRuntime string `json:"defaultRuntime,omitempty"`
+	// DryRun makes the proxy only log the runtimes the rules
+	// choose for the pods, without actually using them.
+	DryRun bool `json:"dryRun,omitempty"`
+}
+
+// RoutingRule chooses the runtime for the matching pods. A pod
+// matches the rule if it matches all of the conditions that are
+// specified.
+type RoutingRule struct {
+	// Name identifies the rule in the log. It defaults
+	// to rules[N], where N is the index of the rule.
+	Name string `json:"name,omitempty"`
+	// Namespaces lists the namespaces of the matching pods.
+	Namespaces []string `json:"namespaces,omitempty"`
+	// Labels lists the labels the matching pods must have,
+	// with these values.
+	Labels map[string]string `json:"labels,omitempty"`
+	// Annotations lists the annotations the matching pods
+	// must have, with these values.
+	Annotations map[string]string `json:"annotations,omitempty"`
+	// Runtime is the id of the runtime for the matching pods.
+	// Empty id denotes the primary runtime.
+	Runtime string `json:"runtime"`
+}
+
+// Config describes CRI proxy configuration.
+type Config struct {
+	// Listeners is the list of the endpoints the proxy accepts
+	// CRI requests on. Changing the listeners requires restarting
+	// the proxy.
+	Listeners []ListenerConfig `json:"listeners,omitempty"`
+	// Backends is the list of the runtimes to connect to. The
+	// first backend must be the primary one, i.e. have an empty id.
+	Backends []BackendConfig `json:"backends"`
+	// StreamUrl is the streaming url of the primary runtime that's
+	// used to fix relative urls returned by Exec, Attach and
+	// PortForward.
+	StreamUrl string `json:"streamUrl,omitempty"`
+	// StreamPort is the streaming port of the primary runtime.
+	// It's used to construct the streaming url using the node
+	// address if StreamUrl is not set.
+	StreamPort int `json:"streamPort,omitempty"`
+	// Streaming describes the proxy's own streaming endpoint.
+	// If it's not set, the streaming urls of the runtimes are
+	// returned to the clients.
+	Streaming *StreamingConfig `json:"streaming,omitempty"`
+	// ImageCacheFile is the path to the file that's used to keep
+	// the image id to image name mapping across proxy restarts.
+	// If it's empty, the mapping is only kept in memory.
+	ImageCacheFile string `json:"imageCacheFile,omitempty"`
+	// UnknownMethods maps the names of CRI methods the proxy has
+	// no special handling for, such as RuntimeService/PodSandboxStats,
+	// to the policies for them: "primary", "all" or "reject".
+	// The requests for such methods are passed to the runtimes
+	// as raw protobuf data, so the ids in them aren't prefixed
+	// or unprefixed. The policies for the methods added in newer
+	// CRI versions are set by default. The policies can be changed
+	// by reloading the config, but adding new methods requires
+	// restarting the proxy.
+	UnknownMethods map[string]string `json:"unknownMethods,omitempty"`
+	// Log describes how CRI requests and responses are logged.
+	Log LogConfig `json:"log,omitempty"`
+	// Routing describes the rules that choose the runtimes
+	// for the pods.
+	Routing *RoutingConfig `json:"routing,omitempty"`
+	// Authorization describes which callers may make the requests
+	// that change anything. If it's not set, any process that can
+	// connect to the proxy can make any requests.
+	Authorization *AuthorizationConfig `json:"authorization,omitempty"`
+	// Audit describes the audit log of the requests that
+	// change anything.
+	Audit AuditConfig `json:"audit,omitempty"`
+	// ListTimeout limits the time each runtime is given to reply
+	// to List* and ImageFsInfo requests, which are passed to all
+	// of the runtimes in parallel. Regardless of this setting, the
+	// runtimes are given at most 90% of the time that's left before
+	// the deadline of the incoming request, so the proxy can reply
+	// with the items from the other runtimes if one of them hangs.
+	// Zero value means no additional limit.
+	ListTimeout Duration `json:"listTimeout,omitempty"`
+	// FailListOnTimeout makes List* and ImageFsInfo requests fail
+	// if one of the runtimes doesn't reply in time. By default,
+	// the items of such runtime are left out of the response.
+	FailListOnTimeout bool `json:"failListOnTimeout,omitempty"`
+	// ImageFailurePolicy specifies what happens if PullImage or
+	// RemoveImage request fails for some of the runtimes it's
+	// passed to: "fail" (default) or "ignore".
+	ImageFailurePolicy string `json:"imageFailurePolicy,omitempty"`
+}
+
+// ParseBackendSpec parses the backend spec in id:endpoint or
+// endpoint (for the primary runtime) format, where endpoint is
+// either /path/to/socket or an URL like tcp://host:port.
+func ParseBackendSpec(spec string) BackendConfig {
+	id, socket := "", spec
+	if p := strings.Index(spec, ":"); p >= 0 && !strings.HasPrefix(spec[p:], "://") {
+		id, socket = spec[:p], spec[p+1:]
+	}
+	return BackendConfig{ID: id, Socket: socket}
+}
+
+// LoadConfig loads the config from the specified YAML or JSON
+// file, sets the default values and validates it.
+func LoadConfig(path string) (*Config, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("can't read config file %q: %v", path, err)
+	}
+	var config Config
+	if err := yaml.Unmarshal(data, &config); err != nil {
+		return nil, fmt.Errorf("can't parse config file %q: %v", path, err)
+	}
+	config.SetDefaults()
+	if err := config.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid config file %q: %v", path, err)
+	}
+	return &config, nil
+}
+
+// SetDefaults sets the default values for the fields that
+// aren't set.
+func (c *Config) SetDefaults() {
+	if c.StreamUrl == "" && c.StreamPort == 0 {
+		c.StreamPort = DefaultStreamPort
+	}
+	for n := range c.Backends {
+		b := &c.Backends[n]
+		if b.ConnectionTimeout.Duration == 0 {
+			b.ConnectionTimeout.Duration = DefaultConnectionTimeout
+		}
+		if b.ImagePolicy == "" {
+			b.ImagePolicy = ImagePolicyAll
+		}
+		for i := range b.Images {
+			if b.Images[i].RuntimeImage == "" {
+				b.Images[i].RuntimeImage = b.Images[i].Image
+			}
+		}
+	}
+	if c.Streaming != nil && c.Streaming.TokenTTL.Duration == 0 {
+		c.Streaming.TokenTTL.Duration = DefaultStreamTokenTTL
+	}
+	if c.Audit.File != "" {
+		if c.Audit.MaxSizeMB == 0 {
+			c.Audit.MaxSizeMB = DefaultAuditMaxSizeMB
+		}
+		if c.Audit.MaxBackups == 0 {
+			c.Audit.MaxBackups = DefaultAuditMaxBackups
+		}
+	}
+}
+
+// Validate verifies the config, returning an error if it's not valid.
+func (c *Config) Validate() error {
+	if len(c.Backends) == 0 {
+		return errors.New("no backends specified")
+	}
+	ids := make(map[string]bool)
+	handlers := make(map[string]string)
+	for n, b := range c.Backends {
+		prefix := fmt.Sprintf("backends[%d]", n)
+		if !b.IsPrimary() {
+			prefix = fmt.Sprintf("backends[%d] (%q)", n, b.ID)
+		}
+		switch {
+		case n == 0 && !b.IsPrimary():
+			return fmt.Errorf("%s: the first backend should be primary (no id)", prefix)
+		case n > 0 && b.IsPrimary():
+			return fmt.Errorf("%s: only the first backend should be primary (no id)", prefix)
+		case strings.ContainsAny(b.ID, "/:") || strings.Contains(b.ID, "__"):
+			return fmt.Errorf("%s: runtime id must not contain '/', ':' or '__'", prefix)
+		case ids[b.ID]:
+			return fmt.Errorf("%s: duplicate runtime id", prefix)
+		case b.Socket == "":
+			return fmt.Errorf("%s: socket is not specified", prefix)
+		case b.ConnectionTimeout.Duration < 0:
+			return fmt.Errorf("%s: connection timeout must not be negative", prefix)
+		case b.CRIVersion != "" && !isKnownProtoPackage(b.CRIVersion):
+			return fmt.Errorf("%s: unknown CRI version %q (must be one of: %s)", prefix, b.CRIVersion, strings.Join(knownProtoPackages(), ", "))
+		case b.ImagePolicy != "" && b.ImagePolicy != ImagePolicyAll && b.ImagePolicy != ImagePolicyMatching && b.ImagePolicy != ImagePolicyLazy:
+			return fmt.Errorf("%s: unknown image policy %q", prefix, b.ImagePolicy)
+		case b.StatusPolicy != "" && b.StatusPolicy != StatusPolicyRequired && b.StatusPolicy != StatusPolicyOptional:
+			return fmt.Errorf("%s: unknown status policy %q", prefix, b.StatusPolicy)
+		case b.IsPrimary() && b.StatusPolicy == StatusPolicyOptional:
+			return fmt.Errorf("%s: the primary runtime can't have optional status policy", prefix)
+		case b.IsPrimary() && len(b.Images) > 0:
+			return fmt.Errorf("%s: the primary runtime can't have image mappings", prefix)
+		}
+		for i, m := range b.Images {
+			if err := m.validate(); err != nil {
+				return fmt.Errorf("%s: images[%d]: %v", prefix, i, err)
+			}
+		}
+		if err := b.validateEndpoint(); err != nil {
+			return fmt.Errorf("%s: %v", prefix, err)
+		}
+		if b.StreamUrl != "" {
+			if _, err := url.Parse(b.StreamUrl); err != nil {
+				return fmt.Errorf("%s: invalid stream url %q: %v", prefix, b.StreamUrl, err)
+			}
+			if b.DiscoverStreamUrl {
+				return fmt.Errorf("%s: streamUrl and discoverStreamUrl can't be used together", prefix)
+			}
+		}
+		ids[b.ID] = true
+		for _, h := range b.RuntimeHandlers {
+			if h == "" {
+				return fmt.Errorf("%s: empty runtime handler", prefix)
+			}
+			if otherId, found := handlers[h]; found {
+				return fmt.Errorf("%s: runtime handler %q is already used by runtime %q", prefix, h, otherId)
+			}
+			handlers[h] = b.ID
+		}
+	}
+	for n, l := range c.Listeners {
+		if err := l.validate(); err != nil {
+			return fmt.Errorf("listeners[%d]: %v", n, err)
+		}
+	}
+	if c.Routing != nil {
+		if err := c.Routing.validate(ids); err != nil {
+			return fmt.Errorf("routing: %v", err)
+		}
+	}
+	if c.Authorization != nil {
+		for n, rule := range c.Authorization.Rules {
+			if err := rule.validate(ids); err != nil {
+				return fmt.Errorf("authorization: rules[%d]: %v", n, err)
+			}
+		}
+	}
+	for method, policy := range c.UnknownMethods {
+		_, known := dispatchTable[method]
+		if _, found := streamDispatchTable[method]; found {
+			known = true
+		}
+		switch {
+		case !methodNameRx.MatchString(method):
+			return fmt.Errorf("unknownMethods: bad method name %q (must be RuntimeService/Method or ImageService/Method)", method)
+		case known:
+			return fmt.Errorf("unknownMethods: method %q is handled by the proxy", method)
+		case policy != MethodPolicyPrimary && policy != MethodPolicyAll && policy != MethodPolicyReject:
+			return fmt.Errorf("unknownMethods: unknown policy %q for method %q", policy, method)
+		}
+	}
+	if c.ImageFailurePolicy != "" && c.ImageFailurePolicy != ImageFailurePolicyFail && c.ImageFailurePolicy != ImageFailurePolicyIgnore {
+		return fmt.Errorf("unknown image failure policy %q", c.ImageFailurePolicy)
+	}
+	if c.ListTimeout.Duration < 0 {
+		return errors.New("list timeout must not be negative")
+	}
+	if c.Audit.MaxSizeMB < 0 {
+		return errors.New("audit: maxSizeMB must not be negative")
+	}
+	if c.Audit.MaxBackups < 0 {
+		return errors.New("audit: maxBackups must not be negative")
+	}
+	if c.Log.Format != "" && c.Log.Format != LogFormatYAML && c.Log.Format != LogFormatJSON {
+		return fmt.Errorf("log: unknown format %q", c.Log.Format)
+	}
+	if _, err := newRequestLogger(c.Log); err != nil {
+		return fmt.Errorf("log: %v", err)
+	}
+	if c.Streaming != nil {
+		if err := c.Streaming.validate(); err != nil {
+			return fmt.Errorf("streaming: %v", err)
+		}
+	}
+	if c.StreamUrl != "" {
+		if _, err := url.Parse(c.StreamUrl); err != nil {
+			return fmt.Errorf("invalid stream url %q: %v", c.StreamUrl, err)
+		}
+	} else if c.StreamPort <= 0 || c.StreamPort > 65535 {
+		return fmt.Errorf("invalid stream port %d", c.StreamPort)
+	}
+	return nil
+}
+
+func (sc *StreamingConfig) validate() error {
+	if _, _, err := net.SplitHostPort(sc.Address); err != nil {
+		return fmt.Errorf("bad address %q: %v", sc.Address, err)
+	}
+	if sc.Url != "" {
+		u, err := url.Parse(sc.Url)
+		if err != nil {
+			return fmt.Errorf("invalid url %q: %v", sc.Url, err)
+		}
+		if u.Scheme != "http" && u.Scheme != "https" || u.Host == "" {
+			return fmt.Errorf("invalid url %q: must be http(s)://host:port", sc.Url)
+		}
+	}
+	switch {
+	case (sc.TLS.CertFile == "") != (sc.TLS.KeyFile == ""):
+		return errors.New("tls: certFile and keyFile must be specified together")
+	case sc.TLS.ClientCAFile != "" && sc.TLS.CertFile == "":
+		return errors.New("tls: clientCAFile can only be used with certFile and keyFile")
+	case sc.TokenTTL.Duration < 0:
+		return errors.New("token TTL must not be negative")
+	}
+	return nil
+}
+
+// sameEndpoint returns true if both configs describe the endpoint
+// listening on the same address with the same TLS settings. Either
+// config may be nil, meaning that there's no streaming endpoint.
+func (sc *StreamingConfig) sameEndpoint(other *StreamingConfig) bool {
+	if sc == nil || other == nil {
+		return sc == other
+	}
+	return sc.Address == other.Address && sc.TLS == other.TLS
+}
+
+// baseUrl returns the base url of the streaming endpoint that's
+// either specified in the config or constructed using the node
+// address and the port the endpoint listens on.
+func (sc *StreamingConfig) baseUrl() (*url.URL, error) {
+	if sc.Url != "" {
+		return url.Parse(sc.Url)
+	}
+	_, portStr, err := net.SplitHostPort(sc.Address)
+	if err != nil {
+		return nil, err
+	}
+	port, err := strconv.Atoi(portStr)
+	if err != nil {
+		return nil, fmt.Errorf("bad port in %q", sc.Address)
+	}
+	u, err := utils.GetStreamUrl(port)
+	if err != nil {
+		return nil, fmt.Errorf("can't get stream url: %v", err)
+	}
+	if sc.TLS.CertFile != "" {
+		u.Scheme = "https"
+	}
+	return u, nil
+}
+
+func (bc *BackendConfig) validateEndpoint() error {
+	scheme, _, err := utils.ParseEndpoint(bc.Socket)
+	switch {
+	case err != nil:
+		return err
+	case scheme != utils.EndpointSchemeTLS && !bc.TLS.isEmpty():
+		return errors.New("tls settings can only be used with tls:// endpoints")
+	case (bc.TLS.CertFile == "") != (bc.TLS.KeyFile == ""):
+		return errors.New("tls: certFile and keyFile must be specified together")
+	case scheme == utils.EndpointSchemeUnix && bc.Keepalive != KeepaliveConfig{}:
+		return errors.New("keepalive settings can only be used with tcp:// and tls:// endpoints")
+	case bc.Keepalive.Time.Duration < 0:
+		return errors.New("keepalive: time must not be negative")
+	}
+	return nil
+}
+
+func (lc *ListenerConfig) validate() error {
+	scheme, _, err := utils.ParseEndpoint(lc.Address)
+	switch {
+	case lc.Address == "":
+		return errors.New("address is not specified")
+	case err != nil:
+		return err
+	case scheme == utils.EndpointSchemeTCP:
+		return errors.New("tcp:// listeners are not supported, use tls:// with client certificates")
+	case scheme == utils.EndpointSchemeTLS && (lc.TLS.CertFile == "" || lc.TLS.KeyFile == "" || lc.TLS.ClientCAFile == ""):
+		return errors.New("tls: certFile, keyFile and clientCAFile must be specified for tls:// listeners")
+	case scheme != utils.EndpointSchemeTLS && lc.TLS != ListenerTLSConfig{}:
+		return errors.New("tls settings can only be used with tls:// listeners")
+	case scheme != utils.EndpointSchemeUnix && (lc.Mode != "" || lc.Group != ""):
+		return errors.New("mode and group can only be set for unix domain sockets")
+	case lc.ReadOnly && len(lc.AllowedMethods) > 0:
+		return errors.New("readOnly and allowedMethods can't be used together")
+	}
+	if _, err := lc.fileMode(); err != nil {
+		return err
+	}
+	for _, pattern := range lc.AllowedMethods {
+		if !methodPatternRx.MatchString(pattern) {
+			return fmt.Errorf("allowedMethods: bad method pattern %q (must be RuntimeService/Method or ImageService/Method, possibly with wildcards)", pattern)
+		}
+	}
+	return nil
+}
+
+func (ar *AuthorizationRule) validate(ids map[string]bool) error {
+	for _, pattern := range ar.AllowedMethods {
+		if !methodPatternRx.MatchString(pattern) {
+			return fmt.Errorf("allowedMethods: bad method pattern %q (must be RuntimeService/Method or ImageService/Method, possibly with wildcards)", pattern)
+		}
+	}
+	for _, id := range ar.AllowedRuntimes {
+		if id != "*" && !ids[id] {
+			return fmt.Errorf("allowedRuntimes: unknown runtime %q", id)
+		}
+	}
+	return nil
+}
+
+func (m *ImageMapping) validate() error {
+	switch {
+	case m.Image == "":
+		return errors.New("image is not specified")
+	case strings.Count(m.Image, "*") > 1 || strings.Count(m.RuntimeImage, "*") > 1:
+		return errors.New("the patterns can only have a single wildcard")
+	case m.Image == "*":
+		return errors.New(`image "*" matches every image, leaving none for the other runtimes`)
+	case strings.Count(m.Image, "*") != strings.Count(m.RuntimeImage, "*"):
+		return fmt.Errorf("image %q and runtimeImage %q must both have a wildcard or both have none", m.Image, m.RuntimeImage)
+	}
+	return nil
+}
+
+func (rc *RoutingConfig) validate(ids map[string]bool) error {
+	for n, rule := range rc.Rules {
+		switch {
+		case len(rule.Namespaces) == 0 && len(rule.Labels) == 0 && len(rule.Annotations) == 0:
+			return fmt.Errorf("rules[%d]: no conditions (use defaultRuntime instead)", n)
+		case !ids[rule.Runtime]:
+			return fmt.Errorf("rules[%d]: unknown runtime %q", n, rule.Runtime)
+		}
+	}
+	if !ids[rc.DefaultRuntime] {
+		return fmt.Errorf("unknown default runtime %q", rc.DefaultRuntime)
+	}
+	return nil
+}
+
+// fileMode returns the file mode of the listener's unix domain
+// socket, or zero if it's not specified.
+func (lc *ListenerConfig) fileMode() (os.FileMode, error) {
+	if lc.Mode == "" {
+		return 0, nil
+	}
+	mode, err := strconv.ParseUint(lc.Mode, 8, 32)
+	if err != nil || mode == 0 || mode > 0777 {
+		return 0, fmt.Errorf("bad mode %q (must be an octal number like \"0660\")", lc.Mode)
+	}
+	return os.FileMode(mode), nil
+}
+
+// methodPatterns returns the patterns of the methods that are
+// allowed for the listener, or nil if all of the methods are
+// allowed.
+func (lc *ListenerConfig) methodPatterns() []string {
+	if lc.ReadOnly {
+		return readOnlyMethodPatterns
+	}
+	return lc.AllowedMethods
+}
+
+// RuntimeHandlers returns the mapping from RuntimeClass handlers
+// to runtime ids.
+func (c *Config) RuntimeHandlers() map[string]string {
+	r := make(map[string]string)
+	for _, b := range c.Backends {
+		for _, h := range b.RuntimeHandlers {
+			r[h] = b.ID
+		}
+	}
+	return r
+}
+
+// MethodPolicies returns the mapping from the names of the methods
+// that are passed through as raw protobuf data to the policies for
+// them, including the default ones.
+func (c *Config) MethodPolicies() map[string]string {
+	r := make(map[string]string)
+	for method, policy := range defaultMethodPolicies {
+		r[method] = policy
+	}
+	for method, policy := range c.UnknownMethods {
+		r[method] = policy
+	}
+	return r
+}
+
+// GetStreamUrl returns the streaming url of the primary runtime
+// that's either specified in the config or constructed using the
+// node address and the streaming port.
+func (c *Config) GetStreamUrl() (*url.URL, error) {
+	if c.StreamUrl == "" {
+		u, err := utils.GetStreamUrl(c.StreamPort)
+		if err != nil {
+			return nil, fmt.Errorf("can't get stream url: %v", err)
+		}
+		return u, nil
+	}
+	u, err := url.Parse(c.StreamUrl)
+	if err != nil {
+		return nil, fmt.Errorf("invalid stream url %q: %v", c.StreamUrl, err)
+	}
+	return u, nil
+}
+
+// GetBackendStreamUrls returns the streaming urls of the runtimes
+// that have them in the config, keyed by the runtime id. The urls
+// are checked to be reachable from the node address.
+func (c *Config) GetBackendStreamUrls() (map[string]url.URL, error) {
+	r := make(map[string]url.URL)
+	for _, b := range c.Backends {
+		if b.StreamUrl == "" {
+			continue
+		}
+		u, err := url.Parse(b.StreamUrl)
+		if err != nil {
+			return nil, fmt.Errorf("invalid stream url %q: %v", b.StreamUrl, err)
+		}
+		if u, err = utils.ResolveStreamUrl(u, c.Streaming != nil); err != nil {
+			return nil, fmt.Errorf("runtime %q: %v", b.ID, err)
+		}
+		r[b.ID] = *u
+	}
+	return r, nil
+}
+
+// knownCRIVersions lists CRI versions that can be specified for
+// the backends.
+var knownCRIVersions = []CRIVersion{&CRI19{}, &CRI112{}, &CRI1{}}
+
+func isKnownProtoPackage(protoPackage string) bool {
+	for _, v := range knownCRIVersions {
+		if v.ProtoPackage() == protoPackage {
+			return true
+		}
+	}
+	return false
+}
+
+func knownProtoPackages() []string {
+	var r []string
+	for _, v := range knownCRIVersions {
+		r = append(r, v.ProtoPackage())
+	}
+	return r
+}
@@ -0,0 +1,744 @@
+/*
+Copyright 2018 Mirantis
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package proxy
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLoadConfig(t *testing.T) {
+	for _, tc := range []struct {
+		name, content, error string
+		expected             *Config
+	}{
+		{
+			name: "yaml",
+			content: `
+backends:
+- socket: /var/run/dockershim.sock
+  runtimeHandlers: [runc]
+- id: virtlet.cloud
+  socket: /run/virtlet.sock
+  connectionTimeout: 1m
+  criVersion: runtime.v1alpha2
+  runtimeHandlers: [vm]
+streamUrl: http://10.0.0.1:11250/
+`,
+			expected: &Config{
+				Backends: []BackendConfig{
+					{
+						Socket:            "/var/run/dockershim.sock",
+						ConnectionTimeout: Duration{DefaultConnectionTimeout},
+						ImagePolicy:       ImagePolicyAll,
+						RuntimeHandlers:   []string{"runc"},
+					},
+					{
+						ID:                "virtlet.cloud",
+						Socket:            "/run/virtlet.sock",
+						ConnectionTimeout: Duration{time.Minute},
+						CRIVersion:        "runtime.v1alpha2",
+						ImagePolicy:       ImagePolicyAll,
+						RuntimeHandlers:   []string{"vm"},
+					},
+				},
+				StreamUrl: "http://10.0.0.1:11250/",
+			},
+		},
+		{
+			name:    "json",
+			content: `{"backends": [{"socket": "/var/run/dockershim.sock"}], "streamPort": 4242}`,
+			expected: &Config{
+				Backends: []BackendConfig{
+					{
+						Socket:            "/var/run/dockershim.sock",
+						ConnectionTimeout: Duration{DefaultConnectionTimeout},
+						ImagePolicy:       ImagePolicyAll,
+					},
+				},
+				StreamPort: 4242,
+			},
+		},
+		{
+			name: "unknown methods",
+			content: `
+backends:
+- socket: /var/run/dockershim.sock
+unknownMethods:
+  RuntimeService/CheckpointContainer: reject
+  ImageService/ImageFsStats: all
+`,
+			expected: &Config{
+				Backends: []BackendConfig{
+					{
+						Socket:            "/var/run/dockershim.sock",
+						ConnectionTimeout: Duration{DefaultConnectionTimeout},
+						ImagePolicy:       ImagePolicyAll,
+					},
+				},
+				StreamPort: DefaultStreamPort,
+				UnknownMethods: map[string]string{
+					"RuntimeService/CheckpointContainer": MethodPolicyReject,
+					"ImageService/ImageFsStats":          MethodPolicyAll,
+				},
+			},
+		},
+		{
+			name:    "list timeout",
+			content: "backends: [{socket: /run/a.sock}]\nlistTimeout: 5s\nfailListOnTimeout: true",
+			expected: &Config{
+				Backends: []BackendConfig{
+					{
+						Socket:            "/run/a.sock",
+						ConnectionTimeout: Duration{DefaultConnectionTimeout},
+						ImagePolicy:       ImagePolicyAll,
+					},
+				},
+				StreamPort:        DefaultStreamPort,
+				ListTimeout:       Duration{5 * time.Second},
+				FailListOnTimeout: true,
+			},
+		},
+		{
+			name: "tcp and tls endpoints",
+			content: `
+backends:
+- socket: unix:///var/run/dockershim.sock
+- id: vm
+  socket: tls://10.0.0.2:9000
+  tls:
+    caFile: /etc/criproxy/ca.pem
+    certFile: /etc/criproxy/client.pem
+    keyFile: /etc/criproxy/client-key.pem
+    serverName: runtime.example.com
+  keepalive:
+    time: 10s
+- id: sidecar
+  socket: tcp://127.0.0.1:9001
+  keepalive:
+    disable: true
+`,
+			expected: &Config{
+				Backends: []BackendConfig{
+					{
+						Socket:            "unix:///var/run/dockershim.sock",
+						ConnectionTimeout: Duration{DefaultConnectionTimeout},
+						ImagePolicy:       ImagePolicyAll,
+					},
+					{
+						ID:     "vm",
+						Socket: "tls://10.0.0.2:9000",
+						TLS: BackendTLSConfig{
+							CAFile:     "/etc/criproxy/ca.pem",
+							CertFile:   "/etc/criproxy/client.pem",
+							KeyFile:    "/etc/criproxy/client-key.pem",
+							ServerName: "runtime.example.com",
+						},
+						Keepalive:         KeepaliveConfig{Time: Duration{10 * time.Second}},
+						ConnectionTimeout: Duration{DefaultConnectionTimeout},
+						ImagePolicy:       ImagePolicyAll,
+					},
+					{
+						ID:                "sidecar",
+						Socket:            "tcp://127.0.0.1:9001",
+						Keepalive:         KeepaliveConfig{Disable: true},
+						ConnectionTimeout: Duration{DefaultConnectionTimeout},
+						ImagePolicy:       ImagePolicyAll,
+					},
+				},
+				StreamPort: DefaultStreamPort,
+			},
+		},
+		{
+			name: "listeners",
+			content: `
+backends:
+- socket: /var/run/dockershim.sock
+listeners:
+- address: /run/criproxy.sock
+- address: unix:///run/criproxy-ro.sock
+  mode: "0660"
+  group: monitoring
+  readOnly: true
+- address: tls://0.0.0.0:9443
+  tls:
+    certFile: /etc/criproxy/server.pem
+    keyFile: /etc/criproxy/server-key.pem
+    clientCAFile: /etc/criproxy/ca.pem
+  allowedMethods: [RuntimeService/Version, "*/List*"]
+`,
+			expected: &Config{
+				Backends: []BackendConfig{
+					{
+						Socket:            "/var/run/dockershim.sock",
+						ConnectionTimeout: Duration{DefaultConnectionTimeout},
+						ImagePolicy:       ImagePolicyAll,
+					},
+				},
+				Listeners: []ListenerConfig{
+					{Address: "/run/criproxy.sock"},
+					{
+						Address:  "unix:///run/criproxy-ro.sock",
+						Mode:     "0660",
+						Group:    "monitoring",
+						ReadOnly: true,
+					},
+					{
+						Address: "tls://0.0.0.0:9443",
+						TLS: ListenerTLSConfig{
+							CertFile:     "/etc/criproxy/server.pem",
+							KeyFile:      "/etc/criproxy/server-key.pem",
+							ClientCAFile: "/etc/criproxy/ca.pem",
+						},
+						AllowedMethods: []string{"RuntimeService/Version", "*/List*"},
+					},
+				},
+				StreamPort: DefaultStreamPort,
+			},
+		},
+		{
+			name: "authorization",
+			content: `
+backends:
+- socket: /var/run/dockershim.sock
+- id: alt
+  socket: /run/alt.sock
+authorization:
+  rules:
+  - uids: [0]
+  - gids: [1001]
+    allowedMethods: ["RuntimeService/*"]
+    allowedRuntimes: ["", alt]
+`,
+			expected: &Config{
+				Backends: []BackendConfig{
+					{
+						Socket:            "/var/run/dockershim.sock",
+						ConnectionTimeout: Duration{DefaultConnectionTimeout},
+						ImagePolicy:       ImagePolicyAll,
+					},
+					{
+						ID:                "alt",
+						Socket:            "/run/alt.sock",
+						ConnectionTimeout: Duration{DefaultConnectionTimeout},
+						ImagePolicy:       ImagePolicyAll,
+					},
+				},
+				Authorization: &AuthorizationConfig{
+					Rules: []AuthorizationRule{
+						{UIDs: []uint32{0}},
+						{
+							GIDs:            []uint32{1001},
+							AllowedMethods:  []string{"RuntimeService/*"},
+							AllowedRuntimes: []string{"", "alt"},
+						},
+					},
+				},
+				StreamPort: DefaultStreamPort,
+			},
+		},
+		{
+			name: "image mappings",
+			content: `
+backends:
+- socket: /var/run/dockershim.sock
+- id: virtlet
+  socket: /run/virtlet.sock
+  images:
+  - image: registry.vms.example.com/*
+    runtimeImage: "*"
+  - image: docker.io/library/cirros:*
+`,
+			expected: &Config{
+				Backends: []BackendConfig{
+					{
+						Socket:            "/var/run/dockershim.sock",
+						ConnectionTimeout: Duration{DefaultConnectionTimeout},
+						ImagePolicy:       ImagePolicyAll,
+					},
+					{
+						ID:                "virtlet",
+						Socket:            "/run/virtlet.sock",
+						ConnectionTimeout: Duration{DefaultConnectionTimeout},
+						ImagePolicy:       ImagePolicyAll,
+						Images: []ImageMapping{
+							{Image: "registry.vms.example.com/*", RuntimeImage: "*"},
+							{Image: "docker.io/library/cirros:*", RuntimeImage: "docker.io/library/cirros:*"},
+						},
+					},
+				},
+				StreamPort: DefaultStreamPort,
+			},
+		},
+		{
+			name: "image policies",
+			content: `
+backends:
+- socket: /var/run/dockershim.sock
+  imagePolicy: matching
+- id: virtlet
+  socket: /run/virtlet.sock
+  imagePolicy: lazy
+imageFailurePolicy: ignore
+`,
+			expected: &Config{
+				Backends: []BackendConfig{
+					{
+						Socket:            "/var/run/dockershim.sock",
+						ConnectionTimeout: Duration{DefaultConnectionTimeout},
+						ImagePolicy:       ImagePolicyMatching,
+					},
+					{
+						ID:                "virtlet",
+						Socket:            "/run/virtlet.sock",
+						ConnectionTimeout: Duration{DefaultConnectionTimeout},
+						ImagePolicy:       ImagePolicyLazy,
+					},
+				},
+				ImageFailurePolicy: ImageFailurePolicyIgnore,
+				StreamPort:         DefaultStreamPort,
+			},
+		},
+		{
+			name: "routing",
+			content: `
+backends:
+- socket: /var/run/dockershim.sock
+- id: virtlet
+  socket: /run/virtlet.sock
+routing:
+  rules:
+  - name: vms
+    namespaces: [vms]
+    runtime: virtlet
+  - labels: {sandbox: kata}
+    annotations: {example.com/isolation: vm}
+    runtime: virtlet
+  dryRun: true
+`,
+			expected: &Config{
+				Backends: []BackendConfig{
+					{
+						Socket:            "/var/run/dockershim.sock",
+						ConnectionTimeout: Duration{DefaultConnectionTimeout},
+						ImagePolicy:       ImagePolicyAll,
+					},
+					{
+						ID:                "virtlet",
+						Socket:            "/run/virtlet.sock",
+						ConnectionTimeout: Duration{DefaultConnectionTimeout},
+						ImagePolicy:       ImagePolicyAll,
+					},
+				},
+				Routing: &RoutingConfig{
+					Rules: []RoutingRule{
+						{
+							Name:       "vms",
+							Namespaces: []string{"vms"},
+							Runtime:    "virtlet",
+						},
+						{
+							Labels:      map[string]string{"sandbox": "kata"},
+							Annotations: map[string]string{"example.com/isolation": "vm"},
+							Runtime:     "virtlet",
+						},
+					},
+					DryRun: true,
+				},
+				StreamPort: DefaultStreamPort,
+			},
+		},
+		{
+			name: "audit log",
+			content: `
+backends:
+- socket: /var/run/dockershim.sock
+audit:
+  file: /var/log/criproxy/audit.log
+  maxBackups: 10
+`,
+			expected: &Config{
+				Backends: []BackendConfig{
+					{
+						Socket:            "/var/run/dockershim.sock",
+						ConnectionTimeout: Duration{DefaultConnectionTimeout},
+						ImagePolicy:       ImagePolicyAll,
+					},
+				},
+				Audit: AuditConfig{
+					File:       "/var/log/criproxy/audit.log",
+					MaxSizeMB:  DefaultAuditMaxSizeMB,
+					MaxBackups: 10,
+				},
+				StreamPort: DefaultStreamPort,
+			},
+		},
+		{
+			name: "streaming",
+			content: `
+backends:
+- socket: /var/run/dockershim.sock
+- id: alt
+  socket: /run/alt.sock
+  streamUrl: http://127.0.0.1:10011
+streaming:
+  address: 0.0.0.0:11251
+  url: https://node1.example.com:11251
+  tls:
+    certFile: /etc/criproxy/stream.pem
+    keyFile: /etc/criproxy/stream-key.pem
+`,
+			expected: &Config{
+				Backends: []BackendConfig{
+					{
+						Socket:            "/var/run/dockershim.sock",
+						ConnectionTimeout: Duration{DefaultConnectionTimeout},
+						ImagePolicy:       ImagePolicyAll,
+					},
+					{
+						ID:                "alt",
+						Socket:            "/run/alt.sock",
+						ConnectionTimeout: Duration{DefaultConnectionTimeout},
+						ImagePolicy:       ImagePolicyAll,
+						StreamUrl:         "http://127.0.0.1:10011",
+					},
+				},
+				Streaming: &StreamingConfig{
+					Address: "0.0.0.0:11251",
+					Url:     "https://node1.example.com:11251",
+					TLS: ListenerTLSConfig{
+						CertFile: "/etc/criproxy/stream.pem",
+						KeyFile:  "/etc/criproxy/stream-key.pem",
+					},
+					TokenTTL: Duration{DefaultStreamTokenTTL},
+				},
+				StreamPort: DefaultStreamPort,
+			},
+		},
+		{
+			name:    "no backends",
+			content: "streamPort: 4242",
+			error:   "no backends specified",
+		},
+		{
+			name:    "bad duration",
+			content: "backends: [{socket: /run/a.sock, connectionTimeout: 10}]",
+			error:   "bad duration",
+		},
+		{
+			name:    "no primary runtime",
+			content: "backends: [{id: alt, socket: /run/a.sock}]",
+			error:   `backends[0] ("alt"): the first backend should be primary`,
+		},
+		{
+			name:    "two primary runtimes",
+			content: "backends: [{socket: /run/a.sock}, {socket: /run/b.sock}]",
+			error:   "backends[1]: only the first backend should be primary",
+		},
+		{
+			name:    "duplicate id",
+			content: "backends: [{socket: /run/a.sock}, {id: alt, socket: /run/b.sock}, {id: alt, socket: /run/c.sock}]",
+			error:   `backends[2] ("alt"): duplicate runtime id`,
+		},
+		{
+			name:    "bad id",
+			content: "backends: [{socket: /run/a.sock}, {id: a/b, socket: /run/b.sock}]",
+			error:   "runtime id must not contain",
+		},
+		{
+			name:    "no socket",
+			content: "backends: [{socket: /run/a.sock}, {id: alt}]",
+			error:   `backends[1] ("alt"): socket is not specified`,
+		},
+		{
+			name:    "unknown endpoint scheme",
+			content: "backends: [{socket: \"http://10.0.0.2:9000\"}]",
+			error:   `backends[0]: bad endpoint "http://10.0.0.2:9000": unknown scheme "http"`,
+		},
+		{
+			name:    "no port in tcp endpoint",
+			content: "backends: [{socket: /run/a.sock}, {id: alt, socket: \"tcp://10.0.0.2\"}]",
+			error:   `backends[1] ("alt"): bad endpoint "tcp://10.0.0.2": must be tcp://host:port`,
+		},
+		{
+			name:    "bad unix endpoint",
+			content: "backends: [{socket: \"unix://run/a.sock\"}]",
+			error:   "must be unix:///path/to/socket",
+		},
+		{
+			name:    "tls settings for tcp endpoint",
+			content: "backends: [{socket: /run/a.sock}, {id: alt, socket: \"tcp://10.0.0.2:9000\", tls: {caFile: /etc/ca.pem}}]",
+			error:   "tls settings can only be used with tls:// endpoints",
+		},
+		{
+			name:    "client cert without key",
+			content: "backends: [{socket: /run/a.sock}, {id: alt, socket: \"tls://10.0.0.2:9000\", tls: {certFile: /etc/client.pem}}]",
+			error:   "tls: certFile and keyFile must be specified together",
+		},
+		{
+			name:    "keepalive for unix socket",
+			content: "backends: [{socket: /run/a.sock, keepalive: {time: 10s}}]",
+			error:   "keepalive settings can only be used with tcp:// and tls:// endpoints",
+		},
+		{
+			name:    "negative keepalive time",
+			content: "backends: [{socket: /run/a.sock}, {id: alt, socket: \"tcp://10.0.0.2:9000\", keepalive: {time: -1s}}]",
+			error:   "keepalive: time must not be negative",
+		},
+		{
+			name:    "bad CRI version",
+			content: "backends: [{socket: /run/a.sock, criVersion: runtime.v42}]",
+			error:   `unknown CRI version "runtime.v42"`,
+		},
+		{
+			name:    "bad image policy",
+			content: "backends: [{socket: /run/a.sock, imagePolicy: some}]",
+			error:   `unknown image policy "some"`,
+		},
+		{
+			name:    "bad image failure policy",
+			content: "backends: [{socket: /run/a.sock}]\nimageFailurePolicy: some",
+			error:   `unknown image failure policy "some"`,
+		},
+		{
+			name:    "bad status policy",
+			content: "backends: [{socket: /run/a.sock}, {id: alt, socket: /run/b.sock, statusPolicy: some}]",
+			error:   `unknown status policy "some"`,
+		},
+		{
+			name:    "optional primary runtime",
+			content: "backends: [{socket: /run/a.sock, statusPolicy: optional}]",
+			error:   "the primary runtime can't have optional status policy",
+		},
+		{
+			name:    "duplicate runtime handler",
+			content: "backends: [{socket: /run/a.sock, runtimeHandlers: [a]}, {id: alt, socket: /run/b.sock, runtimeHandlers: [a]}]",
+			error:   `runtime handler "a" is already used by runtime ""`,
+		},
+		{
+			name:    "bad unknown method name",
+			content: "backends: [{socket: /run/a.sock}]\nunknownMethods: {Foo: primary}",
+			error:   `unknownMethods: bad method name "Foo"`,
+		},
+		{
+			name:    "unknown method handled by the proxy",
+			content: "backends: [{socket: /run/a.sock}]\nunknownMethods: {RuntimeService/Version: all}",
+			error:   `unknownMethods: method "RuntimeService/Version" is handled by the proxy`,
+		},
+		{
+			name:    "bad unknown method policy",
+			content: "backends: [{socket: /run/a.sock}]\nunknownMethods: {RuntimeService/CheckpointContainer: some}",
+			error:   `unknownMethods: unknown policy "some"`,
+		},
+		{
+			name:    "bad log format",
+			content: "backends: [{socket: /run/a.sock}]\nlog: {format: xml}",
+			error:   `log: unknown format "xml"`,
+		},
+		{
+			name:    "bad secret env pattern",
+			content: "backends: [{socket: /run/a.sock}]\nlog: {secretEnvPatterns: [\"(\"]}",
+			error:   `log: secretEnvPatterns: bad pattern "("`,
+		},
+		{
+			name:    "no listener address",
+			content: "backends: [{socket: /run/a.sock}]\nlisteners: [{mode: \"0660\"}]",
+			error:   "listeners[0]: address is not specified",
+		},
+		{
+			name:    "tcp listener",
+			content: "backends: [{socket: /run/a.sock}]\nlisteners: [{address: \"tcp://0.0.0.0:9443\"}]",
+			error:   "listeners[0]: tcp:// listeners are not supported",
+		},
+		{
+			name:    "tls listener without client CA",
+			content: "backends: [{socket: /run/a.sock}]\nlisteners: [{address: \"tls://0.0.0.0:9443\", tls: {certFile: /etc/server.pem, keyFile: /etc/server-key.pem}}]",
+			error:   "tls: certFile, keyFile and clientCAFile must be specified",
+		},
+		{
+			name:    "mode for tls listener",
+			content: "backends: [{socket: /run/a.sock}]\nlisteners: [{address: \"tls://0.0.0.0:9443\", mode: \"0660\", tls: {certFile: /etc/server.pem, keyFile: /etc/server-key.pem, clientCAFile: /etc/ca.pem}}]",
+			error:   "mode and group can only be set for unix domain sockets",
+		},
+		{
+			name:    "bad listener mode",
+			content: "backends: [{socket: /run/a.sock}]\nlisteners: [{address: /run/criproxy.sock, mode: \"rw\"}]",
+			error:   `listeners[0]: bad mode "rw"`,
+		},
+		{
+			name:    "read-only listener with allowed methods",
+			content: "backends: [{socket: /run/a.sock}]\nlisteners: [{address: /run/criproxy.sock, readOnly: true, allowedMethods: [RuntimeService/Version]}]",
+			error:   "readOnly and allowedMethods can't be used together",
+		},
+		{
+			name:    "bad allowed method",
+			content: "backends: [{socket: /run/a.sock}]\nlisteners: [{address: /run/criproxy.sock, allowedMethods: [Version]}]",
+			error:   `allowedMethods: bad method pattern "Version"`,
+		},
+		{
+			name:    "bad authorization method pattern",
+			content: "backends: [{socket: /run/a.sock}]\nauthorization: {rules: [{allowedMethods: [RunPodSandbox]}]}",
+			error:   `authorization: rules[0]: allowedMethods: bad method pattern "RunPodSandbox"`,
+		},
+		{
+			name:    "unknown runtime in authorization rule",
+			content: "backends: [{socket: /run/a.sock}]\nauthorization: {rules: [{uids: [0]}, {allowedRuntimes: [alt]}]}",
+			error:   `authorization: rules[1]: allowedRuntimes: unknown runtime "alt"`,
+		},
+		{
+			name:    "image mapping for the primary runtime",
+			content: "backends: [{socket: /run/a.sock, images: [{image: \"registry.example.com/*\"}]}]",
+			error:   "backends[0]: the primary runtime can't have image mappings",
+		},
+		{
+			name:    "image mapping with two wildcards",
+			content: "backends: [{socket: /run/a.sock}, {id: alt, socket: /run/b.sock, images: [{image: \"*/*\"}]}]",
+			error:   `backends[1] ("alt"): images[0]: the patterns can only have a single wildcard`,
+		},
+		{
+			name:    "image mapping that matches every image",
+			content: "backends: [{socket: /run/a.sock}, {id: alt, socket: /run/b.sock, images: [{image: \"*\", runtimeImage: \"vms/*\"}]}]",
+			error:   `backends[1] ("alt"): images[0]: image "*" matches every image`,
+		},
+		{
+			name:    "image mapping without runtime wildcard",
+			content: "backends: [{socket: /run/a.sock}, {id: alt, socket: /run/b.sock, images: [{image: \"registry.example.com/*\", runtimeImage: cirros}]}]",
+			error:   `images[0]: image "registry.example.com/*" and runtimeImage "cirros" must both have a wildcard or both have none`,
+		},
+		{
+			name:    "routing rule without conditions",
+			content: "backends: [{socket: /run/a.sock}, {id: alt, socket: /run/b.sock}]\nrouting: {rules: [{runtime: alt}]}",
+			error:   "routing: rules[0]: no conditions",
+		},
+		{
+			name:    "unknown runtime in routing rule",
+			content: "backends: [{socket: /run/a.sock}]\nrouting: {rules: [{namespaces: [vms], runtime: alt}]}",
+			error:   `routing: rules[0]: unknown runtime "alt"`,
+		},
+		{
+			name:    "unknown default runtime",
+			content: "backends: [{socket: /run/a.sock}]\nrouting: {defaultRuntime: alt}",
+			error:   `routing: unknown default runtime "alt"`,
+		},
+		{
+			name:    "negative list timeout",
+			content: "backends: [{socket: /run/a.sock}]\nlistTimeout: -1s",
+			error:   "list timeout must not be negative",
+		},
+		{
+			name:    "negative audit log size",
+			content: "backends: [{socket: /run/a.sock}]\naudit: {file: /var/log/audit.log, maxSizeMB: -1}",
+			error:   "audit: maxSizeMB must not be negative",
+		},
+		{
+			name:    "negative audit log backup count",
+			content: "backends: [{socket: /run/a.sock}]\naudit: {file: /var/log/audit.log, maxBackups: -1}",
+			error:   "audit: maxBackups must not be negative",
+		},
+		{
+			name:    "bad streaming address",
+			content: "backends: [{socket: /run/a.sock}]\nstreaming: {address: localhost}",
+			error:   `streaming: bad address "localhost"`,
+		},
+		{
+			name:    "bad streaming url",
+			content: "backends: [{socket: /run/a.sock}]\nstreaming: {address: \":11251\", url: /stream}",
+			error:   `streaming: invalid url "/stream": must be http(s)://host:port`,
+		},
+		{
+			name:    "streaming client CA without certificate",
+			content: "backends: [{socket: /run/a.sock}]\nstreaming: {address: \":11251\", tls: {clientCAFile: /etc/ca.pem}}",
+			error:   "streaming: tls: clientCAFile can only be used with certFile and keyFile",
+		},
+		{
+			name:    "stream url with discovery",
+			content: "backends: [{socket: /run/a.sock, streamUrl: \"http://10.0.0.1:10010\", discoverStreamUrl: true}]",
+			error:   "streamUrl and discoverStreamUrl can't be used together",
+		},
+		{
+			name:    "bad stream port",
+			content: "backends: [{socket: /run/a.sock}]\nstreamPort: 100000",
+			error:   "invalid stream port 100000",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			tmpDir, err := ioutil.TempDir("", "config-test-")
+			if err != nil {
+				t.Fatalf("TempDir(): %v", err)
+			}
+			defer os.RemoveAll(tmpDir)
+			path := filepath.Join(tmpDir, "criproxy.yaml")
+			if err := ioutil.WriteFile(path, []byte(tc.content), 0644); err != nil {
+				t.Fatalf("WriteFile(): %v", err)
+			}
+			config, err := LoadConfig(path)
+			switch {
+			case tc.error == "" && err != nil:
+				t.Errorf("LoadConfig(): %v", err)
+			case tc.error != "" && err == nil:
+				t.Errorf("didn't get expected error")
+			case tc.error != "" && !strings.Contains(err.Error(), tc.error):
+				t.Errorf("bad error message: %q instead of %q", err.Error(), tc.error)
+			case tc.expected != nil && !reflect.DeepEqual(config, tc.expected):
+				t.Errorf("bad config: %#v instead of %#v", config, tc.expected)
+			}
+		})
+	}
+}
+
+func TestParseBackendSpec(t *testing.T) {
+	for spec, expected := range map[string]BackendConfig{
+		"/var/run/dockershim.sock":        {Socket: "/var/run/dockershim.sock"},
+		"virtlet.cloud:/run/virtlet.sock": {ID: "virtlet.cloud", Socket: "/run/virtlet.sock"},
+		"unix:///var/run/dockershim.sock": {Socket: "unix:///var/run/dockershim.sock"},
+		"tcp://10.0.0.2:9000":             {Socket: "tcp://10.0.0.2:9000"},
+		"vm:tls://10.0.0.2:9000":          {ID: "vm", Socket: "tls://10.0.0.2:9000"},
+		"alt:unix:///run/alt.sock":        {ID: "alt", Socket: "unix:///run/alt.sock"},
+	} {
+		if backend := ParseBackendSpec(spec); !reflect.DeepEqual(backend, expected) {
+			t.Errorf("ParseBackendSpec(%q): %#v instead of %#v", spec, backend, expected)
+		}
+	}
+}
+
+func TestMethodPolicies(t *testing.T) {
+	config := &Config{
+		UnknownMethods: map[string]string{
+			"RuntimeService/CheckpointContainer": MethodPolicyReject,
+			"ImageService/ImageFsStats":          MethodPolicyAll,
+		},
+	}
+	policies := config.MethodPolicies()
+	for method, expectedPolicy := range map[string]string{
+		"RuntimeService/CheckpointContainer":   MethodPolicyReject,
+		"ImageService/ImageFsStats":            MethodPolicyAll,
+		"RuntimeService/ListPodSandboxStats":   MethodPolicyPrimary,
+		"RuntimeService/ListMetricDescriptors": MethodPolicyPrimary,
+	} {
+		if policy := policies[method]; policy != expectedPolicy {
+			t.Errorf("bad policy for %s: %q instead of %q", method, policy, expectedPolicy)
+		}
+	}
+	if _, found := defaultMethodPolicies["ImageService/ImageFsStats"]; found {
+		t.Errorf("MethodPolicies() modified the default policies")
+	}
+}
@@ -0,0 +1,1546 @@
+/*
+Copyright 2018 Mirantis
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package proxy
+
+import (
+	"google.golang.org/grpc"
+
+	"github.com/elotl/criproxy/pkg/rawcodec"
+	runtimeapi "github.com/elotl/criproxy/pkg/runtimeapis/v1"
+)
+
+// ---
+
+type PodSandbox_1 struct {
+	inner *runtimeapi.PodSandbox
+}
+
+var _ PodSandbox = &PodSandbox_1{}
+
+func (o *PodSandbox_1) Wrap(v interface{}) {
+	if v == nil {
+		o.inner = &runtimeapi.PodSandbox{}
+	} else {
+		o.inner = v.(*runtimeapi.PodSandbox)
+	}
+}
+func (o *PodSandbox_1) Unwrap() interface{} { return o.inner }
+func (o *PodSandbox_1) Copy() PodSandbox    { r := *o.inner; return &PodSandbox_1{&r} }
+func (o *PodSandbox_1) Id() string          { return o.inner.Id }
+func (o *PodSandbox_1) SetId(id string)     { o.inner.Id = id }
+
+type Container_1 struct {
+	inner *runtimeapi.Container
+}
+
+// ---
+
+var _ Container = &Container_1{}
+
+func (o *Container_1) Wrap(v interface{}) {
+	if v == nil {
+		o.inner = &runtimeapi.Container{}
+	} else {
+		o.inner = v.(*runtimeapi.Container)
+	}
+}
+func (o *Container_1) Unwrap() interface{}       { return o.inner }
+func (o *Container_1) Copy() Container           { r := *o.inner; return &Container_1{&r} }
+func (o *Container_1) Id() string                { return o.inner.Id }
+func (o *Container_1) SetId(id string)           { o.inner.Id = id }
+func (o *Container_1) PodSandboxId() string      { return o.inner.PodSandboxId }
+func (o *Container_1) SetPodSandboxId(id string) { o.inner.PodSandboxId = id }
+func (o *Container_1) Image() string             { return o.inner.Image.GetImage() }
+func (o *Container_1) SetImage(image string)     { o.inner.Image = &runtimeapi.ImageSpec{Image: image} }
+
+// ---
+
+type Image_1 struct {
+	inner *runtimeapi.Image
+}
+
+var _ Image = &Image_1{}
+
+func (o *Image_1) Wrap(v interface{}) {
+	if v == nil {
+		o.inner = &runtimeapi.Image{}
+	} else {
+		o.inner = v.(*runtimeapi.Image)
+	}
+}
+func (o *Image_1) Unwrap() interface{}                 { return o.inner }
+func (o *Image_1) Copy() Image                         { r := *o.inner; return &Image_1{&r} }
+func (o *Image_1) Id() string                          { return o.inner.Id }
+func (o *Image_1) SetId(id string)                     { o.inner.Id = id }
+func (o *Image_1) RepoTags() []string                  { return o.inner.RepoTags }
+func (o *Image_1) SetRepoTags(repoTags []string)       { o.inner.RepoTags = repoTags }
+func (o *Image_1) RepoDigests() []string               { return o.inner.RepoDigests }
+func (o *Image_1) SetRepoDigests(repoDigests []string) { o.inner.RepoDigests = repoDigests }
+
+// ---
+
+type PodSandboxStatus_1 struct {
+	inner *runtimeapi.PodSandboxStatus
+}
+
+var _ PodSandboxStatus = &PodSandboxStatus_1{}
+
+func (o *PodSandboxStatus_1) Wrap(v interface{}) {
+	if v == nil {
+		o.inner = &runtimeapi.PodSandboxStatus{}
+	} else {
+		o.inner = v.(*runtimeapi.PodSandboxStatus)
+	}
+}
+func (o *PodSandboxStatus_1) Unwrap() interface{} { return o.inner }
+func (o *PodSandboxStatus_1) Copy() PodSandboxStatus {
+	r := *o.inner
+	return &PodSandboxStatus_1{&r}
+}
+func (o *PodSandboxStatus_1) Id() string      { return o.inner.Id }
+func (o *PodSandboxStatus_1) SetId(id string) { o.inner.Id = id }
+
+// ---
+
+type ContainerStatus_1 struct {
+	inner *runtimeapi.ContainerStatus
+}
+
+var _ ContainerStatus = &ContainerStatus_1{}
+
+func (o *ContainerStatus_1) Wrap(v interface{}) {
+	if v == nil {
+		o.inner = &runtimeapi.ContainerStatus{}
+	} else {
+		o.inner = v.(*runtimeapi.ContainerStatus)
+	}
+}
+func (o *ContainerStatus_1) Unwrap() interface{}   { return o.inner }
+func (o *ContainerStatus_1) Copy() ContainerStatus { r := *o.inner; return &ContainerStatus_1{&r} }
+func (o *ContainerStatus_1) Id() string            { return o.inner.Id }
+func (o *ContainerStatus_1) SetId(id string)       { o.inner.Id = id }
+func (o *ContainerStatus_1) Image() string         { return o.inner.Image.GetImage() }
+func (o *ContainerStatus_1) SetImage(image string) {
+	o.inner.Image = &runtimeapi.ImageSpec{Image: image}
+}
+
+// ---
+
+type ContainerStats_1 struct {
+	inner *runtimeapi.ContainerStats
+}
+
+var _ ContainerStats = &ContainerStats_1{}
+
+func (o *ContainerStats_1) Wrap(v interface{}) {
+	if v == nil {
+		o.inner = &runtimeapi.ContainerStats{}
+	} else {
+		o.inner = v.(*runtimeapi.ContainerStats)
+	}
+}
+func (o *ContainerStats_1) Unwrap() interface{}  { return o.inner }
+func (o *ContainerStats_1) Copy() ContainerStats { r := *o.inner; return &ContainerStats_1{&r} }
+func (o *ContainerStats_1) Id() string           { return o.inner.Attributes.GetId() }
+func (o *ContainerStats_1) SetId(id string) {
+	if o.inner.Attributes == nil {
+		o.inner.Attributes = &runtimeapi.ContainerAttributes{Id: id}
+	} else {
+		o.inner.Attributes.Id = id
+	}
+}
+
+// ---
+
+type FilesystemUsage_1 struct {
+	inner *runtimeapi.FilesystemUsage
+}
+
+func (o *FilesystemUsage_1) Wrap(v interface{}) {
+	if v == nil {
+		o.inner = &runtimeapi.FilesystemUsage{}
+	} else {
+		o.inner = v.(*runtimeapi.FilesystemUsage)
+	}
+}
+func (o *FilesystemUsage_1) Unwrap() interface{} { return o.inner }
+
+// ---
+
+type VersionRequest_1 struct {
+	inner *runtimeapi.VersionRequest
+}
+
+var _ VersionRequest = &VersionRequest_1{}
+
+func (o *VersionRequest_1) Wrap(v interface{}) {
+	if v == nil {
+		o.inner = &runtimeapi.VersionRequest{}
+	} else {
+		o.inner = v.(*runtimeapi.VersionRequest)
+	}
+}
+func (o *VersionRequest_1) Unwrap() interface{} { return o.inner }
+
+// ---
+
+type VersionResponse_1 struct {
+	inner *runtimeapi.VersionResponse
+}
+
+var _ VersionResponse = &VersionResponse_1{}
+
+func (o *VersionResponse_1) Wrap(v interface{}) {
+	if v == nil {
+		o.inner = &runtimeapi.VersionResponse{}
+	} else {
+		o.inner = v.(*runtimeapi.VersionResponse)
+	}
+}
+func (o *VersionResponse_1) Unwrap() interface{} { return o.inner }
+
+// ---
+
+type StatusRequest_1 struct {
+	inner *runtimeapi.StatusRequest
+}
+
+var _ StatusRequest = &StatusRequest_1{}
+
+func (o *StatusRequest_1) Wrap(v interface{}) {
+	if v == nil {
+		o.inner = &runtimeapi.StatusRequest{}
+	} else {
+		o.inner = v.(*runtimeapi.StatusRequest)
+	}
+}
+func (o *StatusRequest_1) Unwrap() interface{} { return o.inner }
+func (o *StatusRequest_1) Verbose() bool       { return o.inner.Verbose }
+
+// ---
+
+type StatusResponse_1 struct {
+	inner *runtimeapi.StatusResponse
+}
+
+var _ StatusResponse = &StatusResponse_1{}
+
+func (o *StatusResponse_1) Wrap(v interface{}) {
+	if v == nil {
+		o.inner = &runtimeapi.StatusResponse{}
+	} else {
+		o.inner = v.(*runtimeapi.StatusResponse)
+	}
+}
+func (o *StatusResponse_1) Unwrap() interface{}            { return o.inner }
+func (o *StatusResponse_1) Info() map[string]string        { return o.inner.Info }
+func (o *StatusResponse_1) SetInfo(info map[string]string) { o.inner.Info = info }
+func (o *StatusResponse_1) Conditions() []RuntimeCondition {
+	var r []RuntimeCondition
+	for _, c := range o.inner.Status.GetConditions() {
+		r = append(r, RuntimeCondition{
+			Type:    c.Type,
+			Status:  c.Status,
+			Reason:  c.Reason,
+			Message: c.Message,
+		})
+	}
+	return r
+}
+func (o *StatusResponse_1) SetConditions(conditions []RuntimeCondition) {
+	o.inner.Status = &runtimeapi.RuntimeStatus{}
+	for _, c := range conditions {
+		o.inner.Status.Conditions = append(o.inner.Status.Conditions, &runtimeapi.RuntimeCondition{
+			Type:    c.Type,
+			Status:  c.Status,
+			Reason:  c.Reason,
+			Message: c.Message,
+		})
+	}
+}
+
+// ---
+
+type UpdateRuntimeConfigRequest_1 struct {
+	inner *runtimeapi.UpdateRuntimeConfigRequest
+}
+
+var _ UpdateRuntimeConfigRequest = &UpdateRuntimeConfigRequest_1{}
+
+func (o *UpdateRuntimeConfigRequest_1) Wrap(v interface{}) {
+	if v == nil {
+		o.inner = &runtimeapi.UpdateRuntimeConfigRequest{}
+	} else {
+		o.inner = v.(*runtimeapi.UpdateRuntimeConfigRequest)
+	}
+}
+func (o *UpdateRuntimeConfigRequest_1) Unwrap() interface{} { return o.inner }
+
+// ---
+
+type UpdateRuntimeConfigResponse_1 struct {
+	inner *runtimeapi.UpdateRuntimeConfigResponse
+}
+
+var _ UpdateRuntimeConfigResponse = &UpdateRuntimeConfigResponse_1{}
+
+func (o *UpdateRuntimeConfigResponse_1) Wrap(v interface{}) {
+	if v == nil {
+		o.inner = &runtimeapi.UpdateRuntimeConfigResponse{}
+	} else {
+		o.inner = v.(*runtimeapi.UpdateRuntimeConfigResponse)
+	}
+}
+func (o *UpdateRuntimeConfigResponse_1) Unwrap() interface{} { return o.inner }
+
+// ---
+
+type RunPodSandboxRequest_1 struct {
+	inner *runtimeapi.RunPodSandboxRequest
+}
+
+var _ RunPodSandboxRequest = &RunPodSandboxRequest_1{}
+
+func (o *RunPodSandboxRequest_1) Wrap(v interface{}) {
+	if v == nil {
+		o.inner = &runtimeapi.RunPodSandboxRequest{}
+	} else {
+		o.inner = v.(*runtimeapi.RunPodSandboxRequest)
+	}
+}
+func (o *RunPodSandboxRequest_1) Unwrap() interface{} { return o.inner }
+func (o *RunPodSandboxRequest_1) GetAnnotations() map[string]string {
+	return o.inner.Config.GetAnnotations()
+}
+func (o *RunPodSandboxRequest_1) GetLabels() map[string]string {
+	return o.inner.Config.GetLabels()
+}
+func (o *RunPodSandboxRequest_1) PodMetadata() *PodMetadata {
+	return podMetadata_1(o.inner.Config.GetMetadata())
+}
+func (o *RunPodSandboxRequest_1) RuntimeHandler() string { return o.inner.RuntimeHandler }
+
+// ---
+
+type RunPodSandboxResponse_1 struct {
+	inner *runtimeapi.RunPodSandboxResponse
+}
+
+var _ RunPodSandboxResponse = &RunPodSandboxResponse_1{}
+
+func (o *RunPodSandboxResponse_1) Wrap(v interface{}) {
+	if v == nil {
+		o.inner = &runtimeapi.RunPodSandboxResponse{}
+	} else {
+		o.inner = v.(*runtimeapi.RunPodSandboxResponse)
+	}
+}
+func (o *RunPodSandboxResponse_1) Unwrap() interface{}       { return o.inner }
+func (o *RunPodSandboxResponse_1) PodSandboxId() string      { return o.inner.PodSandboxId }
+func (o *RunPodSandboxResponse_1) SetPodSandboxId(id string) { o.inner.PodSandboxId = id }
+
+// ---
+
+type ListPodSandboxRequest_1 struct {
+	inner *runtimeapi.ListPodSandboxRequest
+}
+
+var _ ListPodSandboxRequest = &ListPodSandboxRequest_1{}
+
+func (o *ListPodSandboxRequest_1) Wrap(v interface{}) {
+	if v == nil {
+		o.inner = &runtimeapi.ListPodSandboxRequest{}
+	} else {
+		o.inner = v.(*runtimeapi.ListPodSandboxRequest)
+	}
+}
+func (o *ListPodSandboxRequest_1) Unwrap() interface{} { return o.inner }
+func (o *ListPodSandboxRequest_1) IdFilter() string {
+	return o.inner.Filter.GetId()
+}
+
+func (o *ListPodSandboxRequest_1) SetIdFilter(id string) {
+	if o.inner.Filter == nil {
+		o.inner.Filter = &runtimeapi.PodSandboxFilter{Id: id}
+	} else {
+		o.inner.Filter.Id = id
+	}
+}
+
+// ---
+
+type ListPodSandboxResponse_1 struct {
+	inner *runtimeapi.ListPodSandboxResponse
+}
+
+var _ ListPodSandboxResponse = &ListPodSandboxResponse_1{}
+
+func (o *ListPodSandboxResponse_1) Wrap(v interface{}) {
+	if v == nil {
+		o.inner = &runtimeapi.ListPodSandboxResponse{}
+	} else {
+		o.inner = v.(*runtimeapi.ListPodSandboxResponse)
+	}
+}
+func (o *ListPodSandboxResponse_1) Unwrap() interface{} { return o.inner }
+func (o *ListPodSandboxResponse_1) Items() []CRIObject {
+	var r []CRIObject
+	for _, sandbox := range o.inner.Items {
+		r = append(r, &PodSandbox_1{sandbox})
+	}
+	return r
+}
+func (o *ListPodSandboxResponse_1) SetItems(items []CRIObject) {
+	o.inner.Items = nil
+	for _, wrapped := range items {
+		o.inner.Items = append(o.inner.Items, wrapped.Unwrap().(*runtimeapi.PodSandbox))
+	}
+}
+
+// ---
+
+type StopPodSandboxRequest_1 struct {
+	inner *runtimeapi.StopPodSandboxRequest
+}
+
+var _ StopPodSandboxRequest = &StopPodSandboxRequest_1{}
+
+func (o *StopPodSandboxRequest_1) Wrap(v interface{}) {
+	if v == nil {
+		o.inner = &runtimeapi.StopPodSandboxRequest{}
+	} else {
+		o.inner = v.(*runtimeapi.StopPodSandboxRequest)
+	}
+}
+func (o *StopPodSandboxRequest_1) Unwrap() interface{}       { return o.inner }
+func (o *StopPodSandboxRequest_1) PodSandboxId() string      { return o.inner.PodSandboxId }
+func (o *StopPodSandboxRequest_1) SetPodSandboxId(id string) { o.inner.PodSandboxId = id }
+
+// ---
+
+type StopPodSandboxResponse_1 struct {
+	inner *runtimeapi.StopPodSandboxResponse
+}
+
+var _ StopPodSandboxResponse = &StopPodSandboxResponse_1{}
+
+func (o *StopPodSandboxResponse_1) Wrap(v interface{}) {
+	if v == nil {
+		o.inner = &runtimeapi.StopPodSandboxResponse{}
+	} else {
+		o.inner = v.(*runtimeapi.StopPodSandboxResponse)
+	}
+}
+func (o *StopPodSandboxResponse_1) Unwrap() interface{} { return o.inner }
+
+// ---
+
+type RemovePodSandboxRequest_1 struct {
+	inner *runtimeapi.RemovePodSandboxRequest
+}
+
+var _ RemovePodSandboxRequest = &RemovePodSandboxRequest_1{}
+
+func (o *RemovePodSandboxRequest_1) Wrap(v interface{}) {
+	if v == nil {
+		o.inner = &runtimeapi.RemovePodSandboxRequest{}
+	} else {
+		o.inner = v.(*runtimeapi.RemovePodSandboxRequest)
+	}
+}
+func (o *RemovePodSandboxRequest_1) Unwrap() interface{}       { return o.inner }
+func (o *RemovePodSandboxRequest_1) PodSandboxId() string      { return o.inner.PodSandboxId }
+func (o *RemovePodSandboxRequest_1) SetPodSandboxId(id string) { o.inner.PodSandboxId = id }
+
+// ---
+
+type RemovePodSandboxResponse_1 struct {
+	inner *runtimeapi.RemovePodSandboxResponse
+}
+
+var _ RemovePodSandboxResponse = &RemovePodSandboxResponse_1{}
+
+func (o *RemovePodSandboxResponse_1) Wrap(v interface{}) {
+	if v == nil {
+		o.inner = &runtimeapi.RemovePodSandboxResponse{}
+	} else {
+		o.inner = v.(*runtimeapi.RemovePodSandboxResponse)
+	}
+}
+func (o *RemovePodSandboxResponse_1) Unwrap() interface{} { return o.inner }
+
+// ---
+
+type PodSandboxStatusRequest_1 struct {
+	inner *runtimeapi.PodSandboxStatusRequest
+}
+
+var _ PodSandboxStatusRequest = &PodSandboxStatusRequest_1{}
+
+func (o *PodSandboxStatusRequest_1) Wrap(v interface{}) {
+	if v == nil {
+		o.inner = &runtimeapi.PodSandboxStatusRequest{}
+	} else {
+		o.inner = v.(*runtimeapi.PodSandboxStatusRequest)
+	}
+}
+func (o *PodSandboxStatusRequest_1) Unwrap() interface{}       { return o.inner }
+func (o *PodSandboxStatusRequest_1) PodSandboxId() string      { return o.inner.PodSandboxId }
+func (o *PodSandboxStatusRequest_1) SetPodSandboxId(id string) { o.inner.PodSandboxId = id }
+
+// ---
+
+type PodSandboxStatusResponse_1 struct {
+	inner *runtimeapi.PodSandboxStatusResponse
+}
+
+var _ PodSandboxStatusResponse = &PodSandboxStatusResponse_1{}
+
+func (o *PodSandboxStatusResponse_1) Wrap(v interface{}) {
+	if v == nil {
+		o.inner = &runtimeapi.PodSandboxStatusResponse{}
+	} else {
+		o.inner = v.(*runtimeapi.PodSandboxStatusResponse)
+	}
+}
+func (o *PodSandboxStatusResponse_1) Unwrap() interface{} { return o.inner }
+func (o *PodSandboxStatusResponse_1) Status() PodSandboxStatus {
+	if o.inner.Status == nil {
+		return nil
+	}
+	return &PodSandboxStatus_1{o.inner.Status}
+}
+
+// ---
+
+type CreateContainerRequest_1 struct {
+	inner *runtimeapi.CreateContainerRequest
+}
+
+var _ CreateContainerRequest = &CreateContainerRequest_1{}
+
+func (o *CreateContainerRequest_1) Wrap(v interface{}) {
+	if v == nil {
+		o.inner = &runtimeapi.CreateContainerRequest{}
+	} else {
+		o.inner = v.(*runtimeapi.CreateContainerRequest)
+	}
+}
+func (o *CreateContainerRequest_1) Unwrap() interface{}       { return o.inner }
+func (o *CreateContainerRequest_1) PodSandboxId() string      { return o.inner.PodSandboxId }
+func (o *CreateContainerRequest_1) SetPodSandboxId(id string) { o.inner.PodSandboxId = id }
+func (o *CreateContainerRequest_1) Image() string {
+	if o.inner.Config == nil {
+		return ""
+	}
+	return o.inner.Config.Image.GetImage()
+}
+
+func (o *CreateContainerRequest_1) SetImage(image string) {
+	if o.inner.Config != nil {
+		o.inner.Config.Image = &runtimeapi.ImageSpec{Image: image}
+	}
+}
+
+func (o *CreateContainerRequest_1) PodMetadata() *PodMetadata {
+	return podMetadata_1(o.inner.SandboxConfig.GetMetadata())
+}
+
+// ---
+
+type CreateContainerResponse_1 struct {
+	inner *runtimeapi.CreateContainerResponse
+}
+
+var _ CreateContainerResponse = &CreateContainerResponse_1{}
+
+func (o *CreateContainerResponse_1) Wrap(v interface{}) {
+	if v == nil {
+		o.inner = &runtimeapi.CreateContainerResponse{}
+	} else {
+		o.inner = v.(*runtimeapi.CreateContainerResponse)
+	}
+}
+func (o *CreateContainerResponse_1) Unwrap() interface{}      { return o.inner }
+func (o *CreateContainerResponse_1) ContainerId() string      { return o.inner.ContainerId }
+func (o *CreateContainerResponse_1) SetContainerId(id string) { o.inner.ContainerId = id }
+
+// ---
+
+type ListContainersRequest_1 struct {
+	inner *runtimeapi.ListContainersRequest
+}
+
+var _ ListContainersRequest = &ListContainersRequest_1{}
+
+func (o *ListContainersRequest_1) Wrap(v interface{}) {
+	if v == nil {
+		o.inner = &runtimeapi.ListContainersRequest{}
+	} else {
+		o.inner = v.(*runtimeapi.ListContainersRequest)
+	}
+}
+func (o *ListContainersRequest_1) Unwrap() interface{} { return o.inner }
+func (o *ListContainersRequest_1) IdFilter() string {
+	return o.inner.Filter.GetId()
+}
+
+func (o *ListContainersRequest_1) SetIdFilter(id string) {
+	if o.inner.Filter == nil {
+		o.inner.Filter = &runtimeapi.ContainerFilter{Id: id}
+	} else {
+		o.inner.Filter.Id = id
+	}
+}
+
+func (o *ListContainersRequest_1) PodSandboxIdFilter() string {
+	return o.inner.Filter.GetPodSandboxId()
+}
+
+func (o *ListContainersRequest_1) SetPodSandboxIdFilter(podSandboxId string) {
+	if o.inner.Filter == nil {
+		o.inner.Filter = &runtimeapi.ContainerFilter{Id: podSandboxId}
+	} else {
+		o.inner.Filter.PodSandboxId = podSandboxId
+	}
+}
+
+// ---
+
+type ListContainersResponse_1 struct {
+	inner *runtimeapi.ListContainersResponse
+}
+
+var _ ListContainersResponse = &ListContainersResponse_1{}
+
+func (o *ListContainersResponse_1) Wrap(v interface{}) {
+	if v == nil {
+		o.inner = &runtimeapi.ListContainersResponse{}
+	} else {
+		o.inner = v.(*runtimeapi.ListContainersResponse)
+	}
+}
+func (o *ListContainersResponse_1) Unwrap() interface{} { return o.inner }
+func (o *ListContainersResponse_1) Items() []CRIObject {
+	var r []CRIObject
+	for _, container := range o.inner.Containers {
+		r = append(r, &Container_1{container})
+	}
+	return r
+}
+func (o *ListContainersResponse_1) SetItems(items []CRIObject) {
+	o.inner.Containers = nil
+	for _, wrapped := range items {
+		o.inner.Containers = append(o.inner.Containers, wrapped.Unwrap().(*runtimeapi.Container))
+	}
+}
+
+// ---
+
+type ListContainerStatsRequest_1 struct {
+	inner *runtimeapi.ListContainerStatsRequest
+}
+
+var _ ListContainerStatsRequest = &ListContainerStatsRequest_1{}
+
+func (o *ListContainerStatsRequest_1) Wrap(v interface{}) {
+	if v == nil {
+		o.inner = &runtimeapi.ListContainerStatsRequest{}
+	} else {
+		o.inner = v.(*runtimeapi.ListContainerStatsRequest)
+	}
+}
+func (o *ListContainerStatsRequest_1) Unwrap() interface{} { return o.inner }
+func (o *ListContainerStatsRequest_1) IdFilter() string {
+	return o.inner.Filter.GetId()
+}
+
+func (o *ListContainerStatsRequest_1) SetIdFilter(id string) {
+	if o.inner.Filter == nil {
+		o.inner.Filter = &runtimeapi.ContainerStatsFilter{Id: id}
+	} else {
+		o.inner.Filter.Id = id
+	}
+}
+
+func (o *ListContainerStatsRequest_1) PodSandboxIdFilter() string {
+	return o.inner.Filter.GetPodSandboxId()
+}
+
+func (o *ListContainerStatsRequest_1) SetPodSandboxIdFilter(podSandboxId string) {
+	if o.inner.Filter == nil {
+		o.inner.Filter = &runtimeapi.ContainerStatsFilter{Id: podSandboxId}
+	} else {
+		o.inner.Filter.PodSandboxId = podSandboxId
+	}
+}
+
+// ---
+
+type ListContainerStatsResponse_1 struct {
+	inner *runtimeapi.ListContainerStatsResponse
+}
+
+var _ ListContainerStatsResponse = &ListContainerStatsResponse_1{}
+
+func (o *ListContainerStatsResponse_1) Wrap(v interface{}) {
+	if v == nil {
+		o.inner = &runtimeapi.ListContainerStatsResponse{}
+	} else {
+		o.inner = v.(*runtimeapi.ListContainerStatsResponse)
+	}
+}
+func (o *ListContainerStatsResponse_1) Unwrap() interface{} { return o.inner }
+func (o *ListContainerStatsResponse_1) Items() []CRIObject {
+	var r []CRIObject
+	for _, stats := range o.inner.Stats {
+		r = append(r, &ContainerStats_1{stats})
+	}
+	return r
+}
+func (o *ListContainerStatsResponse_1) SetItems(items []CRIObject) {
+	o.inner.Stats = nil
+	for _, wrapped := range items {
+		o.inner.Stats = append(o.inner.Stats, wrapped.Unwrap().(*runtimeapi.ContainerStats))
+	}
+}
+
+// ---
+
+type StartContainerRequest_1 struct {
+	inner *runtimeapi.StartContainerRequest
+}
+
+var _ StartContainerRequest = &StartContainerRequest_1{}
+
+func (o *StartContainerRequest_1) Wrap(v interface{}) {
+	if v == nil {
+		o.inner = &runtimeapi.StartContainerRequest{}
+	} else {
+		o.inner = v.(*runtimeapi.StartContainerRequest)
+	}
+}
+func (o *StartContainerRequest_1) Unwrap() interface{}      { return o.inner }
+func (o *StartContainerRequest_1) ContainerId() string      { return o.inner.ContainerId }
+func (o *StartContainerRequest_1) SetContainerId(id string) { o.inner.ContainerId = id }
+
+// ---
+
+type StartContainerResponse_1 struct {
+	inner *runtimeapi.StartContainerResponse
+}
+
+var _ StartContainerResponse = &StartContainerResponse_1{}
+
+func (o *StartContainerResponse_1) Wrap(v interface{}) {
+	if v == nil {
+		o.inner = &runtimeapi.StartContainerResponse{}
+	} else {
+		o.inner = v.(*runtimeapi.StartContainerResponse)
+	}
+}
+func (o *StartContainerResponse_1) Unwrap() interface{} { return o.inner }
+
+// ---
+
+type StopContainerRequest_1 struct {
+	inner *runtimeapi.StopContainerRequest
+}
+
+var _ StopContainerRequest = &StopContainerRequest_1{}
+
+func (o *StopContainerRequest_1) Wrap(v interface{}) {
+	if v == nil {
+		o.inner = &runtimeapi.StopContainerRequest{}
+	} else {
+		o.inner = v.(*runtimeapi.StopContainerRequest)
+	}
+}
+func (o *StopContainerRequest_1) Unwrap() interface{}      { return o.inner }
+func (o *StopContainerRequest_1) ContainerId() string      { return o.inner.ContainerId }
+func (o *StopContainerRequest_1) SetContainerId(id string) { o.inner.ContainerId = id }
+
+// ---
+
+type StopContainerResponse_1 struct {
+	inner *runtimeapi.StopContainerResponse
+}
+
+var _ StopContainerResponse = &StopContainerResponse_1{}
+
+func (o *StopContainerResponse_1) Wrap(v interface{}) {
+	if v == nil {
+		o.inner = &runtimeapi.StopContainerResponse{}
+	} else {
+		o.inner = v.(*runtimeapi.StopContainerResponse)
+	}
+}
+func (o *StopContainerResponse_1) Unwrap() interface{} { return o.inner }
+
+// ---
+
+type RemoveContainerRequest_1 struct {
+	inner *runtimeapi.RemoveContainerRequest
+}
+
+var _ RemoveContainerRequest = &RemoveContainerRequest_1{}
+
+func (o *RemoveContainerRequest_1) Wrap(v interface{}) {
+	if v == nil {
+		o.inner = &runtimeapi.RemoveContainerRequest{}
+	} else {
+		o.inner = v.(*runtimeapi.RemoveContainerRequest)
+	}
+}
+func (o *RemoveContainerRequest_1) Unwrap() interface{}      { return o.inner }
+func (o *RemoveContainerRequest_1) ContainerId() string      { return o.inner.ContainerId }
+func (o *RemoveContainerRequest_1) SetContainerId(id string) { o.inner.ContainerId = id }
+
+// ---
+
+type RemoveContainerResponse_1 struct {
+	inner *runtimeapi.RemoveContainerResponse
+}
+
+var _ RemoveContainerResponse = &RemoveContainerResponse_1{}
+
+func (o *RemoveContainerResponse_1) Wrap(v interface{}) {
+	if v == nil {
+		o.inner = &runtimeapi.RemoveContainerResponse{}
+	} else {
+		o.inner = v.(*runtimeapi.RemoveContainerResponse)
+	}
+}
+func (o *RemoveContainerResponse_1) Unwrap() interface{} { return o.inner }
+
+// ---
+
+type ReopenContainerLogRequest_1 struct {
+	inner *runtimeapi.ReopenContainerLogRequest
+}
+
+var _ ReopenContainerLogRequest = &ReopenContainerLogRequest_1{}
+
+func (o *ReopenContainerLogRequest_1) Wrap(v interface{}) {
+	if v == nil {
+		o.inner = &runtimeapi.ReopenContainerLogRequest{}
+	} else {
+		o.inner = v.(*runtimeapi.ReopenContainerLogRequest)
+	}
+}
+func (o *ReopenContainerLogRequest_1) Unwrap() interface{}      { return o.inner }
+func (o *ReopenContainerLogRequest_1) ContainerId() string      { return o.inner.ContainerId }
+func (o *ReopenContainerLogRequest_1) SetContainerId(id string) { o.inner.ContainerId = id }
+
+// ---
+
+type ReopenContainerLogResponse_1 struct {
+	inner *runtimeapi.ReopenContainerLogResponse
+}
+
+var _ ReopenContainerLogResponse = &ReopenContainerLogResponse_1{}
+
+func (o *ReopenContainerLogResponse_1) Wrap(v interface{}) {
+	if v == nil {
+		o.inner = &runtimeapi.ReopenContainerLogResponse{}
+	} else {
+		o.inner = v.(*runtimeapi.ReopenContainerLogResponse)
+	}
+}
+func (o *ReopenContainerLogResponse_1) Unwrap() interface{} { return o.inner }
+
+// ---
+
+type ContainerStatusRequest_1 struct {
+	inner *runtimeapi.ContainerStatusRequest
+}
+
+var _ ContainerStatusRequest = &ContainerStatusRequest_1{}
+
+func (o *ContainerStatusRequest_1) Wrap(v interface{}) {
+	if v == nil {
+		o.inner = &runtimeapi.ContainerStatusRequest{}
+	} else {
+		o.inner = v.(*runtimeapi.ContainerStatusRequest)
+	}
+}
+func (o *ContainerStatusRequest_1) Unwrap() interface{}      { return o.inner }
+func (o *ContainerStatusRequest_1) ContainerId() string      { return o.inner.ContainerId }
+func (o *ContainerStatusRequest_1) SetContainerId(id string) { o.inner.ContainerId = id }
+
+// ---
+
+type ContainerStatusResponse_1 struct {
+	inner *runtimeapi.ContainerStatusResponse
+}
+
+var _ ContainerStatusResponse = &ContainerStatusResponse_1{}
+
+func (o *ContainerStatusResponse_1) Wrap(v interface{}) {
+	if v == nil {
+		o.inner = &runtimeapi.ContainerStatusResponse{}
+	} else {
+		o.inner = v.(*runtimeapi.ContainerStatusResponse)
+	}
+}
+func (o *ContainerStatusResponse_1) Unwrap() interface{} { return o.inner }
+func (o *ContainerStatusResponse_1) Status() ContainerStatus {
+	if o.inner.Status == nil {
+		return nil
+	}
+	return &ContainerStatus_1{o.inner.Status}
+}
+
+// ---
+
+type ContainerStatsRequest_1 struct {
+	inner *runtimeapi.ContainerStatsRequest
+}
+
+var _ ContainerStatsRequest = &ContainerStatsRequest_1{}
+
+func (o *ContainerStatsRequest_1) Wrap(v interface{}) {
+	if v == nil {
+		o.inner = &runtimeapi.ContainerStatsRequest{}
+	} else {
+		o.inner = v.(*runtimeapi.ContainerStatsRequest)
+	}
+}
+func (o *ContainerStatsRequest_1) Unwrap() interface{}      { return o.inner }
+func (o *ContainerStatsRequest_1) ContainerId() string      { return o.inner.ContainerId }
+func (o *ContainerStatsRequest_1) SetContainerId(id string) { o.inner.ContainerId = id }
+
+// ---
+
+type ContainerStatsResponse_1 struct {
+	inner *runtimeapi.ContainerStatsResponse
+}
+
+var _ ContainerStatsResponse = &ContainerStatsResponse_1{}
+
+func (o *ContainerStatsResponse_1) Wrap(v interface{}) {
+	if v == nil {
+		o.inner = &runtimeapi.ContainerStatsResponse{}
+	} else {
+		o.inner = v.(*runtimeapi.ContainerStatsResponse)
+	}
+}
+func (o *ContainerStatsResponse_1) Unwrap() interface{} { return o.inner }
+func (o *ContainerStatsResponse_1) Stats() ContainerStats {
+	if o.inner.Stats == nil {
+		return nil
+	}
+	return &ContainerStats_1{o.inner.Stats}
+}
+
+// ---
+
+type ExecSyncRequest_1 struct {
+	inner *runtimeapi.ExecSyncRequest
+}
+
+var _ ExecSyncRequest = &ExecSyncRequest_1{}
+
+func (o *ExecSyncRequest_1) Wrap(v interface{}) {
+	if v == nil {
+		o.inner = &runtimeapi.ExecSyncRequest{}
+	} else {
+		o.inner = v.(*runtimeapi.ExecSyncRequest)
+	}
+}
+func (o *ExecSyncRequest_1) Unwrap() interface{}      { return o.inner }
+func (o *ExecSyncRequest_1) ContainerId() string      { return o.inner.ContainerId }
+func (o *ExecSyncRequest_1) SetContainerId(id string) { o.inner.ContainerId = id }
+
+// ---
+
+type ExecSyncResponse_1 struct {
+	inner *runtimeapi.ExecSyncResponse
+}
+
+var _ ExecSyncResponse = &ExecSyncResponse_1{}
+
+func (o *ExecSyncResponse_1) Wrap(v interface{}) {
+	if v == nil {
+		o.inner = &runtimeapi.ExecSyncResponse{}
+	} else {
+		o.inner = v.(*runtimeapi.ExecSyncResponse)
+	}
+}
+func (o *ExecSyncResponse_1) Unwrap() interface{} { return o.inner }
+
+// ---
+
+type ExecRequest_1 struct {
+	inner *runtimeapi.ExecRequest
+}
+
+var _ ExecRequest = &ExecRequest_1{}
+
+func (o *ExecRequest_1) Wrap(v interface{}) {
+	if v == nil {
+		o.inner = &runtimeapi.ExecRequest{}
+	} else {
+		o.inner = v.(*runtimeapi.ExecRequest)
+	}
+}
+func (o *ExecRequest_1) Unwrap() interface{}      { return o.inner }
+func (o *ExecRequest_1) ContainerId() string      { return o.inner.ContainerId }
+func (o *ExecRequest_1) SetContainerId(id string) { o.inner.ContainerId = id }
+
+// ---
+
+type ExecResponse_1 struct {
+	inner *runtimeapi.ExecResponse
+}
+
+var _ ExecResponse = &ExecResponse_1{}
+
+func (o *ExecResponse_1) Wrap(v interface{}) {
+	if v == nil {
+		o.inner = &runtimeapi.ExecResponse{}
+	} else {
+		o.inner = v.(*runtimeapi.ExecResponse)
+	}
+}
+func (o *ExecResponse_1) Unwrap() interface{} { return o.inner }
+func (o *ExecResponse_1) Url() string         { return o.inner.Url }
+func (o *ExecResponse_1) SetUrl(url string)   { o.inner.Url = url }
+
+// ---
+
+type AttachRequest_1 struct {
+	inner *runtimeapi.AttachRequest
+}
+
+var _ AttachRequest = &AttachRequest_1{}
+
+func (o *AttachRequest_1) Wrap(v interface{}) {
+	if v == nil {
+		o.inner = &runtimeapi.AttachRequest{}
+	} else {
+		o.inner = v.(*runtimeapi.AttachRequest)
+	}
+}
+func (o *AttachRequest_1) Unwrap() interface{}      { return o.inner }
+func (o *AttachRequest_1) ContainerId() string      { return o.inner.ContainerId }
+func (o *AttachRequest_1) SetContainerId(id string) { o.inner.ContainerId = id }
+
+// ---
+
+type AttachResponse_1 struct {
+	inner *runtimeapi.AttachResponse
+}
+
+var _ AttachResponse = &AttachResponse_1{}
+
+func (o *AttachResponse_1) Wrap(v interface{}) {
+	if v == nil {
+		o.inner = &runtimeapi.AttachResponse{}
+	} else {
+		o.inner = v.(*runtimeapi.AttachResponse)
+	}
+}
+func (o *AttachResponse_1) Unwrap() interface{} { return o.inner }
+func (o *AttachResponse_1) Url() string         { return o.inner.Url }
+func (o *AttachResponse_1) SetUrl(url string)   { o.inner.Url = url }
+
+// ---
+
+type PortForwardRequest_1 struct {
+	inner *runtimeapi.PortForwardRequest
+}
+
+var _ PortForwardRequest = &PortForwardRequest_1{}
+
+func (o *PortForwardRequest_1) Wrap(v interface{}) {
+	if v == nil {
+		o.inner = &runtimeapi.PortForwardRequest{}
+	} else {
+		o.inner = v.(*runtimeapi.PortForwardRequest)
+	}
+}
+func (o *PortForwardRequest_1) Unwrap() interface{}  { return o.inner }
+func (o *PortForwardRequest_1) PodSandboxId() string { return o.inner.PodSandboxId }
+func (o *PortForwardRequest_1) SetPodSandboxId(podSandboxId string) {
+	o.inner.PodSandboxId = podSandboxId
+}
+
+// ---
+
+type PortForwardResponse_1 struct {
+	inner *runtimeapi.PortForwardResponse
+}
+
+var _ PortForwardResponse = &PortForwardResponse_1{}
+
+func (o *PortForwardResponse_1) Wrap(v interface{}) {
+	if v == nil {
+		o.inner = &runtimeapi.PortForwardResponse{}
+	} else {
+		o.inner = v.(*runtimeapi.PortForwardResponse)
+	}
+}
+func (o *PortForwardResponse_1) Unwrap() interface{} { return o.inner }
+func (o *PortForwardResponse_1) Url() string         { return o.inner.Url }
+func (o *PortForwardResponse_1) SetUrl(url string)   { o.inner.Url = url }
+
+// ---
+
+type ListImagesRequest_1 struct {
+	inner *runtimeapi.ListImagesRequest
+}
+
+var _ ListImagesRequest = &ListImagesRequest_1{}
+
+func (o *ListImagesRequest_1) Wrap(v interface{}) {
+	if v == nil {
+		o.inner = &runtimeapi.ListImagesRequest{}
+	} else {
+		o.inner = v.(*runtimeapi.ListImagesRequest)
+	}
+}
+func (o *ListImagesRequest_1) Unwrap() interface{} { return o.inner }
+func (o *ListImagesRequest_1) ImageFilter() string { return o.inner.Filter.GetImage().GetImage() }
+func (o *ListImagesRequest_1) SetImageFilter(image string) {
+	if o.inner.Filter == nil {
+		o.inner.Filter = &runtimeapi.ImageFilter{
+			Image: &runtimeapi.ImageSpec{Image: image},
+		}
+	} else {
+		o.inner.Filter.Image = &runtimeapi.ImageSpec{Image: image}
+	}
+}
+
+// ---
+
+type ListImagesResponse_1 struct {
+	inner *runtimeapi.ListImagesResponse
+}
+
+var _ ListImagesResponse = &ListImagesResponse_1{}
+
+func (o *ListImagesResponse_1) Wrap(v interface{}) {
+	if v == nil {
+		o.inner = &runtimeapi.ListImagesResponse{}
+	} else {
+		o.inner = v.(*runtimeapi.ListImagesResponse)
+	}
+}
+func (o *ListImagesResponse_1) Unwrap() interface{} { return o.inner }
+func (o *ListImagesResponse_1) Items() []CRIObject {
+	var r []CRIObject
+	for _, image := range o.inner.Images {
+		r = append(r, &Image_1{image})
+	}
+	return r
+}
+func (o *ListImagesResponse_1) SetItems(items []CRIObject) {
+	o.inner.Images = nil
+	for _, wrapped := range items {
+		o.inner.Images = append(o.inner.Images, wrapped.Unwrap().(*runtimeapi.Image))
+	}
+}
+
+// ---
+
+type ImageStatusRequest_1 struct {
+	inner *runtimeapi.ImageStatusRequest
+}
+
+var _ ImageStatusRequest = &ImageStatusRequest_1{}
+
+func (o *ImageStatusRequest_1) Wrap(v interface{}) {
+	if v == nil {
+		o.inner = &runtimeapi.ImageStatusRequest{}
+	} else {
+		o.inner = v.(*runtimeapi.ImageStatusRequest)
+	}
+}
+func (o *ImageStatusRequest_1) Unwrap() interface{} { return o.inner }
+func (o *ImageStatusRequest_1) Image() string       { return o.inner.Image.GetImage() }
+func (o *ImageStatusRequest_1) SetImage(image string) {
+	o.inner.Image = &runtimeapi.ImageSpec{Image: image}
+}
+
+// ---
+
+type ImageStatusResponse_1 struct {
+	inner *runtimeapi.ImageStatusResponse
+}
+
+var _ ImageStatusResponse = &ImageStatusResponse_1{}
+
+func (o *ImageStatusResponse_1) Wrap(v interface{}) {
+	if v == nil {
+		o.inner = &runtimeapi.ImageStatusResponse{}
+	} else {
+		o.inner = v.(*runtimeapi.ImageStatusResponse)
+	}
+}
+func (o *ImageStatusResponse_1) Unwrap() interface{} { return o.inner }
+func (o *ImageStatusResponse_1) Image() Image {
+	if o.inner.Image == nil {
+		return nil
+	}
+	return &Image_1{o.inner.Image}
+}
+func (o *ImageStatusResponse_1) SetImage(image Image) {
+	o.inner.Image = image.Unwrap().(*runtimeapi.Image)
+}
+
+// ---
+
+type PullImageRequest_1 struct {
+	inner *runtimeapi.PullImageRequest
+}
+
+var _ PullImageRequest = &PullImageRequest_1{}
+
+func (o *PullImageRequest_1) Wrap(v interface{}) {
+	if v == nil {
+		o.inner = &runtimeapi.PullImageRequest{}
+	} else {
+		o.inner = v.(*runtimeapi.PullImageRequest)
+	}
+}
+func (o *PullImageRequest_1) Unwrap() interface{} { return o.inner }
+func (o *PullImageRequest_1) Image() string       { return o.inner.Image.GetImage() }
+func (o *PullImageRequest_1) SetImage(image string) {
+	o.inner.Image = &runtimeapi.ImageSpec{Image: image}
+}
+func (o *PullImageRequest_1) PodMetadata() *PodMetadata {
+	return podMetadata_1(o.inner.SandboxConfig.GetMetadata())
+}
+
+// ---
+
+type PullImageResponse_1 struct {
+	inner *runtimeapi.PullImageResponse
+}
+
+var _ PullImageResponse = &PullImageResponse_1{}
+
+func (o *PullImageResponse_1) Wrap(v interface{}) {
+	if v == nil {
+		o.inner = &runtimeapi.PullImageResponse{}
+	} else {
+		o.inner = v.(*runtimeapi.PullImageResponse)
+	}
+}
+func (o *PullImageResponse_1) Unwrap() interface{}   { return o.inner }
+func (o *PullImageResponse_1) Image() string         { return o.inner.ImageRef }
+func (o *PullImageResponse_1) SetImage(image string) { o.inner.ImageRef = image }
+
+// ---
+
+type RemoveImageRequest_1 struct {
+	inner *runtimeapi.RemoveImageRequest
+}
+
+var _ RemoveImageRequest = &RemoveImageRequest_1{}
+
+func (o *RemoveImageRequest_1) Wrap(v interface{}) {
+	if v == nil {
+		o.inner = &runtimeapi.RemoveImageRequest{}
+	} else {
+		o.inner = v.(*runtimeapi.RemoveImageRequest)
+	}
+}
+func (o *RemoveImageRequest_1) Unwrap() interface{} { return o.inner }
+func (o *RemoveImageRequest_1) Image() string       { return o.inner.Image.GetImage() }
+func (o *RemoveImageRequest_1) SetImage(image string) {
+	o.inner.Image = &runtimeapi.ImageSpec{Image: image}
+}
+
+// ---
+
+type RemoveImageResponse_1 struct {
+	inner *runtimeapi.RemoveImageResponse
+}
+
+var _ RemoveImageResponse = &RemoveImageResponse_1{}
+
+func (o *RemoveImageResponse_1) Wrap(v interface{}) {
+	if v == nil {
+		o.inner = &runtimeapi.RemoveImageResponse{}
+	} else {
+		o.inner = v.(*runtimeapi.RemoveImageResponse)
+	}
+}
+func (o *RemoveImageResponse_1) Unwrap() interface{} { return o.inner }
+
+// ---
+
+type ImageFsInfoRequest_1 struct {
+	inner *runtimeapi.ImageFsInfoRequest
+}
+
+var _ ImageFsInfoRequest = &ImageFsInfoRequest_1{}
+
+func (o *ImageFsInfoRequest_1) Wrap(v interface{}) {
+	if v == nil {
+		o.inner = &runtimeapi.ImageFsInfoRequest{}
+	} else {
+		o.inner = v.(*runtimeapi.ImageFsInfoRequest)
+	}
+}
+func (o *ImageFsInfoRequest_1) Unwrap() interface{} { return o.inner }
+
+// ---
+
+type ImageFsInfoResponse_1 struct {
+	inner *runtimeapi.ImageFsInfoResponse
+}
+
+var _ ImageFsInfoResponse = &ImageFsInfoResponse_1{}
+
+func (o *ImageFsInfoResponse_1) Wrap(v interface{}) {
+	if v == nil {
+		o.inner = &runtimeapi.ImageFsInfoResponse{}
+	} else {
+		o.inner = v.(*runtimeapi.ImageFsInfoResponse)
+	}
+}
+func (o *ImageFsInfoResponse_1) Unwrap() interface{} { return o.inner }
+func (o *ImageFsInfoResponse_1) Items() []CRIObject {
+	var r []CRIObject
+	for _, fs := range o.inner.ImageFilesystems {
+		r = append(r, &FilesystemUsage_1{fs})
+	}
+	return r
+}
+func (o *ImageFsInfoResponse_1) SetItems(items []CRIObject) {
+	o.inner.ImageFilesystems = nil
+	for _, wrapped := range items {
+		o.inner.ImageFilesystems = append(o.inner.ImageFilesystems, wrapped.Unwrap().(*runtimeapi.FilesystemUsage))
+	}
+}
+
+// --- 1.8+ only ---
+
+type UpdateContainerResourcesRequest_1 struct {
+	inner *runtimeapi.UpdateContainerResourcesRequest
+}
+
+var _ UpdateContainerResourcesRequest = &UpdateContainerResourcesRequest_1{}
+
+func (o *UpdateContainerResourcesRequest_1) Wrap(v interface{}) {
+	if v == nil {
+		o.inner = &runtimeapi.UpdateContainerResourcesRequest{}
+	} else {
+		o.inner = v.(*runtimeapi.UpdateContainerResourcesRequest)
+	}
+}
+func (o *UpdateContainerResourcesRequest_1) Unwrap() interface{}      { return o.inner }
+func (o *UpdateContainerResourcesRequest_1) ContainerId() string      { return o.inner.ContainerId }
+func (o *UpdateContainerResourcesRequest_1) SetContainerId(id string) { o.inner.ContainerId = id }
+
+// --- 1.8+ only ---
+
+type UpdateContainerResourcesResponse_1 struct {
+	inner *runtimeapi.UpdateContainerResourcesResponse
+}
+
+var _ UpdateContainerResourcesResponse = &UpdateContainerResourcesResponse_1{}
+
+func (o *UpdateContainerResourcesResponse_1) Wrap(v interface{}) {
+	if v == nil {
+		o.inner = &runtimeapi.UpdateContainerResourcesResponse{}
+	} else {
+		o.inner = v.(*runtimeapi.UpdateContainerResourcesResponse)
+	}
+}
+func (o *UpdateContainerResourcesResponse_1) Unwrap() interface{} { return o.inner }
+
+// ---
+
+type GetEventsRequest_1 struct {
+	inner *runtimeapi.GetEventsRequest
+}
+
+var _ GetEventsRequest = &GetEventsRequest_1{}
+
+func (o *GetEventsRequest_1) Wrap(v interface{}) {
+	if v == nil {
+		o.inner = &runtimeapi.GetEventsRequest{}
+	} else {
+		o.inner = v.(*runtimeapi.GetEventsRequest)
+	}
+}
+func (o *GetEventsRequest_1) Unwrap() interface{} { return o.inner }
+
+// ---
+
+type ContainerEventResponse_1 struct {
+	inner *runtimeapi.ContainerEventResponse
+}
+
+var _ ContainerEventResponse = &ContainerEventResponse_1{}
+
+func (o *ContainerEventResponse_1) Wrap(v interface{}) {
+	if v == nil {
+		o.inner = &runtimeapi.ContainerEventResponse{}
+	} else {
+		o.inner = v.(*runtimeapi.ContainerEventResponse)
+	}
+}
+func (o *ContainerEventResponse_1) Unwrap() interface{}      { return o.inner }
+func (o *ContainerEventResponse_1) ContainerId() string      { return o.inner.ContainerId }
+func (o *ContainerEventResponse_1) SetContainerId(id string) { o.inner.ContainerId = id }
+func (o *ContainerEventResponse_1) PodSandboxStatus() PodSandboxStatus {
+	if o.inner.PodSandboxStatus == nil {
+		return nil
+	}
+	return &PodSandboxStatus_1{o.inner.PodSandboxStatus}
+}
+func (o *ContainerEventResponse_1) ContainersStatuses() []ContainerStatus {
+	var r []ContainerStatus
+	for _, status := range o.inner.ContainersStatuses {
+		r = append(r, &ContainerStatus_1{status})
+	}
+	return r
+}
+
+// ---
+
+var cri1typeMatcher = newTypeMatcher()
+
+func init() {
+	cri1typeMatcher.registerTypes(
+		&PodSandbox_1{},
+		&Container_1{},
+		&Image_1{},
+		&PodSandboxStatus_1{},
+		&ContainerStatus_1{},
+		&ContainerStats_1{},
+		&FilesystemUsage_1{},
+		&VersionRequest_1{},
+		&VersionResponse_1{},
+		&StatusRequest_1{},
+		&StatusResponse_1{},
+		&UpdateRuntimeConfigRequest_1{},
+		&UpdateRuntimeConfigResponse_1{},
+		&RunPodSandboxRequest_1{},
+		&RunPodSandboxResponse_1{},
+		&ListPodSandboxRequest_1{},
+		&ListPodSandboxResponse_1{},
+		&StopPodSandboxRequest_1{},
+		&StopPodSandboxResponse_1{},
+		&RemovePodSandboxRequest_1{},
+		&RemovePodSandboxResponse_1{},
+		&PodSandboxStatusRequest_1{},
+		&PodSandboxStatusResponse_1{},
+		&CreateContainerRequest_1{},
+		&CreateContainerResponse_1{},
+		&ListContainersRequest_1{},
+		&ListContainersResponse_1{},
+		&ListContainerStatsRequest_1{},
+		&ListContainerStatsResponse_1{},
+		&StartContainerRequest_1{},
+		&StartContainerResponse_1{},
+		&StopContainerRequest_1{},
+		&StopContainerResponse_1{},
+		&RemoveContainerRequest_1{},
+		&RemoveContainerResponse_1{},
+		&ReopenContainerLogRequest_1{},
+		&ReopenContainerLogResponse_1{},
+		&ContainerStatusRequest_1{},
+		&ContainerStatusResponse_1{},
+		&ContainerStatsRequest_1{},
+		&ContainerStatsResponse_1{},
+		&ExecSyncRequest_1{},
+		&ExecSyncResponse_1{},
+		&ExecRequest_1{},
+		&ExecResponse_1{},
+		&AttachRequest_1{},
+		&AttachResponse_1{},
+		&PortForwardRequest_1{},
+		&PortForwardResponse_1{},
+		&ListImagesRequest_1{},
+		&ListImagesResponse_1{},
+		&ImageStatusRequest_1{},
+		&ImageStatusResponse_1{},
+		&PullImageRequest_1{},
+		&PullImageResponse_1{},
+		&RemoveImageRequest_1{},
+		&RemoveImageResponse_1{},
+		&ImageFsInfoRequest_1{},
+		&ImageFsInfoResponse_1{},
+		&UpdateContainerResourcesRequest_1{},
+		&UpdateContainerResourcesResponse_1{},
+		&GetEventsRequest_1{},
+		&ContainerEventResponse_1{},
+	)
+}
+
+func podMetadata_1(m *runtimeapi.PodSandboxMetadata) *PodMetadata {
+	if m == nil {
+		return nil
+	}
+	return &PodMetadata{Name: m.Name, Namespace: m.Namespace, Uid: m.Uid}
+}
+
+// ---
+
+// CRI1 denotes CRI v1 (runtime.v1) used by k8s 1.20 and newer
+type CRI1 struct{}
+
+var _ ContainerEventsCRIVersion = &CRI1{}
+
+func (c *CRI1) Register(server *grpc.Server, rawMethods []string) {
+	runtimeapi.RegisterDummyRuntimeServiceServer(server, rawcodec.MethodDescs(c.ProtoPackage()+".RuntimeService", rawMethods)...)
+	runtimeapi.RegisterDummyImageServiceServer(server, rawcodec.MethodDescs(c.ProtoPackage()+".ImageService", rawMethods)...)
+}
+
+func (c *CRI1) ProbeRequest() (interface{}, interface{}) {
+	return &runtimeapi.VersionRequest{}, &runtimeapi.VersionResponse{}
+}
+
+func (c *CRI1) ImageListRequest() interface{} {
+	return &runtimeapi.ListImagesRequest{}
+}
+
+func (c *CRI1) VerboseStatusRequest() interface{} {
+	return &runtimeapi.StatusRequest{Verbose: true}
+}
+
+func (c *CRI1) ImageStatusRequest(image string) interface{} {
+	return &runtimeapi.ImageStatusRequest{Image: &runtimeapi.ImageSpec{Image: image}}
+}
+
+func (c *CRI1) PullImageRequest(image string) interface{} {
+	return &runtimeapi.PullImageRequest{Image: &runtimeapi.ImageSpec{Image: image}}
+}
+
+func (c *CRI1) WrapObject(o interface{}) (CRIObject, CRIObject, error) {
+	return wrapUsingMatcher(cri1typeMatcher, o)
+}
+
+func (c *CRI1) GetEventsRequest() interface{} {
+	return &runtimeapi.GetEventsRequest{}
+}
+
+func (c *CRI1) ContainerEventResponse() interface{} {
+	return &runtimeapi.ContainerEventResponse{}
+}
+
+func (c *CRI1) ProtoPackage() string { return "runtime.v1" }
+
+func (c *CRI1) BackendVersions() []CRIVersion {
+	return []CRIVersion{c, &CRI112{}}
+}
@@ -19,6 +19,7 @@ package proxy
 import (
 	"google.golang.org/grpc"
 
+	"github.com/elotl/criproxy/pkg/rawcodec"
 	runtimeapi "github.com/elotl/criproxy/pkg/runtimeapis/v1_12"
 )
 
@@ -228,6 +229,7 @@ func (o *StatusRequest_112) Wrap(v interface{}) {
 	}
 }
 func (o *StatusRequest_112) Unwrap() interface{} { return o.inner }
+func (o *StatusRequest_112) Verbose() bool       { return o.inner.Verbose }
 
 // ---
 
@@ -244,7 +246,32 @@ func (o *StatusResponse_112) Wrap(v interface{}) {
 		o.inner = v.(*runtimeapi.StatusResponse)
 	}
 }
-func (o *StatusResponse_112) Unwrap() interface{} { return o.inner }
+func (o *StatusResponse_112) Unwrap() interface{}            { return o.inner }
+func (o *StatusResponse_112) Info() map[string]string        { return o.inner.Info }
+func (o *StatusResponse_112) SetInfo(info map[string]string) { o.inner.Info = info }
+func (o *StatusResponse_112) Conditions() []RuntimeCondition {
+	var r []RuntimeCondition
+	for _, c := range o.inner.Status.GetConditions() {
+		r = append(r, RuntimeCondition{
+			Type:    c.Type,
+			Status:  c.Status,
+			Reason:  c.Reason,
+			Message: c.Message,
+		})
+	}
+	return r
+}
+func (o *StatusResponse_112) SetConditions(conditions []RuntimeCondition) {
+	o.inner.Status = &runtimeapi.RuntimeStatus{}
+	for _, c := range conditions {
+		o.inner.Status.Conditions = append(o.inner.Status.Conditions, &runtimeapi.RuntimeCondition{
+			Type:    c.Type,
+			Status:  c.Status,
+			Reason:  c.Reason,
+			Message: c.Message,
+		})
+	}
+}
 
 // ---
 
@@ -299,6 +326,13 @@ func (o *RunPodSandboxRequest_112) Unwrap() interface{} { return o.inner }
 func (o *RunPodSandboxRequest_112) GetAnnotations() map[string]string {
 	return o.inner.Config.GetAnnotations()
 }
+func (o *RunPodSandboxRequest_112) GetLabels() map[string]string {
+	return o.inner.Config.GetLabels()
+}
+func (o *RunPodSandboxRequest_112) PodMetadata() *PodMetadata {
+	return podMetadata_112(o.inner.Config.GetMetadata())
+}
+func (o *RunPodSandboxRequest_112) RuntimeHandler() string { return o.inner.RuntimeHandler }
 
 // ---
 
@@ -522,6 +556,10 @@ func (o *CreateContainerRequest_112) SetImage(image string) {
 	}
 }
 
+func (o *CreateContainerRequest_112) PodMetadata() *PodMetadata {
+	return podMetadata_112(o.inner.SandboxConfig.GetMetadata())
+}
+
 // ---
 
 type CreateContainerResponse_112 struct {
@@ -1185,6 +1223,9 @@ func (o *PullImageRequest_112) Image() string       { return o.inner.Image.GetIm
 func (o *PullImageRequest_112) SetImage(image string) {
 	o.inner.Image = &runtimeapi.ImageSpec{Image: image}
 }
+func (o *PullImageRequest_112) PodMetadata() *PodMetadata {
+	return podMetadata_112(o.inner.SandboxConfig.GetMetadata())
+}
 
 // ---
 
@@ -1396,22 +1437,51 @@ func init() {
 	)
 }
 
+func podMetadata_112(m *runtimeapi.PodSandboxMetadata) *PodMetadata {
+	if m == nil {
+		return nil
+	}
+	return &PodMetadata{Name: m.Name, Namespace: m.Namespace, Uid: m.Uid}
+}
+
+// ---
+
 // CRI112 denotes the CRI version 1.10
 type CRI112 struct{}
 
 var _ CRIVersion = &CRI112{}
 
-func (c *CRI112) Register(server *grpc.Server) {
-	runtimeapi.RegisterDummyRuntimeServiceServer(server)
-	runtimeapi.RegisterDummyImageServiceServer(server)
+func (c *CRI112) Register(server *grpc.Server, rawMethods []string) {
+	runtimeapi.RegisterDummyRuntimeServiceServer(server, rawcodec.MethodDescs(c.ProtoPackage()+".RuntimeService", rawMethods)...)
+	runtimeapi.RegisterDummyImageServiceServer(server, rawcodec.MethodDescs(c.ProtoPackage()+".ImageService", rawMethods)...)
 }
 
 func (c *CRI112) ProbeRequest() (interface{}, interface{}) {
 	return &runtimeapi.VersionRequest{}, &runtimeapi.VersionResponse{}
 }
 
+func (c *CRI112) ImageListRequest() interface{} {
+	return &runtimeapi.ListImagesRequest{}
+}
+
+func (c *CRI112) VerboseStatusRequest() interface{} {
+	return &runtimeapi.StatusRequest{Verbose: true}
+}
+
+func (c *CRI112) ImageStatusRequest(image string) interface{} {
+	return &runtimeapi.ImageStatusRequest{Image: &runtimeapi.ImageSpec{Image: image}}
+}
+
+func (c *CRI112) PullImageRequest(image string) interface{} {
+	return &runtimeapi.PullImageRequest{Image: &runtimeapi.ImageSpec{Image: image}}
+}
+
 func (c *CRI112) WrapObject(o interface{}) (CRIObject, CRIObject, error) {
 	return wrapUsingMatcher(cri112typeMatcher, o)
 }
 
 func (c *CRI112) ProtoPackage() string { return "runtime.v1alpha2" }
+
+func (c *CRI112) BackendVersions() []CRIVersion {
+	return []CRIVersion{c, &CRI1{}}
+}
@@ -19,6 +19,7 @@ package proxy
 import (
 	"google.golang.org/grpc"
 
+	"github.com/elotl/criproxy/pkg/rawcodec"
 	runtimeapi "github.com/elotl/criproxy/pkg/runtimeapis/v1_9"
 )
 
@@ -225,6 +226,7 @@ func (o *StatusRequest_19) Wrap(v interface{}) {
 	}
 }
 func (o *StatusRequest_19) Unwrap() interface{} { return o.inner }
+func (o *StatusRequest_19) Verbose() bool       { return o.inner.Verbose }
 
 // ---
 
@@ -241,7 +243,32 @@ func (o *StatusResponse_19) Wrap(v interface{}) {
 		o.inner = v.(*runtimeapi.StatusResponse)
 	}
 }
-func (o *StatusResponse_19) Unwrap() interface{} { return o.inner }
+func (o *StatusResponse_19) Unwrap() interface{}            { return o.inner }
+func (o *StatusResponse_19) Info() map[string]string        { return o.inner.Info }
+func (o *StatusResponse_19) SetInfo(info map[string]string) { o.inner.Info = info }
+func (o *StatusResponse_19) Conditions() []RuntimeCondition {
+	var r []RuntimeCondition
+	for _, c := range o.inner.Status.GetConditions() {
+		r = append(r, RuntimeCondition{
+			Type:    c.Type,
+			Status:  c.Status,
+			Reason:  c.Reason,
+			Message: c.Message,
+		})
+	}
+	return r
+}
+func (o *StatusResponse_19) SetConditions(conditions []RuntimeCondition) {
+	o.inner.Status = &runtimeapi.RuntimeStatus{}
+	for _, c := range conditions {
+		o.inner.Status.Conditions = append(o.inner.Status.Conditions, &runtimeapi.RuntimeCondition{
+			Type:    c.Type,
+			Status:  c.Status,
+			Reason:  c.Reason,
+			Message: c.Message,
+		})
+	}
+}
 
 // ---
 
@@ -296,6 +323,16 @@ func (o *RunPodSandboxRequest_19) Unwrap() interface{} { return o.inner }
 func (o *RunPodSandboxRequest_19) GetAnnotations() map[string]string {
 	return o.inner.Config.GetAnnotations()
 }
+func (o *RunPodSandboxRequest_19) GetLabels() map[string]string {
+	return o.inner.Config.GetLabels()
+}
+func (o *RunPodSandboxRequest_19) PodMetadata() *PodMetadata {
+	return podMetadata_19(o.inner.Config.GetMetadata())
+}
+
+// RuntimeHandler always returns an empty string because CRI 1.9
+// doesn't support runtime handlers.
+func (o *RunPodSandboxRequest_19) RuntimeHandler() string { return "" }
 
 // ---
 
@@ -519,6 +556,10 @@ func (o *CreateContainerRequest_19) SetImage(image string) {
 	}
 }
 
+func (o *CreateContainerRequest_19) PodMetadata() *PodMetadata {
+	return podMetadata_19(o.inner.SandboxConfig.GetMetadata())
+}
+
 // ---
 
 type CreateContainerResponse_19 struct {
@@ -1156,6 +1197,9 @@ func (o *PullImageRequest_19) Image() string       { return o.inner.Image.GetIma
 func (o *PullImageRequest_19) SetImage(image string) {
 	o.inner.Image = &runtimeapi.ImageSpec{Image: image}
 }
+func (o *PullImageRequest_19) PodMetadata() *PodMetadata {
+	return podMetadata_19(o.inner.SandboxConfig.GetMetadata())
+}
 
 // ---
 
@@ -1365,26 +1409,51 @@ func init() {
 	)
 }
 
+func podMetadata_19(m *runtimeapi.PodSandboxMetadata) *PodMetadata {
+	if m == nil {
+		return nil
+	}
+	return &PodMetadata{Name: m.Name, Namespace: m.Namespace, Uid: m.Uid}
+}
+
+// ---
+
 // CRI19 denotes CRI version 1.9 that's compatible with k8s 1.7, 1.8 and 1.9.
 type CRI19 struct{}
 
 var _ CRIVersion = &CRI19{}
 
-func (c *CRI19) Register(server *grpc.Server) {
-	runtimeapi.RegisterDummyRuntimeServiceServer(server)
-	runtimeapi.RegisterDummyImageServiceServer(server)
+func (c *CRI19) Register(server *grpc.Server, rawMethods []string) {
+	runtimeapi.RegisterDummyRuntimeServiceServer(server, rawcodec.MethodDescs(c.ProtoPackage()+".RuntimeService", rawMethods)...)
+	runtimeapi.RegisterDummyImageServiceServer(server, rawcodec.MethodDescs(c.ProtoPackage()+".ImageService", rawMethods)...)
 }
 
 func (c *CRI19) ProbeRequest() (interface{}, interface{}) {
 	return &runtimeapi.VersionRequest{}, &runtimeapi.VersionResponse{}
 }
 
+func (c *CRI19) ImageListRequest() interface{} {
+	return &runtimeapi.ListImagesRequest{}
+}
+
+func (c *CRI19) VerboseStatusRequest() interface{} {
+	return &runtimeapi.StatusRequest{Verbose: true}
+}
+
+func (c *CRI19) ImageStatusRequest(image string) interface{} {
+	return &runtimeapi.ImageStatusRequest{Image: &runtimeapi.ImageSpec{Image: image}}
+}
+
+func (c *CRI19) PullImageRequest(image string) interface{} {
+	return &runtimeapi.PullImageRequest{Image: &runtimeapi.ImageSpec{Image: image}}
+}
+
 func (c *CRI19) WrapObject(o interface{}) (CRIObject, CRIObject, error) {
 	return wrapUsingMatcher(cri19typeMatcher, o)
 }
 
 func (c *CRI19) ProtoPackage() string { return "runtime" }
 
-func (c *CRI19) UpgradesTo() CRIVersion {
-	return &CRI112{}
+func (c *CRI19) BackendVersions() []CRIVersion {
+	return []CRIVersion{&CRI112{}, c, &CRI1{}}
 }
@@ -77,6 +77,20 @@ type ImageObject interface {
 	SetImage(string)
 }
 
+// PodMetadata is the metadata of a pod sandbox.
+type PodMetadata struct {
+	Name      string `json:"name"`
+	Namespace string `json:"namespace"`
+	Uid       string `json:"uid"`
+}
+
+// PodMetadataObject is a wrapped CRI object that contains pod sandbox metadata.
+type PodMetadataObject interface {
+	// PodMetadata returns the pod sandbox metadata of the object,
+	// or nil if it's not set.
+	PodMetadata() *PodMetadata
+}
+
 // IdFilterObject is a wrapped CRI object that denotes a filter that uses an id.
 type IdFilterObject interface {
 	// IdFilter returns the id used by the filter.
@@ -184,11 +198,31 @@ type VersionResponse interface {
 // StatusRequest wraps a CRI StatusRequest object
 type StatusRequest interface {
 	CRIObject
+	// Verbose returns true if extra information about
+	// the runtime is requested.
+	Verbose() bool
+}
+
+// RuntimeCondition is a CRI RuntimeCondition that's
+// independent of CRI version.
+type RuntimeCondition struct {
+	Type    string `json:"type"`
+	Status  bool   `json:"status"`
+	Reason  string `json:"reason,omitempty"`
+	Message string `json:"message,omitempty"`
 }
 
 // StatusResponse wraps a CRI StatusResponse object
 type StatusResponse interface {
 	CRIObject
+	// Conditions returns the runtime conditions.
+	Conditions() []RuntimeCondition
+	// SetConditions sets the runtime conditions.
+	SetConditions([]RuntimeCondition)
+	// Info returns the extra information about the runtime.
+	Info() map[string]string
+	// SetInfo sets the extra information about the runtime.
+	SetInfo(map[string]string)
 }
 
 // UpdateRuntimeConfigRequest wraps a CRI UpdateRuntimeConfigRequest object
@@ -204,7 +238,13 @@ type UpdateRuntimeConfigResponse interface {
 // RunPodSandboxRequest wraps a CRI RunPodSandboxRequest object
 type RunPodSandboxRequest interface {
 	CRIObject
+	PodMetadataObject
 	GetAnnotations() map[string]string
+	GetLabels() map[string]string
+	// RuntimeHandler returns the runtime handler requested for the
+	// pod sandbox via RuntimeClass, or an empty string if no handler
+	// is specified or the CRI version doesn't support it.
+	RuntimeHandler() string
 }
 
 // RunPodSandboxResponse wraps a CRI RunPodSandboxResponse object
@@ -264,6 +304,7 @@ type CreateContainerRequest interface {
 	CRIObject
 	PodSandboxIdObject
 	ImageObject
+	PodMetadataObject
 }
 
 // CreateContainerResponse wraps a CRI CreateContainerResponse object
@@ -354,6 +395,19 @@ type ContainerStatusResponse interface {
 	Status() ContainerStatus
 }
 
+// GetEventsRequest wraps a CRI GetEventsRequest object
+type GetEventsRequest interface {
+	CRIObject
+}
+
+// ContainerEventResponse wraps a CRI ContainerEventResponse object
+type ContainerEventResponse interface {
+	CRIObject
+	ContainerIdObject
+	PodSandboxStatus() PodSandboxStatus
+	ContainersStatuses() []ContainerStatus
+}
+
 // ContainerStatsRequest wraps a CRI ContainerStatsRequest object
 type ContainerStatsRequest interface {
 	CRIObject
@@ -453,6 +507,7 @@ type ImageStatusResponse interface {
 type PullImageRequest interface {
 	CRIObject
 	ImageObject
+	PodMetadataObject
 }
 
 // PullImageResponse wraps a CRI PullImageResponse object
@@ -486,25 +541,48 @@ type ImageFsInfoResponse interface {
 // CRI version denotes a version of CRI.
 type CRIVersion interface {
 	// Register registers the CRI version with a gRPC Server.
-	Register(*grpc.Server)
+	// rawMethods lists the methods in Service/Method form that
+	// don't have typed wrappers and are passed through as raw
+	// protobuf data.
+	Register(server *grpc.Server, rawMethods []string)
 	// ProbeRequest returns raw CRI request and response objects
 	// that can be used to check the server availability and
 	// compatibility with this CRI version.
 	ProbeRequest() (interface{}, interface{})
+	// ImageListRequest returns raw CRI request object that
+	// lists all of the images.
+	ImageListRequest() interface{}
+	// VerboseStatusRequest returns raw CRI StatusRequest object
+	// that requests extra information about the runtime.
+	VerboseStatusRequest() interface{}
+	// ImageStatusRequest returns raw CRI ImageStatusRequest
+	// object for the image.
+	ImageStatusRequest(image string) interface{}
+	// PullImageRequest returns raw CRI PullImageRequest object
+	// for the image.
+	PullImageRequest(image string) interface{}
 	// WrapObject wraps a raw CRI object and returns the wrapped
 	// source object, and, in case if the object is a Request,
 	// also an empty Response object that matches it
 	WrapObject(interface{}) (CRIObject, CRIObject, error)
 	// ProtoPackage returns proto package used by the CRI version.
 	ProtoPackage() string
+	// BackendVersions returns the CRI versions that can be used
+	// to talk to the runtimes on behalf of the clients of this
+	// CRI version, in the order of preference. If the runtime
+	// uses another CRI version, the objects are converted.
+	BackendVersions() []CRIVersion
 }
 
-// UpgradableCRIVersion is a CRI version that supports upgrading of
-// the objects for a newer CRI version.
-type UpgradableCRIVersion interface {
+// ContainerEventsCRIVersion is a CRI version that supports
+// GetContainerEvents streaming method.
+type ContainerEventsCRIVersion interface {
 	CRIVersion
-	// UpgradesTo returns a CRI version this one upgrades to.
-	UpgradesTo() CRIVersion
+	// GetEventsRequest returns raw CRI GetEventsRequest object.
+	GetEventsRequest() interface{}
+	// ContainerEventResponse returns an empty raw CRI
+	// ContainerEventResponse object.
+	ContainerEventResponse() interface{}
 }
 
 func wrapUsingMatcher(tm *typeMatcher, o interface{}) (CRIObject, CRIObject, error) {
@@ -0,0 +1,228 @@
+/*
+Copyright 2018 Mirantis
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package proxy
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/golang/glog"
+	"github.com/golang/protobuf/proto"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+)
+
+const (
+	// BackendIdTrailerKey is the key of gRPC trailer metadata
+	// that holds the ids of the runtimes that returned the error
+	// (empty for the primary runtime).
+	BackendIdTrailerKey = "criproxy-backend-id"
+	// BackendSocketTrailerKey is the key of gRPC trailer
+	// metadata that holds the sockets of the runtimes that
+	// returned the error.
+	BackendSocketTrailerKey = "criproxy-backend-socket"
+	// statusDetailsTrailerKey is the key of gRPC trailer metadata
+	// that holds google.rpc.Status with the details of the error.
+	statusDetailsTrailerKey = "grpc-status-details-bin"
+	// ErrorInfoDomain is the domain of google.rpc.ErrorInfo
+	// details that identify the runtimes that returned the error.
+	// The metadata of ErrorInfo contains runtimeId and socket keys.
+	ErrorInfoDomain = "criproxy"
+	// ErrorInfoReason is the reason of google.rpc.ErrorInfo
+	// details that identify the runtimes that returned the error.
+	ErrorInfoReason  = "RUNTIME_ERROR"
+	errorInfoTypeUrl = "type.googleapis.com/google.rpc.ErrorInfo"
+)
+
+// BackendError is an error returned by a runtime. It keeps the
+// gRPC status code of the original error, so kubelet can tell
+// e.g. a container that's not found from other failures.
+type BackendError struct {
+	// ID is the runtime id (empty for the primary runtime).
+	ID string
+	// Socket is the path to the runtime's socket.
+	Socket string
+	// Code is the gRPC status code of the error.
+	Code codes.Code
+	// Desc is the error description returned by the runtime.
+	Desc string
+	// Details is google.rpc.Status with the error details returned
+	// by the runtime in the trailer metadata, if any.
+	Details []byte
+}
+
+func newBackendError(id, socket string, err error) *BackendError {
+	if be, ok := err.(*BackendError); ok {
+		return be
+	}
+	return &BackendError{
+		ID:     id,
+		Socket: socket,
+		Code:   grpc.Code(err),
+		Desc:   grpc.ErrorDesc(err),
+	}
+}
+
+// statusDetails returns the error details returned by the runtime
+// followed by ErrorInfo that identifies the runtime.
+func (e *BackendError) statusDetails() []*anyMessage {
+	var st rpcStatus
+	if len(e.Details) != 0 {
+		if err := proto.Unmarshal(e.Details, &st); err != nil {
+			glog.Warningf("Failed to parse the error details returned by runtime %q: %v", e.ID, err)
+		}
+	}
+	info, err := proto.Marshal(&errorInfo{
+		Reason: ErrorInfoReason,
+		Domain: ErrorInfoDomain,
+		Metadata: map[string]string{
+			"runtimeId": e.ID,
+			"socket":    e.Socket,
+		},
+	})
+	if err != nil {
+		glog.Warningf("Failed to marshal ErrorInfo: %v", err)
+		return st.Details
+	}
+	return append(st.Details, &anyMessage{TypeUrl: errorInfoTypeUrl, Value: info})
+}
+
+func (e *BackendError) Error() string {
+	return fmt.Sprintf("runtime %q (%s): %s", e.ID, e.Socket, e.Desc)
+}
+
+// MultiBackendError is returned by the methods that are passed to
+// several runtimes when one or more of the runtimes fail.
+type MultiBackendError struct {
+	Errors []*BackendError
+}
+
+func (e *MultiBackendError) Error() string {
+	var msgs []string
+	for _, be := range e.Errors {
+		msgs = append(msgs, be.Error())
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// Code returns the status code of the errors if it's the same for
+// all of them, or codes.Unknown otherwise.
+func (e *MultiBackendError) Code() codes.Code {
+	if len(e.Errors) == 0 {
+		return codes.Unknown
+	}
+	code := e.Errors[0].Code
+	for _, be := range e.Errors[1:] {
+		if be.Code != code {
+			return codes.Unknown
+		}
+	}
+	return code
+}
+
+// add adds an error returned by client's handleError() to the list.
+func (e *MultiBackendError) add(c client, err error) {
+	e.Errors = append(e.Errors, newBackendError(c.getID(), c.status().Socket, err))
+}
+
+// errorOrNil returns nil if there are no errors and e otherwise.
+func (e *MultiBackendError) errorOrNil() error {
+	if len(e.Errors) == 0 {
+		return nil
+	}
+	return e
+}
+
+// errorCode returns the gRPC status code of the error.
+func errorCode(err error) codes.Code {
+	switch e := err.(type) {
+	case *BackendError:
+		return e.Code
+	case *MultiBackendError:
+		return e.Code()
+	default:
+		return grpc.Code(err)
+	}
+}
+
+// grpcError converts an error returned by a method handler to
+// the error that's returned to the proxy's client. The status codes
+// and details of the runtimes' errors are preserved, and the runtimes
+// are identified using ErrorInfo details as well as trailer metadata.
+func grpcError(ctx context.Context, err error) error {
+	var errs []*BackendError
+	switch e := err.(type) {
+	case *BackendError:
+		errs = []*BackendError{e}
+	case *MultiBackendError:
+		errs = e.Errors
+	default:
+		return err
+	}
+	md := metadata.MD{}
+	st := &rpcStatus{Code: int32(errorCode(err)), Message: err.Error()}
+	for _, be := range errs {
+		md[BackendIdTrailerKey] = append(md[BackendIdTrailerKey], be.ID)
+		md[BackendSocketTrailerKey] = append(md[BackendSocketTrailerKey], be.Socket)
+		st.Details = append(st.Details, be.statusDetails()...)
+	}
+	if details, err := proto.Marshal(st); err != nil {
+		glog.Warningf("Failed to marshal the error details: %v", err)
+	} else {
+		// Pairs() takes care of the base64 encoding of binary metadata
+		md = metadata.Join(md, metadata.Pairs(statusDetailsTrailerKey, string(details)))
+	}
+	// this fails if the context doesn't belong to
+	// a gRPC server call, which doesn't matter here
+	grpc.SetTrailer(ctx, md)
+	return grpc.Errorf(errorCode(err), "%s", err.Error())
+}
+
+// rpcStatus mirrors google.rpc.Status, which is used for gRPC error
+// details, as the gRPC version in use doesn't provide it.
+type rpcStatus struct {
+	Code    int32         `protobuf:"varint,1,opt,name=code,proto3"`
+	Message string        `protobuf:"bytes,2,opt,name=message,proto3"`
+	Details []*anyMessage `protobuf:"bytes,3,rep,name=details"`
+}
+
+func (m *rpcStatus) Reset()         { *m = rpcStatus{} }
+func (m *rpcStatus) String() string { return proto.CompactTextString(m) }
+func (*rpcStatus) ProtoMessage()    {}
+
+// anyMessage mirrors google.protobuf.Any.
+type anyMessage struct {
+	TypeUrl string `protobuf:"bytes,1,opt,name=type_url,json=typeUrl,proto3"`
+	Value   []byte `protobuf:"bytes,2,opt,name=value,proto3"`
+}
+
+func (m *anyMessage) Reset()         { *m = anyMessage{} }
+func (m *anyMessage) String() string { return proto.CompactTextString(m) }
+func (*anyMessage) ProtoMessage()    {}
+
+// errorInfo mirrors google.rpc.ErrorInfo.
+type errorInfo struct {
+	Reason   string            `protobuf:"bytes,1,opt,name=reason,proto3"`
+	Domain   string            `protobuf:"bytes,2,opt,name=domain,proto3"`
+	Metadata map[string]string `protobuf:"bytes,3,rep,name=metadata" protobuf_key:"bytes,1,opt,name=key,proto3" protobuf_val:"bytes,2,opt,name=value,proto3"`
+}
+
+func (m *errorInfo) Reset()         { *m = errorInfo{} }
+func (m *errorInfo) String() string { return proto.CompactTextString(m) }
+func (*errorInfo) ProtoMessage()    {}
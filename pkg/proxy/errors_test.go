@@ -0,0 +1,45 @@
+/*
+Copyright 2018 Mirantis
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package proxy
+
+import (
+	"testing"
+
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+)
+
+func TestMultiBackendError(t *testing.T) {
+	err := &MultiBackendError{
+		Errors: []*BackendError{
+			{Socket: "/run/a.sock", Code: codes.NotFound, Desc: "image not found"},
+			{ID: "alt", Socket: "/run/b.sock", Code: codes.NotFound, Desc: "no such image"},
+		},
+	}
+	expectedMsg := `runtime "" (/run/a.sock): image not found; runtime "alt" (/run/b.sock): no such image`
+	if msg := err.Error(); msg != expectedMsg {
+		t.Errorf("bad error message %q instead of %q", msg, expectedMsg)
+	}
+	if code := grpc.Code(grpcError(context.Background(), err)); code != codes.NotFound {
+		t.Errorf("bad code %v instead of NotFound", code)
+	}
+	err.Errors[1].Code = codes.Unavailable
+	if code := grpc.Code(grpcError(context.Background(), err)); code != codes.Unknown {
+		t.Errorf("bad code for different runtime error codes: %v instead of Unknown", code)
+	}
+}
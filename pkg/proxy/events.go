@@ -0,0 +1,146 @@
+/*
+Copyright 2018 Mirantis
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package proxy
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/golang/glog"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+)
+
+// eventStreamRetryInterval is the interval between the attempts
+// to (re)start the event streams of the runtimes.
+var eventStreamRetryInterval = 5 * time.Second
+
+type streamMethodHandler func(r *RuntimeProxy, ss grpc.ServerStream, method string, logLevel glog.Level) error
+
+type streamDispatchItem struct {
+	handler  streamMethodHandler
+	logLevel glog.Level
+}
+
+var streamDispatchTable = map[string]streamDispatchItem{
+	"RuntimeService/GetContainerEvents": {(*RuntimeProxy).getContainerEvents, criNoisyLogLevel},
+}
+
+// getContainerEvents merges the container event streams of all of
+// the runtimes into one stream. The streams of the runtimes that
+// aren't available or fail are (re)started periodically without
+// interrupting the merged stream.
+func (r *RuntimeProxy) getContainerEvents(ss grpc.ServerStream, method string, logLevel glog.Level) error {
+	criVersion, ok := r.criVersion.(ContainerEventsCRIVersion)
+	if !ok {
+		return grpc.Errorf(codes.Unimplemented, "%s is not supported by CRI version %q", method, r.criVersion.ProtoPackage())
+	}
+	req, _, err := r.criVersion.WrapObject(criVersion.GetEventsRequest())
+	if err != nil {
+		return err
+	}
+	if err := ss.RecvMsg(req.Unwrap()); err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithCancel(ss.Context())
+	defer cancel()
+	events := make(chan CRIObject)
+	done := make(chan client)
+	running := make(map[client]bool)
+	startStreams := func() {
+		for _, c := range r.clients(ctx).clients {
+			// the events of the runtimes the caller isn't
+			// allowed to use are skipped
+			if running[c] || !runtimeAllowed(ctx, c.getID()) {
+				continue
+			}
+			running[c] = true
+			go func(c client) {
+				err := r.forwardContainerEvents(ctx, c, method, req, events)
+				switch {
+				case ctx.Err() != nil:
+					// the merged stream is closed
+				case err == errNotConnected:
+				case grpc.Code(err) == codes.Unimplemented:
+					glog.V(logLevel).Infof("%s: runtime %q doesn't support container events: %v", method, c.getID(), err)
+				default:
+					glog.Warningf("%s: event stream of runtime %q failed: %v", method, c.getID(), c.handleError(err, false))
+				}
+				select {
+				case done <- c:
+				case <-ctx.Done():
+				}
+			}(c)
+		}
+	}
+
+	ticker := time.NewTicker(eventStreamRetryInterval)
+	defer ticker.Stop()
+	startStreams()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-r.stopCtx.Done():
+			return grpc.Errorf(codes.Unavailable, "CRI proxy is shutting down")
+		case event := <-events:
+			if glog.V(logLevel) {
+				glog.Info(r.clients(ctx).logger.format("EVENT", method, event.Unwrap()))
+			}
+			if err := ss.SendMsg(event.Unwrap()); err != nil {
+				return err
+			}
+		case c := <-done:
+			delete(running, c)
+		case <-ticker.C:
+			startStreams()
+		}
+	}
+}
+
+// forwardContainerEvents passes the container events from the
+// runtime to the events channel, prefixing the ids in them, until
+// the runtime's stream fails or ctx is cancelled.
+func (r *RuntimeProxy) forwardContainerEvents(ctx context.Context, c client, method string, req CRIObject, events chan<- CRIObject) error {
+	if c.currentState() != clientStateConnected {
+		// This does nothing if the state is clientStateConnecting,
+		// otherwise it tries to connect asynchronously
+		c.connect()
+		return errNotConnected
+	}
+	stream, err := c.openStream(ctx, method, req)
+	if err != nil {
+		return err
+	}
+	criVersion := r.criVersion.(ContainerEventsCRIVersion)
+	for {
+		event, _, err := r.criVersion.WrapObject(criVersion.ContainerEventResponse())
+		if err != nil {
+			return fmt.Errorf("can't wrap container event: %v", err)
+		}
+		if err := stream.RecvMsg(event.Unwrap()); err != nil {
+			return err
+		}
+		select {
+		case events <- c.addPrefix(event):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
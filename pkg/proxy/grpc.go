@@ -17,13 +17,25 @@ limitations under the License.
 package proxy
 
 import (
+	"crypto/tls"
 	"fmt"
+	"io/ioutil"
 	"net"
 	"os"
+	"os/user"
+	"path"
+	"path/filepath"
+	"strconv"
+	"sync"
 	"syscall"
 
+	"github.com/golang/glog"
 	"golang.org/x/net/context"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+
+	"github.com/elotl/criproxy/pkg/rawcodec"
+	"github.com/elotl/criproxy/pkg/utils"
 )
 
 // Interceptor specifies an interceptor to be used by gRPC server.
@@ -34,29 +46,69 @@ type Interceptor interface {
 	Match(fullMethod string) bool
 	// Intercept handles a CRI request. It's invoked from a gRPC interceptor.
 	Intercept(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error)
+	// InterceptStream handles a streaming CRI request. It's invoked from a gRPC stream interceptor.
+	InterceptStream(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error
 	// Stop disconnects from all the CRI servers
 	Stop()
 }
 
-// Server denotes a gRPC server.
+// Server denotes a gRPC server that accepts CRI requests on
+// one or more listeners.
 type Server struct {
-	server       *grpc.Server
+	sync.Mutex
 	interceptors []Interceptor
+	hook         func()
+	servers      []*grpc.Server
+	stopped      bool
 }
 
 // NewServer makes a new gRPC server.
 func NewServer(interceptors []Interceptor, hook func()) *Server {
-	s := &Server{interceptors: interceptors}
-	s.server = grpc.NewServer(grpc.UnaryInterceptor(func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (resp interface{}, err error) {
-		if hook != nil {
-			hook()
+	return &Server{interceptors: interceptors, hook: hook}
+}
+
+// newGRPCServer makes a gRPC server for a listener that only
+// accepts the methods matching the patterns (all of the methods
+// if patterns is nil).
+func (s *Server) newGRPCServer(patterns []string) *grpc.Server {
+	checkMethod := func(fullMethod string) error {
+		if patterns == nil || methodMatchesAny(patterns, metricMethodName(fullMethod)) {
+			return nil
+		}
+		return grpc.Errorf(codes.PermissionDenied, "criproxy: method %s is not allowed on this endpoint", fullMethod)
+	}
+	// rawcodec.Codec is needed for the methods
+	// that are passed through as raw protobuf data
+	server := grpc.NewServer(grpc.CustomCodec(rawcodec.Codec{}), grpc.UnaryInterceptor(func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (resp interface{}, err error) {
+		if s.hook != nil {
+			s.hook()
+		}
+		if err := checkMethod(info.FullMethod); err != nil {
+			return nil, err
 		}
 		return s.intercept(ctx, req, info, handler)
+	}), grpc.StreamInterceptor(func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		if s.hook != nil {
+			s.hook()
+		}
+		if err := checkMethod(info.FullMethod); err != nil {
+			return err
+		}
+		return s.interceptStream(srv, ss, info, handler)
 	}))
 	for _, intc := range s.interceptors {
-		intc.Register(s.server)
+		intc.Register(server)
 	}
-	return s
+	return server
+}
+
+func methodMatchesAny(patterns []string, method string) bool {
+	for _, pattern := range patterns {
+		if matched, _ := path.Match(pattern, method); matched {
+			return true
+		}
+	}
+	return false
 }
 
 func (s *Server) intercept(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
@@ -68,22 +120,180 @@ func (s *Server) intercept(ctx context.Context, req interface{}, info *grpc.Unar
 	return nil, fmt.Errorf("no interceptor for method %q", info.FullMethod)
 }
 
-// Serve makes the server listen on the specified addr. If readyCh is
-// not nil, it'll be closed when the server is ready to accept
-// connections.
-func (s *Server) Serve(addr string, readyCh chan struct{}) error {
-	if err := syscall.Unlink(addr); err != nil && !os.IsNotExist(err) {
-		return err
+func (s *Server) interceptStream(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	for _, intc := range s.interceptors {
+		if intc.Match(info.FullMethod) {
+			return intc.InterceptStream(srv, ss, info, handler)
+		}
 	}
-	ln, err := net.Listen("unix", addr)
+	return fmt.Errorf("no interceptor for method %q", info.FullMethod)
+}
+
+// listen starts listening on the listener's address, setting the
+// permissions of the unix domain socket or enabling TLS. For unix
+// domain sockets, the credentials of the callers are made available
+// to the interceptors via PeerCredentialsFromContext().
+func listen(lc ListenerConfig) (net.Listener, error) {
+	scheme, addr, err := utils.ParseEndpoint(lc.Address)
+	if err != nil {
+		return nil, err
+	}
+	if scheme == utils.EndpointSchemeTLS {
+		tlsConfig, err := lc.TLS.serverConfig()
+		if err != nil {
+			return nil, err
+		}
+		ln, err := net.Listen("tcp", addr)
+		if err != nil {
+			return nil, err
+		}
+		return tls.NewListener(ln, tlsConfig), nil
+	}
+
+	ln, err := listenUnix(addr, lc)
+	if err != nil {
+		return nil, err
+	}
+	return &peerCredListener{ln}, nil
+}
+
+// listenUnix creates the unix domain socket in a private temporary
+// directory next to the socket path, sets its permissions and then
+// renames it to the socket path, replacing the old socket if any.
+// This way, the socket can't be connected to before its permissions
+// are set.
+func listenUnix(addr string, lc ListenerConfig) (net.Listener, error) {
+	dir, err := ioutil.TempDir(filepath.Dir(addr), ".criproxy-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+	// keep the temporary path short as the length of
+	// unix domain socket paths is limited
+	tmpPath := filepath.Join(dir, "s")
+	ln, err := net.ListenUnix("unix", &net.UnixAddr{Name: tmpPath, Net: "unix"})
+	if err != nil {
+		return nil, err
+	}
+	// the socket is removed under its final path upon Close()
+	ln.SetUnlinkOnClose(false)
+	if err := setSocketPermissions(tmpPath, lc); err != nil {
+		ln.Close()
+		return nil, err
+	}
+	if err := os.Rename(tmpPath, addr); err != nil {
+		ln.Close()
+		return nil, err
+	}
+	return &unlinkingListener{Listener: ln, path: addr}, nil
+}
+
+// unlinkingListener removes the unix domain socket when it's closed.
+// As with net.UnixListener, the socket is only removed upon the first
+// Close(), so that a new socket with the same path isn't removed.
+type unlinkingListener struct {
+	net.Listener
+	path       string
+	unlinkOnce sync.Once
+}
+
+func (l *unlinkingListener) Close() error {
+	err := l.Listener.Close()
+	l.unlinkOnce.Do(func() {
+		if err := syscall.Unlink(l.path); err != nil && !os.IsNotExist(err) {
+			glog.Warningf("Failed to remove the socket %q: %v", l.path, err)
+		}
+	})
+	return err
+}
+
+func setSocketPermissions(path string, lc ListenerConfig) error {
+	mode, err := lc.fileMode()
 	if err != nil {
 		return err
 	}
-	defer ln.Close()
+	if mode != 0 {
+		if err := os.Chmod(path, mode); err != nil {
+			return err
+		}
+	}
+	if lc.Group == "" {
+		return nil
+	}
+	gid, err := strconv.Atoi(lc.Group)
+	if err != nil {
+		g, err := user.LookupGroup(lc.Group)
+		if err != nil {
+			return err
+		}
+		if gid, err = strconv.Atoi(g.Gid); err != nil {
+			return fmt.Errorf("bad gid %q of group %q", g.Gid, lc.Group)
+		}
+	}
+	return os.Chown(path, -1, gid)
+}
+
+// Serve makes the server listen on the specified unix domain
+// socket. If readyCh is not nil, it'll be closed when the server
+// is ready to accept connections.
+func (s *Server) Serve(addr string, readyCh chan struct{}) error {
+	return s.ServeListeners([]ListenerConfig{{Address: addr}}, readyCh)
+}
+
+// ServeListeners makes the server listen on the specified
+// listeners. If readyCh is not nil, it'll be closed when the
+// server is ready to accept connections on all of them. It
+// returns when the server is stopped or any of the listeners
+// fails, in which case it stops serving on the other listeners
+// before returning.
+func (s *Server) ServeListeners(listeners []ListenerConfig, readyCh chan struct{}) error {
+	var lns []net.Listener
+	for _, lc := range listeners {
+		ln, err := listen(lc)
+		if err != nil {
+			for _, ln := range lns {
+				ln.Close()
+			}
+			return fmt.Errorf("can't listen on %q: %v", lc.Address, err)
+		}
+		lns = append(lns, ln)
+	}
+
+	var servers []*grpc.Server
+	for _, lc := range listeners {
+		servers = append(servers, s.newGRPCServer(lc.methodPatterns()))
+	}
+	s.Lock()
+	if s.stopped {
+		s.Unlock()
+		for _, ln := range lns {
+			ln.Close()
+		}
+		return grpc.ErrServerStopped
+	}
+	s.servers = append(s.servers, servers...)
+	s.Unlock()
+
 	if readyCh != nil {
 		close(readyCh)
 	}
-	return s.server.Serve(ln)
+	errCh := make(chan error, len(lns))
+	for n, ln := range lns {
+		go func(server *grpc.Server, ln net.Listener) {
+			defer ln.Close()
+			errCh <- server.Serve(ln)
+		}(servers[n], ln)
+	}
+	var firstErr error
+	for range lns {
+		if err := <-errCh; err != nil && firstErr == nil {
+			firstErr = err
+			for _, server := range servers {
+				server.Stop()
+			}
+		}
+	}
+	return firstErr
 }
 
 // Stop stops the server.
@@ -91,5 +301,11 @@ func (s *Server) Stop() {
 	for _, intc := range s.interceptors {
 		intc.Stop()
 	}
-	s.server.GracefulStop()
+	s.Lock()
+	s.stopped = true
+	servers := s.servers
+	s.Unlock()
+	for _, server := range servers {
+		server.GracefulStop()
+	}
 }
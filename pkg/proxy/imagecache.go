@@ -0,0 +1,219 @@
+/*
+Copyright 2018 Mirantis
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package proxy
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/golang/glog"
+)
+
+// imageCacheData is the contents of the image cache file.
+type imageCacheData struct {
+	Images map[string]string `json:"images"`
+}
+
+// imageCache maps image ids to image names. The secondary runtimes
+// don't know the ids of the images assigned by the primary one, so
+// the proxy uses the cache to replace image ids with the image names
+// in CreateContainer requests. If the cache has a path, it's loaded
+// from the file when it's created and is saved to the file upon each
+// change, so it survives proxy restarts.
+type imageCache struct {
+	sync.Mutex
+	path   string
+	images map[string]string
+	// generation is incremented upon each change of the cache
+	// except for the changes made by update()
+	generation int
+	// rebuildOnce makes sure the cache is only rebuilt once
+	// even if it's shared by several proxies
+	rebuildOnce sync.Once
+}
+
+var (
+	imageCachesLock sync.Mutex
+	imageCaches     = make(map[string]*imageCache)
+)
+
+// getImageCache returns the image cache stored in the file at the
+// specified path, loading it if necessary. The proxies for different
+// CRI versions that use the same file share the cache. If path is
+// empty, a new cache that's only kept in memory is returned.
+func getImageCache(path string) *imageCache {
+	if path == "" {
+		return newImageCache("")
+	}
+	imageCachesLock.Lock()
+	defer imageCachesLock.Unlock()
+	if c, found := imageCaches[path]; found {
+		return c
+	}
+	c := newImageCache(path)
+	c.load()
+	imageCaches[path] = c
+	return c
+}
+
+func newImageCache(path string) *imageCache {
+	return &imageCache{
+		path:   path,
+		images: make(map[string]string),
+	}
+}
+
+func (c *imageCache) load() {
+	c.Lock()
+	defer c.Unlock()
+	data, err := ioutil.ReadFile(c.path)
+	switch {
+	case os.IsNotExist(err):
+		return
+	case err != nil:
+		glog.Warningf("Can't read image cache file %q: %v", c.path, err)
+		return
+	}
+	var cacheData imageCacheData
+	if err := json.Unmarshal(data, &cacheData); err != nil {
+		glog.Warningf("Can't parse image cache file %q: %v", c.path, err)
+		return
+	}
+	if cacheData.Images != nil {
+		c.images = cacheData.Images
+	}
+	glog.V(1).Infof("Loaded %d entries from image cache file %q", len(c.images), c.path)
+}
+
+func (c *imageCache) saveNonLocked() {
+	if c.path == "" {
+		return
+	}
+	data, err := json.Marshal(imageCacheData{Images: c.images})
+	if err != nil {
+		glog.Errorf("Can't marshal image cache: %v", err)
+		return
+	}
+	if err := os.MkdirAll(filepath.Dir(c.path), 0755); err != nil {
+		glog.Warningf("Can't create the directory for image cache file %q: %v", c.path, err)
+		return
+	}
+	// write to a temporary file first so the cache
+	// doesn't get corrupted if the proxy is killed
+	tmpPath := c.path + ".tmp"
+	if err := ioutil.WriteFile(tmpPath, data, 0644); err != nil {
+		glog.Warningf("Can't write image cache file %q: %v", tmpPath, err)
+		return
+	}
+	if err := os.Rename(tmpPath, c.path); err != nil {
+		glog.Warningf("Can't rename %q to %q: %v", tmpPath, c.path, err)
+	}
+}
+
+func (c *imageCache) get(imageId string) string {
+	c.Lock()
+	defer c.Unlock()
+	return c.images[imageId]
+}
+
+func (c *imageCache) set(imageId, imageName string, overwrite bool) {
+	c.Lock()
+	defer c.Unlock()
+	oldName, found := c.images[imageId]
+	if (found && !overwrite) || oldName == imageName {
+		return
+	}
+	c.images[imageId] = imageName
+	c.generation++
+	c.saveNonLocked()
+}
+
+// remove removes the entry for the image, which is specified either
+// by its id or by its name.
+func (c *imageCache) remove(image string) {
+	c.Lock()
+	defer c.Unlock()
+	changed := false
+	for id, name := range c.images {
+		if id == image || name == image {
+			delete(c.images, id)
+			changed = true
+		}
+	}
+	if changed {
+		c.generation++
+		c.saveNonLocked()
+	}
+}
+
+// startRebuild runs rebuild in the background unless the cache
+// rebuild was already started by another proxy sharing the cache.
+func (c *imageCache) startRebuild(rebuild func()) {
+	c.rebuildOnce.Do(func() {
+		go rebuild()
+	})
+}
+
+func (c *imageCache) currentGeneration() int {
+	c.Lock()
+	defer c.Unlock()
+	return c.generation
+}
+
+// update adds the entries for the images that aren't in the cache
+// yet. If complete is true, the images map is expected to contain
+// all of the images that exist in the runtimes, so the other entries
+// are removed from the cache. generation must be the generation of
+// the cache obtained before the images were listed. If the cache
+// was changed since then, the images map may be stale, so update
+// does nothing and returns false.
+func (c *imageCache) update(images map[string]string, complete bool, generation int) bool {
+	c.Lock()
+	defer c.Unlock()
+	if c.generation != generation {
+		return false
+	}
+	changed := false
+	for id, name := range images {
+		if _, found := c.images[id]; !found {
+			c.images[id] = name
+			changed = true
+		}
+	}
+	if complete {
+		for id := range c.images {
+			if _, found := images[id]; !found {
+				glog.V(2).Infof("Removing stale image cache entry %q -> %q", id, c.images[id])
+				delete(c.images, id)
+				changed = true
+			}
+		}
+	}
+	if changed {
+		c.saveNonLocked()
+	}
+	return true
+}
+
+func (c *imageCache) size() int {
+	c.Lock()
+	defer c.Unlock()
+	return len(c.images)
+}
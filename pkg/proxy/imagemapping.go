@@ -0,0 +1,99 @@
+/*
+Copyright 2018 Mirantis
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package proxy
+
+import (
+	"strings"
+)
+
+// imagePattern is an image name pattern with an optional
+// wildcard, split around the wildcard.
+type imagePattern struct {
+	prefix, suffix string
+	wildcard       bool
+}
+
+func parseImagePattern(pattern string) imagePattern {
+	p := strings.Index(pattern, "*")
+	if p < 0 {
+		return imagePattern{prefix: pattern}
+	}
+	return imagePattern{prefix: pattern[:p], suffix: pattern[p+1:], wildcard: true}
+}
+
+// match returns the part of the name matched by the wildcard
+// and true if the name matches the pattern.
+func (p imagePattern) match(name string) (string, bool) {
+	switch {
+	case !p.wildcard:
+		return "", name == p.prefix
+	case len(name) < len(p.prefix)+len(p.suffix):
+		return "", false
+	case !strings.HasPrefix(name, p.prefix) || !strings.HasSuffix(name, p.suffix):
+		return "", false
+	default:
+		return name[len(p.prefix) : len(name)-len(p.suffix)], true
+	}
+}
+
+// expand returns the name that matches the pattern with the
+// wildcard replaced by the specified string.
+func (p imagePattern) expand(wildcardPart string) string {
+	if !p.wildcard {
+		return p.prefix
+	}
+	return p.prefix + wildcardPart + p.suffix
+}
+
+// imageMapping maps the image names used by the clients
+// to the image names of a runtime and back.
+type imageMapping struct {
+	image, runtimeImage imagePattern
+}
+
+// newImageMappings makes the image mappings for the config,
+// which must be already validated.
+func newImageMappings(config []ImageMapping) []imageMapping {
+	var r []imageMapping
+	for _, m := range config {
+		r = append(r, imageMapping{
+			image:        parseImagePattern(m.Image),
+			runtimeImage: parseImagePattern(m.RuntimeImage),
+		})
+	}
+	return r
+}
+
+// toRuntime returns the runtime's name of the image
+// and true if the name matches the mapping.
+func (m imageMapping) toRuntime(name string) (string, bool) {
+	part, ok := m.image.match(name)
+	if !ok {
+		return "", false
+	}
+	return m.runtimeImage.expand(part), true
+}
+
+// fromRuntime returns the name of the runtime's image that's
+// used by the clients and true if the name matches the mapping.
+func (m imageMapping) fromRuntime(runtimeName string) (string, bool) {
+	part, ok := m.runtimeImage.match(runtimeName)
+	if !ok {
+		return "", false
+	}
+	return m.image.expand(part), true
+}
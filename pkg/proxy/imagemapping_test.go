@@ -0,0 +1,155 @@
+/*
+Copyright 2018 Mirantis
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package proxy
+
+import (
+	"testing"
+)
+
+func TestImagePattern(t *testing.T) {
+	for _, tc := range []struct {
+		pattern, name string
+		matches       bool
+		wildcardPart  string
+	}{
+		{
+			pattern: "cirros",
+			name:    "cirros",
+			matches: true,
+		},
+		{
+			pattern: "cirros",
+			name:    "cirros:latest",
+		},
+		{
+			pattern:      "registry.example.com/*",
+			name:         "registry.example.com/cirros:0.4@sha256:0123",
+			matches:      true,
+			wildcardPart: "cirros:0.4@sha256:0123",
+		},
+		{
+			pattern: "registry.example.com/*",
+			name:    "registry.example.org/cirros",
+		},
+		{
+			pattern: "registry.example.com/*",
+			name:    "registry.example.com",
+		},
+		{
+			pattern:      "*:vm",
+			name:         "cirros:vm",
+			matches:      true,
+			wildcardPart: "cirros",
+		},
+		{
+			pattern:      "vms/*:latest",
+			name:         "vms/:latest",
+			matches:      true,
+			wildcardPart: "",
+		},
+		{
+			// the prefix and the suffix must not overlap
+			pattern: "a*a",
+			name:    "a",
+		},
+		{
+			pattern:      "*",
+			name:         "cirros",
+			matches:      true,
+			wildcardPart: "cirros",
+		},
+	} {
+		t.Run(tc.pattern+" "+tc.name, func(t *testing.T) {
+			p := parseImagePattern(tc.pattern)
+			part, matches := p.match(tc.name)
+			switch {
+			case matches != tc.matches:
+				t.Errorf("match(): %v instead of %v", matches, tc.matches)
+			case !matches:
+				// ok
+			case part != tc.wildcardPart:
+				t.Errorf("bad wildcard part %q instead of %q", part, tc.wildcardPart)
+			case p.expand(part) != tc.name:
+				t.Errorf("expand(%q) = %q instead of %q", part, p.expand(part), tc.name)
+			}
+		})
+	}
+}
+
+func TestImageMapping(t *testing.T) {
+	for _, tc := range []struct {
+		name                string
+		mapping             ImageMapping
+		image, runtimeImage string
+	}{
+		{
+			name:         "registry removed",
+			mapping:      ImageMapping{Image: "registry.vms.example.com/*", RuntimeImage: "*"},
+			image:        "registry.vms.example.com/cirros:0.4",
+			runtimeImage: "cirros:0.4",
+		},
+		{
+			name:         "registry replaced",
+			mapping:      ImageMapping{Image: "registry.vms.example.com/*", RuntimeImage: "image-service/*"},
+			image:        "registry.vms.example.com/cirros",
+			runtimeImage: "image-service/cirros",
+		},
+		{
+			name:         "suffix",
+			mapping:      ImageMapping{Image: "*:vm", RuntimeImage: "vms/*"},
+			image:        "cirros:vm",
+			runtimeImage: "vms/cirros",
+		},
+		{
+			name:         "no wildcard",
+			mapping:      ImageMapping{Image: "example.com/cirros", RuntimeImage: "cirros"},
+			image:        "example.com/cirros",
+			runtimeImage: "cirros",
+		},
+		{
+			name:         "name passed as is",
+			mapping:      ImageMapping{Image: "registry.vms.example.com/*"},
+			image:        "registry.vms.example.com/cirros",
+			runtimeImage: "registry.vms.example.com/cirros",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			config := Config{
+				Backends: []BackendConfig{
+					{Socket: "/run/a.sock"},
+					{ID: "alt", Socket: "/run/b.sock", Images: []ImageMapping{tc.mapping}},
+				},
+			}
+			config.SetDefaults()
+			if err := config.Validate(); err != nil {
+				t.Fatalf("Validate(): %v", err)
+			}
+			m := newImageMappings(config.Backends[1].Images)[0]
+			runtimeImage, ok := m.toRuntime(tc.image)
+			if !ok || runtimeImage != tc.runtimeImage {
+				t.Errorf("toRuntime(%q) = %q, %v instead of %q, true", tc.image, runtimeImage, ok, tc.runtimeImage)
+			}
+			image, ok := m.fromRuntime(runtimeImage)
+			if !ok || image != tc.image {
+				t.Errorf("fromRuntime(%q) = %q, %v instead of %q, true", runtimeImage, image, ok, tc.image)
+			}
+			if _, ok := m.toRuntime("other.example.com/cirros"); ok {
+				t.Errorf("toRuntime() matched an image that doesn't match the mapping")
+			}
+		})
+	}
+}
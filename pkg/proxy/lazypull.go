@@ -0,0 +1,87 @@
+/*
+Copyright 2018 Mirantis
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package proxy
+
+import (
+	"sync"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+)
+
+// lazyPullRequestTTL is the time the PullImage requests are kept
+// for the lazy pulls. kubelet creates the container right after
+// pulling its image, so it doesn't need to be long.
+const lazyPullRequestTTL = time.Minute
+
+// lazyPullRequests keeps the PullImage requests received by the
+// proxy for the images that aren't pulled for the runtimes with
+// the lazy image policy, so the registry credentials and the pod
+// sandbox config from them can be used when CreateContainer pulls
+// the image for such a runtime. As the requests hold the
+// credentials, they're only kept in memory for a short time and
+// are never logged.
+type lazyPullRequests struct {
+	sync.Mutex
+	ttl      time.Duration
+	requests map[string]lazyPullRequest
+}
+
+type lazyPullRequest struct {
+	req     proto.Message
+	expires time.Time
+}
+
+func newLazyPullRequests(ttl time.Duration) *lazyPullRequests {
+	return &lazyPullRequests{
+		ttl:      ttl,
+		requests: make(map[string]lazyPullRequest),
+	}
+}
+
+// put keeps a copy of the raw CRI PullImage request for the image,
+// replacing the previous one, if any, and dropping the expired ones.
+func (l *lazyPullRequests) put(image string, req proto.Message) {
+	l.Lock()
+	defer l.Unlock()
+	now := time.Now()
+	for name, r := range l.requests {
+		if now.After(r.expires) {
+			delete(l.requests, name)
+		}
+	}
+	l.requests[image] = lazyPullRequest{
+		req:     proto.Clone(req),
+		expires: now.Add(l.ttl),
+	}
+}
+
+// get returns a copy of the raw CRI PullImage request for the
+// image, or nil if there's none or it has expired.
+func (l *lazyPullRequests) get(image string) proto.Message {
+	l.Lock()
+	defer l.Unlock()
+	r, found := l.requests[image]
+	switch {
+	case !found:
+		return nil
+	case time.Now().After(r.expires):
+		delete(l.requests, image)
+		return nil
+	}
+	return proto.Clone(r.req)
+}
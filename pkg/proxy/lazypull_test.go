@@ -0,0 +1,60 @@
+/*
+Copyright 2018 Mirantis
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package proxy
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	runtimeapi "github.com/elotl/criproxy/pkg/runtimeapis/v1_9"
+)
+
+func TestLazyPullRequests(t *testing.T) {
+	req := &runtimeapi.PullImageRequest{
+		Image: &runtimeapi.ImageSpec{Image: "alt/image1"},
+		Auth:  &runtimeapi.AuthConfig{Username: "user", Password: "secret"},
+	}
+	l := newLazyPullRequests(time.Minute)
+	l.put("alt/image1", req)
+	req.Auth.Password = "changed"
+	expected := &runtimeapi.PullImageRequest{
+		Image: &runtimeapi.ImageSpec{Image: "alt/image1"},
+		Auth:  &runtimeapi.AuthConfig{Username: "user", Password: "secret"},
+	}
+	r := l.get("alt/image1")
+	if !reflect.DeepEqual(r, expected) {
+		t.Errorf("bad request %#v instead of %#v", r, expected)
+	}
+	// the callers get copies of the request
+	r.(*runtimeapi.PullImageRequest).Auth = nil
+	if r := l.get("alt/image1"); !reflect.DeepEqual(r, expected) {
+		t.Errorf("the kept request was changed: %#v", r)
+	}
+	if r := l.get("alt/image2"); r != nil {
+		t.Errorf("unexpected request for an unknown image: %#v", r)
+	}
+
+	l = newLazyPullRequests(-time.Second)
+	l.put("alt/image1", req)
+	if r := l.get("alt/image1"); r != nil {
+		t.Errorf("unexpected expired request: %#v", r)
+	}
+	if len(l.requests) != 0 {
+		t.Errorf("the expired request wasn't removed")
+	}
+}
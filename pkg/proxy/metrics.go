@@ -0,0 +1,141 @@
+/*
+Copyright 2018 Mirantis
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package proxy
+
+import (
+	"strings"
+	"time"
+
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+
+	"github.com/elotl/criproxy/pkg/metrics"
+)
+
+var (
+	requestCount = metrics.NewCounterVec(
+		"criproxy_requests_total",
+		"Number of CRI requests handled by the proxy.",
+		"method", "code")
+	requestDuration = metrics.NewHistogramVec(
+		"criproxy_request_duration_seconds",
+		"Latency of CRI requests handled by the proxy.",
+		nil, "method")
+	backendRequestCount = metrics.NewCounterVec(
+		"criproxy_backend_requests_total",
+		"Number of CRI requests passed to the runtimes.",
+		"backend", "method", "code")
+	backendRequestDuration = metrics.NewHistogramVec(
+		"criproxy_backend_request_duration_seconds",
+		"Latency of CRI requests passed to the runtimes.",
+		nil, "backend", "method")
+	backendReconnectCount = metrics.NewCounterVec(
+		"criproxy_backend_reconnects_total",
+		"Number of times the proxy had to reconnect to the runtime after losing the connection.",
+		"backend", "socket")
+	backendListFailureCount = metrics.NewCounterVec(
+		"criproxy_backend_list_failures_total",
+		"Number of List* requests for which the items of the runtime were left out because of an error or a timeout.",
+		"backend", "method")
+	runtimeConfigReplayCount = metrics.NewCounterVec(
+		"criproxy_backend_runtime_config_replays_total",
+		"Number of times the last runtime config was passed to the runtime after connecting to it.",
+		"backend", "code")
+	authorizationDenialCount = metrics.NewCounterVec(
+		"criproxy_authorization_denials_total",
+		"Number of CRI requests denied by the authorization rules.",
+		"method")
+)
+
+var clientStateNames = map[clientState]string{
+	clientStateOffline:    "offline",
+	clientStateConnecting: "connecting",
+	clientStateConnected:  "connected",
+}
+
+func (s clientState) String() string {
+	if name, found := clientStateNames[s]; found {
+		return name
+	}
+	return "unknown"
+}
+
+// metricMethodName returns the method name without the proto
+// package, e.g. RuntimeService/Version, so the same method of
+// different CRI versions is counted together.
+func metricMethodName(fullMethod string) string {
+	fullMethod = strings.TrimPrefix(fullMethod, "/")
+	if p := strings.Index(fullMethod, "/"); p >= 0 {
+		if lastDot := strings.LastIndex(fullMethod[:p], "."); lastDot >= 0 {
+			return fullMethod[lastDot+1:]
+		}
+	}
+	return fullMethod
+}
+
+func observeRequest(fullMethod string, start time.Time, err error) {
+	method := metricMethodName(fullMethod)
+	requestCount.Inc(method, grpc.Code(err).String())
+	requestDuration.Observe(time.Since(start).Seconds(), method)
+}
+
+func observeBackendRequest(id, fullMethod string, start time.Time, err error) {
+	method := metricMethodName(fullMethod)
+	backendRequestCount.Inc(id, method, grpc.Code(err).String())
+	backendRequestDuration.Observe(time.Since(start).Seconds(), id, method)
+}
+
+// RegisterMetrics registers the metrics of the specified proxies
+// within the registry.
+func RegisterMetrics(registry *metrics.Registry, proxies []*RuntimeProxy) {
+	registry.Register(
+		requestCount,
+		requestDuration,
+		backendRequestCount,
+		backendRequestDuration,
+		backendReconnectCount,
+		backendListFailureCount,
+		runtimeConfigReplayCount,
+		authorizationDenialCount,
+		metrics.NewGaugeFunc(
+			"criproxy_backend_state",
+			"State of the connection to the runtime (1 for the current state, 0 otherwise).",
+			func(set func(value float64, labelValues ...string)) {
+				for _, r := range proxies {
+					cri := r.criVersion.ProtoPackage()
+					cs := r.clients(context.Background())
+					for n, c := range cs.clients {
+						state := c.currentState()
+						for s, name := range clientStateNames {
+							v := 0.
+							if s == state {
+								v = 1
+							}
+							set(v, c.getID(), cs.backends[n].Socket, cri, name)
+						}
+					}
+				}
+			}, "backend", "socket", "cri", "state"),
+		metrics.NewGaugeFunc(
+			"criproxy_image_cache_size",
+			"Number of entries in the image id to image name cache.",
+			func(set func(value float64, labelValues ...string)) {
+				for _, r := range proxies {
+					set(float64(r.imageCacheSize()), r.criVersion.ProtoPackage())
+				}
+			}, "cri"))
+}
@@ -0,0 +1,72 @@
+/*
+Copyright 2018 Mirantis
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package proxy
+
+import (
+	"golang.org/x/net/context"
+)
+
+// BackendRequest is a request that's passed to a runtime.
+type BackendRequest struct {
+	// Method is the full name of the CRI method using the proto
+	// package of the proxy's CRI version, e.g.
+	// /runtime.RuntimeService/CreateContainer. If the runtime
+	// uses another CRI version, the request is converted after
+	// passing through the middleware.
+	Method string
+	// RuntimeID is the id of the runtime the request is passed
+	// to (empty for the primary runtime).
+	RuntimeID string
+	// Request is the wrapped request. Its Unwrap() method returns
+	// the raw CRI object of the proxy's CRI version. The runtime
+	// prefixes are already removed from the ids in the request.
+	// If the request is passed to several runtimes, e.g. ListPodSandbox,
+	// each runtime gets its own copy, so it can be modified for the
+	// specific runtime.
+	Request CRIObject
+	// Response is the wrapped response that's filled in by the
+	// runtime. The runtime prefixes are added to the ids in the
+	// response after it passes through the middleware.
+	Response CRIObject
+}
+
+// Invoker passes a request to the runtime, filling in the response.
+type Invoker func(ctx context.Context, req *BackendRequest) error
+
+// Middleware is called for each request that's passed to a runtime,
+// except for the streaming ones. It can modify the request before
+// calling next, short-circuit the request by returning without
+// calling next, filling in the response or returning an error, and
+// post-process the response after next returns. The errors returned
+// by the middleware are passed to the proxy's clients as-is, so they
+// should be gRPC errors with the appropriate status codes. The
+// middleware is called concurrently for different requests and
+// for the runtimes that are queried in parallel.
+type Middleware func(ctx context.Context, req *BackendRequest, next Invoker) error
+
+// chainMiddleware returns the invoker that passes the request
+// through the middleware, the first one being the outermost,
+// and then to invoke.
+func chainMiddleware(middleware []Middleware, invoke Invoker) Invoker {
+	for n := len(middleware) - 1; n >= 0; n-- {
+		mw, next := middleware[n], invoke
+		invoke = func(ctx context.Context, req *BackendRequest) error {
+			return mw(ctx, req, next)
+		}
+	}
+	return invoke
+}
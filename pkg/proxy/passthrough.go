@@ -0,0 +1,178 @@
+/*
+Copyright 2018 Mirantis
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package proxy
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/golang/glog"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+
+	"github.com/elotl/criproxy/pkg/rawcodec"
+)
+
+// rawObject wraps a message of a method that has no typed wrappers.
+// Such messages are passed to the runtimes as raw protobuf data
+// without any conversion.
+type rawObject struct {
+	inner *rawcodec.Message
+}
+
+var _ CRIObject = &rawObject{}
+
+func (o *rawObject) Wrap(v interface{}) {
+	if v == nil {
+		o.inner = &rawcodec.Message{}
+	} else {
+		o.inner = v.(*rawcodec.Message)
+	}
+}
+
+func (o *rawObject) Unwrap() interface{} { return o.inner }
+
+func wrapRawObject(m *rawcodec.Message) (CRIObject, CRIObject) {
+	req, resp := &rawObject{}, &rawObject{}
+	req.Wrap(m)
+	resp.Wrap(nil)
+	return req, resp
+}
+
+var methodPolicyHandlers = map[string]methodHandler{
+	MethodPolicyPrimary: (*RuntimeProxy).passToPrimary,
+	MethodPolicyAll:     (*RuntimeProxy).passToAll,
+	MethodPolicyReject:  (*RuntimeProxy).rejectMethod,
+}
+
+// podSandboxIdMethods lists the methods that have no typed wrappers
+// but accept a pod sandbox id as the field 1 of their requests.
+// With the primary policy, such requests are passed to the runtime
+// that owns the pod sandbox. The values are the paths of the pod
+// sandbox ids in the responses, which are prefixed with the runtime
+// id, or nil if the responses contain no ids.
+var podSandboxIdMethods = map[string][]int{
+	// PodSandboxStatsResponse.stats.attributes.id
+	"RuntimeService/PodSandboxStats":           {1, 1, 1},
+	"RuntimeService/UpdatePodSandboxResources": nil,
+}
+
+// rawDispatchItem returns the dispatch item for a method that's
+// passed through as raw protobuf data. The methods that were
+// removed from the config after the proxy was started are passed
+// to the primary runtime.
+func (cs *clientSet) rawDispatchItem(method string) dispatchItem {
+	policy, found := cs.methodPolicies[method]
+	if !found {
+		policy = MethodPolicyPrimary
+	}
+	if _, found := podSandboxIdMethods[method]; found && policy == MethodPolicyPrimary {
+		return dispatchItem{(*RuntimeProxy).passToPodSandboxOwner, criRequestLogLevel}
+	}
+	return dispatchItem{methodPolicyHandlers[policy], criRequestLogLevel}
+}
+
+// rawMethodNames returns the sorted names of the methods
+// that have policies.
+func rawMethodNames(policies map[string]string) []string {
+	var r []string
+	for method := range policies {
+		r = append(r, method)
+	}
+	sort.Strings(r)
+	return r
+}
+
+// passToAll passes the request to all of the runtimes that are
+// connected. Concatenating protobuf messages merges them, so the
+// response contains the items of the repeated fields from all of
+// the runtimes, while for the other fields the last runtime wins.
+// An error from the primary runtime fails the request, while the
+// errors from the other runtimes are only logged.
+func (r *RuntimeProxy) passToAll(ctx context.Context, method string, req, resp CRIObject) (interface{}, error) {
+	clients := r.clients(ctx).clients
+	if err := checkRuntimes(ctx, clients); err != nil {
+		return nil, err
+	}
+	out := resp.Unwrap().(*rawcodec.Message)
+	var data []byte
+	for _, client := range clients {
+		if client.currentState() != clientStateConnected {
+			// This does nothing if the state is clientStateConnecting,
+			// otherwise it tries to connect asynchronously
+			client.connect()
+			continue
+		}
+
+		backendReq, backendResp, err := r.copyRequest(req)
+		if err != nil {
+			return nil, err
+		}
+		_, err = client.invoke(ctx, method, backendReq, backendResp)
+		switch {
+		case err == nil:
+			data = append(data, backendResp.Unwrap().(*rawcodec.Message).Data...)
+		case client.isPrimary():
+			return nil, client.handleError(err, false)
+		default:
+			if err = client.handleError(err, true); err != nil {
+				glog.Warningf("%s failed for runtime %q: %v", method, client.getID(), err)
+			}
+		}
+	}
+	out.Data = data
+	return resp, nil
+}
+
+// passToPodSandboxOwner passes the request to the runtime that owns
+// the pod sandbox, removing the runtime id prefix from the pod
+// sandbox id in the request and adding it to the pod sandbox id
+// in the response.
+func (r *RuntimeProxy) passToPodSandboxOwner(ctx context.Context, method string, req, resp CRIObject) (interface{}, error) {
+	in := req.Unwrap().(*rawcodec.Message)
+	podSandboxId, err := rawcodec.StringField(in.Data, 1)
+	if err != nil {
+		return nil, grpc.Errorf(codes.InvalidArgument, "criproxy: bad %s request: %v", method, err)
+	}
+	client, unprefixed, err := r.clients(ctx).clientForId(podSandboxId)
+	if err != nil {
+		return nil, err
+	}
+	data, err := rawcodec.RewriteStrings(in.Data, []int{1}, func(string) string { return unprefixed })
+	if err != nil {
+		return nil, grpc.Errorf(codes.InvalidArgument, "criproxy: bad %s request: %v", method, err)
+	}
+	req = &rawObject{&rawcodec.Message{Data: data}}
+	if _, err := client.invokeWithErrorHandling(ctx, method, req, resp); err != nil {
+		return nil, err
+	}
+	path := podSandboxIdMethods[strings.TrimPrefix(method, r.methodPrefix)]
+	if path == nil {
+		return resp, nil
+	}
+	out := resp.Unwrap().(*rawcodec.Message)
+	if out.Data, err = rawcodec.RewriteStrings(out.Data, path, client.augmentId); err != nil {
+		return nil, fmt.Errorf("criproxy: bad %s response from runtime %q: %v", method, client.getID(), err)
+	}
+	return resp, nil
+}
+
+func (r *RuntimeProxy) rejectMethod(ctx context.Context, method string, req, resp CRIObject) (interface{}, error) {
+	return nil, grpc.Errorf(codes.Unimplemented, "criproxy: method %s is disabled", method)
+}
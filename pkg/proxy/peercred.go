@@ -0,0 +1,90 @@
+/*
+Copyright 2018 Mirantis
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package proxy
+
+import (
+	"fmt"
+	"net"
+
+	"github.com/golang/glog"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc/peer"
+)
+
+// PeerCredentials are the credentials of the process that's
+// connected to the proxy over a unix domain socket.
+type PeerCredentials struct {
+	PID int32
+	UID uint32
+	GID uint32
+}
+
+func (c *PeerCredentials) String() string {
+	return fmt.Sprintf("pid=%d uid=%d gid=%d", c.PID, c.UID, c.GID)
+}
+
+// PeerCredentialsFromContext returns the credentials of the caller
+// for a request received over a unix domain socket.
+func PeerCredentialsFromContext(ctx context.Context) (*PeerCredentials, bool) {
+	p, ok := peer.FromContext(ctx)
+	if !ok {
+		return nil, false
+	}
+	addr, ok := p.Addr.(*peerCredAddr)
+	if !ok {
+		return nil, false
+	}
+	return addr.creds, true
+}
+
+// peerCredAddr is the remote address of the connections accepted
+// by peerCredListener. gRPC puts the remote address into the peer
+// info of the requests, which makes it possible to get the caller's
+// credentials using the request context.
+type peerCredAddr struct {
+	creds *PeerCredentials
+}
+
+func (a *peerCredAddr) Network() string { return "unix" }
+func (a *peerCredAddr) String() string  { return a.creds.String() }
+
+type peerCredConn struct {
+	net.Conn
+	addr *peerCredAddr
+}
+
+func (c *peerCredConn) RemoteAddr() net.Addr { return c.addr }
+
+// peerCredListener gets the credentials of the peer (SO_PEERCRED)
+// for each connection accepted on a unix domain socket.
+type peerCredListener struct {
+	net.Listener
+}
+
+func (l *peerCredListener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	creds, err := getPeerCredentials(conn)
+	if err != nil {
+		// the caller is treated as an unknown one
+		glog.Warningf("Can't get the credentials of the peer: %v", err)
+		return conn, nil
+	}
+	return &peerCredConn{Conn: conn, addr: &peerCredAddr{creds}}, nil
+}
@@ -23,16 +23,23 @@ import (
 	"net/url"
 	"regexp"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/ghodss/yaml"
 	"github.com/golang/glog"
+	"github.com/golang/protobuf/proto"
 	digest "github.com/opencontainers/go-digest"
 	"golang.org/x/net/context"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+
+	"github.com/elotl/criproxy/pkg/rawcodec"
 )
 
 const (
+	maxImageCacheRebuildAttempts = 3
+
 	criErrorLogLevel   = 2
 	criRequestLogLevel = 3
 	criNoisyLogLevel   = 4
@@ -41,12 +48,48 @@ const (
 
 // RuntimeProxy is a gRPC implementation of internalapi.RuntimeService.
 type RuntimeProxy struct {
-	criVersion   CRIVersion
-	streamUrl    url.URL
+	sync.RWMutex
+	criVersion CRIVersion
+	streamUrl  url.URL
+	// streamServer is the proxy's streaming endpoint
+	// (nil if it's not configured)
+	streamServer *streamServer
+	// streaming is the config of the streaming endpoint the
+	// proxy was created with. The endpoint's listener is only
+	// started once, so its address and TLS settings can't be
+	// changed by Reload.
+	streaming    *StreamingConfig
 	conn         *grpc.ClientConn
-	clients      []client
+	clientSet    *clientSet
 	methodPrefix string
-	images       map[string]string
+	images       *imageCache
+	// lazyPulls keeps the PullImage requests for the runtimes
+	// with the lazy image policy
+	lazyPulls *lazyPullRequests
+	// rawMethods lists the methods that are passed through
+	// as raw protobuf data. It's fixed when the proxy is created
+	// because the methods can't be registered after the gRPC
+	// server is started.
+	rawMethods []string
+	// middleware is called for each request that's passed
+	// to a runtime
+	middleware []Middleware
+	// stopCtx is cancelled when the proxy is stopped
+	// to terminate the streaming requests
+	stopCtx    context.Context
+	cancelStop context.CancelFunc
+	// runtimeConfig is the last UpdateRuntimeConfig request
+	// received by the proxy. It's passed again to the runtimes
+	// each time they're connected, as kubelet only sends it once.
+	runtimeConfigLock sync.Mutex
+	runtimeConfig     CRIObject
+	// discoveredStreamUrls maps the clients of the runtimes
+	// with discoverStreamUrl set to the streaming urls taken
+	// from their status info
+	discoveredStreamUrls map[client]url.URL
+	// retiredSets holds the client sets replaced by Reload
+	// that may still be used by the requests in flight
+	retiredSets []*clientSet
 }
 
 var _ Interceptor = &RuntimeProxy{}
@@ -59,40 +102,175 @@ type dispatchItem struct {
 }
 
 // NewRuntimeProxy creates a new internalapi.RuntimeService.
-func NewRuntimeProxy(criVersion CRIVersion, addrs []string, connectionTimout time.Duration, streamUrl *url.URL) (*RuntimeProxy, error) {
-	if len(addrs) == 0 {
-		return nil, errors.New("no sockets specified to connect to")
+// It sets the default values for unset fields of the config
+// and validates it. The requests are passed through the middleware,
+// if any, before they're passed to the runtimes, with the first
+// middleware being the outermost one.
+func NewRuntimeProxy(criVersion CRIVersion, config *Config, middleware ...Middleware) (*RuntimeProxy, error) {
+	config.SetDefaults()
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+	streamUrl, err := config.GetStreamUrl()
+	if err != nil {
+		return nil, err
+	}
+	backendStreamUrls, err := config.GetBackendStreamUrls()
+	if err != nil {
+		return nil, err
+	}
+	var streamServer *streamServer
+	if config.Streaming != nil {
+		if streamServer, err = getStreamServer(config.Streaming); err != nil {
+			return nil, err
+		}
 	}
 
 	r := &RuntimeProxy{
-		criVersion:   criVersion,
-		streamUrl:    *streamUrl,
-		methodPrefix: fmt.Sprintf("/%s.", criVersion.ProtoPackage()),
-		images:       make(map[string]string),
+		criVersion:           criVersion,
+		streamUrl:            *streamUrl,
+		streamServer:         streamServer,
+		streaming:            config.Streaming,
+		discoveredStreamUrls: make(map[client]url.URL),
+		methodPrefix:         fmt.Sprintf("/%s.", criVersion.ProtoPackage()),
+		images:               getImageCache(config.ImageCacheFile),
+		lazyPulls:            newLazyPullRequests(lazyPullRequestTTL),
+		rawMethods:           rawMethodNames(config.MethodPolicies()),
+		middleware:           middleware,
 	}
-	for _, addr := range addrs {
-		r.clients = append(r.clients, newAutoClient(criVersion, addr, connectionTimout))
+	r.stopCtx, r.cancelStop = context.WithCancel(context.Background())
+	r.clientSet, _ = newClientSet(criVersion, config, nil, r.runtimeConnected, r.middleware)
+	r.clientSet.streamUrls = backendStreamUrls
+	if config.ImageCacheFile != "" {
+		r.images.startRebuild(r.RebuildImageCache)
 	}
-	if !r.clients[0].isPrimary() {
-		return nil, errors.New("the first client should be primary (no id)")
+
+	return r, nil
+}
+
+// Reload replaces the set of the runtimes the proxy passes the
+// requests to according to the specified config. The clients
+// for the backends that didn't change are kept, so their
+// connections aren't interrupted. The clients that aren't used
+// anymore are stopped after the requests that use them complete,
+// including the requests that use the sets replaced by the earlier
+// reloads that contain these clients. The configs that add or remove
+// the streaming endpoint or change its address or TLS settings are
+// rejected, as no listener would serve the changed endpoint.
+// In case of an error, the old configuration is left in place.
+func (r *RuntimeProxy) Reload(config *Config) error {
+	config.SetDefaults()
+	if err := config.Validate(); err != nil {
+		return err
+	}
+	if !r.streaming.sameEndpoint(config.Streaming) {
+		return errors.New("adding or removing the streaming endpoint or changing its address or TLS settings requires restarting the proxy")
+	}
+	streamUrl, err := config.GetStreamUrl()
+	if err != nil {
+		return err
 	}
-	for _, client := range r.clients[1:] {
-		if client.isPrimary() {
-			return nil, errors.New("only the first client should be primary (no id)")
+	backendStreamUrls, err := config.GetBackendStreamUrls()
+	if err != nil {
+		return err
+	}
+	var streamServer *streamServer
+	if config.Streaming != nil {
+		if streamServer, err = getStreamServer(config.Streaming); err != nil {
+			return err
 		}
 	}
 
-	return r, nil
+	for _, method := range rawMethodNames(config.MethodPolicies()) {
+		if !r.hasRawMethod(method) {
+			glog.Warningf("Method %q will only be passed through after the proxy is restarted", method)
+		}
+	}
+
+	r.Lock()
+	old := r.clientSet
+	cs, removed := newClientSet(r.criVersion, config, old, r.runtimeConnected, r.middleware)
+	cs.streamUrls = backendStreamUrls
+	r.clientSet = cs
+	r.streamUrl = *streamUrl
+	r.streamServer = streamServer
+	for _, c := range removed {
+		delete(r.discoveredStreamUrls, c)
+	}
+	go func() {
+		old.inFlight.Wait()
+		close(old.drained)
+	}()
+	var retired, drain []*clientSet
+	for _, s := range append(r.retiredSets, old) {
+		select {
+		case <-s.drained:
+			continue
+		default:
+		}
+		retired = append(retired, s)
+		if s.hasAnyClient(removed) {
+			drain = append(drain, s)
+		}
+	}
+	r.retiredSets = retired
+	r.Unlock()
+
+	for _, c := range removed {
+		glog.V(1).Infof("Removing runtime %q", c.getID())
+	}
+	go func() {
+		for _, s := range drain {
+			<-s.drained
+		}
+		for _, c := range removed {
+			c.stop()
+		}
+	}()
+	return nil
+}
+
+// acquireClientSet returns the current client set, registering an
+// in-flight request for it. The caller must call inFlight.Done()
+// on the set after it's done with the request.
+func (r *RuntimeProxy) acquireClientSet() *clientSet {
+	r.RLock()
+	defer r.RUnlock()
+	r.clientSet.inFlight.Add(1)
+	return r.clientSet
+}
+
+// clients returns the client set that's used by the request
+// or the current client set if there's none in the context.
+func (r *RuntimeProxy) clients(ctx context.Context) *clientSet {
+	if cs := clientSetFromContext(ctx); cs != nil {
+		return cs
+	}
+	r.RLock()
+	defer r.RUnlock()
+	return r.clientSet
 }
 
 // Register implements Register method of the Interceptor interface.
 func (r *RuntimeProxy) Register(s *grpc.Server) {
-	r.criVersion.Register(s)
+	r.criVersion.Register(s, r.rawMethods)
+}
+
+func (r *RuntimeProxy) hasRawMethod(method string) bool {
+	for _, m := range r.rawMethods {
+		if m == method {
+			return true
+		}
+	}
+	return false
 }
 
 // Stop implements Stop method of the Interceptor interface.
 func (r *RuntimeProxy) Stop() {
-	for _, client := range r.clients {
+	r.cancelStop()
+	r.RLock()
+	defer r.RUnlock()
+	for _, client := range r.clientSet.clients {
 		client.stop()
 	}
 }
@@ -109,10 +287,12 @@ func (r *RuntimeProxy) Match(fullMethod string) bool {
 // Intercept implements Intercept method of the Interceptor interface.
 func (r *RuntimeProxy) Intercept(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
 	var err error
+	start := time.Now()
 	defer func() {
 		if err != nil {
 			glog.V(criErrorLogLevel).Infof("FAIL: %s(): %v", info.FullMethod, err)
 		}
+		observeRequest(info.FullMethod, start, err)
 	}()
 	if !strings.HasPrefix(info.FullMethod, r.methodPrefix) {
 		err = fmt.Errorf("bad method prefix in %q (expected to start with %q)", info.FullMethod, r.methodPrefix) // make it logged in defer
@@ -120,125 +300,177 @@ func (r *RuntimeProxy) Intercept(ctx context.Context, req interface{}, info *grp
 	}
 
 	method := info.FullMethod[len(r.methodPrefix):]
+	cs := r.acquireClientSet()
+	defer cs.inFlight.Done()
+	var wrappedReq, wrappedResp CRIObject
 	dispatchItem, found := dispatchTable[method]
+	rawReq, isRaw := req.(*rawcodec.Message)
+	if isRaw {
+		dispatchItem, found = cs.rawDispatchItem(method), true
+	}
 	if !found {
 		err = fmt.Errorf("no handler for method %q", method) // make it logged in defer
 		return nil, err
 	}
 	if glog.V(dispatchItem.logLevel) {
-		glog.Infof("ENTER: %s():\n%s", info.FullMethod, dump(req))
+		glog.Info(cs.logger.format("ENTER", info.FullMethod, req))
 	}
-	wrappedReq, wrappedResp, err := r.criVersion.WrapObject(req)
-	if err != nil {
+	if isRaw {
+		wrappedReq, wrappedResp = wrapRawObject(rawReq)
+	} else if wrappedReq, wrappedResp, err = r.criVersion.WrapObject(req); err != nil {
+		return nil, err
+	}
+	if entry := cs.newAuditEntry(ctx, method, wrappedReq); entry != nil {
+		ctx = withAuditEntry(ctx, entry)
+		defer func() { cs.finishAuditEntry(entry, wrappedResp, err) }()
+	}
+	if ctx, err = cs.authorize(ctx, method); err != nil {
 		return nil, err
 	}
-	resp, err := dispatchItem.handler(r, ctx, info.FullMethod, wrappedReq, wrappedResp)
+	resp, err := dispatchItem.handler(r, withClientSet(ctx, cs), info.FullMethod, wrappedReq, wrappedResp)
 	if err != nil {
+		err = grpcError(ctx, err)
 		return nil, err
 	}
 	if wrappedResp, ok := resp.(CRIObject); ok {
 		resp = wrappedResp.Unwrap()
 	}
 	if glog.V(dispatchItem.logLevel) {
-		glog.Infof("LEAVE: %s():\n%s", info.FullMethod, dump(resp))
+		glog.Info(cs.logger.format("LEAVE", info.FullMethod, resp))
 	}
 	return resp, nil
 }
 
+// InterceptStream implements InterceptStream method of the Interceptor interface.
+func (r *RuntimeProxy) InterceptStream(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	var err error
+	start := time.Now()
+	defer func() {
+		if err != nil {
+			glog.V(criErrorLogLevel).Infof("FAIL: %s(): %v", info.FullMethod, err)
+		}
+		observeRequest(info.FullMethod, start, err)
+	}()
+	if !strings.HasPrefix(info.FullMethod, r.methodPrefix) {
+		err = fmt.Errorf("bad method prefix in %q (expected to start with %q)", info.FullMethod, r.methodPrefix) // make it logged in defer
+		return err
+	}
+
+	method := info.FullMethod[len(r.methodPrefix):]
+	dispatchItem, found := streamDispatchTable[method]
+	if !found {
+		err = fmt.Errorf("no handler for streaming method %q", method) // make it logged in defer
+		return err
+	}
+	cs := r.acquireClientSet()
+	ctx := ss.Context()
+	if entry := cs.newAuditEntry(ctx, method, nil); entry != nil {
+		ctx = withAuditEntry(ctx, entry)
+		defer func() { cs.finishAuditEntry(entry, nil, err) }()
+	}
+	ctx, err = cs.authorize(ctx, method)
+	cs.inFlight.Done()
+	if err != nil {
+		return err
+	}
+	glog.V(dispatchItem.logLevel).Infof("ENTER: %s()", info.FullMethod)
+	if err = dispatchItem.handler(r, &serverStreamWithContext{ss, ctx}, info.FullMethod, dispatchItem.logLevel); err != nil {
+		err = grpcError(ss.Context(), err)
+	}
+	glog.V(dispatchItem.logLevel).Infof("LEAVE: %s()", info.FullMethod)
+	return err
+}
+
+// serverStreamWithContext replaces the context of a server stream.
+type serverStreamWithContext struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *serverStreamWithContext) Context() context.Context { return s.ctx }
+
 func (r *RuntimeProxy) getImageNameById(imageId string) string {
-	return r.images[imageId]
+	return r.images.get(imageId)
 }
 
 func (r *RuntimeProxy) setImageNameById(imageId, imageName string, overwrite bool) {
-	if _, ok := r.images[imageId]; !ok || overwrite {
-		r.images[imageId] = imageName
-	}
+	r.images.set(imageId, imageName, overwrite)
 }
 
 func (r *RuntimeProxy) deleteImageNameById(imageId string) {
-	delete(r.images, imageId)
+	r.images.remove(imageId)
 }
 
-func (r *RuntimeProxy) primaryClient() (client, error) {
-	if err := <-r.clients[0].connect(); err != nil {
-		return nil, err
-	}
-	return r.clients[0], nil
+func (r *RuntimeProxy) imageCacheSize() int {
+	return r.images.size()
 }
 
-func (r *RuntimeProxy) clientForAnnotations(annotations map[string]string) (client, error) {
-	for _, client := range r.clients {
-		if client.annotationsMatch(annotations) {
-			if err := <-client.connect(); err != nil {
-				return nil, err
-			}
-			return client, nil
+// RebuildImageCache lists the images in all of the runtimes and
+// adds the missing entries to the image cache. If all of the runtimes
+// could be listed, it also removes the stale entries from the cache.
+// The runtimes that aren't available are skipped after waiting for
+// them for the connection timeout.
+func (r *RuntimeProxy) RebuildImageCache() {
+	for attempt := 0; attempt < maxImageCacheRebuildAttempts; attempt++ {
+		if r.rebuildImageCache() {
+			return
 		}
+		glog.V(1).Infof("The image cache was changed while listing the images, retrying the rebuild")
 	}
-	return nil, fmt.Errorf("criproxy: unknown runtime: %q", annotations[targetRuntimeAnnotationKey])
-}
-
-func (r *RuntimeProxy) clientAtIndex(index int) (client, error) {
-	if index >= len(r.clients) {
-		return nil, fmt.Errorf("client index %d out of range", index)
-	}
-	c := r.clients[index]
-	c.connect()
-	if c.currentState() != clientStateConnected {
-		return nil, fmt.Errorf("CRI proxy: target runtime is not available")
-	}
-	client := c
-	if err := <-client.connect(); err != nil {
-		return nil, err
-	}
-	return client, nil
+	glog.Warningf("Failed to rebuild the image cache: the cache keeps changing")
 }
 
-func (r *RuntimeProxy) clientForId(id string) (client, string, error) {
-	client := r.clients[0]
-	unprefixed := id
-	for _, c := range r.clients[1:] {
-		if ok, unpref := c.idPrefixMatches(id); ok {
-			c.connect()
-			if c.currentState() != clientStateConnected {
-				return nil, "", fmt.Errorf("CRI proxy: target runtime is not available")
+func (r *RuntimeProxy) rebuildImageCache() bool {
+	cs := r.acquireClientSet()
+	defer cs.inFlight.Done()
+	generation := r.images.currentGeneration()
+	images := make(map[string]string)
+	complete := true
+	for n, client := range cs.clients {
+		timeout := cs.backends[n].ConnectionTimeout.Duration
+		select {
+		case err := <-client.connect():
+			if err != nil {
+				glog.Warningf("Can't list images of runtime %q: %v", client.getID(), err)
+				complete = false
+				continue
 			}
-			client = c
-			unprefixed = unpref
-			break
+		case <-time.After(timeout):
+			glog.Warningf("Can't list images of runtime %q: timed out waiting for the connection", client.getID())
+			complete = false
+			continue
 		}
-	}
-	if err := <-client.connect(); err != nil {
-		return nil, "", err
-	}
-	return client, unprefixed, nil
-}
-
-func (r *RuntimeProxy) clientForImage(image string, noErrorIfNotConnected bool) (client, string, error) {
-	client := r.clients[0]
-	unprefixed := image
-	for _, c := range r.clients[1:] {
-		if ok, unpref := c.imageMatches(image); ok {
-			c.connect()
-			// don't wait for additional runtimes
-			if c.currentState() != clientStateConnected {
-				if noErrorIfNotConnected {
-					return nil, "", nil
-				}
-				return nil, "", fmt.Errorf("CRI proxy: target runtime is not available")
+		req, resp, err := r.criVersion.WrapObject(r.criVersion.ImageListRequest())
+		if err != nil {
+			glog.Errorf("Can't wrap ListImages request: %v", err)
+			return true
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		_, err = client.invoke(ctx, r.methodPrefix+"ImageService/ListImages", req, resp)
+		cancel()
+		if err != nil {
+			glog.Warningf("Can't list images of runtime %q: %v", client.getID(), client.handleError(err, false))
+			complete = false
+			continue
+		}
+		for _, item := range resp.(ObjectList).Items() {
+			image := item.(Image)
+			name := ""
+			switch {
+			case len(image.RepoDigests()) > 0:
+				name = image.RepoDigests()[0]
+			case len(image.RepoTags()) > 0:
+				name = image.RepoTags()[0]
+			}
+			if _, found := images[image.Id()]; !found && image.Id() != "" && name != "" {
+				images[image.Id()] = name
 			}
-			client = c
-			unprefixed = unpref
-			break
 		}
 	}
-	if err := <-client.connect(); err != nil {
-		return nil, "", err
-	}
-	return client, unprefixed, nil
+	return r.images.update(images, complete, generation)
 }
 
-func (r *RuntimeProxy) fixStreamingUrl(url string) string {
+func (r *RuntimeProxy) fixStreamingUrl(ctx context.Context, c client, url string) string {
 	// The URLs provided by dockershim in k8s 1.11+ look like this:
 	// //[::]:35057/cri/exec/tb8rgDBh
 	// These can be passed as-is to the client because they
@@ -248,7 +480,15 @@ func (r *RuntimeProxy) fixStreamingUrl(url string) string {
 	// These need to be replaced to make exec/attach work with
 	// dockershim.
 	if strings.HasPrefix(url, "/") && !strings.Contains(url, ":") {
+		r.RLock()
 		u := r.streamUrl
+		discoveredUrl, discovered := r.discoveredStreamUrls[c]
+		r.RUnlock()
+		if backendUrl, found := r.clients(ctx).streamUrls[c.getID()]; found {
+			u = backendUrl
+		} else if discovered {
+			u = discoveredUrl
+		}
 		u.Path = url
 		return u.String()
 	}
@@ -256,7 +496,7 @@ func (r *RuntimeProxy) fixStreamingUrl(url string) string {
 }
 
 func (r *RuntimeProxy) passToPrimary(ctx context.Context, method string, req, resp CRIObject) (interface{}, error) {
-	client, err := r.primaryClient()
+	client, err := r.clients(ctx).primaryClient()
 	if err != nil {
 		return nil, err
 	}
@@ -264,8 +504,17 @@ func (r *RuntimeProxy) passToPrimary(ctx context.Context, method string, req, re
 }
 
 func (r *RuntimeProxy) updateRuntimeConfig(ctx context.Context, method string, req, resp CRIObject) (interface{}, error) {
-	var errs []string
-	for _, client := range r.clients {
+	if err := checkRuntimes(ctx, r.clients(ctx).clients); err != nil {
+		return nil, err
+	}
+	// the config is remembered before it's passed to the runtimes
+	// so the runtimes that are being connected get it, too
+	r.runtimeConfigLock.Lock()
+	r.runtimeConfig = req
+	r.runtimeConfigLock.Unlock()
+
+	var errs MultiBackendError
+	for _, client := range r.clients(ctx).clients {
 		if client.currentState() != clientStateConnected {
 			// This does nothing if the state is clientStateConnecting,
 			// otherwise it tries to connect asynchronously
@@ -273,28 +522,67 @@ func (r *RuntimeProxy) updateRuntimeConfig(ctx context.Context, method string, r
 			continue
 		}
 
-		_, err := client.invoke(ctx, method, req, resp)
+		backendReq, backendResp, err := r.copyRequest(req)
 		if err != nil {
-			errs = append(errs, client.handleError(err, false).Error())
+			return nil, err
+		}
+		if _, err := client.invoke(ctx, method, backendReq, backendResp); err != nil {
+			errs.add(client, client.handleError(err, false))
 		}
 	}
 
-	if errs != nil {
-		return nil, errors.New(strings.Join(errs, "\n"))
+	if err := errs.errorOrNil(); err != nil {
+		return nil, err
 	}
 
 	return resp, nil
 }
 
+// runtimeConnected is called each time the proxy connects
+// to a runtime. It runs concurrently with the requests that
+// waited for the connection, so the requests made right after
+// the proxy connects to a runtime that has discoverStreamUrl set
+// may get the streaming urls that aren't fixed using the
+// discovered url yet.
+func (r *RuntimeProxy) runtimeConnected(c client) {
+	r.replayRuntimeConfig(c)
+	r.discoverStreamUrl(c)
+}
+
+// replayRuntimeConfig passes the last UpdateRuntimeConfig request
+// received by the proxy to the runtime that has just been connected.
+func (r *RuntimeProxy) replayRuntimeConfig(c client) {
+	r.runtimeConfigLock.Lock()
+	req := r.runtimeConfig
+	r.runtimeConfigLock.Unlock()
+	if req == nil {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.stopCtx, runtimeConfigReplayTimeout)
+	defer cancel()
+	req, resp, err := r.copyRequest(req)
+	if err == nil {
+		_, err = c.invoke(ctx, r.methodPrefix+updateRuntimeConfigMethod, req, resp)
+	}
+	runtimeConfigReplayCount.Inc(c.getID(), errorCode(err).String())
+	if err != nil {
+		glog.Warningf("Failed to pass the runtime config to runtime %q after connecting: %v", c.getID(), err)
+		return
+	}
+	glog.V(1).Infof("Passed the runtime config to runtime %q after connecting", c.getID())
+}
+
 func (r *RuntimeProxy) listObjects(ctx context.Context, method string, req, resp CRIObject) (interface{}, error) {
 	out := resp.(ObjectList)
-	clients := r.clients
+	cs := r.clients(ctx)
+	clients := cs.clients
 	var singleClient client
 	useSingleClient := false
 	if in, ok := req.(IdFilterObject); ok && in.IdFilter() != "" {
 		var unprefixed string
 		var err error
-		singleClient, unprefixed, err = r.clientForId(in.IdFilter())
+		singleClient, unprefixed, err = cs.clientForId(in.IdFilter())
 		if err != nil {
 			return nil, err
 		}
@@ -303,7 +591,7 @@ func (r *RuntimeProxy) listObjects(ctx context.Context, method string, req, resp
 	}
 
 	if in, ok := req.(PodSandboxIdFilterObject); ok && in.PodSandboxIdFilter() != "" {
-		anotherClient, unprefixed, err := r.clientForId(in.PodSandboxIdFilter())
+		anotherClient, unprefixed, err := cs.clientForId(in.PodSandboxIdFilter())
 		if err != nil {
 			return nil, err
 		}
@@ -321,7 +609,7 @@ func (r *RuntimeProxy) listObjects(ctx context.Context, method string, req, resp
 	}
 
 	if in, ok := req.(ImageFilterObject); ok && in.ImageFilter() != "" {
-		anotherClient, unprefixed, err := r.clientForImage(in.ImageFilter(), true)
+		anotherClient, unprefixed, err := cs.clientForImage(in.ImageFilter(), true)
 		if err != nil {
 			return nil, err
 		}
@@ -350,39 +638,122 @@ func (r *RuntimeProxy) listObjects(ctx context.Context, method string, req, resp
 		}
 	}
 
-	var items []CRIObject
-	for _, client := range clients {
-		if client.currentState() != clientStateConnected {
+	// The runtimes are queried in parallel so a slow runtime
+	// doesn't delay the others. The results are kept in the order
+	// of the clients so the items are always listed in the same order.
+	results := make([]listResult, len(clients))
+	var wg sync.WaitGroup
+	for n, c := range clients {
+		if c.currentState() != clientStateConnected {
 			// This does nothing if the state is clientStateConnecting,
 			// otherwise it tries to connect asynchronously
-			client.connect()
+			c.connect()
 			continue
 		}
 
-		out.SetItems(nil)
-		_, err := client.invoke(ctx, method, req, resp)
-		if err != nil {
-			// if the runtime server is gone, let's just skip it
-			err = client.handleError(err, true)
-			if err != nil {
-				// for more serious errors, log a warning but don't
-				// block the other runtimes by making List* fail
-				glog.Warningf("List request failed for runtime %q: %v", client.getID(), err)
-			}
-		}
-		for _, item := range out.Items() {
-			items = append(items, client.addPrefix(item))
+		wg.Add(1)
+		go func(n int, c client) {
+			defer wg.Done()
+			results[n] = r.listBackend(ctx, cs, c, method, req)
+		}(n, c)
+	}
+	wg.Wait()
+
+	var items []CRIObject
+	for _, result := range results {
+		if result.err != nil {
+			return nil, result.err
 		}
+		items = append(items, result.items...)
 	}
 
 	out.SetItems(items)
 	return resp, nil
+}
 
+// backendDeadlineShare is the share of the time left before the
+// deadline of a request that the runtimes are given to reply when
+// the request is passed to several runtimes in parallel. The rest
+// is reserved for replying with the results from the other runtimes
+// if one of them hangs.
+const backendDeadlineShare = 0.9
+
+// runtimeConfigReplayTimeout is the timeout for passing the
+// runtime config to a runtime that has just been connected.
+const runtimeConfigReplayTimeout = 30 * time.Second
+
+// backendContext returns the context for a request that's passed
+// to one of the runtimes in parallel with the others. The request
+// is given at most the specified timeout, unless it's zero.
+func backendContext(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if deadline, ok := ctx.Deadline(); ok {
+		share := time.Duration(float64(deadline.Sub(time.Now())) * backendDeadlineShare)
+		if timeout == 0 || share < timeout {
+			timeout = share
+		}
+	}
+	if timeout == 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, timeout)
+}
+
+// copyRequest returns a copy of the request along with a new response
+// object for passing the request to one of several runtimes, so the
+// changes made to the request for one runtime, e.g. by the middleware,
+// don't affect the others.
+func (r *RuntimeProxy) copyRequest(req CRIObject) (CRIObject, CRIObject, error) {
+	if raw, ok := req.(*rawObject); ok {
+		req, resp := wrapRawObject(&rawcodec.Message{Data: append([]byte(nil), raw.inner.Data...)})
+		return req, resp, nil
+	}
+	return r.criVersion.WrapObject(proto.Clone(req.Unwrap().(proto.Message)))
+}
+
+type listResult struct {
+	items []CRIObject
+	err   error
+}
+
+// listBackend passes a List* or ImageFsInfo request to a single
+// runtime, giving it a separate deadline. If the runtime fails,
+// its items are left out of the response, unless it has timed out
+// and the proxy is configured to fail the request in this case.
+func (r *RuntimeProxy) listBackend(ctx context.Context, cs *clientSet, client client, method string, req CRIObject) listResult {
+	backendCtx, cancel := backendContext(ctx, cs.listTimeout)
+	defer cancel()
+	// the request and response objects can't be shared
+	// between the runtimes that are queried in parallel
+	req, resp, err := r.copyRequest(req)
+	if err != nil {
+		return listResult{err: err}
+	}
+	if _, err = client.invoke(backendCtx, method, req, resp); err != nil {
+		timedOut := backendCtx.Err() == context.DeadlineExceeded && ctx.Err() == nil
+		// handleError returns nil if the runtime server is gone,
+		// which is logged and counted as a failure, too
+		if handledErr := client.handleError(err, true); handledErr != nil {
+			if timedOut && cs.failListOnTimeout {
+				return listResult{err: handledErr}
+			}
+			err = handledErr
+		}
+		// log a warning but don't block the other
+		// runtimes by making List* fail
+		glog.Warningf("List request failed for runtime %q: %v", client.getID(), err)
+		backendListFailureCount.Inc(client.getID(), metricMethodName(method))
+		return listResult{}
+	}
+	var items []CRIObject
+	for _, item := range resp.(ObjectList).Items() {
+		items = append(items, client.addPrefix(item))
+	}
+	return listResult{items: items}
 }
 
 func (r *RuntimeProxy) invokePodSandboxMethod(ctx context.Context, method string, req, resp CRIObject) (client, error) {
 	in := req.(PodSandboxIdObject)
-	client, unprefixed, err := r.clientForId(in.PodSandboxId())
+	client, unprefixed, err := r.clients(ctx).clientForId(in.PodSandboxId())
 	if err != nil {
 		return nil, err
 	}
@@ -393,7 +764,7 @@ func (r *RuntimeProxy) invokePodSandboxMethod(ctx context.Context, method string
 
 func (r *RuntimeProxy) invokeContainerMethod(ctx context.Context, method string, req, resp CRIObject) (client, error) {
 	in := req.(ContainerIdObject)
-	client, unprefixed, err := r.clientForId(in.ContainerId())
+	client, unprefixed, err := r.clients(ctx).clientForId(in.ContainerId())
 	if err != nil {
 		return nil, err
 	}
@@ -405,7 +776,7 @@ func (r *RuntimeProxy) invokeContainerMethod(ctx context.Context, method string,
 }
 
 func (r *RuntimeProxy) runPodSandbox(ctx context.Context, method string, req, resp CRIObject) (interface{}, error) {
-	client, err := r.clientForAnnotations(req.(RunPodSandboxRequest).GetAnnotations())
+	client, err := r.clients(ctx).clientForPodSandbox(req.(RunPodSandboxRequest))
 	if err != nil {
 		return nil, err
 	}
@@ -417,13 +788,18 @@ func (r *RuntimeProxy) runPodSandbox(ctx context.Context, method string, req, re
 }
 
 func (r *RuntimeProxy) handlePodSandbox(ctx context.Context, method string, req, resp CRIObject) (interface{}, error) {
-	_, err := r.invokePodSandboxMethod(ctx, method, req, resp)
-	if err == nil {
-		if out, ok := resp.(UrlObject); ok {
-			out.SetUrl(r.fixStreamingUrl(out.Url()))
+	client, err := r.invokePodSandboxMethod(ctx, method, req, resp)
+	if err != nil {
+		return nil, err
+	}
+	if out, ok := resp.(UrlObject); ok {
+		url, err := r.streamingUrl(ctx, client, method, out.Url())
+		if err != nil {
+			return nil, err
 		}
+		out.SetUrl(url)
 	}
-	return resp, err
+	return resp, nil
 }
 
 func (r *RuntimeProxy) podSandboxStatus(ctx context.Context, method string, req, resp CRIObject) (interface{}, error) {
@@ -439,7 +815,8 @@ func (r *RuntimeProxy) podSandboxStatus(ctx context.Context, method string, req,
 
 func (r *RuntimeProxy) createContainer(ctx context.Context, method string, req, resp CRIObject) (interface{}, error) {
 	in := req.(CreateContainerRequest)
-	client, unprefixed, err := r.clientForId(in.PodSandboxId())
+	cs := r.clients(ctx)
+	client, unprefixed, err := cs.clientForId(in.PodSandboxId())
 	if err != nil {
 		return nil, err
 	}
@@ -471,6 +848,15 @@ func (r *RuntimeProxy) createContainer(ctx context.Context, method string, req,
 			in.SetImage(imageName)
 		}
 	}
+	if runtimeImage, ok := client.mapImage(in.Image()); ok {
+		glog.Infof("CreateContainer: using image name %s for runtime %q", runtimeImage, client.getID())
+		in.SetImage(runtimeImage)
+	}
+	if n := cs.clientIndex(client); n >= 0 && cs.backends[n].ImagePolicy == ImagePolicyLazy {
+		if err := r.pullImageLazily(ctx, client, in.Image()); err != nil {
+			return nil, err
+		}
+	}
 
 	_, err = client.invokeWithErrorHandling(ctx, method, req, resp)
 	if err != nil {
@@ -483,13 +869,18 @@ func (r *RuntimeProxy) createContainer(ctx context.Context, method string, req,
 }
 
 func (r *RuntimeProxy) handleContainer(ctx context.Context, method string, req, resp CRIObject) (interface{}, error) {
-	_, err := r.invokeContainerMethod(ctx, method, req, resp)
-	if err == nil {
-		if out, ok := resp.(UrlObject); ok {
-			out.SetUrl(r.fixStreamingUrl(out.Url()))
+	client, err := r.invokeContainerMethod(ctx, method, req, resp)
+	if err != nil {
+		return nil, err
+	}
+	if out, ok := resp.(UrlObject); ok {
+		url, err := r.streamingUrl(ctx, client, method, out.Url())
+		if err != nil {
+			return nil, err
 		}
+		out.SetUrl(url)
 	}
-	return resp, err
+	return resp, nil
 }
 
 func (r *RuntimeProxy) containerStatus(ctx context.Context, method string, req, resp CRIObject) (interface{}, error) {
@@ -516,21 +907,39 @@ func (r *RuntimeProxy) containerStats(ctx context.Context, method string, req, r
 }
 
 // We don't want to force the user to prefix image names so instead, prefer
-// to say the image is not present if it's not available to all CRIs
+// to say the image is not present if it's not available to all CRIs that
+// get the image according to their image policies
 func (r *RuntimeProxy) handleImageStatus(ctx context.Context, method string, req, resp CRIObject) (interface{}, error) {
 	in := req.(ImageObject)
+	cs := r.clients(ctx)
+	owner, runtimeImage, err := cs.imageOwner(in.Image())
+	if err != nil {
+		return nil, err
+	}
+	if owner != nil {
+		return r.passToImageOwner(ctx, owner, runtimeImage, method, req, resp)
+	}
+	targets := r.imageTargets(cs, in.Image())
+	if len(targets) == 0 {
+		return r.lazyImageStatus(ctx, cs, method, req, resp)
+	}
 	var imageWithDigest Image
-	for i := range r.clients {
-		client, err := r.clientAtIndex(i)
+	for _, i := range targets {
+		client, err := cs.clientAtIndex(i)
 		if err != nil {
 			continue
 		}
 		imageName := in.Image()
-		_, err = client.invokeWithErrorHandling(ctx, method, req, resp)
+		backendReq, backendResp, err := r.copyRequest(req)
+		if err != nil {
+			return nil, err
+		}
+		_, err = client.invokeWithErrorHandling(ctx, method, backendReq, backendResp)
 		if err != nil {
 			glog.Errorf("Error in ImageStatus for client %s: %v", client.getID(), err)
 			return nil, err
 		}
+		resp = backendResp
 		if out, ok := resp.(ImageStatusResponse); ok && out.Image() != nil {
 			img := out.Image().(Image)
 			if len(img.RepoDigests()) > 0 {
@@ -557,46 +966,158 @@ func (r *RuntimeProxy) handleImageStatus(ctx context.Context, method string, req
 	return resp, nil
 }
 
+// lazyImageStatus handles ImageStatus request for the image that
+// doesn't go to any runtime because of the lazy image policies. The
+// image is reported as present if any of the runtimes with the lazy
+// policy already has it, so kubelet doesn't pull it again each time
+// it starts a container. Otherwise, it's reported as missing, so
+// kubelet pulls it, passing the credentials for the lazy pull.
+func (r *RuntimeProxy) lazyImageStatus(ctx context.Context, cs *clientSet, method string, req, resp CRIObject) (interface{}, error) {
+	in := req.(ImageObject)
+	for _, i := range cs.lazyImageRuntimes() {
+		client, err := cs.clientAtIndex(i)
+		if err != nil {
+			continue
+		}
+		backendReq, backendResp, err := r.copyRequest(req)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := client.invokeWithErrorHandling(ctx, method, backendReq, backendResp); err != nil {
+			glog.Errorf("Error in ImageStatus for client %s: %v", client.getID(), err)
+			return nil, err
+		}
+		if img := backendResp.(ImageStatusResponse).Image(); img != nil && img.Id() != "" {
+			r.setImageNameById(img.Id(), in.Image(), false)
+			return backendResp, nil
+		}
+	}
+	return resp, nil
+}
+
 func (r *RuntimeProxy) handleImageAllCRIs(ctx context.Context, method string, req, resp CRIObject) (interface{}, error) {
-	errs := []error{}
+	var errs MultiBackendError
 	in := req.(ImageObject)
 	imageName := in.Image()
-	var primaryImage string
-	for i := range r.clients {
-		client, err := r.clientAtIndex(i)
+	var imageRef string
+	cs := r.clients(ctx)
+	owner, runtimeImage, err := cs.imageOwner(imageName)
+	if err != nil {
+		return nil, err
+	}
+	if owner != nil {
+		return r.passToImageOwner(ctx, owner, runtimeImage, method, req, resp)
+	}
+	targets := r.imageTargets(cs, imageName)
+	for _, i := range targets {
+		if err := checkRuntime(ctx, cs.clients[i].getID()); err != nil {
+			return nil, err
+		}
+	}
+	succeeded := false
+	for _, i := range targets {
+		client, err := cs.clientAtIndex(i)
 		if err != nil {
+			// the runtime that isn't connected doesn't get
+			// the image, so it's a failure, too
+			glog.Errorf("Image error in %s for client %s: %v",
+				method, cs.clients[i].getID(), err)
+			errs.add(cs.clients[i], grpc.Errorf(codes.Unavailable, "%v", err))
 			continue
 		}
-		_, err = client.invokeWithErrorHandling(ctx, method, req, resp)
+		backendReq, backendResp, err := r.copyRequest(req)
+		if err != nil {
+			return nil, err
+		}
+		_, err = client.invokeWithErrorHandling(ctx, method, backendReq, backendResp)
 		if err != nil {
 			glog.Errorf("Image error in %s for client %s: %v",
 				method, client.getID(), err)
-			errs = append(errs, err)
+			errs.add(client, err)
+			continue
 		}
-		if out, ok := resp.(ImageObject); ok {
+		succeeded = true
+		if out, ok := backendResp.(ImageObject); ok {
 			// PullImage
 			r.setImageNameById(out.Image(), imageName, false)
-			if client.isPrimary() {
-				primaryImage = out.Image()
+			// the targets start with the primary CRI if it gets the image
+			if imageRef == "" {
+				imageRef = out.Image()
 			}
 		} else {
 			// RemoveImage
 			r.deleteImageNameById(in.Image())
 		}
 	}
-	if len(errs) > 0 {
-		return resp, errs[0]
+	if err := errs.errorOrNil(); err != nil {
+		if !cs.ignoreImageFailures || !succeeded {
+			return resp, err
+		}
+		glog.Warningf("%s: ignoring the failures for image %q: %v", method, imageName, err)
+	}
+	if pullReq, ok := req.(PullImageRequest); ok && len(cs.lazyImageRuntimes()) > 0 {
+		// keep the credentials for CreateContainer
+		// that pulls the image for the lazy runtimes
+		r.lazyPulls.put(imageName, pullReq.Unwrap().(proto.Message))
 	}
-	// Set the response to the response from the primary CRI
-	if out, ok := resp.(ImageObject); ok && primaryImage != "" {
-		out.SetImage(primaryImage)
+	if len(targets) == 0 {
+		// the image will be pulled by CreateContainer
+		imageRef = imageName
+	}
+	// Set the response to the response from the primary CRI, or
+	// the first CRI that got the image if the primary didn't
+	if out, ok := resp.(ImageObject); ok && imageRef != "" {
+		out.SetImage(imageRef)
 	}
 	return resp, nil
 }
 
+// imageTargets returns the indices of the clients that get image
+// requests for the image according to their image policies. If
+// the image is specified by its id, its name from the image cache
+// is used to match it to the runtimes.
+func (r *RuntimeProxy) imageTargets(cs *clientSet, image string) []int {
+	if imageName := r.getImageNameById(image); imageName != "" {
+		image = imageName
+	}
+	return cs.imageTargets(image)
+}
+
+// pullImageLazily pulls the image for the runtime with the lazy
+// image policy unless the runtime already has it. If the proxy got
+// PullImage request for the image shortly before, the registry
+// credentials and the pod sandbox config are taken from it.
+func (r *RuntimeProxy) pullImageLazily(ctx context.Context, client client, image string) error {
+	req, resp, err := r.criVersion.WrapObject(r.criVersion.ImageStatusRequest(image))
+	if err != nil {
+		return err
+	}
+	if _, err := client.invokeWithErrorHandling(ctx, r.methodPrefix+"ImageService/ImageStatus", req, resp); err != nil {
+		return err
+	}
+	if img := resp.(ImageStatusResponse).Image(); img != nil && img.Id() != "" {
+		return nil
+	}
+	if pullReq := r.lazyPulls.get(image); pullReq != nil {
+		glog.Infof("CreateContainer: pulling image %s for runtime %q using PullImage request settings", image, client.getID())
+		req, resp, err = r.criVersion.WrapObject(pullReq)
+	} else {
+		glog.Infof("CreateContainer: pulling image %s for runtime %q", image, client.getID())
+		req, resp, err = r.criVersion.WrapObject(r.criVersion.PullImageRequest(image))
+	}
+	if err != nil {
+		return err
+	}
+	if _, err := client.invokeWithErrorHandling(ctx, r.methodPrefix+"ImageService/PullImage", req, resp); err != nil {
+		return err
+	}
+	r.setImageNameById(resp.(ImageObject).Image(), image, false)
+	return nil
+}
+
 var dispatchTable = map[string]dispatchItem{
 	"RuntimeService/Version":                  {(*RuntimeProxy).passToPrimary, criNoisyLogLevel},
-	"RuntimeService/Status":                   {(*RuntimeProxy).passToPrimary, criNoisyLogLevel},
+	"RuntimeService/Status":                   {(*RuntimeProxy).runtimeStatus, criNoisyLogLevel},
 	"RuntimeService/UpdateRuntimeConfig":      {(*RuntimeProxy).updateRuntimeConfig, criRequestLogLevel},
 	"RuntimeService/RunPodSandbox":            {(*RuntimeProxy).runPodSandbox, criRequestLogLevel},
 	"RuntimeService/ListPodSandbox":           {(*RuntimeProxy).listObjects, criListLogLevel},
@@ -628,6 +1149,33 @@ var dispatchTable = map[string]dispatchItem{
 	"ImageService/ImageFsInfo": {(*RuntimeProxy).listObjects, criRequestLogLevel},
 }
 
+// passToImageOwner passes ImageStatus, PullImage or RemoveImage
+// request to the runtime that owns the image according to its
+// image mappings, using the runtime's name of the image. The image
+// names in ImageStatus response are mapped back.
+func (r *RuntimeProxy) passToImageOwner(ctx context.Context, client client, runtimeImage, method string, req, resp CRIObject) (interface{}, error) {
+	in := req.(ImageObject)
+	imageName := in.Image()
+	in.SetImage(runtimeImage)
+	if _, err := client.invokeWithErrorHandling(ctx, method, req, resp); err != nil {
+		return nil, err
+	}
+	switch out := resp.(type) {
+	case ImageStatusResponse:
+		if img := out.Image(); img != nil && img.Id() != "" {
+			r.setImageNameById(img.Id(), imageName, true)
+			out.SetImage(client.addPrefix(img).(Image))
+		}
+	case ImageObject:
+		// PullImage
+		r.setImageNameById(out.Image(), imageName, false)
+	default:
+		// RemoveImage
+		r.deleteImageNameById(imageName)
+	}
+	return resp, nil
+}
+
 var replaceRx = regexp.MustCompile(`\(\*(v1alpha2.\w+)\)\(0x[0-9a-f]+\)`)
 var rmRx = regexp.MustCompile(`(?: \(string\))? \(len=\d+(?: cap=\d+)?\)`)
 
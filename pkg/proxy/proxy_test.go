@@ -17,22 +17,49 @@ limitations under the License.
 package proxy
 
 import (
+	"bufio"
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
 	"flag"
 	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
 	"net/url"
+	"os"
+	"path/filepath"
 	"reflect"
+	"sort"
+	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
 	"github.com/ghodss/yaml"
 	"github.com/golang/glog"
+	"github.com/golang/protobuf/proto"
 	"github.com/pmezard/go-difflib/difflib"
 	"golang.org/x/net/context"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
 
+	"github.com/elotl/criproxy/pkg/metrics"
 	proxytest "github.com/elotl/criproxy/pkg/proxy/testing"
 	"github.com/elotl/criproxy/pkg/runtimeapis"
+	v1 "github.com/elotl/criproxy/pkg/runtimeapis/v1"
 	v1_12 "github.com/elotl/criproxy/pkg/runtimeapis/v1_12"
 	runtimeapi "github.com/elotl/criproxy/pkg/runtimeapis/v1_9"
 	"github.com/elotl/criproxy/pkg/utils"
@@ -82,10 +109,10 @@ func startServer(t *testing.T, s ServerWithReadinessFeedback, addr string) {
 }
 
 type proxyTester struct {
-	hookCallCount   int
+	hookCallCount   int32
 	journal         *proxytest.SimpleJournal
 	servers         []proxytest.FakeCriServer
-	proxy           *RuntimeProxy
+	proxies         []*RuntimeProxy
 	proxyServer     *Server
 	conn            *grpc.ClientConn
 	containerStats  []*runtimeapi.ContainerStats
@@ -94,7 +121,7 @@ type proxyTester struct {
 
 type makeFakeCriServerFunc func(journal proxytest.Journal, streamUrl string) proxytest.FakeCriServer
 
-func newProxyTester(t *testing.T, secondSocketSpec string, fakeCriServerMakers []makeFakeCriServerFunc) *proxyTester {
+func newProxyTester(t *testing.T, secondSocketSpec string, fakeCriServerMakers []makeFakeCriServerFunc, configure func(config *Config), middleware ...Middleware) *proxyTester {
 	journal := proxytest.NewSimpleJournal()
 	servers := []proxytest.FakeCriServer{
 		fakeCriServerMakers[0](proxytest.NewPrefixJournal(journal, "1/"), "/cri"),
@@ -127,20 +154,30 @@ func newProxyTester(t *testing.T, secondSocketSpec string, fakeCriServerMakers [
 	// NOTE: in reality the loopback address should not be
 	// actually used for streaming unless you're absolutely sure
 	// that the only apiserver instance resides on this node
-	streamUrl, err := url.Parse("http://127.0.0.1:11250/")
-	if err != nil {
-		t.Fatalf("error parsing stream url: %v", err)
+	config := &Config{
+		Backends: []BackendConfig{
+			ParseBackendSpec(fakeCriSocketPath1),
+			ParseBackendSpec(secondSocketSpec),
+		},
+		StreamUrl: "http://127.0.0.1:11250/",
+	}
+	for n := range config.Backends {
+		config.Backends[n].ConnectionTimeout.Duration = connectionTimeoutForTests
+	}
+	if configure != nil {
+		configure(config)
 	}
 	var interceptors []Interceptor
-	for _, criVersion := range []CRIVersion{&CRI19{}, &CRI112{}} {
-		proxy, err := NewRuntimeProxy(criVersion, []string{fakeCriSocketPath1, secondSocketSpec}, connectionTimeoutForTests, streamUrl)
+	for _, criVersion := range []CRIVersion{&CRI19{}, &CRI112{}, &CRI1{}} {
+		proxy, err := NewRuntimeProxy(criVersion, config, middleware...)
 		if err != nil {
 			t.Fatalf("failed to create runtime proxy: %v", err)
 		}
 		interceptors = append(interceptors, proxy)
+		tester.proxies = append(tester.proxies, proxy)
 	}
 	tester.proxyServer = NewServer(interceptors, func() {
-		tester.hookCallCount++
+		atomic.AddInt32(&tester.hookCallCount, 1)
 	})
 
 	return tester
@@ -167,6 +204,18 @@ func (tester *proxyTester) connectToProxy(t *testing.T) {
 	tester.conn = conn
 }
 
+// connectAll makes the proxy with the specified index connect
+// to all of its runtimes and waits for it to finish handling
+// the new connections.
+func (tester *proxyTester) connectAll(t *testing.T, n int) {
+	for _, c := range tester.proxies[n].clientSet.clients {
+		if err := <-c.connect(); err != nil {
+			t.Fatalf("connect(): %v", err)
+		}
+		waitForOnConnected(c)
+	}
+}
+
 func (tester *proxyTester) stop() {
 	if tester.conn != nil {
 		tester.conn.Close()
@@ -189,6 +238,20 @@ func (tester *proxyTester) verifyJournal(t *testing.T, expectedItems []string) {
 	}
 }
 
+// verifyJournalUnordered verifies the journal for the requests
+// that are passed to the runtimes in parallel.
+func (tester *proxyTester) verifyJournalUnordered(t *testing.T, expectedItems []string) {
+	if err := tester.journal.VerifyUnordered(expectedItems); err != nil {
+		t.Error(err)
+	}
+}
+
+// waitForOnConnected waits for the calls of the client's
+// onConnected hook that are in progress to complete.
+func waitForOnConnected(c client) {
+	c.(*autoClient).onConnectedCalls.Wait()
+}
+
 func (tester *proxyTester) invoke(method string, in, resp interface{}) error {
 	return grpc.Invoke(context.Background(), method, in, resp, tester.conn)
 }
@@ -228,7 +291,7 @@ func (tester *proxyTester) verifyCall(t *testing.T, method string, in, resp inte
 }
 
 func verifyCRIProxy(t *testing.T, secondSocketSpec string, useNewCriVersionForProxy bool, fakeCriServerMakers []makeFakeCriServerFunc) {
-	tester := newProxyTester(t, secondSocketSpec, fakeCriServerMakers)
+	tester := newProxyTester(t, secondSocketSpec, fakeCriServerMakers, nil)
 	defer tester.stop()
 	tester.startServers(t, -1)
 	tester.startProxy(t)
@@ -271,28 +334,6 @@ func verifyCRIProxy(t *testing.T, secondSocketSpec string, useNewCriVersionForPr
 			// to verify the connection
 			journal: []string{"1/runtime/Version", "1/runtime/Version"},
 		},
-		{
-			name:   "status",
-			method: "/runtime.RuntimeService/Status",
-			in:     &runtimeapi.StatusRequest{},
-			resp: &runtimeapi.StatusResponse{
-				Status: &runtimeapi.RuntimeStatus{
-					Conditions: []*runtimeapi.RuntimeCondition{
-						{
-							Type:   "RuntimeReady",
-							Status: true,
-						},
-						{
-							Type:   "NetworkReady",
-							Status: true,
-						},
-					},
-				},
-			},
-			// FIXME: actually, both runtimes need to be contacted and
-			// the result needs to be combined
-			journal: []string{"1/runtime/Status"},
-		},
 		{
 			name:   "run pod sandbox 1",
 			method: "/runtime.RuntimeService/RunPodSandbox",
@@ -358,6 +399,37 @@ func verifyCRIProxy(t *testing.T, secondSocketSpec string, useNewCriVersionForPr
 			resp:  &runtimeapi.RunPodSandboxResponse{},
 			error: "criproxy: unknown runtime: \"badruntime\"",
 		},
+		{
+			// this is done after the alt runtime is connected,
+			// the status of the runtimes that aren't connected
+			// is checked in TestCriProxyStatus
+			name:   "status",
+			method: "/runtime.RuntimeService/Status",
+			in:     &runtimeapi.StatusRequest{},
+			resp: &runtimeapi.StatusResponse{
+				Status: &runtimeapi.RuntimeStatus{
+					Conditions: []*runtimeapi.RuntimeCondition{
+						{
+							Type:   "RuntimeReady",
+							Status: true,
+						},
+						{
+							Type:   "NetworkReady",
+							Status: true,
+						},
+						{
+							Type:   "alt/RuntimeReady",
+							Status: true,
+						},
+						{
+							Type:   "alt/NetworkReady",
+							Status: true,
+						},
+					},
+				},
+			},
+			journal: []string{"1/runtime/Status", "2/runtime/Status"},
+		},
 		{
 			name:   "list pod sandboxes",
 			method: "/runtime.RuntimeService/ListPodSandbox",
@@ -1441,7 +1513,14 @@ func verifyCRIProxy(t *testing.T, secondSocketSpec string, useNewCriVersionForPr
 					}
 				}
 				tester.verifyCall(t, method, req, resp, step.error)
-				tester.verifyJournal(t, step.journal)
+				// List* and ImageFsInfo requests are passed to the
+				// runtimes in parallel, so the order of the journal
+				// items isn't defined for them
+				if strings.Contains(method, "Service/List") || strings.HasSuffix(method, "/ImageFsInfo") {
+					tester.verifyJournalUnordered(t, step.journal)
+				} else {
+					tester.verifyJournal(t, step.journal)
+				}
 			})
 		}
 
@@ -1449,8 +1528,8 @@ func verifyCRIProxy(t *testing.T, secondSocketSpec string, useNewCriVersionForPr
 			break
 		}
 	}
-	if tester.hookCallCount != nCalls {
-		t.Errorf("unexpected hook call count: %d instead of %d", tester.hookCallCount, nCalls)
+	if hookCallCount := int(atomic.LoadInt32(&tester.hookCallCount)); hookCallCount != nCalls {
+		t.Errorf("unexpected hook call count: %d instead of %d", hookCallCount, nCalls)
 	}
 }
 
@@ -1479,7 +1558,7 @@ func TestCriProxyInactiveServers(t *testing.T) {
 	tester := newProxyTester(t, altSocketSpec, []makeFakeCriServerFunc{
 		proxytest.NewFakeCriServer19,
 		proxytest.NewFakeCriServer19,
-	})
+	}, nil)
 	defer tester.stop()
 	tester.startServers(t, 0)
 
@@ -1641,10 +1720,2602 @@ func TestCriProxyInactiveServers(t *testing.T) {
 	tester.verifyJournal(t, []string{"1/runtime/ListContainers"})
 }
 
-func init() {
-	// FIXME: testing.Verbose() always returns false
-	flag.Set("logtostderr", "true")
-	flag.Set("v", "5")
+func TestCriProxyRuntimeHandlers(t *testing.T) {
+	tester := newProxyTester(t, altSocketSpec, []makeFakeCriServerFunc{
+		proxytest.NewFakeCriServer110,
+		proxytest.NewFakeCriServer110,
+	}, func(config *Config) {
+		config.Backends[0].RuntimeHandlers = []string{"runc"}
+		config.Backends[1].RuntimeHandlers = []string{"vm"}
+	})
+	defer tester.stop()
+	tester.startServers(t, -1)
+	tester.startProxy(t)
+	tester.connectToProxy(t)
+	tester.skipJournalItems("1/runtime/Version", "2/runtime/Version")
+
+	for _, tc := range []struct {
+		name, handler, targetRuntime, expectedId string
+		journal                                  []string
+	}{
+		{
+			name:       "no handler, no annotation",
+			expectedId: "pod-1_default_" + podUid1 + "_0",
+			journal:    []string{"1/runtime/RunPodSandbox"},
+		},
+		{
+			name:       "unmapped handler",
+			handler:    "unknown",
+			expectedId: "pod-2_default_" + podUid1 + "_0",
+			journal:    []string{"1/runtime/RunPodSandbox"},
+		},
+		{
+			name:          "unmapped handler with annotation",
+			handler:       "unknown",
+			targetRuntime: "alt",
+			expectedId:    "alt__pod-3_default_" + podUid1 + "_0",
+			journal:       []string{"2/runtime/RunPodSandbox"},
+		},
+		{
+			name:       "handler mapped to a secondary runtime",
+			handler:    "vm",
+			expectedId: "alt__pod-4_default_" + podUid1 + "_0",
+			journal:    []string{"2/runtime/RunPodSandbox"},
+		},
+		{
+			name:          "handler overrides the annotation",
+			handler:       "runc",
+			targetRuntime: "alt",
+			expectedId:    "pod-5_default_" + podUid1 + "_0",
+			journal:       []string{"1/runtime/RunPodSandbox"},
+		},
+		{
+			name:          "handler overrides a bad annotation",
+			handler:       "vm",
+			targetRuntime: "badruntime",
+			expectedId:    "alt__pod-6_default_" + podUid1 + "_0",
+			journal:       []string{"2/runtime/RunPodSandbox"},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			podName := strings.SplitN(strings.TrimPrefix(tc.expectedId, "alt__"), "_", 2)[0]
+			req := &v1_12.RunPodSandboxRequest{
+				Config: &v1_12.PodSandboxConfig{
+					Metadata: &v1_12.PodSandboxMetadata{
+						Name:      podName,
+						Uid:       podUid1,
+						Namespace: "default",
+					},
+				},
+				RuntimeHandler: tc.handler,
+			}
+			if tc.targetRuntime != "" {
+				req.Config.Annotations = map[string]string{
+					"kubernetes.io/target-runtime": tc.targetRuntime,
+				}
+			}
+			tester.verifyCall(t, "/runtime.v1alpha2.RuntimeService/RunPodSandbox", req, &v1_12.RunPodSandboxResponse{
+				PodSandboxId: tc.expectedId,
+			}, "")
+			tester.verifyJournal(t, tc.journal)
+		})
+	}
 }
 
-// TODO: test reconnecting after restart of a runtime
+func TestCriProxyRouting(t *testing.T) {
+	var config *Config
+	tester := newProxyTester(t, altSocketSpec, []makeFakeCriServerFunc{
+		proxytest.NewFakeCriServer110,
+		proxytest.NewFakeCriServer110,
+	}, func(c *Config) {
+		c.Backends[0].RuntimeHandlers = []string{"runc"}
+		c.Routing = &RoutingConfig{
+			Rules: []RoutingRule{
+				{
+					Name:       "vms",
+					Namespaces: []string{"vms"},
+					Runtime:    "alt",
+				},
+				{
+					Labels:  map[string]string{"sandbox": "kata"},
+					Runtime: "alt",
+				},
+				{
+					Namespaces: []string{"kube-system"},
+					Runtime:    "",
+				},
+			},
+		}
+		config = c
+	})
+	defer tester.stop()
+	tester.startServers(t, -1)
+	tester.startProxy(t)
+	tester.connectToProxy(t)
+	tester.skipJournalItems("1/runtime/Version", "2/runtime/Version")
+
+	for _, tc := range []struct {
+		name, namespace, handler, targetRuntime, expectedId string
+		labels                                              map[string]string
+		dryRun                                              bool
+		journal                                             []string
+	}{
+		{
+			name:       "namespace rule",
+			namespace:  "vms",
+			expectedId: "alt__pod-1_vms_" + podUid1 + "_0",
+			journal:    []string{"2/runtime/RunPodSandbox"},
+		},
+		{
+			name:       "label rule",
+			namespace:  "default",
+			labels:     map[string]string{"sandbox": "kata", "app": "test"},
+			expectedId: "alt__pod-2_default_" + podUid1 + "_0",
+			journal:    []string{"2/runtime/RunPodSandbox"},
+		},
+		{
+			name:       "no matching rule",
+			namespace:  "default",
+			labels:     map[string]string{"sandbox": "runc"},
+			expectedId: "pod-3_default_" + podUid1 + "_0",
+			journal:    []string{"1/runtime/RunPodSandbox"},
+		},
+		{
+			name:          "annotation overrides the rules",
+			namespace:     "kube-system",
+			targetRuntime: "alt",
+			expectedId:    "alt__pod-4_kube-system_" + podUid1 + "_0",
+			journal:       []string{"2/runtime/RunPodSandbox"},
+		},
+		{
+			name:       "handler overrides the rules",
+			namespace:  "vms",
+			handler:    "runc",
+			expectedId: "pod-5_vms_" + podUid1 + "_0",
+			journal:    []string{"1/runtime/RunPodSandbox"},
+		},
+		{
+			name:       "dry run",
+			namespace:  "vms",
+			dryRun:     true,
+			expectedId: "pod-6_vms_" + podUid1 + "_0",
+			journal:    []string{"1/runtime/RunPodSandbox"},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if tc.dryRun {
+				config.Routing.DryRun = true
+				tester.reload(t, config)
+			}
+			podName := strings.SplitN(strings.TrimPrefix(tc.expectedId, "alt__"), "_", 2)[0]
+			req := &v1_12.RunPodSandboxRequest{
+				Config: &v1_12.PodSandboxConfig{
+					Metadata: &v1_12.PodSandboxMetadata{
+						Name:      podName,
+						Uid:       podUid1,
+						Namespace: tc.namespace,
+					},
+					Labels: tc.labels,
+				},
+				RuntimeHandler: tc.handler,
+			}
+			if tc.targetRuntime != "" {
+				req.Config.Annotations = map[string]string{
+					"kubernetes.io/target-runtime": tc.targetRuntime,
+				}
+			}
+			tester.verifyCall(t, "/runtime.v1alpha2.RuntimeService/RunPodSandbox", req, &v1_12.RunPodSandboxResponse{
+				PodSandboxId: tc.expectedId,
+			}, "")
+			tester.verifyJournal(t, tc.journal)
+		})
+	}
+}
+
+func TestCriProxyImageMappings(t *testing.T) {
+	tester := newProxyTester(t, altSocketSpec, []makeFakeCriServerFunc{
+		proxytest.NewFakeCriServer19,
+		proxytest.NewFakeCriServer19,
+	}, func(config *Config) {
+		config.Backends[1].Images = []ImageMapping{
+			{Image: "registry.vms.example.com/*", RuntimeImage: "*"},
+		}
+	})
+	defer tester.stop()
+	tester.startServers(t, -1)
+	tester.startProxy(t)
+	tester.connectToProxy(t)
+	tester.connectAll(t, 0)
+	tester.verifyJournalUnordered(t, []string{"1/runtime/Version", "2/runtime/Version"})
+
+	// the images from the registry only go to the runtime
+	// that owns them, without the registry part
+	const image = "registry.vms.example.com/cirros"
+	var pullResp runtimeapi.PullImageResponse
+	if err := tester.invoke("/runtime.ImageService/PullImage", &runtimeapi.PullImageRequest{
+		Image: &runtimeapi.ImageSpec{Image: image},
+	}, &pullResp); err != nil {
+		t.Fatalf("PullImage failed: %v", err)
+	}
+	tester.verifyJournal(t, []string{"2/image/PullImage"})
+	if pullResp.ImageRef != "cirros" {
+		t.Errorf("bad image ref %q", pullResp.ImageRef)
+	}
+
+	var statusResp runtimeapi.ImageStatusResponse
+	if err := tester.invoke("/runtime.ImageService/ImageStatus", &runtimeapi.ImageStatusRequest{
+		Image: &runtimeapi.ImageSpec{Image: image},
+	}, &statusResp); err != nil {
+		t.Fatalf("ImageStatus failed: %v", err)
+	}
+	tester.verifyJournal(t, []string{"2/image/ImageStatus"})
+	if statusResp.Image == nil || statusResp.Image.Id != image || !reflect.DeepEqual(statusResp.Image.RepoTags, []string{image}) {
+		t.Errorf("bad image status: %#v", statusResp.Image)
+	}
+
+	// the names of the runtime's images are mapped back
+	var listResp runtimeapi.ListImagesResponse
+	if err := tester.invoke("/runtime.ImageService/ListImages", &runtimeapi.ListImagesRequest{}, &listResp); err != nil {
+		t.Fatalf("ListImages failed: %v", err)
+	}
+	tester.verifyJournalUnordered(t, []string{"1/image/ListImages", "2/image/ListImages"})
+	var tags []string
+	for _, img := range listResp.Images {
+		tags = append(tags, img.RepoTags...)
+	}
+	sort.Strings(tags)
+	expectedTags := []string{
+		"image1-1",
+		"image1-2",
+		image,
+		"registry.vms.example.com/image2-1",
+		"registry.vms.example.com/image2-2",
+	}
+	if !reflect.DeepEqual(tags, expectedTags) {
+		t.Errorf("bad image tags: %v instead of %v", tags, expectedTags)
+	}
+
+	// CreateContainer uses the same mapping
+	if err := tester.invoke("/runtime.RuntimeService/RunPodSandbox", &runtimeapi.RunPodSandboxRequest{
+		Config: &runtimeapi.PodSandboxConfig{
+			Metadata: &runtimeapi.PodSandboxMetadata{
+				Name:      "pod-2-1",
+				Uid:       podUid2,
+				Namespace: "default",
+			},
+			Annotations: map[string]string{
+				"kubernetes.io/target-runtime": "alt",
+			},
+		},
+	}, &runtimeapi.RunPodSandboxResponse{}); err != nil {
+		t.Fatalf("RunPodSandbox failed: %v", err)
+	}
+	if err := tester.invoke("/runtime.RuntimeService/CreateContainer", &runtimeapi.CreateContainerRequest{
+		PodSandboxId: podSandboxId2,
+		Config: &runtimeapi.ContainerConfig{
+			Metadata: &runtimeapi.ContainerMetadata{Name: "container2"},
+			Image:    &runtimeapi.ImageSpec{Image: image},
+		},
+	}, &runtimeapi.CreateContainerResponse{}); err != nil {
+		t.Fatalf("CreateContainer failed: %v", err)
+	}
+	tester.verifyJournal(t, []string{"2/runtime/RunPodSandbox", "2/runtime/CreateContainer"})
+	var containerResp runtimeapi.ContainerStatusResponse
+	if err := tester.invoke("/runtime.RuntimeService/ContainerStatus", &runtimeapi.ContainerStatusRequest{
+		ContainerId: containerId2,
+	}, &containerResp); err != nil {
+		t.Fatalf("ContainerStatus failed: %v", err)
+	}
+	if containerResp.Status == nil || containerResp.Status.Image.GetImage() != image || containerResp.Status.ImageRef != "cirros" {
+		t.Errorf("bad container status: %#v", containerResp.Status)
+	}
+}
+
+func TestCriProxyImagePolicies(t *testing.T) {
+	// the alt runtime fails to pull the "broken" image
+	var altPullAuth *runtimeapi.AuthConfig
+	failPulls := func(ctx context.Context, req *BackendRequest, next Invoker) error {
+		if in, ok := req.Request.Unwrap().(*runtimeapi.PullImageRequest); ok && req.RuntimeID == "alt" {
+			if in.Image.Image == "broken" {
+				return grpc.Errorf(codes.Unavailable, "can't pull the image")
+			}
+			altPullAuth = in.Auth
+		}
+		return next(ctx, req)
+	}
+	var config *Config
+	tester := newProxyTester(t, altSocketSpec, []makeFakeCriServerFunc{
+		proxytest.NewFakeCriServer19,
+		proxytest.NewFakeCriServer19,
+	}, func(c *Config) {
+		c.Backends[0].ImagePolicy = ImagePolicyMatching
+		c.Backends[1].ImagePolicy = ImagePolicyMatching
+		config = c
+	}, failPulls)
+	defer tester.stop()
+	tester.startServers(t, -1)
+	tester.startProxy(t)
+	tester.connectToProxy(t)
+	tester.connectAll(t, 0)
+	tester.verifyJournalUnordered(t, []string{"1/runtime/Version", "2/runtime/Version"})
+
+	pullImage := func(image, expectedRef string, expectedJournal []string) {
+		var resp runtimeapi.PullImageResponse
+		if err := tester.invoke("/runtime.ImageService/PullImage", &runtimeapi.PullImageRequest{
+			Image: &runtimeapi.ImageSpec{Image: image},
+		}, &resp); err != nil {
+			t.Fatalf("PullImage(%q) failed: %v", image, err)
+		}
+		tester.verifyJournalUnordered(t, expectedJournal)
+		if resp.ImageRef != expectedRef {
+			t.Errorf("PullImage(%q): bad image ref %q instead of %q", image, resp.ImageRef, expectedRef)
+		}
+	}
+
+	// with the matching policy, the images only go
+	// to the runtimes they match
+	pullImage("alt/image3", "alt/image3", []string{"2/image/PullImage"})
+	pullImage("image3", "image3", []string{"1/image/PullImage"})
+
+	// the image is present if all of the matching runtimes have it
+	var statusResp runtimeapi.ImageStatusResponse
+	if err := tester.invoke("/runtime.ImageService/ImageStatus", &runtimeapi.ImageStatusRequest{
+		Image: &runtimeapi.ImageSpec{Image: "image1-1"},
+	}, &statusResp); err != nil {
+		t.Fatalf("ImageStatus failed: %v", err)
+	}
+	tester.verifyJournal(t, []string{"1/image/ImageStatus"})
+	if statusResp.Image == nil || statusResp.Image.Id != "image1-1" {
+		t.Errorf("bad image status: %#v", statusResp.Image)
+	}
+
+	// with the lazy policy, the image is pulled
+	// by CreateContainer
+	config.Backends[1].ImagePolicy = ImagePolicyLazy
+	tester.reload(t, config)
+	imageStatus := func(image string) *runtimeapi.Image {
+		var resp runtimeapi.ImageStatusResponse
+		if err := tester.invoke("/runtime.ImageService/ImageStatus", &runtimeapi.ImageStatusRequest{
+			Image: &runtimeapi.ImageSpec{Image: image},
+		}, &resp); err != nil {
+			t.Fatalf("ImageStatus(%q) failed: %v", image, err)
+		}
+		return resp.Image
+	}
+	// the image is missing until the lazy runtime pulls it
+	if img := imageStatus("alt/image4"); img != nil && img.Id != "" {
+		t.Errorf("the image that's not pulled yet is reported as present: %#v", img)
+	}
+	tester.verifyJournal(t, []string{"2/image/ImageStatus"})
+	auth := &runtimeapi.AuthConfig{Username: "user", Password: "secret"}
+	var pullResp runtimeapi.PullImageResponse
+	if err := tester.invoke("/runtime.ImageService/PullImage", &runtimeapi.PullImageRequest{
+		Image: &runtimeapi.ImageSpec{Image: "alt/image4"},
+		Auth:  auth,
+	}, &pullResp); err != nil {
+		t.Fatalf("PullImage failed: %v", err)
+	}
+	tester.verifyJournal(t, nil)
+	if pullResp.ImageRef != "alt/image4" {
+		t.Errorf("bad image ref %q", pullResp.ImageRef)
+	}
+	if err := tester.invoke("/runtime.RuntimeService/RunPodSandbox", &runtimeapi.RunPodSandboxRequest{
+		Config: &runtimeapi.PodSandboxConfig{
+			Metadata: &runtimeapi.PodSandboxMetadata{
+				Name:      "pod-2-1",
+				Uid:       podUid2,
+				Namespace: "default",
+			},
+			Annotations: map[string]string{
+				"kubernetes.io/target-runtime": "alt",
+			},
+		},
+	}, &runtimeapi.RunPodSandboxResponse{}); err != nil {
+		t.Fatalf("RunPodSandbox failed: %v", err)
+	}
+	if err := tester.invoke("/runtime.RuntimeService/CreateContainer", &runtimeapi.CreateContainerRequest{
+		PodSandboxId: podSandboxId2,
+		Config: &runtimeapi.ContainerConfig{
+			Metadata: &runtimeapi.ContainerMetadata{Name: "container2"},
+			Image:    &runtimeapi.ImageSpec{Image: "alt/image4"},
+		},
+	}, &runtimeapi.CreateContainerResponse{}); err != nil {
+		t.Fatalf("CreateContainer failed: %v", err)
+	}
+	tester.verifyJournal(t, []string{
+		"2/runtime/RunPodSandbox",
+		"2/image/ImageStatus",
+		"2/image/PullImage",
+		"2/runtime/CreateContainer",
+	})
+	// the credentials from PullImage are used to pull the image
+	if !reflect.DeepEqual(altPullAuth, auth) {
+		t.Errorf("bad credentials for the lazy pull: %#v", altPullAuth)
+	}
+	// after that, the image is present, so kubelet
+	// doesn't pull it again
+	if img := imageStatus("alt/image4"); img == nil || img.Id != "alt/image4" {
+		t.Errorf("bad image status after the lazy pull: %#v", img)
+	}
+	tester.verifyJournal(t, []string{"2/image/ImageStatus"})
+
+	// partial failures fail PullImage unless they're ignored
+	config.Backends[0].ImagePolicy = ImagePolicyAll
+	config.Backends[1].ImagePolicy = ImagePolicyAll
+	tester.reload(t, config)
+	if err := tester.invoke("/runtime.ImageService/PullImage", &runtimeapi.PullImageRequest{
+		Image: &runtimeapi.ImageSpec{Image: "broken"},
+	}, &runtimeapi.PullImageResponse{}); err == nil {
+		t.Errorf("PullImage didn't fail")
+	}
+	tester.verifyJournal(t, []string{"1/image/PullImage"})
+
+	config.ImageFailurePolicy = ImageFailurePolicyIgnore
+	tester.reload(t, config)
+	pullImage("broken", "broken", []string{"1/image/PullImage"})
+
+	// the requests fail if the only runtime
+	// that gets the image isn't connected
+	config.Backends[0].ImagePolicy = ImagePolicyMatching
+	config.Backends[1].ImagePolicy = ImagePolicyMatching
+	tester.reload(t, config)
+	tester.servers[1].Stop()
+	// make the proxy notice that the runtime is gone
+	if err := tester.invoke("/runtime.ImageService/PullImage", &runtimeapi.PullImageRequest{
+		Image: &runtimeapi.ImageSpec{Image: "alt/image5"},
+	}, &runtimeapi.PullImageResponse{}); err == nil {
+		t.Errorf("PullImage didn't fail for a runtime that's down")
+	}
+	if err := tester.invoke("/runtime.ImageService/PullImage", &runtimeapi.PullImageRequest{
+		Image: &runtimeapi.ImageSpec{Image: "alt/image5"},
+	}, &runtimeapi.PullImageResponse{}); grpc.Code(err) != codes.Unavailable {
+		t.Errorf("PullImage: unexpected error %v for a runtime that isn't connected (expected Unavailable)", err)
+	}
+	if err := tester.invoke("/runtime.ImageService/RemoveImage", &runtimeapi.RemoveImageRequest{
+		Image: &runtimeapi.ImageSpec{Image: "alt/image3"},
+	}, &runtimeapi.RemoveImageResponse{}); grpc.Code(err) != codes.Unavailable {
+		t.Errorf("RemoveImage: unexpected error %v for a runtime that isn't connected (expected Unavailable)", err)
+	}
+	tester.verifyJournal(t, nil)
+}
+
+func (tester *proxyTester) reload(t *testing.T, config *Config) {
+	for _, proxy := range tester.proxies {
+		if err := proxy.Reload(config); err != nil {
+			t.Fatalf("Reload(): %v", err)
+		}
+	}
+}
+
+func TestCriProxyReload(t *testing.T) {
+	tester := newProxyTester(t, altSocketSpec, []makeFakeCriServerFunc{
+		proxytest.NewFakeCriServer19,
+		proxytest.NewFakeCriServer19,
+	}, func(config *Config) {
+		config.Backends = config.Backends[:1]
+	})
+	defer tester.stop()
+	tester.startServers(t, -1)
+	tester.startProxy(t)
+	tester.connectToProxy(t)
+	tester.skipJournalItems("1/runtime/Version", "2/runtime/Version")
+
+	runPodSandbox := func(name, expectedId, expectedError string) {
+		tester.verifyCall(t, "/runtime.RuntimeService/RunPodSandbox", &runtimeapi.RunPodSandboxRequest{
+			Config: &runtimeapi.PodSandboxConfig{
+				Metadata: &runtimeapi.PodSandboxMetadata{
+					Name:      name,
+					Uid:       podUid1,
+					Namespace: "default",
+				},
+				Annotations: map[string]string{
+					"kubernetes.io/target-runtime": "alt",
+				},
+			},
+		}, &runtimeapi.RunPodSandboxResponse{PodSandboxId: expectedId}, expectedError)
+	}
+
+	// make the proxy connect to the primary runtime
+	if err := tester.invoke("/runtime.RuntimeService/Version", &runtimeapi.VersionRequest{}, &runtimeapi.VersionResponse{}); err != nil {
+		t.Fatalf("Version(): %v", err)
+	}
+	runPodSandbox("pod-1", "", `criproxy: unknown runtime: "alt"`)
+	tester.verifyJournal(t, nil)
+	primaryClient := tester.proxies[0].clientSet.clients[0]
+
+	altConfig := &Config{
+		Backends: []BackendConfig{
+			ParseBackendSpec(fakeCriSocketPath1),
+			ParseBackendSpec(altSocketSpec),
+		},
+		StreamUrl: "http://127.0.0.1:11250/",
+	}
+	for n := range altConfig.Backends {
+		altConfig.Backends[n].ConnectionTimeout.Duration = connectionTimeoutForTests
+	}
+	tester.reload(t, altConfig)
+	runPodSandbox("pod-2", "alt__pod-2_default_"+podUid1+"_0", "")
+	tester.verifyJournal(t, []string{"2/runtime/RunPodSandbox"})
+	if tester.proxies[0].clientSet.clients[0] != primaryClient {
+		t.Errorf("the client for the primary runtime was replaced")
+	}
+
+	for _, proxy := range tester.proxies {
+		if err := proxy.Reload(&Config{
+			Backends: []BackendConfig{ParseBackendSpec(altSocketSpec)},
+		}); err == nil {
+			t.Errorf("Reload() didn't fail for a config without the primary runtime")
+		}
+	}
+	// the listener of the streaming endpoint is only started
+	// when the proxy starts
+	for _, proxy := range tester.proxies {
+		if err := proxy.Reload(&Config{
+			Backends:  altConfig.Backends,
+			Streaming: &StreamingConfig{Address: "127.0.0.1:10010"},
+		}); err == nil {
+			t.Errorf("Reload() didn't fail for a config that adds the streaming endpoint")
+		}
+	}
+	// the configuration must not change after a failed reload
+	runPodSandbox("pod-3", "alt__pod-3_default_"+podUid1+"_0", "")
+	tester.verifyJournal(t, []string{"2/runtime/RunPodSandbox"})
+
+	altClient := tester.proxies[0].clientSet.clients[1]
+	// a request that still uses an older set that has the
+	// client keeps it from being stopped even if the client
+	// was reused by the next set
+	oldSet := tester.proxies[0].acquireClientSet()
+	tester.reload(t, altConfig)
+	if tester.proxies[0].clientSet.clients[1] != altClient {
+		t.Errorf("the client for the alt runtime was replaced")
+	}
+	tester.reload(t, &Config{
+		Backends:  altConfig.Backends[:1],
+		StreamUrl: "http://127.0.0.1:11250/",
+	})
+	runPodSandbox("pod-4", "", `criproxy: unknown runtime: "alt"`)
+	tester.verifyJournal(t, nil)
+	time.Sleep(200 * time.Millisecond)
+	if altClient.currentState() == clientStateOffline {
+		t.Errorf("the removed client was stopped while an older client set was in use")
+	}
+	oldSet.inFlight.Done()
+	for i := 0; altClient.currentState() != clientStateOffline; i++ {
+		if i == 100 {
+			t.Fatalf("the removed client wasn't stopped")
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+
+	tester.verifyCall(t, "/runtime.RuntimeService/ListPodSandbox", &runtimeapi.ListPodSandboxRequest{}, &runtimeapi.ListPodSandboxResponse{}, "")
+	tester.verifyJournal(t, []string{"1/runtime/ListPodSandbox"})
+}
+
+func TestCriProxyMetrics(t *testing.T) {
+	tester := newProxyTester(t, altSocketSpec, []makeFakeCriServerFunc{
+		proxytest.NewFakeCriServer19,
+		proxytest.NewFakeCriServer19,
+	}, nil)
+	defer tester.stop()
+	tester.startServers(t, -1)
+	tester.startProxy(t)
+	tester.connectToProxy(t)
+
+	versionCount := requestCount.Get("RuntimeService/Version", "OK")
+	backendVersionCount := backendRequestCount.Get("", "RuntimeService/Version", "OK")
+	backendVersionLatencyCount := backendRequestDuration.Count("", "RuntimeService/Version")
+	failedCount := requestCount.Get("RuntimeService/RunPodSandbox", "Unknown")
+	reconnectCount := backendReconnectCount.Get("", fakeCriSocketPath1)
+
+	if err := tester.invoke("/runtime.RuntimeService/Version", &runtimeapi.VersionRequest{}, &runtimeapi.VersionResponse{}); err != nil {
+		t.Fatalf("Version(): %v", err)
+	}
+	tester.verifyCall(t, "/runtime.RuntimeService/RunPodSandbox", &runtimeapi.RunPodSandboxRequest{
+		Config: &runtimeapi.PodSandboxConfig{
+			Metadata: &runtimeapi.PodSandboxMetadata{
+				Name:      "pod-1",
+				Uid:       podUid1,
+				Namespace: "default",
+			},
+			Annotations: map[string]string{
+				"kubernetes.io/target-runtime": "no-such-runtime",
+			},
+		},
+	}, &runtimeapi.RunPodSandboxResponse{}, "unknown runtime")
+
+	if v := requestCount.Get("RuntimeService/Version", "OK") - versionCount; v != 1 {
+		t.Errorf("bad Version request count: %v instead of 1", v)
+	}
+	if v := backendRequestCount.Get("", "RuntimeService/Version", "OK") - backendVersionCount; v != 1 {
+		t.Errorf("bad Version request count for the primary runtime: %v instead of 1", v)
+	}
+	if v := backendRequestDuration.Count("", "RuntimeService/Version") - backendVersionLatencyCount; v != 1 {
+		t.Errorf("bad Version request latency observation count for the primary runtime: %v instead of 1", v)
+	}
+	if v := requestCount.Get("RuntimeService/RunPodSandbox", "Unknown") - failedCount; v != 1 {
+		t.Errorf("bad failed RunPodSandbox request count: %v instead of 1", v)
+	}
+
+	tester.proxies[0].clientSet.clients[0].handleError(grpc.Errorf(codes.Unavailable, "oops"), true)
+	if v := backendReconnectCount.Get("", fakeCriSocketPath1) - reconnectCount; v != 1 {
+		t.Errorf("bad reconnect count: %v instead of 1", v)
+	}
+	if err := tester.invoke("/runtime.RuntimeService/Version", &runtimeapi.VersionRequest{}, &runtimeapi.VersionResponse{}); err != nil {
+		t.Fatalf("Version(): %v", err)
+	}
+
+	tester.proxies[0].setImageNameById(sampleDigest, "image2-3", false)
+	registry := metrics.NewRegistry()
+	RegisterMetrics(registry, tester.proxies)
+	var buf bytes.Buffer
+	if err := registry.Write(&buf); err != nil {
+		t.Fatalf("Write(): %v", err)
+	}
+	out := buf.String()
+	for _, line := range []string{
+		fmt.Sprintf(`criproxy_backend_state{backend="",socket=%q,cri="runtime",state="connected"} 1`, fakeCriSocketPath1),
+		fmt.Sprintf(`criproxy_backend_state{backend="",socket=%q,cri="runtime",state="offline"} 0`, fakeCriSocketPath1),
+		fmt.Sprintf(`criproxy_backend_state{backend="",socket=%q,cri="runtime.v1alpha2",state="offline"} 1`, fakeCriSocketPath1),
+		fmt.Sprintf(`criproxy_backend_state{backend="alt",socket=%q,cri="runtime.v1alpha2",state="offline"} 1`, fakeCriSocketPath2),
+		`criproxy_image_cache_size{cri="runtime"} 1`,
+		`criproxy_image_cache_size{cri="runtime.v1alpha2"} 0`,
+		`criproxy_requests_total{method="RuntimeService/RunPodSandbox",code="Unknown"} `,
+		`criproxy_backend_request_duration_seconds_count{backend="",method="RuntimeService/Version"} `,
+		`criproxy_backend_reconnects_total{backend="",socket="/tmp/fake-cri-1.socket"} `,
+	} {
+		if !strings.Contains(out, "\n"+line) {
+			t.Errorf("metrics output doesn't contain %q:\n%s", line, out)
+		}
+	}
+}
+
+func TestCriProxyAdmin(t *testing.T) {
+	tester := newProxyTester(t, altSocketSpec, []makeFakeCriServerFunc{
+		proxytest.NewFakeCriServer110,
+		proxytest.NewFakeCriServer110,
+	}, nil)
+	defer tester.stop()
+	tester.startServers(t, 0)
+	tester.startProxy(t)
+
+	server := httptest.NewServer(NewAdminHandler(tester.proxies))
+	defer server.Close()
+	get := func(path string) (int, string) {
+		resp, err := http.Get(server.URL + path)
+		if err != nil {
+			t.Fatalf("GET %s: %v", path, err)
+		}
+		defer resp.Body.Close()
+		body, err := ioutil.ReadAll(resp.Body)
+		if err != nil {
+			t.Fatalf("GET %s: error reading body: %v", path, err)
+		}
+		return resp.StatusCode, string(body)
+	}
+	waitFor := func(what string, check func() bool) {
+		for i := 0; !check(); i++ {
+			if i == 100 {
+				t.Fatalf("timed out waiting for %s", what)
+			}
+			time.Sleep(50 * time.Millisecond)
+		}
+	}
+
+	if code, body := get("/healthz"); code != http.StatusOK || body != "ok\n" {
+		t.Errorf("/healthz: bad response: %d %q", code, body)
+	}
+	if code, body := get("/readyz"); code != http.StatusServiceUnavailable {
+		t.Errorf("/readyz: bad response: %d %q", code, body)
+	}
+	waitFor("the primary runtime to become connected", func() bool {
+		_, body := get("/readyz")
+		return !strings.Contains(body, `runtime ""`)
+	})
+	if code, body := get("/readyz"); code != http.StatusServiceUnavailable || !strings.Contains(body, `runtime "alt" (/tmp/fake-cri-2.socket) is connecting`) {
+		t.Errorf("/readyz: bad response: %d %q", code, body)
+	}
+
+	statuses, err := GetStatus(strings.TrimPrefix(server.URL, "http://"))
+	if err != nil {
+		t.Fatalf("GetStatus(): %v", err)
+	}
+	if len(statuses) != 3 {
+		t.Fatalf("bad number of statuses: %d instead of 3", len(statuses))
+	}
+	for n, expected := range []struct {
+		protoPackage string
+		converting   bool
+	}{
+		{"runtime", true},
+		{"runtime.v1alpha2", false},
+		{"runtime.v1", true},
+	} {
+		status := statuses[n]
+		if status.ProtoPackage != expected.protoPackage {
+			t.Errorf("status %d: bad proto package %q instead of %q", n, status.ProtoPackage, expected.protoPackage)
+		}
+		if len(status.Backends) != 2 {
+			t.Errorf("status %d: bad number of backends: %d instead of 2", n, len(status.Backends))
+			continue
+		}
+		expectedPrimary := BackendStatus{
+			Socket:       fakeCriSocketPath1,
+			State:        "connected",
+			ProtoPackage: "runtime.v1alpha2",
+			Converting:   expected.converting,
+		}
+		if !reflect.DeepEqual(status.Backends[0], expectedPrimary) {
+			t.Errorf("status %d: bad primary runtime status: %#v instead of %#v", n, status.Backends[0], expectedPrimary)
+		}
+		if alt := status.Backends[1]; alt.ID != "alt" || alt.State != "connecting" || alt.LastError == "" {
+			t.Errorf("status %d: bad alt runtime status: %#v", n, alt)
+		}
+	}
+
+	tester.startServers(t, 1)
+	waitFor("the proxy to become ready", func() bool {
+		code, _ := get("/readyz")
+		return code == http.StatusOK
+	})
+}
+
+func TestCriProxyV1(t *testing.T) {
+	// the primary runtime uses CRI v1alpha2, and the alt one uses CRI v1
+	tester := newProxyTester(t, altSocketSpec, []makeFakeCriServerFunc{
+		proxytest.NewFakeCriServer110,
+		proxytest.NewFakeCriServer1,
+	}, nil)
+	defer tester.stop()
+	tester.startServers(t, -1)
+	tester.startProxy(t)
+	tester.connectToProxy(t)
+	tester.skipJournalItems("1/runtime/Version", "2/runtime/Version")
+	// image requests skip the runtimes that aren't connected yet
+	for n := range tester.proxies {
+		tester.connectAll(t, n)
+	}
+
+	listImagesResp := &v1.ListImagesResponse{
+		Images: []*v1.Image{
+			{
+				Id:       "image1-1",
+				RepoTags: []string{"image1-1"},
+				Size_:    fakeImageSize1,
+			},
+			{
+				Id:       "image1-2",
+				RepoTags: []string{"image1-2"},
+				Size_:    fakeImageSize1,
+			},
+			{
+				Id:       "alt/image2-1",
+				RepoTags: []string{"alt/image2-1"},
+				Size_:    fakeImageSize2,
+			},
+			{
+				Id:       "alt/image2-2",
+				RepoTags: []string{"alt/image2-2"},
+				Size_:    fakeImageSize2,
+			},
+		},
+	}
+	for n, protoPackage := range []string{"runtime", "runtime.v1alpha2", "runtime.v1"} {
+		req, err := runtimeapis.Convert(&v1.ListImagesRequest{}, protoPackage)
+		if err != nil {
+			t.Fatalf("Convert: %v", err)
+		}
+		resp, err := runtimeapis.Convert(listImagesResp, protoPackage)
+		if err != nil {
+			t.Fatalf("Convert: %v", err)
+		}
+		tester.verifyCall(t, fmt.Sprintf("/%s.ImageService/ListImages", protoPackage), req, resp, "")
+		tester.verifyJournalUnordered(t, []string{"1/image/ListImages", "2/image/ListImages"})
+
+		status := tester.proxies[n].Status()
+		if len(status.Backends) != 2 {
+			t.Fatalf("%s: bad number of backends: %d instead of 2", protoPackage, len(status.Backends))
+		}
+		for i, expected := range []struct {
+			protoPackage string
+		}{
+			{"runtime.v1alpha2"},
+			{"runtime.v1"},
+		} {
+			b := status.Backends[i]
+			if b.ProtoPackage != expected.protoPackage {
+				t.Errorf("%s: backend %d: bad proto package %q instead of %q", protoPackage, i, b.ProtoPackage, expected.protoPackage)
+			}
+			if converting := expected.protoPackage != protoPackage; b.Converting != converting {
+				t.Errorf("%s: backend %d: bad converting flag: %v instead of %v", protoPackage, i, b.Converting, converting)
+			}
+		}
+	}
+
+	tester.verifyCall(t, "/runtime.v1.RuntimeService/ReopenContainerLog", &v1.ReopenContainerLogRequest{
+		ContainerId: containerId2,
+	}, &v1.ReopenContainerLogResponse{}, "")
+	tester.verifyJournal(t, []string{"2/runtime/ReopenContainerLog"})
+}
+
+func TestCriProxyContainerEvents(t *testing.T) {
+	savedRetryInterval := eventStreamRetryInterval
+	eventStreamRetryInterval = 100 * time.Millisecond
+	defer func() { eventStreamRetryInterval = savedRetryInterval }()
+
+	tester := newProxyTester(t, altSocketSpec, []makeFakeCriServerFunc{
+		proxytest.NewFakeCriServer1,
+		proxytest.NewFakeCriServer1,
+	}, nil)
+	defer tester.stop()
+	tester.startServers(t, -1)
+	tester.startProxy(t)
+	tester.connectToProxy(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	stream, err := grpc.NewClientStream(ctx, &v1.GetContainerEventsStreamDesc, tester.conn, "/runtime.v1.RuntimeService/GetContainerEvents")
+	if err != nil {
+		t.Fatalf("GetContainerEvents: %v", err)
+	}
+	if err := stream.SendMsg(&v1.GetEventsRequest{}); err != nil {
+		t.Fatalf("SendMsg(): %v", err)
+	}
+	if err := stream.CloseSend(); err != nil {
+		t.Fatalf("CloseSend(): %v", err)
+	}
+	events := make(chan *v1.ContainerEventResponse, 100)
+	go func() {
+		defer close(events)
+		for {
+			event := &v1.ContainerEventResponse{}
+			if err := stream.RecvMsg(event); err != nil {
+				return
+			}
+			events <- event
+		}
+	}()
+
+	waitForStream := func(n int) *proxytest.FakeCriServer1 {
+		server := tester.servers[n].(*proxytest.FakeCriServer1)
+		for i := 0; server.ContainerEventStreamCount() == 0; i++ {
+			if i == 200 {
+				t.Fatalf("timed out waiting for the event stream of runtime %d", n)
+			}
+			time.Sleep(50 * time.Millisecond)
+		}
+		return server
+	}
+	makeEvent := func(podSandboxId, containerId, image string) *v1.ContainerEventResponse {
+		return &v1.ContainerEventResponse{
+			ContainerId:        containerId,
+			ContainerEventType: v1.ContainerEventType_CONTAINER_STARTED_EVENT,
+			CreatedAt:          4242,
+			PodSandboxStatus: &v1.PodSandboxStatus{
+				Id:    podSandboxId,
+				State: v1.PodSandboxState_SANDBOX_READY,
+			},
+			ContainersStatuses: []*v1.ContainerStatus{
+				{
+					Id:    containerId,
+					State: v1.ContainerState_CONTAINER_RUNNING,
+					Image: &v1.ImageSpec{Image: image},
+				},
+			},
+		}
+	}
+	expectEvent := func(expected *v1.ContainerEventResponse) {
+		select {
+		case event, ok := <-events:
+			switch {
+			case !ok:
+				t.Fatalf("the event stream was closed")
+			case !reflect.DeepEqual(event, expected):
+				t.Errorf("bad event: expected:\n%s\nactual:\n%s", dump(expected), dump(event))
+			}
+		case <-time.After(10 * time.Second):
+			t.Fatalf("timed out waiting for the event for container %q", expected.ContainerId)
+		}
+	}
+
+	primaryEvent := makeEvent(podSandboxId1, containerId1, "image1-1")
+	waitForStream(0).SendContainerEvent(primaryEvent)
+	expectEvent(primaryEvent)
+	waitForStream(1).SendContainerEvent(makeEvent(podSandboxId2unprefixed, containerId2unprefixed, "image2-1"))
+	expectEvent(makeEvent(podSandboxId2, containerId2, "alt/image2-1"))
+
+	// the merged stream must survive the alt runtime going away
+	tester.servers[1].Stop()
+	tester.servers[0].(*proxytest.FakeCriServer1).SendContainerEvent(primaryEvent)
+	expectEvent(primaryEvent)
+
+	// the event stream of the alt runtime is restarted
+	// after the runtime comes back
+	tester.servers[1] = proxytest.NewFakeCriServer1(proxytest.NewPrefixJournal(tester.journal, "2/"), "//[::]:12345/stream")
+	tester.startServers(t, 1)
+	waitForStream(1).SendContainerEvent(makeEvent(podSandboxId2unprefixed, containerId2unprefixed, "image2-1"))
+	expectEvent(makeEvent(podSandboxId2, containerId2, "alt/image2-1"))
+}
+
+func TestCriProxyUnknownMethods(t *testing.T) {
+	tester := newProxyTester(t, altSocketSpec, []makeFakeCriServerFunc{
+		proxytest.NewFakeCriServer1,
+		proxytest.NewFakeCriServer1,
+	}, func(config *Config) {
+		config.UnknownMethods = map[string]string{
+			"RuntimeService/CheckpointContainer": MethodPolicyReject,
+			"RuntimeService/ListPodSandboxStats": MethodPolicyAll,
+		}
+	})
+	defer tester.stop()
+	tester.startServers(t, -1)
+	tester.startProxy(t)
+	tester.connectToProxy(t)
+	tester.skipJournalItems("1/runtime/Version", "2/runtime/Version")
+	// fan-out requests skip the runtimes that aren't connected yet
+	for n := range tester.proxies {
+		tester.connectAll(t, n)
+	}
+
+	// The fake servers echo the requests for the unknown methods.
+	// ListImagesResponse is used here as an arbitrary message with
+	// a repeated field to see how the responses are merged.
+	image := &v1.Image{Id: "image", RepoTags: []string{"image"}}
+	req := &v1.ListImagesResponse{Images: []*v1.Image{image}}
+	for _, protoPackage := range []string{"runtime", "runtime.v1alpha2", "runtime.v1"} {
+		t.Run(protoPackage, func(t *testing.T) {
+			tester.verifyCall(t, fmt.Sprintf("/%s.RuntimeService/ListPodSandboxStats", protoPackage), req, &v1.ListImagesResponse{
+				Images: []*v1.Image{image, image},
+			}, "")
+			tester.verifyJournal(t, []string{"1/runtime/ListPodSandboxStats", "2/runtime/ListPodSandboxStats"})
+
+			tester.verifyCall(t, fmt.Sprintf("/%s.RuntimeService/ListMetricDescriptors", protoPackage), req, req, "")
+			tester.verifyJournal(t, []string{"1/runtime/ListMetricDescriptors"})
+
+			err := tester.invoke(fmt.Sprintf("/%s.RuntimeService/CheckpointContainer", protoPackage), req, &v1.ListImagesResponse{})
+			if grpc.Code(err) != codes.Unimplemented {
+				t.Errorf("CheckpointContainer: expected Unimplemented error, got %v", err)
+			}
+			tester.verifyJournal(t, nil)
+
+			// PodSandboxStats is passed to the runtime that owns the
+			// pod sandbox. PodSandboxStatusRequest has the pod sandbox id
+			// as the field 1, same as PodSandboxStatsRequest, and
+			// ListContainerStatsResponse has the same layout as
+			// PodSandboxStatsResponse up to the id of the pod sandbox
+			// in the stats.
+			for _, tc := range []struct{ podSandboxId, journalItem string }{
+				{podSandboxId1, "1/runtime/PodSandboxStats"},
+				{podSandboxId2, "2/runtime/PodSandboxStats"},
+			} {
+				tester.verifyCall(t, fmt.Sprintf("/%s.RuntimeService/PodSandboxStats", protoPackage), &v1.PodSandboxStatusRequest{
+					PodSandboxId: tc.podSandboxId,
+				}, &v1.ListContainerStatsResponse{
+					Stats: []*v1.ContainerStats{
+						{Attributes: &v1.ContainerAttributes{Id: tc.podSandboxId}},
+					},
+				}, "")
+				tester.verifyJournal(t, []string{tc.journalItem})
+			}
+		})
+	}
+
+	// the policies can be changed by reloading the config
+	tester.reload(t, &Config{
+		Backends:  tester.proxies[0].clientSet.backends,
+		StreamUrl: "http://127.0.0.1:11250/",
+		UnknownMethods: map[string]string{
+			"RuntimeService/ListMetricDescriptors": MethodPolicyAll,
+			"RuntimeService/ListPodSandboxStats":   MethodPolicyReject,
+		},
+	})
+	tester.verifyCall(t, "/runtime.v1.RuntimeService/ListMetricDescriptors", req, &v1.ListImagesResponse{
+		Images: []*v1.Image{image, image},
+	}, "")
+	tester.verifyJournal(t, []string{"1/runtime/ListMetricDescriptors", "2/runtime/ListMetricDescriptors"})
+	tester.verifyCall(t, "/runtime.v1.RuntimeService/CheckpointContainer", req, req, "")
+	tester.verifyJournal(t, []string{"1/runtime/CheckpointContainer"})
+	tester.verifyCall(t, "/runtime.v1.RuntimeService/ListPodSandboxStats", req, req, "disabled")
+	tester.verifyJournal(t, nil)
+}
+
+func TestCriProxyErrors(t *testing.T) {
+	tester := newProxyTester(t, altSocketSpec, []makeFakeCriServerFunc{
+		proxytest.NewFakeCriServer110,
+		proxytest.NewFakeCriServer110,
+	}, nil)
+	defer tester.stop()
+	tester.startServers(t, -1)
+	tester.startProxy(t)
+	tester.connectToProxy(t)
+	tester.skipJournalItems("1/runtime/Version", "2/runtime/Version")
+	tester.connectAll(t, 1)
+
+	invoke := func(method string, in, resp interface{}, expectedCode codes.Code, expectedIds, expectedSockets []string) *rpcStatus {
+		var trailer metadata.MD
+		callErr := grpc.Invoke(context.Background(), method, in, resp, tester.conn, grpc.Trailer(&trailer))
+		if code := grpc.Code(callErr); code != expectedCode {
+			t.Errorf("%s: bad error code %v instead of %v (error: %v)", method, code, expectedCode, callErr)
+		}
+		if ids := trailer[BackendIdTrailerKey]; !reflect.DeepEqual(ids, expectedIds) {
+			t.Errorf("%s: bad backend ids in the trailer: %#v instead of %#v", method, ids, expectedIds)
+		}
+		if sockets := trailer[BackendSocketTrailerKey]; !reflect.DeepEqual(sockets, expectedSockets) {
+			t.Errorf("%s: bad backend sockets in the trailer: %#v instead of %#v", method, sockets, expectedSockets)
+		}
+		var st rpcStatus
+		if details := trailer[statusDetailsTrailerKey]; len(details) != 1 {
+			t.Errorf("%s: expected the error details in the trailer, got %#v", method, details)
+		} else if err := proto.Unmarshal([]byte(details[0]), &st); err != nil {
+			t.Errorf("%s: failed to parse the error details: %v", method, err)
+		} else if st.Code != int32(expectedCode) || st.Message != grpc.ErrorDesc(callErr) {
+			t.Errorf("%s: bad error details: %s", method, st.String())
+		}
+		return &st
+	}
+	// verifyDetails checks the error details, parsing ErrorInfo
+	// as its map field may be serialized in any order
+	verifyDetails := func(st *rpcStatus, expectedDetails []interface{}) {
+		var details []interface{}
+		for _, d := range st.Details {
+			if d.TypeUrl != errorInfoTypeUrl {
+				details = append(details, d)
+				continue
+			}
+			info := &errorInfo{}
+			if err := proto.Unmarshal(d.Value, info); err != nil {
+				t.Errorf("failed to parse ErrorInfo: %v", err)
+			}
+			details = append(details, info)
+		}
+		if !reflect.DeepEqual(details, expectedDetails) {
+			t.Errorf("bad error details: %s", st.String())
+		}
+	}
+	altErrorInfo := &errorInfo{
+		Reason:   ErrorInfoReason,
+		Domain:   ErrorInfoDomain,
+		Metadata: map[string]string{"runtimeId": "alt", "socket": fakeCriSocketPath2},
+	}
+
+	// the status code and the details of the runtime's error are preserved
+	runtimeDetail := &anyMessage{TypeUrl: "type.googleapis.com/google.rpc.DebugInfo", Value: []byte("\x12\x0bfake detail")}
+	details, err := proto.Marshal(&rpcStatus{
+		Code:    int32(codes.NotFound),
+		Message: "not found",
+		Details: []*anyMessage{runtimeDetail},
+	})
+	if err != nil {
+		t.Fatalf("proto.Marshal(): %v", err)
+	}
+	tester.servers[1].(*proxytest.FakeCriServer110).SetNotFoundDetails(details)
+	st := invoke("/runtime.v1alpha2.RuntimeService/ContainerStatus", &v1_12.ContainerStatusRequest{
+		ContainerId: "alt__nonexistent",
+	}, &v1_12.ContainerStatusResponse{}, codes.NotFound, []string{"alt"}, []string{fakeCriSocketPath2})
+	tester.verifyJournal(t, []string{"2/runtime/ContainerStatus"})
+	verifyDetails(st, []interface{}{runtimeDetail, altErrorInfo})
+
+	// the errors of the methods that are passed to all of
+	// the runtimes identify the runtimes that failed
+	tester.servers[1].Stop()
+	st = invoke("/runtime.v1alpha2.RuntimeService/UpdateRuntimeConfig", &v1_12.UpdateRuntimeConfigRequest{},
+		&v1_12.UpdateRuntimeConfigResponse{}, codes.Unavailable, []string{"alt"}, []string{fakeCriSocketPath2})
+	tester.verifyJournal(t, []string{"1/runtime/UpdateRuntimeConfig"})
+	verifyDetails(st, []interface{}{altErrorInfo})
+}
+
+func TestCriProxyImageCache(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "image-cache-test-")
+	if err != nil {
+		t.Fatalf("TempDir(): %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+	cacheFile := filepath.Join(tmpDir, "criproxy", "images.json")
+	if err := os.MkdirAll(filepath.Dir(cacheFile), 0755); err != nil {
+		t.Fatalf("MkdirAll(): %v", err)
+	}
+	if err := ioutil.WriteFile(cacheFile, []byte(`{"images":{"sha256:stale":"stale-image","image1-1":"image1-1-old"}}`), 0644); err != nil {
+		t.Fatalf("WriteFile(): %v", err)
+	}
+
+	tester := newProxyTester(t, altSocketSpec, []makeFakeCriServerFunc{
+		proxytest.NewFakeCriServer110,
+		proxytest.NewFakeCriServer110,
+	}, func(config *Config) {
+		config.ImageCacheFile = cacheFile
+	})
+	defer tester.stop()
+	if tester.proxies[0].images != tester.proxies[1].images {
+		t.Errorf("the proxies don't share the image cache")
+	}
+	if name := tester.proxies[0].getImageNameById("image1-1"); name != "image1-1-old" {
+		t.Errorf("the image cache wasn't loaded: got %q instead of image1-1-old", name)
+	}
+	tester.skipJournalItems("1/runtime/Version", "2/runtime/Version")
+	tester.startServers(t, -1)
+	tester.startProxy(t)
+	tester.connectToProxy(t)
+
+	readCacheFile := func() map[string]string {
+		data, err := ioutil.ReadFile(cacheFile)
+		if err != nil {
+			t.Fatalf("ReadFile(): %v", err)
+		}
+		var cacheData imageCacheData
+		if err := json.Unmarshal(data, &cacheData); err != nil {
+			t.Fatalf("Unmarshal(): %v", err)
+		}
+		return cacheData.Images
+	}
+	expectedImages := map[string]string{
+		// the existing entries must not be replaced
+		"image1-1": "image1-1-old",
+		"image1-2": "image1-2",
+		"image2-1": "image2-1",
+		"image2-2": "image2-2",
+	}
+	// image requests skip the runtimes that aren't connected yet
+	tester.connectAll(t, 0)
+	for i := 0; tester.proxies[0].getImageNameById("sha256:stale") != ""; i++ {
+		if i == 100 {
+			t.Fatalf("the image cache wasn't rebuilt")
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	// the proxies share the cache, so the images are only listed once
+	tester.verifyJournalUnordered(t, []string{"1/image/ListImages", "2/image/ListImages"})
+	if images := readCacheFile(); !reflect.DeepEqual(images, expectedImages) {
+		t.Errorf("bad image cache file contents after rebuild: %#v instead of %#v", images, expectedImages)
+	}
+
+	tester.verifyCall(t, "/runtime.ImageService/RemoveImage", &runtimeapi.RemoveImageRequest{
+		Image: &runtimeapi.ImageSpec{Image: "image1-2"},
+	}, &runtimeapi.RemoveImageResponse{}, "")
+	delete(expectedImages, "image1-2")
+	if images := readCacheFile(); !reflect.DeepEqual(images, expectedImages) {
+		t.Errorf("bad image cache file contents after RemoveImage: %#v instead of %#v", images, expectedImages)
+	}
+
+	// simulate proxy restart
+	imageCachesLock.Lock()
+	delete(imageCaches, cacheFile)
+	imageCachesLock.Unlock()
+	if cache := getImageCache(cacheFile); !reflect.DeepEqual(cache.images, expectedImages) {
+		t.Errorf("bad image cache contents after reloading: %#v instead of %#v", cache.images, expectedImages)
+	}
+}
+
+func TestCriProxyConcurrentRequests(t *testing.T) {
+	const (
+		numWorkers    = 8
+		numIterations = 5
+	)
+	var config *Config
+	tester := newProxyTester(t, altSocketSpec, []makeFakeCriServerFunc{
+		proxytest.NewFakeCriServer19,
+		proxytest.NewFakeCriServer19,
+	}, func(c *Config) {
+		config = c
+	})
+	defer tester.stop()
+	tester.startServers(t, -1)
+	tester.startProxy(t)
+	tester.connectToProxy(t)
+
+	sandboxIds := []string{podSandboxId1, podSandboxId2}
+	for n, annotations := range []map[string]string{
+		nil,
+		{"kubernetes.io/target-runtime": "alt"},
+	} {
+		tester.verifyCall(t, "/runtime.RuntimeService/RunPodSandbox", &runtimeapi.RunPodSandboxRequest{
+			Config: &runtimeapi.PodSandboxConfig{
+				Metadata: &runtimeapi.PodSandboxMetadata{
+					Name:      fmt.Sprintf("pod-%d-1", n+1),
+					Uid:       []string{podUid1, podUid2}[n],
+					Namespace: "default",
+				},
+				Annotations: annotations,
+			},
+		}, &runtimeapi.RunPodSandboxResponse{PodSandboxId: sandboxIds[n]}, "")
+	}
+
+	var wg sync.WaitGroup
+	stopCh := make(chan struct{})
+	// reload the configuration, export the metrics and get
+	// the status while the requests are being handled
+	var bgWg sync.WaitGroup
+	bgWg.Add(1)
+	go func() {
+		defer bgWg.Done()
+		registry := metrics.NewRegistry()
+		RegisterMetrics(registry, tester.proxies)
+		for {
+			select {
+			case <-stopCh:
+				return
+			default:
+			}
+			for _, proxy := range tester.proxies {
+				if err := proxy.Reload(config); err != nil {
+					t.Errorf("Reload(): %v", err)
+				}
+				proxy.Status()
+			}
+			var buf bytes.Buffer
+			if err := registry.Write(&buf); err != nil {
+				t.Errorf("Write(): %v", err)
+			}
+			time.Sleep(time.Millisecond)
+		}
+	}()
+
+	call := func(method string, in, resp interface{}) {
+		if err := tester.invoke(method, in, resp); err != nil {
+			t.Errorf("%s: %v", method, err)
+		}
+	}
+	for i := 0; i < numWorkers; i++ {
+		wg.Add(1)
+		go func(worker int) {
+			defer wg.Done()
+			for j := 0; j < numIterations; j++ {
+				imageName := fmt.Sprintf("image-%d-%d", worker, j)
+				call("/runtime.ImageService/PullImage", &runtimeapi.PullImageRequest{
+					Image: &runtimeapi.ImageSpec{Image: imageName},
+				}, &runtimeapi.PullImageResponse{})
+				imageStatusResp := &runtimeapi.ImageStatusResponse{}
+				call("/runtime.ImageService/ImageStatus", &runtimeapi.ImageStatusRequest{
+					Image: &runtimeapi.ImageSpec{Image: imageName + "/digest"},
+				}, imageStatusResp)
+				imageId := imageName
+				if imageStatusResp.Image != nil {
+					imageId = imageStatusResp.Image.Id
+				}
+				createResp := &runtimeapi.CreateContainerResponse{}
+				call("/runtime.RuntimeService/CreateContainer", &runtimeapi.CreateContainerRequest{
+					PodSandboxId: sandboxIds[(worker+j)%2],
+					Config: &runtimeapi.ContainerConfig{
+						Metadata: &runtimeapi.ContainerMetadata{
+							Name: fmt.Sprintf("container-%d-%d", worker, j),
+						},
+						Image: &runtimeapi.ImageSpec{Image: imageId},
+					},
+				}, createResp)
+				call("/runtime.RuntimeService/ContainerStatus", &runtimeapi.ContainerStatusRequest{
+					ContainerId: createResp.ContainerId,
+				}, &runtimeapi.ContainerStatusResponse{})
+				call("/runtime.RuntimeService/ListPodSandbox", &runtimeapi.ListPodSandboxRequest{}, &runtimeapi.ListPodSandboxResponse{})
+				call("/runtime.RuntimeService/ListContainers", &runtimeapi.ListContainersRequest{}, &runtimeapi.ListContainersResponse{})
+				call("/runtime.ImageService/ListImages", &runtimeapi.ListImagesRequest{}, &runtimeapi.ListImagesResponse{})
+				call("/runtime.RuntimeService/Version", &runtimeapi.VersionRequest{}, &runtimeapi.VersionResponse{})
+				call("/runtime.ImageService/RemoveImage", &runtimeapi.RemoveImageRequest{
+					Image: &runtimeapi.ImageSpec{Image: imageId},
+				}, &runtimeapi.RemoveImageResponse{})
+				if name := tester.proxies[0].getImageNameById(imageId); name != "" {
+					t.Errorf("image cache entry for %q wasn't removed", imageId)
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+	close(stopCh)
+	bgWg.Wait()
+}
+
+func init() {
+	// FIXME: testing.Verbose() always returns false
+	flag.Set("logtostderr", "true")
+	flag.Set("v", "5")
+}
+
+// TODO: test reconnecting after restart of a runtime
+
+func TestCriProxyParallelList(t *testing.T) {
+	tester := newProxyTester(t, altSocketSpec, []makeFakeCriServerFunc{
+		proxytest.NewFakeCriServer1,
+		proxytest.NewFakeCriServer1,
+	}, nil)
+	defer tester.stop()
+	tester.startServers(t, -1)
+	tester.startProxy(t)
+	tester.connectToProxy(t)
+	tester.connectAll(t, 2)
+
+	listImages := func(timeout time.Duration) ([]string, error) {
+		ctx := context.Background()
+		if timeout != 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, timeout)
+			defer cancel()
+		}
+		var resp v1.ListImagesResponse
+		if err := grpc.Invoke(ctx, "/runtime.v1.ImageService/ListImages", &v1.ListImagesRequest{}, &resp, tester.conn); err != nil {
+			return nil, err
+		}
+		var ids []string
+		for _, image := range resp.Images {
+			ids = append(ids, image.Id)
+		}
+		return ids, nil
+	}
+
+	allImages, err := listImages(0)
+	if err != nil {
+		t.Fatalf("ListImages: %v", err)
+	}
+	var primaryImages []string
+	for _, id := range allImages {
+		if !strings.HasPrefix(id, "alt/") {
+			primaryImages = append(primaryImages, id)
+		}
+	}
+	if len(primaryImages) == 0 || len(primaryImages) == len(allImages) {
+		t.Fatalf("expected images from both of the runtimes, got %v", allImages)
+	}
+
+	// the items of the runtime that doesn't reply in time are
+	// left out of the response
+	tester.servers[1].(*proxytest.FakeCriServer1).SetDelay("ListImages", 10*time.Second)
+	failures := backendListFailureCount.Get("alt", "ImageService/ListImages")
+	start := time.Now()
+	images, err := listImages(time.Second)
+	if err != nil {
+		t.Fatalf("ListImages with a slow runtime: %v", err)
+	}
+	if !reflect.DeepEqual(images, primaryImages) {
+		t.Errorf("bad images %v instead of %v", images, primaryImages)
+	}
+	if elapsed := time.Since(start); elapsed >= time.Second {
+		t.Errorf("ListImages took too long: %v", elapsed)
+	}
+	if n := backendListFailureCount.Get("alt", "ImageService/ListImages"); n != failures+1 {
+		t.Errorf("bad list failure count %v instead of %v", n, failures+1)
+	}
+
+	// listTimeout limits the time given to the runtimes
+	// even if the incoming request has no deadline
+	config := &Config{
+		Backends:    tester.proxies[0].clientSet.backends,
+		StreamUrl:   "http://127.0.0.1:11250/",
+		ListTimeout: Duration{100 * time.Millisecond},
+	}
+	tester.reload(t, config)
+	images, err = listImages(0)
+	if err != nil {
+		t.Fatalf("ListImages with listTimeout: %v", err)
+	}
+	if !reflect.DeepEqual(images, primaryImages) {
+		t.Errorf("bad images with listTimeout: %v instead of %v", images, primaryImages)
+	}
+
+	// failListOnTimeout makes the whole request fail
+	config.FailListOnTimeout = true
+	tester.reload(t, config)
+	if _, err = listImages(0); grpc.Code(err) != codes.DeadlineExceeded {
+		t.Errorf("expected DeadlineExceeded error, got %v", err)
+	}
+
+	tester.servers[1].(*proxytest.FakeCriServer1).SetDelay("ListImages", 0)
+	images, err = listImages(0)
+	if err != nil {
+		t.Fatalf("ListImages after removing the delay: %v", err)
+	}
+	if !reflect.DeepEqual(images, allImages) {
+		t.Errorf("bad images after removing the delay: %v instead of %v", images, allImages)
+	}
+
+	// the failure is counted if the runtime has gone away, too
+	tester.servers[1].Stop()
+	failures = backendListFailureCount.Get("alt", "ImageService/ListImages")
+	images, err = listImages(0)
+	if err != nil {
+		t.Fatalf("ListImages with a runtime that's down: %v", err)
+	}
+	if !reflect.DeepEqual(images, primaryImages) {
+		t.Errorf("bad images with a runtime that's down: %v instead of %v", images, primaryImages)
+	}
+	if n := backendListFailureCount.Get("alt", "ImageService/ListImages"); n != failures+1 {
+		t.Errorf("bad list failure count %v for a runtime that's down instead of %v", n, failures+1)
+	}
+}
+
+func TestCriProxyStatus(t *testing.T) {
+	tester := newProxyTester(t, altSocketSpec, []makeFakeCriServerFunc{
+		proxytest.NewFakeCriServer110,
+		proxytest.NewFakeCriServer110,
+	}, nil)
+	defer tester.stop()
+	tester.startServers(t, -1)
+	tester.startProxy(t)
+	tester.connectToProxy(t)
+	tester.skipJournalItems("1/runtime/Version", "2/runtime/Version", "1/runtime/Status", "2/runtime/Status")
+
+	getStatus := func(verbose bool) *v1_12.StatusResponse {
+		var resp v1_12.StatusResponse
+		if err := tester.invoke("/runtime.v1alpha2.RuntimeService/Status", &v1_12.StatusRequest{Verbose: verbose}, &resp); err != nil {
+			t.Fatalf("Status: %v", err)
+		}
+		return &resp
+	}
+	verifyConditions := func(resp *v1_12.StatusResponse, expected []*v1_12.RuntimeCondition) {
+		if !reflect.DeepEqual(resp.Status.GetConditions(), expected) {
+			t.Errorf("bad conditions:\n%s\ninstead of:\n%s", dump(resp.Status.GetConditions()), dump(expected))
+		}
+	}
+
+	// the runtimes that aren't connected are reported as
+	// not ready, but they're optional by default
+	verifyConditions(getStatus(false), []*v1_12.RuntimeCondition{
+		{Type: "RuntimeReady", Status: true},
+		{Type: "NetworkReady", Status: true},
+		{Type: "alt/RuntimeReady", Reason: "RuntimeUnavailable", Message: "the runtime is offline"},
+		{Type: "alt/NetworkReady", Reason: "RuntimeUnavailable", Message: "the runtime is offline"},
+	})
+	tester.connectAll(t, 1)
+
+	tester.servers[1].(*proxytest.FakeCriServer110).SetFakeStatus(&v1_12.RuntimeStatus{
+		Conditions: []*v1_12.RuntimeCondition{
+			{Type: "RuntimeReady", Reason: "LibvirtDown", Message: "libvirt is down"},
+			{Type: "NetworkReady", Status: true},
+		},
+	})
+	verifyConditions(getStatus(false), []*v1_12.RuntimeCondition{
+		{Type: "RuntimeReady", Status: true},
+		{Type: "NetworkReady", Status: true},
+		{Type: "alt/RuntimeReady", Reason: "LibvirtDown", Message: "libvirt is down"},
+		{Type: "alt/NetworkReady", Status: true},
+	})
+
+	// the required runtimes affect RuntimeReady and NetworkReady
+	backends := append([]BackendConfig(nil), tester.proxies[0].clientSet.backends...)
+	backends[1].StatusPolicy = StatusPolicyRequired
+	tester.reload(t, &Config{
+		Backends:  backends,
+		StreamUrl: "http://127.0.0.1:11250/",
+	})
+	verifyConditions(getStatus(false), []*v1_12.RuntimeCondition{
+		{Type: "RuntimeReady", Reason: "LibvirtDown", Message: `runtime "alt": libvirt is down`},
+		{Type: "NetworkReady", Status: true},
+		{Type: "alt/RuntimeReady", Reason: "LibvirtDown", Message: "libvirt is down"},
+		{Type: "alt/NetworkReady", Status: true},
+	})
+
+	// the verbose info includes the status of each runtime
+	resp := getStatus(true)
+	if resp.Info["config"] != `{"fake":true}` {
+		t.Errorf("the info of the primary runtime is missing: %#v", resp.Info)
+	}
+	var infos []runtimeStatusInfo
+	if err := json.Unmarshal([]byte(resp.Info[backendsInfoKey]), &infos); err != nil {
+		t.Fatalf("error unmarshalling runtime status info %q: %v", resp.Info[backendsInfoKey], err)
+	}
+	expectedInfos := []runtimeStatusInfo{
+		{
+			Socket:   fakeCriSocketPath1,
+			Required: true,
+			Conditions: []RuntimeCondition{
+				{Type: "RuntimeReady", Status: true},
+				{Type: "NetworkReady", Status: true},
+			},
+		},
+		{
+			ID:       "alt",
+			Socket:   fakeCriSocketPath2,
+			Required: true,
+			Conditions: []RuntimeCondition{
+				{Type: "RuntimeReady", Reason: "LibvirtDown", Message: "libvirt is down"},
+				{Type: "NetworkReady", Status: true},
+			},
+			Info: map[string]string{"config": `{"fake":true}`},
+		},
+	}
+	if !reflect.DeepEqual(infos, expectedInfos) {
+		t.Errorf("bad runtime status info:\n%s\ninstead of:\n%s", dump(infos), dump(expectedInfos))
+	}
+
+	// the runtimes that fail are reported as not ready
+	tester.servers[1].Stop()
+	resp = getStatus(false)
+	conditions := resp.Status.GetConditions()
+	if len(conditions) != 4 || conditions[0].Status || conditions[0].Reason != "RuntimeUnavailable" ||
+		conditions[1].Status || conditions[1].Reason != "RuntimeUnavailable" ||
+		!strings.HasPrefix(conditions[0].Message, `runtime "alt": `) {
+		t.Errorf("bad conditions for a runtime that's down:\n%s", dump(conditions))
+	}
+}
+
+func TestCriProxyRuntimeConfigReplay(t *testing.T) {
+	tester := newProxyTester(t, altSocketSpec, []makeFakeCriServerFunc{
+		proxytest.NewFakeCriServer110,
+		proxytest.NewFakeCriServer110,
+	}, nil)
+	defer tester.stop()
+	tester.startServers(t, -1)
+	tester.startProxy(t)
+	tester.connectToProxy(t)
+	tester.skipJournalItems("1/runtime/Version")
+	if err := <-tester.proxies[0].clientSet.clients[0].connect(); err != nil {
+		t.Fatalf("connect(): %v", err)
+	}
+
+	// The alt runtime isn't connected yet, so the request is only
+	// passed to it after the proxy connects to it. CRI 1.9 is used
+	// here so the request needs to be converted.
+	alt := tester.proxies[0].clientSet.clients[1]
+	replays := runtimeConfigReplayCount.Get("alt", "OK")
+	tester.verifyCall(t, "/runtime.RuntimeService/UpdateRuntimeConfig", &runtimeapi.UpdateRuntimeConfigRequest{
+		RuntimeConfig: &runtimeapi.RuntimeConfig{
+			NetworkConfig: &runtimeapi.NetworkConfig{PodCidr: "10.244.0.0/16"},
+		},
+	}, &runtimeapi.UpdateRuntimeConfigResponse{}, "")
+	if err := <-alt.connect(); err != nil {
+		t.Fatalf("connect(): %v", err)
+	}
+	waitForOnConnected(alt)
+	tester.verifyJournal(t, []string{"1/runtime/UpdateRuntimeConfig", "2/runtime/Version", "2/runtime/UpdateRuntimeConfig"})
+	if cidr := tester.servers[1].(*proxytest.FakeCriServer110).PodCidr(); cidr != "10.244.0.0/16" {
+		t.Errorf("bad pod CIDR %q passed to the runtime", cidr)
+	}
+	if n := runtimeConfigReplayCount.Get("alt", "OK"); n != replays+1 {
+		t.Errorf("bad runtime config replay count %v instead of %v", n, replays+1)
+	}
+
+	// the other proxies didn't receive any config,
+	// so there's nothing to pass to the runtime
+	if err := <-tester.proxies[1].clientSet.clients[1].connect(); err != nil {
+		t.Fatalf("connect(): %v", err)
+	}
+	waitForOnConnected(tester.proxies[1].clientSet.clients[1])
+	tester.verifyJournal(t, []string{"2/runtime/Version"})
+
+	// ... and again after it reconnects
+	tester.servers[1].Stop()
+	tester.servers[1] = proxytest.NewFakeCriServer110(proxytest.NewPrefixJournal(tester.journal, "2/"), "//[::]:12345/stream")
+	tester.startServers(t, 1)
+	if err := alt.handleError(grpc.Errorf(codes.Unavailable, "connection lost"), true); err != nil {
+		t.Fatalf("handleError(): %v", err)
+	}
+	if err := <-alt.connect(); err != nil {
+		t.Fatalf("connect(): %v", err)
+	}
+	waitForOnConnected(alt)
+	tester.verifyJournal(t, []string{"2/runtime/Version", "2/runtime/UpdateRuntimeConfig"})
+	if cidr := tester.servers[1].(*proxytest.FakeCriServer110).PodCidr(); cidr != "10.244.0.0/16" {
+		t.Errorf("bad pod CIDR %q passed to the restarted runtime", cidr)
+	}
+	if n := runtimeConfigReplayCount.Get("alt", "OK"); n != replays+2 {
+		t.Errorf("bad runtime config replay count %v instead of %v", n, replays+2)
+	}
+}
+
+type testCert struct {
+	cert     *x509.Certificate
+	key      *ecdsa.PrivateKey
+	certFile string
+	keyFile  string
+}
+
+// makeTestCert makes a certificate signed by the parent (self-signed
+// if parent is nil) and writes it along with its key to the directory.
+func makeTestCert(t *testing.T, dir, name string, parent *testCert, template *x509.Certificate) *testCert {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey(): %v", err)
+	}
+	template.Subject = pkix.Name{CommonName: name}
+	template.NotBefore = time.Now().Add(-time.Hour)
+	template.NotAfter = time.Now().Add(time.Hour)
+	parentCert, parentKey := template, key
+	if parent != nil {
+		parentCert, parentKey = parent.cert, parent.key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, parentCert, &key.PublicKey, parentKey)
+	if err != nil {
+		t.Fatalf("CreateCertificate(): %v", err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatalf("ParseCertificate(): %v", err)
+	}
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatalf("MarshalECPrivateKey(): %v", err)
+	}
+	r := &testCert{
+		cert:     cert,
+		key:      key,
+		certFile: filepath.Join(dir, name+".pem"),
+		keyFile:  filepath.Join(dir, name+"-key.pem"),
+	}
+	if err := ioutil.WriteFile(r.certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0644); err != nil {
+		t.Fatalf("WriteFile(): %v", err)
+	}
+	if err := ioutil.WriteFile(r.keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer}), 0600); err != nil {
+		t.Fatalf("WriteFile(): %v", err)
+	}
+	return r
+}
+
+// makeTestCerts makes a CA along with a server certificate for
+// runtime.example.com and a client certificate signed by it.
+func makeTestCerts(t *testing.T, dir string) (ca, serverCert, clientCert *testCert) {
+	ca = makeTestCert(t, dir, "ca", nil, &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	})
+	serverCert = makeTestCert(t, dir, "server", ca, &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		DNSNames:     []string{"runtime.example.com"},
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	})
+	clientCert = makeTestCert(t, dir, "client", ca, &x509.Certificate{
+		SerialNumber: big.NewInt(3),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	})
+	return ca, serverCert, clientCert
+}
+
+func TestCriProxyNetworkBackends(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "criproxy-tls-test-")
+	if err != nil {
+		t.Fatalf("TempDir(): %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+	ca, serverCert, clientCert := makeTestCerts(t, tmpDir)
+	serverKeyPair, err := tls.LoadX509KeyPair(serverCert.certFile, serverCert.keyFile)
+	if err != nil {
+		t.Fatalf("LoadX509KeyPair(): %v", err)
+	}
+	caPool := x509.NewCertPool()
+	caPool.AddCert(ca.cert)
+
+	for _, tc := range []struct {
+		name string
+		tls  *BackendTLSConfig
+		fail bool
+	}{
+		{
+			name: "tcp",
+		},
+		{
+			name: "tls with client certificate",
+			tls: &BackendTLSConfig{
+				CAFile:     ca.certFile,
+				CertFile:   clientCert.certFile,
+				KeyFile:    clientCert.keyFile,
+				ServerName: "runtime.example.com",
+			},
+		},
+		{
+			name: "tls without client certificate",
+			tls: &BackendTLSConfig{
+				CAFile:     ca.certFile,
+				ServerName: "runtime.example.com",
+			},
+			fail: true,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			ln, err := net.Listen("tcp", "127.0.0.1:0")
+			if err != nil {
+				t.Fatalf("Listen(): %v", err)
+			}
+			endpoint := "tcp://" + ln.Addr().String()
+			if tc.tls != nil {
+				ln = tls.NewListener(ln, &tls.Config{
+					Certificates: []tls.Certificate{serverKeyPair},
+					ClientCAs:    caPool,
+					ClientAuth:   tls.RequireAndVerifyClientCert,
+				})
+				endpoint = "tls://" + ln.Addr().String()
+			}
+			tester := newProxyTester(t, "alt:"+endpoint, []makeFakeCriServerFunc{
+				proxytest.NewFakeCriServer110,
+				proxytest.NewFakeCriServer110,
+			}, func(config *Config) {
+				if tc.tls != nil {
+					config.Backends[1].TLS = *tc.tls
+				}
+				config.Backends[1].Keepalive.Time = Duration{10 * time.Second}
+			})
+			defer tester.stop()
+			tester.startServers(t, 0)
+			readyCh := make(chan struct{})
+			go tester.servers[1].ServeListener(ln, readyCh)
+			<-readyCh
+			tester.startProxy(t)
+			tester.connectToProxy(t)
+			tester.skipJournalItems("1/runtime/Version")
+			if err := <-tester.proxies[0].clientSet.clients[0].connect(); err != nil {
+				t.Fatalf("connect(): %v", err)
+			}
+
+			alt := tester.proxies[0].clientSet.clients[1]
+			if tc.fail {
+				// the proxy keeps trying to connect to the runtime
+				alt.connect()
+				deadline := time.Now().Add(connectionTimeoutForTests)
+				for alt.status().LastError == "" && time.Now().Before(deadline) {
+					time.Sleep(50 * time.Millisecond)
+				}
+				if s := alt.status(); s.State == "connected" || s.LastError == "" {
+					t.Errorf("the runtime is %s with last error %q, but the connection should fail", s.State, s.LastError)
+				}
+				return
+			}
+
+			if err := <-alt.connect(); err != nil {
+				t.Fatalf("connect(): %v", err)
+			}
+			if s := alt.status(); s.Socket != endpoint {
+				t.Errorf("bad runtime endpoint in the status: %q instead of %q", s.Socket, endpoint)
+			}
+			tester.verifyJournal(t, []string{"2/runtime/Version"})
+			tester.verifyCall(t, "/runtime.RuntimeService/RemovePodSandbox", &runtimeapi.RemovePodSandboxRequest{
+				PodSandboxId: "alt__" + podSandboxId1,
+			}, &runtimeapi.RemovePodSandboxResponse{}, "")
+			tester.verifyJournal(t, []string{"2/runtime/RemovePodSandbox"})
+		})
+	}
+}
+
+func TestCriProxyListeners(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "criproxy-listeners-test-")
+	if err != nil {
+		t.Fatalf("TempDir(): %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+	ca, serverCert, clientCert := makeTestCerts(t, tmpDir)
+
+	// find a free port for the TLS listener
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen(): %v", err)
+	}
+	tlsAddr := ln.Addr().String()
+	ln.Close()
+
+	tester := newProxyTester(t, altSocketSpec, []makeFakeCriServerFunc{
+		proxytest.NewFakeCriServer19,
+		proxytest.NewFakeCriServer19,
+	}, nil)
+	defer tester.stop()
+	tester.startServers(t, -1)
+	readOnlySocketPath := filepath.Join(tmpDir, "criproxy-ro.sock")
+	readyCh := make(chan struct{})
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- tester.proxyServer.ServeListeners([]ListenerConfig{
+			{
+				Address: criProxySocketForTests,
+			},
+			{
+				Address:  "unix://" + readOnlySocketPath,
+				Mode:     "0600",
+				Group:    strconv.Itoa(os.Getgid()),
+				ReadOnly: true,
+			},
+			{
+				Address: "tls://" + tlsAddr,
+				TLS: ListenerTLSConfig{
+					CertFile:     serverCert.certFile,
+					KeyFile:      serverCert.keyFile,
+					ClientCAFile: ca.certFile,
+				},
+				AllowedMethods: []string{"RuntimeService/Version", "ImageService/*"},
+			},
+		}, readyCh)
+	}()
+	select {
+	case err := <-errCh:
+		t.Fatalf("ServeListeners(): %v", err)
+	case <-readyCh:
+	}
+	tester.connectToProxy(t)
+	// Version requests are passed to the primary runtime and
+	// are also made upon connecting to the runtimes
+	tester.skipJournalItems("1/runtime/Version", "2/runtime/Version")
+	tester.connectAll(t, 0)
+
+	fi, err := os.Stat(readOnlySocketPath)
+	if err != nil {
+		t.Fatalf("Stat(): %v", err)
+	}
+	if mode := fi.Mode().Perm(); mode != 0600 {
+		t.Errorf("bad socket file mode %o instead of 600", mode)
+	}
+	// the socket is created in a temporary directory
+	// that's removed after setting the permissions
+	if tmpDirs, err := filepath.Glob(filepath.Join(tmpDir, ".criproxy-*")); err != nil {
+		t.Errorf("Glob(): %v", err)
+	} else if len(tmpDirs) != 0 {
+		t.Errorf("temporary socket directories left behind: %v", tmpDirs)
+	}
+
+	dial := func(t *testing.T, target string, opts ...grpc.DialOption) *grpc.ClientConn {
+		conn, err := grpc.Dial(target, append(opts, grpc.WithTimeout(connectionTimeoutForTests))...)
+		if err != nil {
+			t.Fatalf("Dial(): %v", err)
+		}
+		return conn
+	}
+	call := func(conn *grpc.ClientConn, method string, in, resp interface{}) error {
+		ctx, cancel := context.WithTimeout(context.Background(), connectionTimeoutForTests)
+		defer cancel()
+		return grpc.Invoke(ctx, method, in, resp, conn)
+	}
+	removeReq := &runtimeapi.RemovePodSandboxRequest{PodSandboxId: podSandboxId1}
+
+	t.Run("all methods", func(t *testing.T) {
+		if err := call(tester.conn, "/runtime.RuntimeService/RemovePodSandbox", removeReq, &runtimeapi.RemovePodSandboxResponse{}); err != nil {
+			t.Errorf("RemovePodSandbox failed: %v", err)
+		}
+		tester.verifyJournal(t, []string{"1/runtime/RemovePodSandbox"})
+	})
+
+	t.Run("read-only", func(t *testing.T) {
+		conn := dial(t, readOnlySocketPath, grpc.WithInsecure(), grpc.WithDialer(utils.Dial))
+		defer conn.Close()
+		if err := call(conn, "/runtime.RuntimeService/Version", &runtimeapi.VersionRequest{}, &runtimeapi.VersionResponse{}); err != nil {
+			t.Errorf("Version failed: %v", err)
+		}
+		if err := call(conn, "/runtime.RuntimeService/ListPodSandbox", &runtimeapi.ListPodSandboxRequest{}, &runtimeapi.ListPodSandboxResponse{}); err != nil {
+			t.Errorf("ListPodSandbox failed: %v", err)
+		}
+		if err := call(conn, "/runtime.RuntimeService/PodSandboxStatus", &runtimeapi.PodSandboxStatusRequest{PodSandboxId: podSandboxId1}, &runtimeapi.PodSandboxStatusResponse{}); grpc.Code(err) == codes.PermissionDenied {
+			t.Errorf("PodSandboxStatus was rejected: %v", err)
+		}
+		err := call(conn, "/runtime.RuntimeService/RemovePodSandbox", removeReq, &runtimeapi.RemovePodSandboxResponse{})
+		if grpc.Code(err) != codes.PermissionDenied {
+			t.Errorf("RemovePodSandbox wasn't rejected with PermissionDenied: %v", err)
+		}
+		tester.verifyJournalUnordered(t, []string{
+			"1/runtime/ListPodSandbox",
+			"2/runtime/ListPodSandbox",
+			"1/runtime/PodSandboxStatus",
+		})
+	})
+
+	t.Run("tls", func(t *testing.T) {
+		clientKeyPair, err := tls.LoadX509KeyPair(clientCert.certFile, clientCert.keyFile)
+		if err != nil {
+			t.Fatalf("LoadX509KeyPair(): %v", err)
+		}
+		rootCAs := x509.NewCertPool()
+		rootCAs.AddCert(ca.cert)
+		conn := dial(t, tlsAddr, grpc.WithTransportCredentials(credentials.NewTLS(&tls.Config{
+			Certificates: []tls.Certificate{clientKeyPair},
+			RootCAs:      rootCAs,
+			ServerName:   "runtime.example.com",
+		})))
+		defer conn.Close()
+		if err := call(conn, "/runtime.RuntimeService/Version", &runtimeapi.VersionRequest{}, &runtimeapi.VersionResponse{}); err != nil {
+			t.Errorf("Version failed: %v", err)
+		}
+		err = call(conn, "/runtime.RuntimeService/ListPodSandbox", &runtimeapi.ListPodSandboxRequest{}, &runtimeapi.ListPodSandboxResponse{})
+		if grpc.Code(err) != codes.PermissionDenied {
+			t.Errorf("ListPodSandbox wasn't rejected with PermissionDenied: %v", err)
+		}
+		tester.verifyJournal(t, nil)
+	})
+
+	t.Run("tls without client certificate", func(t *testing.T) {
+		rootCAs := x509.NewCertPool()
+		rootCAs.AddCert(ca.cert)
+		conn := dial(t, tlsAddr, grpc.WithTransportCredentials(credentials.NewTLS(&tls.Config{
+			RootCAs:    rootCAs,
+			ServerName: "runtime.example.com",
+		})))
+		defer conn.Close()
+		if err := call(conn, "/runtime.RuntimeService/Version", &runtimeapi.VersionRequest{}, &runtimeapi.VersionResponse{}); err == nil {
+			t.Errorf("Version didn't fail without client certificate")
+		}
+		tester.verifyJournal(t, nil)
+	})
+}
+
+func TestCriProxyAuthorization(t *testing.T) {
+	uid := uint32(os.Getuid())
+	for _, tc := range []struct {
+		name     string
+		rules    []AuthorizationRule
+		method   string
+		in, resp interface{}
+		error    string
+		journal  []string
+		// imageNames are put into the image cache
+		imageNames  map[string]string
+		imagePolicy string
+	}{
+		{
+			name:    "read-only request without matching rules",
+			rules:   []AuthorizationRule{{UIDs: []uint32{uid + 1}}},
+			method:  "/runtime.RuntimeService/ListPodSandbox",
+			in:      &runtimeapi.ListPodSandboxRequest{},
+			resp:    &runtimeapi.ListPodSandboxResponse{},
+			journal: []string{"1/runtime/ListPodSandbox", "2/runtime/ListPodSandbox"},
+		},
+		{
+			name:   "mutating request without matching rules",
+			rules:  []AuthorizationRule{{UIDs: []uint32{uid + 1}}},
+			method: "/runtime.RuntimeService/RemovePodSandbox",
+			in:     &runtimeapi.RemovePodSandboxRequest{PodSandboxId: podSandboxId1},
+			resp:   &runtimeapi.RemovePodSandboxResponse{},
+			error:  "the caller is only allowed to make read-only requests",
+		},
+		{
+			name: "allowed method and runtime",
+			rules: []AuthorizationRule{
+				{UIDs: []uint32{uid}, AllowedMethods: []string{"RuntimeService/*"}, AllowedRuntimes: []string{""}},
+			},
+			method:  "/runtime.RuntimeService/RemovePodSandbox",
+			in:      &runtimeapi.RemovePodSandboxRequest{PodSandboxId: podSandboxId1},
+			resp:    &runtimeapi.RemovePodSandboxResponse{},
+			journal: []string{"1/runtime/RemovePodSandbox"},
+		},
+		{
+			name: "runtime not allowed",
+			rules: []AuthorizationRule{
+				{UIDs: []uint32{uid}, AllowedMethods: []string{"RuntimeService/*"}, AllowedRuntimes: []string{""}},
+			},
+			method: "/runtime.RuntimeService/RemovePodSandbox",
+			in:     &runtimeapi.RemovePodSandboxRequest{PodSandboxId: "alt__" + podSandboxId1},
+			resp:   &runtimeapi.RemovePodSandboxResponse{},
+			error:  `runtime "alt" is not allowed for the caller`,
+		},
+		{
+			name: "method not allowed",
+			rules: []AuthorizationRule{
+				{GIDs: []uint32{uint32(os.Getgid())}, AllowedMethods: []string{"RuntimeService/*"}},
+			},
+			method: "/runtime.ImageService/PullImage",
+			in:     &runtimeapi.PullImageRequest{Image: &runtimeapi.ImageSpec{Image: "image1-1"}},
+			resp:   &runtimeapi.PullImageResponse{},
+			error:  "method ImageService/PullImage is not allowed for the caller",
+		},
+		{
+			// the image id is mapped to the image name using the
+			// image cache, and the runtime is checked after it
+			// resolves to the alt runtime
+			name: "image id of a runtime that's not allowed",
+			rules: []AuthorizationRule{
+				{UIDs: []uint32{uid}, AllowedRuntimes: []string{""}},
+			},
+			method:      "/runtime.ImageService/RemoveImage",
+			in:          &runtimeapi.RemoveImageRequest{Image: &runtimeapi.ImageSpec{Image: "image2-1"}},
+			resp:        &runtimeapi.RemoveImageResponse{},
+			error:       `runtime "alt" is not allowed for the caller`,
+			imageNames:  map[string]string{"image2-1": "alt/image2-1"},
+			imagePolicy: ImagePolicyMatching,
+		},
+		{
+			// the requests passed to several runtimes are
+			// denied before they're passed to any of them
+			name: "request for all runtimes",
+			rules: []AuthorizationRule{
+				{UIDs: []uint32{uid}, AllowedRuntimes: []string{""}},
+			},
+			method: "/runtime.RuntimeService/UpdateRuntimeConfig",
+			in:     &runtimeapi.UpdateRuntimeConfigRequest{},
+			resp:   &runtimeapi.UpdateRuntimeConfigResponse{},
+			error:  `runtime "alt" is not allowed for the caller`,
+		},
+		{
+			name:    "rule for any caller",
+			rules:   []AuthorizationRule{{AllowedRuntimes: []string{"*"}}},
+			method:  "/runtime.RuntimeService/RemovePodSandbox",
+			in:      &runtimeapi.RemovePodSandboxRequest{PodSandboxId: "alt__" + podSandboxId1},
+			resp:    &runtimeapi.RemovePodSandboxResponse{},
+			journal: []string{"2/runtime/RemovePodSandbox"},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			tmpDir, err := ioutil.TempDir("", "criproxy-authz-test-")
+			if err != nil {
+				t.Fatalf("TempDir(): %v", err)
+			}
+			defer os.RemoveAll(tmpDir)
+			auditLogFile := filepath.Join(tmpDir, "audit.log")
+			tester := newProxyTester(t, altSocketSpec, []makeFakeCriServerFunc{
+				proxytest.NewFakeCriServer19,
+				proxytest.NewFakeCriServer19,
+			}, func(config *Config) {
+				config.Authorization = &AuthorizationConfig{Rules: tc.rules}
+				config.Audit = AuditConfig{File: auditLogFile}
+				config.Backends[1].ImagePolicy = tc.imagePolicy
+			})
+			defer tester.stop()
+			tester.startServers(t, -1)
+			tester.startProxy(t)
+			tester.connectToProxy(t)
+			tester.skipJournalItems("1/runtime/Version", "2/runtime/Version")
+			tester.connectAll(t, 0)
+			for id, name := range tc.imageNames {
+				tester.proxies[0].setImageNameById(id, name, true)
+			}
+			denials := authorizationDenialCount.Get(metricMethodName(tc.method))
+			err = tester.invoke(tc.method, tc.in, tc.resp)
+			tester.verifyJournalUnordered(t, tc.journal)
+			data, readErr := ioutil.ReadFile(auditLogFile)
+			if tc.error == "" {
+				if err != nil {
+					t.Errorf("the request failed: %v", err)
+				}
+				if bytes.Contains(data, []byte(`"reason"`)) {
+					t.Errorf("unexpected denial in the audit log: %s", data)
+				}
+				return
+			}
+
+			if grpc.Code(err) != codes.PermissionDenied || !strings.Contains(grpc.ErrorDesc(err), tc.error) {
+				t.Errorf("bad error: %v (expected PermissionDenied error containing %q)", err, tc.error)
+			}
+			if n := authorizationDenialCount.Get(metricMethodName(tc.method)); n != denials+1 {
+				t.Errorf("bad authorization denial count %v instead of %v", n, denials+1)
+			}
+			if readErr != nil {
+				t.Fatalf("can't read the audit log: %v", readErr)
+			}
+			var entry auditEntry
+			if err := json.Unmarshal(data, &entry); err != nil {
+				t.Fatalf("can't unmarshal the audit log entry %q: %v", data, err)
+			}
+			if entry.Method != metricMethodName(tc.method) || entry.Code != "PermissionDenied" || !strings.Contains(entry.Reason, tc.error) {
+				t.Errorf("bad audit log entry: %s", data)
+			}
+			if entry.Caller == nil || entry.Caller.PID == nil || *entry.Caller.PID != int32(os.Getpid()) || entry.Caller.UID == nil || *entry.Caller.UID != uid {
+				t.Errorf("bad caller in the audit log entry: %s", data)
+			}
+		})
+	}
+}
+
+func TestCriProxyAuditLog(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "criproxy-audit-test-")
+	if err != nil {
+		t.Fatalf("TempDir(): %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+	auditLogFile := filepath.Join(tmpDir, "audit.log")
+	tester := newProxyTester(t, altSocketSpec, []makeFakeCriServerFunc{
+		proxytest.NewFakeCriServer19,
+		proxytest.NewFakeCriServer19,
+	}, func(config *Config) {
+		config.Audit = AuditConfig{File: auditLogFile}
+	})
+	defer tester.stop()
+	tester.startServers(t, -1)
+	tester.startProxy(t)
+	tester.connectToProxy(t)
+
+	podMetadata := &runtimeapi.PodSandboxMetadata{
+		Name:      "pod-1",
+		Namespace: "default",
+		Uid:       "4bde9008-4663-4342-84ed-310cea787727",
+	}
+	for _, call := range []struct {
+		method   string
+		in, resp interface{}
+	}{
+		{
+			method: "/runtime.RuntimeService/RunPodSandbox",
+			in: &runtimeapi.RunPodSandboxRequest{
+				Config: &runtimeapi.PodSandboxConfig{
+					Metadata: podMetadata,
+					Annotations: map[string]string{
+						"kubernetes.io/target-runtime": "alt",
+						"secret-token":                 "topsecret",
+					},
+				},
+			},
+			resp: &runtimeapi.RunPodSandboxResponse{},
+		},
+		{
+			method: "/runtime.RuntimeService/ListPodSandbox",
+			in:     &runtimeapi.ListPodSandboxRequest{},
+			resp:   &runtimeapi.ListPodSandboxResponse{},
+		},
+		{
+			method: "/runtime.RuntimeService/ExecSync",
+			in: &runtimeapi.ExecSyncRequest{
+				ContainerId: containerId1,
+				Cmd:         []string{"login", "--password", "topsecret"},
+			},
+			resp: &runtimeapi.ExecSyncResponse{},
+		},
+		{
+			method: "/runtime.ImageService/PullImage",
+			in: &runtimeapi.PullImageRequest{
+				Image:         &runtimeapi.ImageSpec{Image: "image1-1"},
+				Auth:          &runtimeapi.AuthConfig{Username: "user", Password: "topsecret"},
+				SandboxConfig: &runtimeapi.PodSandboxConfig{Metadata: podMetadata},
+			},
+			resp: &runtimeapi.PullImageResponse{},
+		},
+	} {
+		if err := tester.invoke(call.method, call.in, call.resp); err != nil {
+			t.Fatalf("%s failed: %v", call.method, err)
+		}
+	}
+	if err := tester.invoke("/runtime.RuntimeService/StartContainer", &runtimeapi.StartContainerRequest{ContainerId: "alt__nosuchcontainer"}, &runtimeapi.StartContainerResponse{}); grpc.Code(err) != codes.NotFound {
+		t.Errorf("StartContainer: unexpected error %v (expected NotFound)", err)
+	}
+
+	data, err := ioutil.ReadFile(auditLogFile)
+	if err != nil {
+		t.Fatalf("can't read the audit log: %v", err)
+	}
+	if strings.Contains(string(data), "topsecret") {
+		t.Errorf("secrets leaked into the audit log:\n%s", data)
+	}
+	var entries []auditEntry
+	for _, line := range strings.Split(strings.TrimSpace(string(data)), "\n") {
+		var entry auditEntry
+		if err := json.Unmarshal([]byte(line), &entry); err != nil {
+			t.Fatalf("can't unmarshal the audit log entry %q: %v", line, err)
+		}
+		if entry.Caller == nil || entry.Caller.PID == nil || *entry.Caller.PID != int32(os.Getpid()) {
+			t.Errorf("bad caller in the audit log entry: %s", line)
+		}
+		if entry.Time.IsZero() || entry.DurationSeconds < 0 {
+			t.Errorf("bad time or duration in the audit log entry: %s", line)
+		}
+		// clear the fields that can't be compared
+		entry.Time, entry.Caller, entry.DurationSeconds = time.Time{}, nil, 0
+		entries = append(entries, entry)
+	}
+	pod := &PodMetadata{Name: podMetadata.Name, Namespace: podMetadata.Namespace, Uid: podMetadata.Uid}
+	expectedEntries := []auditEntry{
+		{
+			Method:       "RuntimeService/RunPodSandbox",
+			Runtimes:     []string{"alt"},
+			Pod:          pod,
+			PodSandboxId: "alt__" + proxytest.BuildSandboxName19(podMetadata),
+			Code:         "OK",
+		},
+		{
+			Method:      "RuntimeService/ExecSync",
+			Runtimes:    []string{""},
+			ContainerId: containerId1,
+			Code:        "OK",
+		},
+		{
+			Method:   "ImageService/PullImage",
+			Runtimes: []string{"", "alt"},
+			Pod:      pod,
+			Image:    "image1-1",
+			Code:     "OK",
+		},
+		{
+			Method:      "RuntimeService/StartContainer",
+			Runtimes:    []string{"alt"},
+			ContainerId: "alt__nosuchcontainer",
+			Code:        "NotFound",
+		},
+	}
+	if !reflect.DeepEqual(entries, expectedEntries) {
+		t.Errorf("bad audit log entries:\n%s", data)
+	}
+}
+
+func TestCriProxyMiddleware(t *testing.T) {
+	var lock sync.Mutex
+	var calls []string
+	record := func(ctx context.Context, req *BackendRequest, next Invoker) error {
+		err := next(ctx, req)
+		lock.Lock()
+		defer lock.Unlock()
+		call := fmt.Sprintf("%s %q", req.Method, req.RuntimeID)
+		if out, ok := req.Response.(CreateContainerResponse); ok && err == nil {
+			// the response is seen before the prefix is added to the id
+			call += " " + out.ContainerId()
+		}
+		calls = append(calls, call)
+		return err
+	}
+	rewrite := func(ctx context.Context, req *BackendRequest, next Invoker) error {
+		runtime := req.RuntimeID
+		if runtime == "" {
+			runtime = "primary"
+		}
+		switch in := req.Request.Unwrap().(type) {
+		case *runtimeapi.RunPodSandboxRequest, *v1_12.RunPodSandboxRequest:
+			if req.RuntimeID == "alt" {
+				return grpc.Errorf(codes.PermissionDenied, "no pods for alt")
+			}
+		case *runtimeapi.CreateContainerRequest:
+			in.Config.Labels = map[string]string{"runtime": runtime}
+			in.Config.Annotations = map[string]string{"runtime": runtime}
+		case *v1_12.CreateContainerRequest:
+			in.Config.Labels = map[string]string{"runtime": runtime}
+			in.Config.Annotations = map[string]string{"runtime": runtime}
+		case *runtimeapi.ListContainersRequest:
+			in.Filter = &runtimeapi.ContainerFilter{LabelSelector: map[string]string{"runtime": runtime}}
+		}
+		return next(ctx, req)
+	}
+	tester := newProxyTester(t, altSocketSpec, []makeFakeCriServerFunc{
+		proxytest.NewFakeCriServer110,
+		proxytest.NewFakeCriServer110,
+	}, nil, record, rewrite)
+	defer tester.stop()
+	tester.startServers(t, -1)
+	tester.startProxy(t)
+	tester.connectToProxy(t)
+	tester.skipJournalItems("1/runtime/Version", "2/runtime/Version")
+	tester.connectAll(t, 0)
+	tester.connectAll(t, 1)
+
+	err := tester.invoke("/runtime.RuntimeService/RunPodSandbox", &runtimeapi.RunPodSandboxRequest{
+		Config: &runtimeapi.PodSandboxConfig{
+			Metadata:    &runtimeapi.PodSandboxMetadata{Name: "pod-1", Namespace: "default", Uid: "uid-1"},
+			Annotations: map[string]string{"kubernetes.io/target-runtime": "alt"},
+		},
+	}, &runtimeapi.RunPodSandboxResponse{})
+	if grpc.Code(err) != codes.PermissionDenied {
+		t.Errorf("RunPodSandbox: unexpected error %v (expected PermissionDenied)", err)
+	}
+
+	var resp19 runtimeapi.CreateContainerResponse
+	if err := tester.invoke("/runtime.RuntimeService/CreateContainer", &runtimeapi.CreateContainerRequest{
+		PodSandboxId: "alt__" + podSandboxId1,
+		Config: &runtimeapi.ContainerConfig{
+			Metadata: &runtimeapi.ContainerMetadata{Name: "container19"},
+			Image:    &runtimeapi.ImageSpec{Image: "image2-1"},
+		},
+		SandboxConfig: &runtimeapi.PodSandboxConfig{},
+	}, &resp19); err != nil {
+		t.Fatalf("CreateContainer (CRI 1.9) failed: %v", err)
+	}
+	var resp112 v1_12.CreateContainerResponse
+	if err := tester.invoke("/runtime.v1alpha2.RuntimeService/CreateContainer", &v1_12.CreateContainerRequest{
+		PodSandboxId: podSandboxId1,
+		Config: &v1_12.ContainerConfig{
+			Metadata: &v1_12.ContainerMetadata{Name: "container112"},
+			Image:    &v1_12.ImageSpec{Image: "image1-1"},
+		},
+		SandboxConfig: &v1_12.PodSandboxConfig{},
+	}, &resp112); err != nil {
+		t.Fatalf("CreateContainer (CRI 1.12) failed: %v", err)
+	}
+	tester.verifyJournal(t, []string{"2/runtime/CreateContainer", "1/runtime/CreateContainer"})
+
+	containerId19 := proxytest.BuildContainerName110(&v1_12.ContainerMetadata{Name: "container19"}, podSandboxId1)
+	containerId112 := proxytest.BuildContainerName110(&v1_12.ContainerMetadata{Name: "container112"}, podSandboxId1)
+	if resp19.ContainerId != "alt__"+containerId19 {
+		t.Errorf("bad container id %q (expected %q)", resp19.ContainerId, "alt__"+containerId19)
+	}
+	var status19 runtimeapi.ContainerStatusResponse
+	if err := tester.invoke("/runtime.RuntimeService/ContainerStatus", &runtimeapi.ContainerStatusRequest{ContainerId: resp19.ContainerId}, &status19); err != nil {
+		t.Fatalf("ContainerStatus (CRI 1.9) failed: %v", err)
+	}
+	if a := status19.Status.Annotations["runtime"]; a != "alt" {
+		t.Errorf("bad annotation injected by the middleware for CRI 1.9: %q", a)
+	}
+	var status112 v1_12.ContainerStatusResponse
+	if err := tester.invoke("/runtime.v1alpha2.RuntimeService/ContainerStatus", &v1_12.ContainerStatusRequest{ContainerId: resp112.ContainerId}, &status112); err != nil {
+		t.Fatalf("ContainerStatus (CRI 1.12) failed: %v", err)
+	}
+	if a := status112.Status.Annotations["runtime"]; a != "primary" {
+		t.Errorf("bad annotation injected by the middleware for CRI 1.12: %q", a)
+	}
+
+	expectedCalls := []string{
+		`/runtime.RuntimeService/RunPodSandbox "alt"`,
+		`/runtime.RuntimeService/CreateContainer "alt" ` + containerId19,
+		`/runtime.v1alpha2.RuntimeService/CreateContainer "" ` + containerId112,
+		`/runtime.RuntimeService/ContainerStatus "alt"`,
+		`/runtime.v1alpha2.RuntimeService/ContainerStatus ""`,
+	}
+	lock.Lock()
+	if !reflect.DeepEqual(calls, expectedCalls) {
+		t.Errorf("bad middleware calls:\n%s\ninstead of:\n%s", strings.Join(calls, "\n"), strings.Join(expectedCalls, "\n"))
+	}
+	lock.Unlock()
+
+	// the runtimes are listed in parallel, each of them
+	// getting its own copy of the request to rewrite
+	var listResp runtimeapi.ListContainersResponse
+	if err := tester.invoke("/runtime.RuntimeService/ListContainers", &runtimeapi.ListContainersRequest{}, &listResp); err != nil {
+		t.Fatalf("ListContainers failed: %v", err)
+	}
+	var ids []string
+	for _, c := range listResp.Containers {
+		ids = append(ids, c.Id)
+	}
+	expectedIds := []string{resp112.ContainerId, resp19.ContainerId}
+	if !reflect.DeepEqual(ids, expectedIds) {
+		t.Errorf("bad container ids %v listed with the per-runtime filters (expected %v)", ids, expectedIds)
+	}
+}
+
+func TestCriProxyStreaming(t *testing.T) {
+	// the runtime's streaming server switches the protocols
+	// and echoes the data back
+	var backendPaths []string
+	var backendLock sync.Mutex
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		backendLock.Lock()
+		backendPaths = append(backendPaths, req.URL.RequestURI())
+		backendLock.Unlock()
+		if req.Header.Get("Upgrade") != "SPDY/3.1" {
+			http.Error(w, "upgrade expected", http.StatusBadRequest)
+			return
+		}
+		conn, buf, err := w.(http.Hijacker).Hijack()
+		if err != nil {
+			t.Errorf("Hijack(): %v", err)
+			return
+		}
+		defer conn.Close()
+		fmt.Fprint(conn, "HTTP/1.1 101 Switching Protocols\r\nConnection: Upgrade\r\nUpgrade: SPDY/3.1\r\n\r\n")
+		line, err := buf.ReadString('\n')
+		if err != nil {
+			t.Errorf("error reading from the upgraded connection: %v", err)
+			return
+		}
+		fmt.Fprint(conn, "echo: "+line)
+	}))
+	defer backend.Close()
+
+	tmpDir, err := ioutil.TempDir("", "criproxy-streaming-test-")
+	if err != nil {
+		t.Fatalf("TempDir(): %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+	ca, serverCert, clientCert := makeTestCerts(t, tmpDir)
+	streamingConfig := &StreamingConfig{
+		Address: "127.0.0.1:0",
+		TLS: ListenerTLSConfig{
+			CertFile:     serverCert.certFile,
+			KeyFile:      serverCert.keyFile,
+			ClientCAFile: ca.certFile,
+		},
+	}
+	ln, err := ListenStreaming(streamingConfig)
+	if err != nil {
+		t.Fatalf("ListenStreaming(): %v", err)
+	}
+	defer ln.Close()
+	streamingConfig.Url = "https://" + ln.Addr().String() + "/streaming"
+	handler, err := NewStreamHandler(streamingConfig)
+	if err != nil {
+		t.Fatalf("NewStreamHandler(): %v", err)
+	}
+	go http.Serve(ln, handler)
+
+	var proxyConfig *Config
+	tester := newProxyTester(t, altSocketSpec, []makeFakeCriServerFunc{
+		proxytest.NewFakeCriServer19,
+		proxytest.NewFakeCriServer19,
+	}, func(config *Config) {
+		// the primary runtime returns relative urls
+		config.Backends[0].StreamUrl = backend.URL
+		config.Streaming = streamingConfig
+		proxyConfig = config
+	})
+	defer tester.stop()
+	tester.startServers(t, -1)
+	tester.startProxy(t)
+	tester.connectToProxy(t)
+	tester.connectAll(t, 0)
+
+	var resp runtimeapi.ExecResponse
+	if err := tester.invoke("/runtime.RuntimeService/Exec", &runtimeapi.ExecRequest{ContainerId: containerId1, Cmd: []string{"ls"}}, &resp); err != nil {
+		t.Fatalf("Exec failed: %v", err)
+	}
+	prefix := streamingConfig.Url + "/cri/exec/"
+	if !strings.HasPrefix(resp.Url, prefix) || len(resp.Url) == len(prefix) {
+		t.Fatalf("bad exec url %q (expected %q followed by a token)", resp.Url, prefix)
+	}
+	var altResp runtimeapi.PortForwardResponse
+	if err := tester.invoke("/runtime.RuntimeService/PortForward", &runtimeapi.PortForwardRequest{PodSandboxId: podSandboxId2}, &altResp); err != nil {
+		t.Fatalf("PortForward failed: %v", err)
+	}
+	altPrefix := streamingConfig.Url + "/cri/portforward/"
+	if !strings.HasPrefix(altResp.Url, altPrefix) {
+		t.Fatalf("bad port forward url %q (expected %q followed by a token)", altResp.Url, altPrefix)
+	}
+	if target := tester.proxies[0].streamServer.take(altResp.Url[len(altPrefix):]); target == nil || target.String() != "http://[::]:12345/stream" {
+		t.Errorf("bad port forward target %v", target)
+	}
+
+	caPool := x509.NewCertPool()
+	caPool.AddCert(ca.cert)
+	clientKeyPair, err := tls.LoadX509KeyPair(clientCert.certFile, clientCert.keyFile)
+	if err != nil {
+		t.Fatalf("LoadX509KeyPair(): %v", err)
+	}
+	tlsConfig := &tls.Config{
+		RootCAs:      caPool,
+		Certificates: []tls.Certificate{clientKeyPair},
+		ServerName:   "runtime.example.com",
+	}
+	u, err := url.Parse(resp.Url)
+	if err != nil {
+		t.Fatalf("can't parse exec url %q: %v", resp.Url, err)
+	}
+	stream := func() (*http.Response, net.Conn) {
+		conn, err := tls.Dial("tcp", u.Host, tlsConfig)
+		if err != nil {
+			t.Fatalf("can't connect to the streaming endpoint: %v", err)
+		}
+		fmt.Fprintf(conn, "GET %s HTTP/1.1\r\nHost: %s\r\nConnection: Upgrade\r\nUpgrade: SPDY/3.1\r\n\r\n", u.RequestURI(), u.Host)
+		r, err := http.ReadResponse(bufio.NewReader(conn), nil)
+		if err != nil {
+			t.Fatalf("can't read the response: %v", err)
+		}
+		return r, conn
+	}
+
+	r, conn := stream()
+	defer conn.Close()
+	if r.StatusCode != http.StatusSwitchingProtocols {
+		t.Fatalf("bad status code %d", r.StatusCode)
+	}
+	fmt.Fprint(conn, "hello\n")
+	data, err := ioutil.ReadAll(conn)
+	if err != nil {
+		t.Errorf("error reading from the upgraded connection: %v", err)
+	}
+	if string(data) != "echo: hello\n" {
+		t.Errorf("bad data from the upgraded connection: %q", data)
+	}
+	backendLock.Lock()
+	if !reflect.DeepEqual(backendPaths, []string{"/cri"}) {
+		t.Errorf("bad backend request paths: %v", backendPaths)
+	}
+	backendLock.Unlock()
+
+	// the tokens can only be used once
+	r, conn = stream()
+	defer conn.Close()
+	if r.StatusCode != http.StatusNotFound {
+		t.Errorf("bad status code %d for a reused token (expected %d)", r.StatusCode, http.StatusNotFound)
+	}
+
+	// the clients must present certificates
+	tlsConfig.Certificates = nil
+	if conn, err := tls.Dial("tcp", u.Host, tlsConfig); err == nil {
+		_, err = conn.Write([]byte("GET / HTTP/1.1\r\n\r\n"))
+		if err == nil {
+			_, err = conn.Read(make([]byte, 1))
+		}
+		conn.Close()
+		if err == nil {
+			t.Errorf("the streaming endpoint accepted a client without a certificate")
+		}
+	}
+
+	// the url and the token TTL can be changed by reloading
+	// the config, but no listener would serve the endpoint
+	// with a different address or TLS settings
+	reloadStreaming := func(streaming *StreamingConfig) error {
+		config := *proxyConfig
+		config.Streaming = streaming
+		return tester.proxies[0].Reload(&config)
+	}
+	if err := reloadStreaming(&StreamingConfig{
+		Address:  streamingConfig.Address,
+		Url:      streamingConfig.Url + "/new",
+		TLS:      streamingConfig.TLS,
+		TokenTTL: Duration{time.Minute},
+	}); err != nil {
+		t.Errorf("Reload() failed for the changed url and token TTL: %v", err)
+	}
+	for _, tc := range []struct {
+		name      string
+		streaming *StreamingConfig
+	}{
+		{
+			name: "address",
+			streaming: &StreamingConfig{
+				Address: "127.0.0.1:10011",
+				Url:     streamingConfig.Url,
+				TLS:     streamingConfig.TLS,
+			},
+		},
+		{
+			name: "TLS",
+			streaming: &StreamingConfig{
+				Address: streamingConfig.Address,
+				Url:     streamingConfig.Url,
+			},
+		},
+		{
+			name: "no streaming endpoint",
+		},
+	} {
+		if err := reloadStreaming(tc.streaming); err == nil {
+			t.Errorf("Reload() didn't fail for the changed streaming endpoint (%s)", tc.name)
+		}
+	}
+	if tester.proxies[0].streamServer == nil || tester.proxies[0].streamServer.baseUrl.String() != streamingConfig.Url+"/new" {
+		t.Errorf("the streaming endpoint was changed by a failed reload")
+	}
+}
+
+func TestCriProxyStreamUrlDiscovery(t *testing.T) {
+	tester := newProxyTester(t, altSocketSpec, []makeFakeCriServerFunc{
+		proxytest.NewFakeCriServer19,
+		proxytest.NewFakeCriServer19,
+	}, func(config *Config) {
+		config.Backends[0].DiscoverStreamUrl = true
+	})
+	defer tester.stop()
+	primary := tester.servers[0].(*proxytest.FakeCriServer19)
+	primary.SetFakeStatusInfo(map[string]string{
+		"config": `{"streamServerAddress":"0.0.0.0","streamServerPort":"10010","enableTLSStreaming":true}`,
+	})
+	// the runtime that doesn't respond to the Status request
+	// doesn't keep the requests from being passed to it
+	statusBlock := make(chan struct{})
+	primary.BlockStatus(statusBlock)
+	tester.startServers(t, -1)
+	tester.startProxy(t)
+	tester.connectToProxy(t)
+	connected := make(chan error, 1)
+	go func() {
+		for _, c := range tester.proxies[0].clientSet.clients {
+			if err := <-c.connect(); err != nil {
+				connected <- err
+				return
+			}
+		}
+		connected <- nil
+	}()
+	select {
+	case err := <-connected:
+		if err != nil {
+			t.Fatalf("connect(): %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("connecting to the runtimes waits for the Status request")
+	}
+	if err := tester.invoke("/runtime.RuntimeService/ListPodSandbox", &runtimeapi.ListPodSandboxRequest{}, &runtimeapi.ListPodSandboxResponse{}); err != nil {
+		t.Fatalf("ListPodSandbox failed: %v", err)
+	}
+	tester.verifyJournalUnordered(t, []string{"1/runtime/Version", "2/runtime/Version", "1/runtime/ListPodSandbox", "2/runtime/ListPodSandbox"})
+	close(statusBlock)
+	waitForOnConnected(tester.proxies[0].clientSet.clients[0])
+	tester.verifyJournal(t, []string{"1/runtime/Status"})
+
+	// the relative url returned by the primary runtime is
+	// fixed using the discovered url with the node address
+	expectedUrl, err := utils.GetStreamUrl(10010)
+	if err != nil {
+		t.Fatalf("GetStreamUrl(): %v", err)
+	}
+	expectedUrl.Scheme = "https"
+	expectedUrl.Path = "/cri"
+	var resp runtimeapi.ExecResponse
+	if err := tester.invoke("/runtime.RuntimeService/Exec", &runtimeapi.ExecRequest{ContainerId: containerId1, Cmd: []string{"ls"}}, &resp); err != nil {
+		t.Fatalf("Exec failed: %v", err)
+	}
+	if resp.Url != expectedUrl.String() {
+		t.Errorf("bad exec url %q (expected %q)", resp.Url, expectedUrl)
+	}
+
+	// the loopback urls can only be used with
+	// the proxy's streaming endpoint
+	config := &Config{
+		Backends: []BackendConfig{
+			ParseBackendSpec(fakeCriSocketPath1),
+			ParseBackendSpec(altSocketSpec),
+		},
+	}
+	config.Backends[1].StreamUrl = "http://127.0.0.1:10010"
+	if _, err := NewRuntimeProxy(&CRI19{}, config); err == nil || !strings.Contains(err.Error(), "loopback address") {
+		t.Errorf("NewRuntimeProxy() didn't reject the loopback stream url (error: %v)", err)
+	}
+	config.Streaming = &StreamingConfig{Address: "127.0.0.1:0"}
+	proxy, err := NewRuntimeProxy(&CRI19{}, config)
+	if err != nil {
+		t.Fatalf("NewRuntimeProxy(): %v", err)
+	}
+	proxy.Stop()
+}
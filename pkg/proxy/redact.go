@@ -0,0 +1,207 @@
+/*
+Copyright 2018 Mirantis
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package proxy
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"regexp"
+
+	"github.com/gogo/protobuf/proto"
+
+	"github.com/elotl/criproxy/pkg/rawcodec"
+)
+
+const redactedValue = "<redacted>"
+
+var (
+	// defaultSecretEnvPatterns match the names of environment
+	// variables that are likely to hold secrets
+	defaultSecretEnvPatterns = []string{
+		`(?i)passw(or)?d|secret|token|credential|api_?key|private_?key|auth`,
+	}
+	// defaultSecretAnnotationPatterns match the annotation keys
+	// that are likely to hold secrets. The last applied config
+	// annotation is included because it contains the whole
+	// object, including the environment variables.
+	defaultSecretAnnotationPatterns = []string{
+		`(?i)passw(or)?d|secret|token|credential|api_?key|private_?key|auth`,
+		`last-applied-configuration$`,
+	}
+)
+
+// requestLogger formats the CRI requests and responses that
+// are logged by the proxy, redacting the sensitive data in them:
+// registry credentials, the values of environment variables and
+// annotations with secret-looking names, exec command arguments
+// and the data of the messages that are passed through as raw
+// protobuf.
+type requestLogger struct {
+	json          bool
+	envRxs        []*regexp.Regexp
+	annotationRxs []*regexp.Regexp
+}
+
+func compilePatterns(patterns []string) ([]*regexp.Regexp, error) {
+	var r []*regexp.Regexp
+	for _, p := range patterns {
+		rx, err := regexp.Compile(p)
+		if err != nil {
+			return nil, fmt.Errorf("bad pattern %q: %v", p, err)
+		}
+		r = append(r, rx)
+	}
+	return r, nil
+}
+
+// newRequestLogger makes a requestLogger for the specified config.
+// The nil pattern lists are replaced with the default ones.
+func newRequestLogger(config LogConfig) (*requestLogger, error) {
+	envPatterns := config.SecretEnvPatterns
+	if envPatterns == nil {
+		envPatterns = defaultSecretEnvPatterns
+	}
+	annotationPatterns := config.SecretAnnotationPatterns
+	if annotationPatterns == nil {
+		annotationPatterns = defaultSecretAnnotationPatterns
+	}
+	envRxs, err := compilePatterns(envPatterns)
+	if err != nil {
+		return nil, fmt.Errorf("secretEnvPatterns: %v", err)
+	}
+	annotationRxs, err := compilePatterns(annotationPatterns)
+	if err != nil {
+		return nil, fmt.Errorf("secretAnnotationPatterns: %v", err)
+	}
+	return &requestLogger{
+		json:          config.Format == LogFormatJSON,
+		envRxs:        envRxs,
+		annotationRxs: annotationRxs,
+	}, nil
+}
+
+// format returns the text to be logged for a request, a response
+// or a streamed message. event is ENTER, LEAVE or EVENT.
+func (l *requestLogger) format(event, method string, o interface{}) string {
+	o = l.redact(o)
+	if !l.json {
+		return fmt.Sprintf("%s: %s():\n%s", event, method, dump(o))
+	}
+	out, err := json.Marshal(struct {
+		Event   string      `json:"event"`
+		Method  string      `json:"method"`
+		Message interface{} `json:"message"`
+	}{event, method, o})
+	if err != nil {
+		return fmt.Sprintf("%s: %s(): <Error marshalling %T: %v>", event, method, o, err)
+	}
+	return string(out)
+}
+
+// redact returns a copy of the CRI object with the sensitive
+// data replaced by a placeholder. The objects that aren't
+// protobuf messages are returned as-is.
+func (l *requestLogger) redact(o interface{}) interface{} {
+	switch m := o.(type) {
+	case *rawcodec.Message:
+		return fmt.Sprintf("<%d bytes of raw protobuf data>", len(m.Data))
+	case proto.Message:
+		if reflect.ValueOf(m).IsNil() {
+			return o
+		}
+		c := proto.Clone(m)
+		l.redactValue(reflect.ValueOf(c))
+		return c
+	default:
+		return o
+	}
+}
+
+func (l *requestLogger) redactValue(v reflect.Value) {
+	switch v.Kind() {
+	case reflect.Ptr:
+		if !v.IsNil() {
+			l.redactValue(v.Elem())
+		}
+	case reflect.Slice:
+		for i := 0; i < v.Len(); i++ {
+			l.redactValue(v.Index(i))
+		}
+	case reflect.Struct:
+		l.redactStruct(v)
+	}
+}
+
+// redactStruct redacts the fields of a CRI message. The rules
+// are based on the names of the types and the fields, which are
+// the same in all of the supported CRI versions.
+func (l *requestLogger) redactStruct(v reflect.Value) {
+	t := v.Type()
+	if t.Name() == "AuthConfig" {
+		// all of the fields of AuthConfig except for
+		// the registry address are sensitive
+		for i := 0; i < v.NumField(); i++ {
+			if t.Field(i).Name == "ServerAddress" {
+				continue
+			}
+			if f := v.Field(i); f.Kind() == reflect.String && f.String() != "" {
+				f.SetString(redactedValue)
+			}
+		}
+		return
+	}
+	for i := 0; i < v.NumField(); i++ {
+		f := v.Field(i)
+		switch name := t.Field(i).Name; {
+		case name == "Envs" && f.Kind() == reflect.Slice:
+			for j := 0; j < f.Len(); j++ {
+				kv := reflect.Indirect(f.Index(j))
+				if !kv.IsValid() {
+					continue
+				}
+				key, value := kv.FieldByName("Key"), kv.FieldByName("Value")
+				if key.IsValid() && value.IsValid() && matchesAny(l.envRxs, key.String()) {
+					value.SetString(redactedValue)
+				}
+			}
+		case name == "Annotations" && f.Kind() == reflect.Map:
+			for _, key := range f.MapKeys() {
+				if matchesAny(l.annotationRxs, key.String()) {
+					f.SetMapIndex(key, reflect.ValueOf(redactedValue))
+				}
+			}
+		case name == "Cmd" && f.Kind() == reflect.Slice && (t.Name() == "ExecSyncRequest" || t.Name() == "ExecRequest"):
+			// keep the executable name, but not the
+			// arguments which may contain secrets
+			for j := 1; j < f.Len(); j++ {
+				f.Index(j).SetString(redactedValue)
+			}
+		default:
+			l.redactValue(f)
+		}
+	}
+}
+
+func matchesAny(rxs []*regexp.Regexp, s string) bool {
+	for _, rx := range rxs {
+		if rx.MatchString(s) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,149 @@
+/*
+Copyright 2018 Mirantis
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package proxy
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/elotl/criproxy/pkg/rawcodec"
+	v1 "github.com/elotl/criproxy/pkg/runtimeapis/v1"
+	v1_12 "github.com/elotl/criproxy/pkg/runtimeapis/v1_12"
+	runtimeapi "github.com/elotl/criproxy/pkg/runtimeapis/v1_9"
+)
+
+func TestRequestLogger(t *testing.T) {
+	logger, err := newRequestLogger(LogConfig{})
+	if err != nil {
+		t.Fatalf("newRequestLogger(): %v", err)
+	}
+	for _, tc := range []struct {
+		name         string
+		in, redacted interface{}
+	}{
+		{
+			name: "CRI 1.9 PullImage auth",
+			in: &runtimeapi.PullImageRequest{
+				Image: &runtimeapi.ImageSpec{Image: "example.com/image"},
+				Auth: &runtimeapi.AuthConfig{
+					Username:      "user",
+					Password:      "pass",
+					ServerAddress: "example.com",
+				},
+			},
+			redacted: &runtimeapi.PullImageRequest{
+				Image: &runtimeapi.ImageSpec{Image: "example.com/image"},
+				Auth: &runtimeapi.AuthConfig{
+					Username:      redactedValue,
+					Password:      redactedValue,
+					ServerAddress: "example.com",
+				},
+			},
+		},
+		{
+			name: "CRI 1.12 CreateContainer envs and annotations",
+			in: &v1_12.CreateContainerRequest{
+				PodSandboxId: "pod",
+				Config: &v1_12.ContainerConfig{
+					Envs: []*v1_12.KeyValue{
+						{Key: "PATH", Value: "/bin"},
+						{Key: "DB_PASSWORD", Value: "qwerty"},
+						{Key: "GITHUB_TOKEN", Value: "abc"},
+					},
+					Annotations: map[string]string{
+						"foo":                "bar",
+						"example.com/secret": "42",
+					},
+				},
+				SandboxConfig: &v1_12.PodSandboxConfig{
+					Annotations: map[string]string{
+						"kubectl.kubernetes.io/last-applied-configuration": "{}",
+						"kubernetes.io/config.source":                      "api",
+					},
+				},
+			},
+			redacted: &v1_12.CreateContainerRequest{
+				PodSandboxId: "pod",
+				Config: &v1_12.ContainerConfig{
+					Envs: []*v1_12.KeyValue{
+						{Key: "PATH", Value: "/bin"},
+						{Key: "DB_PASSWORD", Value: redactedValue},
+						{Key: "GITHUB_TOKEN", Value: redactedValue},
+					},
+					Annotations: map[string]string{
+						"foo":                "bar",
+						"example.com/secret": redactedValue,
+					},
+				},
+				SandboxConfig: &v1_12.PodSandboxConfig{
+					Annotations: map[string]string{
+						"kubectl.kubernetes.io/last-applied-configuration": redactedValue,
+						"kubernetes.io/config.source":                      "api",
+					},
+				},
+			},
+		},
+		{
+			name: "CRI v1 ExecSync command",
+			in: &v1.ExecSyncRequest{
+				ContainerId: "container",
+				Cmd:         []string{"mysql", "-psecret"},
+			},
+			redacted: &v1.ExecSyncRequest{
+				ContainerId: "container",
+				Cmd:         []string{"mysql", redactedValue},
+			},
+		},
+		{
+			name:     "raw message",
+			in:       &rawcodec.Message{Data: []byte("secret")},
+			redacted: "<6 bytes of raw protobuf data>",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			orig := dump(tc.in)
+			if redacted := logger.redact(tc.in); !reflect.DeepEqual(redacted, tc.redacted) {
+				t.Errorf("bad redacted object: expected:\n%s\nactual:\n%s", dump(tc.redacted), dump(redacted))
+			}
+			if dump(tc.in) != orig {
+				t.Errorf("the original object was modified")
+			}
+		})
+	}
+
+	// empty pattern lists disable the redaction
+	logger, err = newRequestLogger(LogConfig{
+		Format:            LogFormatJSON,
+		SecretEnvPatterns: []string{},
+	})
+	if err != nil {
+		t.Fatalf("newRequestLogger(): %v", err)
+	}
+	in := &v1.CreateContainerRequest{
+		Config: &v1.ContainerConfig{
+			Envs: []*v1.KeyValue{{Key: "PASSWORD", Value: "qwerty"}},
+		},
+	}
+	expectedLine := `{"event":"ENTER","method":"/runtime.v1.RuntimeService/CreateContainer","message":{"config":{"envs":[{"key":"PASSWORD","value":"qwerty"}]}}}`
+	if line := logger.format("ENTER", "/runtime.v1.RuntimeService/CreateContainer", in); line != expectedLine {
+		t.Errorf("bad JSON log line:\n%s\ninstead of\n%s", line, expectedLine)
+	}
+
+	if _, err := newRequestLogger(LogConfig{SecretAnnotationPatterns: []string{"("}}); err == nil {
+		t.Errorf("newRequestLogger() didn't fail for a bad pattern")
+	}
+}
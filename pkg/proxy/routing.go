@@ -0,0 +1,117 @@
+/*
+Copyright 2018 Mirantis
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package proxy
+
+import (
+	"fmt"
+
+	"github.com/golang/glog"
+)
+
+// router chooses the runtimes for the pods according to
+// the routing rules.
+type router struct {
+	rules          []RoutingRule
+	defaultRuntime string
+	dryRun         bool
+}
+
+// newRouter makes a router for the config. It returns nil if
+// the config is nil, meaning that the pods go to the primary
+// runtime unless they request another one explicitly.
+func newRouter(config *RoutingConfig) *router {
+	if config == nil {
+		return nil
+	}
+	return &router{
+		rules:          config.Rules,
+		defaultRuntime: config.DefaultRuntime,
+		dryRun:         config.DryRun,
+	}
+}
+
+func mapMatches(expected, actual map[string]string) bool {
+	for k, v := range expected {
+		if actualValue, found := actual[k]; !found || actualValue != v {
+			return false
+		}
+	}
+	return true
+}
+
+func (rr *RoutingRule) matches(namespace string, labels, annotations map[string]string) bool {
+	if len(rr.Namespaces) > 0 {
+		found := false
+		for _, ns := range rr.Namespaces {
+			if ns == namespace {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return mapMatches(rr.Labels, labels) && mapMatches(rr.Annotations, annotations)
+}
+
+// route returns the id of the runtime for the pod and the
+// explanation of the choice for the log.
+func (rt *router) route(req RunPodSandboxRequest) (string, string) {
+	namespace := ""
+	if pod := req.PodMetadata(); pod != nil {
+		namespace = pod.Namespace
+	}
+	for n, rule := range rt.rules {
+		if rule.matches(namespace, req.GetLabels(), req.GetAnnotations()) {
+			name := rule.Name
+			if name == "" {
+				name = fmt.Sprintf("rules[%d]", n)
+			}
+			return rule.Runtime, fmt.Sprintf("matched rule %q", name)
+		}
+	}
+	return rt.defaultRuntime, "no rule matched, using the default runtime"
+}
+
+// routePodSandbox returns the id of the runtime the routing rules
+// choose for the pod, and false if the rules aren't used for it,
+// i.e. if there are no rules, they're in the dry run mode or the
+// pod has the target runtime annotation. The pods with the runtime
+// handlers that are mapped to the runtimes must be handled by the
+// caller. If explain is true, the choice is logged.
+func (cs *clientSet) routePodSandbox(req RunPodSandboxRequest, explain bool) (string, bool) {
+	if cs.router == nil {
+		return "", false
+	}
+	if _, found := req.GetAnnotations()[targetRuntimeAnnotationKey]; found {
+		return "", false
+	}
+	id, explanation := cs.router.route(req)
+	if explain {
+		podName := "<unknown>"
+		if pod := req.PodMetadata(); pod != nil {
+			podName = pod.Namespace + "/" + pod.Name
+		}
+		if cs.router.dryRun {
+			glog.Infof("Routing (dry run): pod %s would go to runtime %q: %s", podName, id, explanation)
+		} else {
+			glog.V(1).Infof("Routing: pod %s goes to runtime %q: %s", podName, id, explanation)
+		}
+	}
+	return id, !cs.router.dryRun
+}
@@ -0,0 +1,98 @@
+/*
+Copyright 2018 Mirantis
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package proxy
+
+import (
+	"testing"
+
+	runtimeapi "github.com/elotl/criproxy/pkg/runtimeapis/v1_9"
+)
+
+func TestRouter(t *testing.T) {
+	rt := newRouter(&RoutingConfig{
+		Rules: []RoutingRule{
+			{
+				Name:       "vms",
+				Namespaces: []string{"vms", "vms-test"},
+				Runtime:    "virtlet",
+			},
+			{
+				Labels:      map[string]string{"sandbox": "kata"},
+				Annotations: map[string]string{"io.example.com/isolated": "true"},
+				Runtime:     "kata",
+			},
+		},
+		DefaultRuntime: "runc",
+	})
+	for _, tc := range []struct {
+		name, namespace     string
+		labels, annotations map[string]string
+		runtime             string
+		explanation         string
+	}{
+		{
+			name:        "namespace",
+			namespace:   "vms-test",
+			runtime:     "virtlet",
+			explanation: `matched rule "vms"`,
+		},
+		{
+			name:        "labels and annotations",
+			namespace:   "default",
+			labels:      map[string]string{"sandbox": "kata", "app": "test"},
+			annotations: map[string]string{"io.example.com/isolated": "true"},
+			runtime:     "kata",
+			explanation: `matched rule "rules[1]"`,
+		},
+		{
+			name:        "all conditions must match",
+			namespace:   "default",
+			labels:      map[string]string{"sandbox": "kata"},
+			runtime:     "runc",
+			explanation: "no rule matched, using the default runtime",
+		},
+		{
+			name:        "the first matching rule wins",
+			namespace:   "vms",
+			labels:      map[string]string{"sandbox": "kata"},
+			annotations: map[string]string{"io.example.com/isolated": "true"},
+			runtime:     "virtlet",
+			explanation: `matched rule "vms"`,
+		},
+		{
+			name:        "no metadata",
+			runtime:     "runc",
+			explanation: "no rule matched, using the default runtime",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			config := &runtimeapi.PodSandboxConfig{
+				Labels:      tc.labels,
+				Annotations: tc.annotations,
+			}
+			if tc.namespace != "" {
+				config.Metadata = &runtimeapi.PodSandboxMetadata{Name: "pod-1", Namespace: tc.namespace}
+			}
+			req := &RunPodSandboxRequest_19{}
+			req.Wrap(&runtimeapi.RunPodSandboxRequest{Config: config})
+			runtime, explanation := rt.route(req)
+			if runtime != tc.runtime || explanation != tc.explanation {
+				t.Errorf("route() = %q, %q instead of %q, %q", runtime, explanation, tc.runtime, tc.explanation)
+			}
+		})
+	}
+}
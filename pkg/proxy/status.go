@@ -0,0 +1,218 @@
+/*
+Copyright 2018 Mirantis
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package proxy
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+
+	"github.com/golang/glog"
+	"golang.org/x/net/context"
+)
+
+const (
+	runtimeReadyCondition = "RuntimeReady"
+	networkReadyCondition = "NetworkReady"
+	// backendsInfoKey is the key of StatusResponse info that
+	// holds the status of each runtime in verbose mode.
+	backendsInfoKey = "criproxy"
+)
+
+// requiredConditions are the conditions that are combined
+// for the runtimes that are required for the node to be ready.
+var requiredConditions = []string{runtimeReadyCondition, networkReadyCondition}
+
+// runtimeStatusInfo describes the status of a runtime in
+// the verbose info of StatusResponse.
+type runtimeStatusInfo struct {
+	ID         string             `json:"id"`
+	Socket     string             `json:"socket"`
+	Required   bool               `json:"required"`
+	Conditions []RuntimeCondition `json:"conditions,omitempty"`
+	Info       map[string]string  `json:"info,omitempty"`
+	Error      string             `json:"error,omitempty"`
+}
+
+// runtimeStatus passes Status request to all of the runtimes and
+// combines their conditions. The conditions of the primary runtime
+// are returned as-is, except that RuntimeReady and NetworkReady
+// are false if they're not true for any of the required runtimes.
+// The conditions of the other runtimes are prefixed with the runtime
+// id, e.g. virtlet.cloud/RuntimeReady. The runtimes that fail or
+// aren't connected are reported as not ready.
+func (r *RuntimeProxy) runtimeStatus(ctx context.Context, method string, req, resp CRIObject) (interface{}, error) {
+	cs := r.clients(ctx)
+	primary, err := cs.primaryClient()
+	if err != nil {
+		return nil, err
+	}
+	// the primary runtime is queried first as its
+	// failure makes the whole request fail anyway
+	primaryReq, _, err := r.copyRequest(req)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := primary.invokeWithErrorHandling(ctx, method, primaryReq, resp); err != nil {
+		return nil, err
+	}
+	out := resp.(StatusResponse)
+
+	infos := make([]runtimeStatusInfo, len(cs.clients))
+	var wg sync.WaitGroup
+	for n, c := range cs.clients {
+		infos[n] = runtimeStatusInfo{
+			ID:       c.getID(),
+			Socket:   cs.backends[n].Socket,
+			Required: cs.backends[n].IsRequiredForStatus(),
+		}
+		switch {
+		case c.isPrimary():
+			infos[n].Conditions = out.Conditions()
+		case c.currentState() != clientStateConnected:
+			infos[n].Error = fmt.Sprintf("the runtime is %s", c.currentState())
+			// This does nothing if the state is clientStateConnecting,
+			// otherwise it tries to connect asynchronously
+			c.connect()
+		default:
+			wg.Add(1)
+			go func(info *runtimeStatusInfo, c client) {
+				defer wg.Done()
+				r.backendStatus(ctx, c, method, req, info)
+			}(&infos[n], c)
+		}
+	}
+	wg.Wait()
+
+	conditions := out.Conditions()
+	info := out.Info()
+	verbose := req.(StatusRequest).Verbose()
+	if verbose && info == nil {
+		info = make(map[string]string)
+	}
+	for _, backendInfo := range infos[1:] {
+		backendConditions := backendInfo.Conditions
+		if backendInfo.Error != "" {
+			backendConditions = unavailableConditions(backendInfo.Error)
+		}
+		for _, c := range backendConditions {
+			c.Type = backendInfo.ID + "/" + c.Type
+			conditions = append(conditions, c)
+		}
+		if backendInfo.Required {
+			conditions = requireConditions(conditions, backendInfo.ID, backendConditions)
+		}
+	}
+	out.SetConditions(conditions)
+
+	if verbose {
+		data, err := json.Marshal(infos)
+		if err != nil {
+			return nil, fmt.Errorf("error marshalling runtime status info: %v", err)
+		}
+		info[backendsInfoKey] = string(data)
+		out.SetInfo(info)
+	}
+	return resp, nil
+}
+
+// backendStatus passes Status request to a non-primary runtime,
+// storing the conditions or the error in the info.
+func (r *RuntimeProxy) backendStatus(ctx context.Context, c client, method string, req CRIObject, info *runtimeStatusInfo) {
+	backendCtx, cancel := backendContext(ctx, 0)
+	defer cancel()
+	// the request and response objects can't be shared
+	// between the runtimes that are queried in parallel
+	req, resp, err := r.copyRequest(req)
+	if err == nil {
+		_, err = c.invoke(backendCtx, method, req, resp)
+		if err != nil {
+			err = c.handleError(err, false)
+		}
+	}
+	if err != nil {
+		glog.V(criErrorLogLevel).Infof("Status failed for runtime %q: %v", c.getID(), err)
+		info.Error = err.Error()
+		return
+	}
+	out := resp.(StatusResponse)
+	info.Conditions = out.Conditions()
+	info.Info = out.Info()
+}
+
+// unavailableConditions returns the conditions that are reported
+// for a runtime that has failed or isn't connected.
+func unavailableConditions(message string) []RuntimeCondition {
+	var r []RuntimeCondition
+	for _, conditionType := range requiredConditions {
+		r = append(r, RuntimeCondition{
+			Type:    conditionType,
+			Status:  false,
+			Reason:  "RuntimeUnavailable",
+			Message: message,
+		})
+	}
+	return r
+}
+
+// requireConditions updates the combined conditions so that
+// RuntimeReady and NetworkReady are false unless they're true
+// for the specified runtime. A missing condition is treated
+// as false, the same way kubelet does it.
+func requireConditions(conditions []RuntimeCondition, id string, backendConditions []RuntimeCondition) []RuntimeCondition {
+	for _, conditionType := range requiredConditions {
+		backendCondition := RuntimeCondition{
+			Type:    conditionType,
+			Reason:  "ConditionNotReported",
+			Message: fmt.Sprintf("%s condition is not reported", conditionType),
+		}
+		for _, c := range backendConditions {
+			if c.Type == conditionType {
+				backendCondition = c
+			}
+		}
+		if backendCondition.Status {
+			continue
+		}
+		message := fmt.Sprintf("runtime %q: %s", id, backendCondition.Message)
+		found := false
+		for n := range conditions {
+			c := &conditions[n]
+			if c.Type != conditionType {
+				continue
+			}
+			found = true
+			if c.Status {
+				c.Status = false
+				c.Reason = backendCondition.Reason
+				c.Message = message
+			} else if c.Message == "" {
+				c.Message = message
+			} else {
+				c.Message += "; " + message
+			}
+		}
+		if !found {
+			conditions = append(conditions, RuntimeCondition{
+				Type:    conditionType,
+				Reason:  backendCondition.Reason,
+				Message: message,
+			})
+		}
+	}
+	return conditions
+}
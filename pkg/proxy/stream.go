@@ -0,0 +1,328 @@
+/*
+Copyright 2018 Mirantis
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package proxy
+
+import (
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+	"golang.org/x/net/context"
+
+	"github.com/elotl/criproxy/pkg/utils"
+)
+
+const (
+	// streamTokenLength is the number of random bytes in
+	// the tokens of the streaming urls
+	streamTokenLength = 16
+	// streamPathPrefix is the prefix of the paths of the
+	// streaming urls returned by the proxy, which is appended
+	// to the path of the base url
+	streamPathPrefix = "/cri/"
+	// streamUrlDiscoveryTimeout is the timeout for getting
+	// the status info of a runtime to find its streaming url
+	streamUrlDiscoveryTimeout = 30 * time.Second
+	// streamUrlInfoKey is the key of the status info item
+	// holding the streaming url of the runtime as a JSON string
+	streamUrlInfoKey = "streamUrl"
+	// runtimeConfigInfoKey is the key of the status info item
+	// holding the config of the CRI plugin of containerd
+	runtimeConfigInfoKey = "config"
+)
+
+// criPluginStreamingConfig holds the streaming settings of
+// the CRI plugin of containerd that are reported in its
+// status info.
+type criPluginStreamingConfig struct {
+	StreamServerAddress string `json:"streamServerAddress"`
+	StreamServerPort    string `json:"streamServerPort"`
+	EnableTLSStreaming  bool   `json:"enableTLSStreaming"`
+}
+
+// streamTarget is the streaming url of a runtime that
+// corresponds to a token.
+type streamTarget struct {
+	url     *url.URL
+	expires time.Time
+}
+
+// streamServer is the proxy's streaming endpoint. It replaces the
+// streaming urls returned by the runtimes with its own urls holding
+// one-time tokens, and passes the requests for these urls to the
+// runtimes' streaming servers.
+type streamServer struct {
+	sync.Mutex
+	baseUrl url.URL
+	ttl     time.Duration
+	targets map[string]streamTarget
+}
+
+var (
+	streamServersLock sync.Mutex
+	streamServers     = make(map[string]*streamServer)
+)
+
+// getStreamServer returns the streaming endpoint for the config.
+// The proxies for different CRI versions that use the same address
+// share the endpoint, so it can serve the urls returned by any of
+// them.
+func getStreamServer(config *StreamingConfig) (*streamServer, error) {
+	baseUrl, err := config.baseUrl()
+	if err != nil {
+		return nil, err
+	}
+	streamServersLock.Lock()
+	defer streamServersLock.Unlock()
+	s, found := streamServers[config.Address]
+	if !found {
+		s = &streamServer{targets: make(map[string]streamTarget)}
+		streamServers[config.Address] = s
+	}
+	// the url and the TTL may be changed by reloading the config
+	s.Lock()
+	defer s.Unlock()
+	s.baseUrl = *baseUrl
+	s.ttl = config.TokenTTL.Duration
+	if s.ttl == 0 {
+		s.ttl = DefaultStreamTokenTTL
+	}
+	return s, nil
+}
+
+// NewStreamHandler returns the HTTP handler of the proxy's
+// streaming endpoint described by the config.
+func NewStreamHandler(config *StreamingConfig) (http.Handler, error) {
+	return getStreamServer(config)
+}
+
+// ListenStreaming starts listening on the address of the proxy's
+// streaming endpoint described by the config, using TLS if it's
+// configured.
+func ListenStreaming(config *StreamingConfig) (net.Listener, error) {
+	var tlsConfig *tls.Config
+	if config.TLS.CertFile != "" {
+		var err error
+		if tlsConfig, err = config.TLS.serverConfig(); err != nil {
+			return nil, err
+		}
+	}
+	ln, err := net.Listen("tcp", config.Address)
+	if err != nil {
+		return nil, err
+	}
+	if tlsConfig != nil {
+		ln = tls.NewListener(ln, tlsConfig)
+	}
+	return ln, nil
+}
+
+// register remembers the runtime's streaming url and returns the
+// url of the proxy's endpoint with a new token that corresponds
+// to it. kind is the last part of the path before the token,
+// e.g. exec.
+func (s *streamServer) register(kind string, target *url.URL) (string, error) {
+	buf := make([]byte, streamTokenLength)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("can't generate streaming token: %v", err)
+	}
+	token := base64.RawURLEncoding.EncodeToString(buf)
+	s.Lock()
+	defer s.Unlock()
+	now := time.Now()
+	for t, st := range s.targets {
+		if now.After(st.expires) {
+			delete(s.targets, t)
+		}
+	}
+	s.targets[token] = streamTarget{url: target, expires: now.Add(s.ttl)}
+	u := s.baseUrl
+	u.Path = path.Join(u.Path, streamPathPrefix, kind, token)
+	return u.String(), nil
+}
+
+// take returns the runtime's streaming url that corresponds to
+// the token, removing the token, or nil if the token is unknown
+// or expired.
+func (s *streamServer) take(token string) *url.URL {
+	s.Lock()
+	defer s.Unlock()
+	st, found := s.targets[token]
+	if !found {
+		return nil
+	}
+	delete(s.targets, token)
+	if time.Now().After(st.expires) {
+		return nil
+	}
+	return st.url
+}
+
+func (s *streamServer) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	var target *url.URL
+	// the base url may have its own path
+	if strings.Contains(req.URL.Path, streamPathPrefix) {
+		target = s.take(path.Base(req.URL.Path))
+	}
+	if target == nil {
+		http.NotFound(w, req)
+		return
+	}
+	glog.V(criRequestLogLevel).Infof("Passing streaming request %s to %s", req.URL.Path, target.Host)
+	rp := &httputil.ReverseProxy{
+		Director: func(out *http.Request) {
+			out.URL.Scheme = target.Scheme
+			out.URL.Host = target.Host
+			out.URL.Path = target.Path
+			out.URL.RawPath = target.RawPath
+			if target.RawQuery != "" {
+				out.URL.RawQuery = target.RawQuery
+			}
+			out.Host = target.Host
+		},
+		// the streams must not be buffered
+		FlushInterval: -1,
+		ErrorHandler: func(w http.ResponseWriter, req *http.Request, err error) {
+			glog.Warningf("Streaming request to %s failed: %v", target.Host, err)
+			w.WriteHeader(http.StatusBadGateway)
+		},
+	}
+	rp.ServeHTTP(w, req)
+}
+
+// streamingUrl returns the url the client should use for the
+// streaming request. rawUrl is the streaming url returned by the
+// client's runtime, which is made absolute using the runtime's
+// streaming url if necessary. If the proxy's streaming endpoint
+// is configured, the url is replaced with the endpoint's url
+// holding a token that corresponds to the runtime's url.
+func (r *RuntimeProxy) streamingUrl(ctx context.Context, c client, method, rawUrl string) (string, error) {
+	rawUrl = r.fixStreamingUrl(ctx, c, rawUrl)
+	r.RLock()
+	s := r.streamServer
+	r.RUnlock()
+	if s == nil {
+		return rawUrl, nil
+	}
+	target, err := url.Parse(rawUrl)
+	if err != nil {
+		return "", fmt.Errorf("criproxy: bad streaming url %q returned by runtime %q: %v", rawUrl, c.getID(), err)
+	}
+	if target.Scheme == "" {
+		// the runtimes return urls like //[::]:35057/cri/exec/tb8rgDBh
+		target.Scheme = "http"
+	}
+	return s.register(strings.ToLower(path.Base(method)), target)
+}
+
+// streamUrlFromStatusInfo returns the streaming url of a runtime
+// found in its verbose status info, or nil if the info doesn't
+// have it. The "streamUrl" item takes precedence over the
+// streaming settings in the "config" item.
+func streamUrlFromStatusInfo(info map[string]string) (*url.URL, error) {
+	if v, found := info[streamUrlInfoKey]; found {
+		var rawUrl string
+		if err := json.Unmarshal([]byte(v), &rawUrl); err != nil {
+			return nil, fmt.Errorf("bad %q item in the status info: %v", streamUrlInfoKey, err)
+		}
+		u, err := url.Parse(rawUrl)
+		if err != nil {
+			return nil, fmt.Errorf("invalid stream url %q: %v", rawUrl, err)
+		}
+		return u, nil
+	}
+	v, found := info[runtimeConfigInfoKey]
+	if !found {
+		return nil, nil
+	}
+	var config criPluginStreamingConfig
+	if err := json.Unmarshal([]byte(v), &config); err != nil {
+		return nil, fmt.Errorf("bad %q item in the status info: %v", runtimeConfigInfoKey, err)
+	}
+	if config.StreamServerPort == "" {
+		return nil, nil
+	}
+	host := config.StreamServerAddress
+	if host == "" {
+		// the streaming server listens on all addresses
+		host = "0.0.0.0"
+	}
+	u := &url.URL{
+		Scheme: "http",
+		Host:   net.JoinHostPort(host, config.StreamServerPort),
+	}
+	if config.EnableTLSStreaming {
+		u.Scheme = "https"
+	}
+	return u, nil
+}
+
+// discoverStreamUrl gets the verbose status info of the runtime
+// if its config has discoverStreamUrl set, and remembers the
+// streaming url found there, so it can be used to fix the
+// relative urls returned by the runtime.
+func (r *RuntimeProxy) discoverStreamUrl(c client) {
+	r.RLock()
+	cs := r.clientSet
+	allowLoopback := r.streamServer != nil
+	r.RUnlock()
+	if n := cs.clientIndex(c); n < 0 || !cs.backends[n].DiscoverStreamUrl {
+		return
+	}
+
+	u, err := r.getStatusStreamUrl(c)
+	if err == nil && u == nil {
+		err = errors.New("the status info doesn't contain the streaming url")
+	}
+	if err == nil {
+		u, err = utils.ResolveStreamUrl(u, allowLoopback)
+	}
+	r.Lock()
+	defer r.Unlock()
+	if err != nil {
+		glog.Warningf("Can't discover the streaming url of runtime %q: %v", c.getID(), err)
+		delete(r.discoveredStreamUrls, c)
+		return
+	}
+	glog.V(1).Infof("Using streaming url %s for runtime %q", u, c.getID())
+	r.discoveredStreamUrls[c] = *u
+}
+
+func (r *RuntimeProxy) getStatusStreamUrl(c client) (*url.URL, error) {
+	req, resp, err := r.criVersion.WrapObject(r.criVersion.VerboseStatusRequest())
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithTimeout(r.stopCtx, streamUrlDiscoveryTimeout)
+	defer cancel()
+	if _, err := c.invoke(ctx, r.methodPrefix+"RuntimeService/Status", req, resp); err != nil {
+		return nil, c.handleError(err, false)
+	}
+	return streamUrlFromStatusInfo(resp.(StatusResponse).Info())
+}
@@ -20,17 +20,27 @@ import (
 	"log"
 	"net"
 	"os"
+	"reflect"
+	"strings"
+	"sync"
 	"syscall"
+	"time"
 
+	"github.com/golang/protobuf/proto"
+	"golang.org/x/net/context"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
 
+	"github.com/elotl/criproxy/pkg/rawcodec"
 	"github.com/elotl/criproxy/pkg/runtimeapis"
+	v1 "github.com/elotl/criproxy/pkg/runtimeapis/v1"
 	v1_12 "github.com/elotl/criproxy/pkg/runtimeapis/v1_12"
 	v1_9 "github.com/elotl/criproxy/pkg/runtimeapis/v1_9"
 )
 
 type FakeCriServer interface {
 	Serve(addr string, readyCh chan struct{}) error
+	ServeListener(ln net.Listener, readyCh chan struct{}) error
 	Stop()
 	SetFakeImages(images []string)
 	SetFakeImageSize(size uint64)
@@ -55,6 +65,12 @@ func (s *fakeCriServerBase) Serve(addr string, readyCh chan struct{}) error {
 	if err != nil {
 		return err
 	}
+	return s.ServeListener(ln, readyCh)
+}
+
+// ServeListener serves the requests on the specified listener,
+// e.g. a TCP or TLS one, closing it upon return.
+func (s *fakeCriServerBase) ServeListener(ln net.Listener, readyCh chan struct{}) error {
 	defer ln.Close()
 	if readyCh != nil {
 		close(readyCh)
@@ -147,3 +163,163 @@ func (s *FakeCriServer110) SetFakeFilesystemUsage(imageFsUUID string) interface{
 func (s *FakeCriServer110) CurrentTime() int64 {
 	return s.FakeRuntimeServer110.CurrentTime
 }
+
+// FakeCriServer1 is a fake CRI v1 server. As CRI v1 is wire
+// compatible with v1alpha2, it converts the requests to v1alpha2
+// and handles them using FakeCriServer110 methods.
+// GetContainerEvents streams the events passed to
+// SendContainerEvent. The methods listed in FakeRawMethods
+// echo their requests as raw protobuf data, except for
+// PodSandboxStats that returns the pod sandbox id from the request
+// as the one in the stats. The methods can be delayed using SetDelay.
+type FakeCriServer1 struct {
+	*FakeCriServer110
+	sync.Mutex
+	rawJournal Journal
+	delays     map[string]time.Duration
+	eventChs   map[chan *v1.ContainerEventResponse]bool
+	stopCh     chan struct{}
+	stopOnce   sync.Once
+}
+
+var _ FakeCriServer = &FakeCriServer1{}
+
+// FakeRawMethods lists the methods that FakeCriServer1 handles
+// as raw protobuf data.
+var FakeRawMethods = []string{
+	"RuntimeService/ListPodSandboxStats",
+	"RuntimeService/ListMetricDescriptors",
+	"RuntimeService/CheckpointContainer",
+	"RuntimeService/PodSandboxStats",
+}
+
+func NewFakeCriServer1(journal Journal, streamUrl string) FakeCriServer {
+	s := &FakeCriServer1{
+		FakeCriServer110: &FakeCriServer110{
+			FakeRuntimeServer110: NewFakeRuntimeServer110(NewPrefixJournal(journal, "runtime/"), streamUrl),
+			FakeImageServer110:   NewFakeImageServer110(NewPrefixJournal(journal, "image/")),
+		},
+		rawJournal: NewPrefixJournal(journal, "runtime/"),
+		delays:     make(map[string]time.Duration),
+		eventChs:   make(map[chan *v1.ContainerEventResponse]bool),
+		stopCh:     make(chan struct{}),
+	}
+	s.fakeCriServerBase = &fakeCriServerBase{grpc.NewServer(grpc.CustomCodec(rawcodec.Codec{}), grpc.UnaryInterceptor(s.intercept), grpc.StreamInterceptor(s.interceptStream))}
+	v1.RegisterDummyRuntimeServiceServer(s.server, rawcodec.MethodDescs("runtime.v1.RuntimeService", FakeRawMethods)...)
+	v1.RegisterDummyImageServiceServer(s.server)
+	return s
+}
+
+// podSandboxStatsResponse makes PodSandboxStatsResponse with the
+// pod sandbox id from PodSandboxStatsRequest. The id is the field 1
+// of both PodSandboxStatsRequest and PodSandboxAttributes, so the
+// request is used as the attributes, which are wrapped into
+// PodSandboxStats, which is wrapped into the response.
+func podSandboxStatsResponse(req *rawcodec.Message) *rawcodec.Message {
+	data := req.Data
+	for i := 0; i < 2; i++ {
+		wrapped := append(proto.EncodeVarint(1<<3|proto.WireBytes), proto.EncodeVarint(uint64(len(data)))...)
+		data = append(wrapped, data...)
+	}
+	return &rawcodec.Message{Data: data}
+}
+
+func (s *FakeCriServer1) intercept(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	methodName := info.FullMethod[strings.LastIndex(info.FullMethod, "/")+1:]
+	s.Lock()
+	delay := s.delays[methodName]
+	s.Unlock()
+	if delay != 0 {
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	if raw, ok := req.(*rawcodec.Message); ok {
+		s.rawJournal.Record(methodName)
+		if methodName == "PodSandboxStats" {
+			return podSandboxStatsResponse(raw), nil
+		}
+		return raw, nil
+	}
+	method := reflect.ValueOf(s.FakeCriServer110).MethodByName(methodName)
+	if !method.IsValid() {
+		return nil, grpc.Errorf(codes.Unimplemented, "unknown method %q", info.FullMethod)
+	}
+	in, err := runtimeapis.Convert(req, runtimeapis.ProtoPackage112)
+	if err != nil {
+		return nil, err
+	}
+	r := method.Call([]reflect.Value{reflect.ValueOf(ctx), reflect.ValueOf(in)})
+	if err, _ := r[1].Interface().(error); err != nil {
+		return nil, err
+	}
+	return runtimeapis.Convert(r[0].Interface(), runtimeapis.ProtoPackage1)
+}
+
+func (s *FakeCriServer1) interceptStream(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	if info.FullMethod != "/runtime.v1.RuntimeService/GetContainerEvents" {
+		return grpc.Errorf(codes.Unimplemented, "unknown method %q", info.FullMethod)
+	}
+	if err := ss.RecvMsg(&v1.GetEventsRequest{}); err != nil {
+		return err
+	}
+	ch := make(chan *v1.ContainerEventResponse, 100)
+	s.Lock()
+	s.eventChs[ch] = true
+	s.Unlock()
+	defer func() {
+		s.Lock()
+		delete(s.eventChs, ch)
+		s.Unlock()
+	}()
+	for {
+		select {
+		case event := <-ch:
+			if err := ss.SendMsg(event); err != nil {
+				return err
+			}
+		case <-ss.Context().Done():
+			return nil
+		case <-s.stopCh:
+			return grpc.Errorf(codes.Unavailable, "the server is stopping")
+		}
+	}
+}
+
+// SetDelay makes the server wait for the specified duration
+// before handling the method, e.g. ListImages. Zero duration
+// removes the delay.
+func (s *FakeCriServer1) SetDelay(methodName string, delay time.Duration) {
+	s.Lock()
+	defer s.Unlock()
+	s.delays[methodName] = delay
+}
+
+// SendContainerEvent sends the event to all of the active
+// GetContainerEvents streams and returns the number of the streams.
+func (s *FakeCriServer1) SendContainerEvent(event *v1.ContainerEventResponse) int {
+	s.Lock()
+	defer s.Unlock()
+	for ch := range s.eventChs {
+		ch <- event
+	}
+	return len(s.eventChs)
+}
+
+// ContainerEventStreamCount returns the number of the active
+// GetContainerEvents streams.
+func (s *FakeCriServer1) ContainerEventStreamCount() int {
+	s.Lock()
+	defer s.Unlock()
+	return len(s.eventChs)
+}
+
+// Stop terminates GetContainerEvents streams and stops the server.
+func (s *FakeCriServer1) Stop() {
+	s.stopOnce.Do(func() {
+		close(s.stopCh)
+		s.FakeCriServer110.Stop()
+	})
+}
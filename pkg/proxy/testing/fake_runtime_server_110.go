@@ -43,6 +43,9 @@ import (
 
 	runtimeapi "github.com/elotl/criproxy/pkg/runtimeapis/v1_12"
 	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
 )
 
 func BuildContainerName110(metadata *runtimeapi.ContainerMetadata, sandboxID string) string {
@@ -76,6 +79,8 @@ type FakeRuntimeServer110 struct {
 	Containers         map[string]*FakeContainer110
 	Sandboxes          map[string]*FakePodSandbox110
 	FakeContainerStats map[string]*runtimeapi.ContainerStats
+	podCidr            string
+	notFoundDetails    []byte
 }
 
 var _ runtimeapi.RuntimeServiceServer = &FakeRuntimeServer110{}
@@ -146,9 +151,30 @@ func (r *FakeRuntimeServer110) Version(ctx context.Context, in *runtimeapi.Versi
 	}, nil
 }
 
+// SetNotFoundDetails sets google.rpc.Status that's passed in
+// grpc-status-details-bin trailer with the NotFound errors of
+// ContainerStatus.
+func (r *FakeRuntimeServer110) SetNotFoundDetails(details []byte) {
+	r.Lock()
+	defer r.Unlock()
+	r.notFoundDetails = details
+}
+
+func (r *FakeRuntimeServer110) SetFakeStatus(status *runtimeapi.RuntimeStatus) {
+	r.Lock()
+	defer r.Unlock()
+	r.FakeStatus = status
+}
+
 func (r *FakeRuntimeServer110) Status(ctx context.Context, in *runtimeapi.StatusRequest) (*runtimeapi.StatusResponse, error) {
+	r.Lock()
+	defer r.Unlock()
 	r.journal.Record("Status")
-	return &runtimeapi.StatusResponse{Status: r.FakeStatus}, nil
+	resp := &runtimeapi.StatusResponse{Status: r.FakeStatus}
+	if in.Verbose {
+		resp.Info = map[string]string{"config": `{"fake":true}`}
+	}
+	return resp, nil
 }
 
 func (r *FakeRuntimeServer110) RunPodSandbox(ctx context.Context, in *runtimeapi.RunPodSandboxRequest) (*runtimeapi.RunPodSandboxResponse, error) {
@@ -188,7 +214,7 @@ func (r *FakeRuntimeServer110) StopPodSandbox(ctx context.Context, in *runtimeap
 	if s, ok := r.Sandboxes[in.PodSandboxId]; ok {
 		s.State = notReadyState
 	} else {
-		return nil, fmt.Errorf("pod sandbox %s not found", in.PodSandboxId)
+		return nil, grpc.Errorf(codes.NotFound, "pod sandbox %s not found", in.PodSandboxId)
 	}
 
 	return &runtimeapi.StopPodSandboxResponse{}, nil
@@ -214,7 +240,7 @@ func (r *FakeRuntimeServer110) PodSandboxStatus(ctx context.Context, in *runtime
 
 	s, ok := r.Sandboxes[in.PodSandboxId]
 	if !ok {
-		return nil, fmt.Errorf("pod sandbox %q not found", in.PodSandboxId)
+		return nil, grpc.Errorf(codes.NotFound, "pod sandbox %q not found", in.PodSandboxId)
 	}
 
 	return &runtimeapi.PodSandboxStatusResponse{Status: &s.PodSandboxStatus}, nil
@@ -296,7 +322,7 @@ func (r *FakeRuntimeServer110) StartContainer(ctx context.Context, in *runtimeap
 
 	c, ok := r.Containers[in.ContainerId]
 	if !ok {
-		return nil, fmt.Errorf("container %s not found", in.ContainerId)
+		return nil, grpc.Errorf(codes.NotFound, "container %s not found", in.ContainerId)
 	}
 
 	// Set container to running.
@@ -314,7 +340,7 @@ func (r *FakeRuntimeServer110) StopContainer(ctx context.Context, in *runtimeapi
 
 	c, ok := r.Containers[in.ContainerId]
 	if !ok {
-		return nil, fmt.Errorf("container %q not found", in.ContainerId)
+		return nil, grpc.Errorf(codes.NotFound, "container %q not found", in.ContainerId)
 	}
 
 	// Set container to exited state.
@@ -391,7 +417,10 @@ func (r *FakeRuntimeServer110) ContainerStatus(ctx context.Context, in *runtimea
 
 	c, ok := r.Containers[in.ContainerId]
 	if !ok {
-		return nil, fmt.Errorf("container %q not found", in.ContainerId)
+		if r.notFoundDetails != nil {
+			grpc.SetTrailer(ctx, metadata.Pairs("grpc-status-details-bin", string(r.notFoundDetails)))
+		}
+		return nil, grpc.Errorf(codes.NotFound, "container %q not found", in.ContainerId)
 	}
 
 	return &runtimeapi.ContainerStatusResponse{Status: &c.ContainerStatus}, nil
@@ -404,7 +433,7 @@ func (r *FakeRuntimeServer110) UpdateContainerResources(ctx context.Context, in
 	r.journal.Record("UpdateContainerResources")
 
 	if _, ok := r.Containers[in.ContainerId]; !ok {
-		return nil, fmt.Errorf("container %q not found", in.ContainerId)
+		return nil, grpc.Errorf(codes.NotFound, "container %q not found", in.ContainerId)
 	}
 
 	return &runtimeapi.UpdateContainerResourcesResponse{}, nil
@@ -430,8 +459,19 @@ func (r *FakeRuntimeServer110) PortForward(ctx context.Context, in *runtimeapi.P
 	return &runtimeapi.PortForwardResponse{Url: r.streamUrl}, nil
 }
 
+// PodCidr returns the pod CIDR passed to the server
+// in the last UpdateRuntimeConfig request.
+func (r *FakeRuntimeServer110) PodCidr() string {
+	r.Lock()
+	defer r.Unlock()
+	return r.podCidr
+}
+
 func (r *FakeRuntimeServer110) UpdateRuntimeConfig(ctx context.Context, in *runtimeapi.UpdateRuntimeConfigRequest) (*runtimeapi.UpdateRuntimeConfigResponse, error) {
+	r.Lock()
+	defer r.Unlock()
 	r.journal.Record("UpdateRuntimeConfig")
+	r.podCidr = in.GetRuntimeConfig().GetNetworkConfig().GetPodCidr()
 	return &runtimeapi.UpdateRuntimeConfigResponse{}, nil
 }
 
@@ -43,6 +43,8 @@ import (
 
 	runtimeapi "github.com/elotl/criproxy/pkg/runtimeapis/v1_9"
 	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
 )
 
 func BuildContainerName19(metadata *runtimeapi.ContainerMetadata, sandboxID string) string {
@@ -73,6 +75,8 @@ type FakeRuntimeServer19 struct {
 	journal            Journal
 	CurrentTime        int64
 	FakeStatus         *runtimeapi.RuntimeStatus
+	FakeStatusInfo     map[string]string
+	statusBlock        chan struct{}
 	Containers         map[string]*FakeContainer19
 	Sandboxes          map[string]*FakePodSandbox19
 	FakeContainerStats map[string]*runtimeapi.ContainerStats
@@ -146,9 +150,40 @@ func (r *FakeRuntimeServer19) Version(ctx context.Context, in *runtimeapi.Versio
 	}, nil
 }
 
+func (r *FakeRuntimeServer19) SetFakeStatusInfo(info map[string]string) {
+	r.Lock()
+	defer r.Unlock()
+	r.FakeStatusInfo = info
+}
+
+// BlockStatus makes Status requests hang until the channel
+// is closed or the requests are cancelled.
+func (r *FakeRuntimeServer19) BlockStatus(ch chan struct{}) {
+	r.Lock()
+	defer r.Unlock()
+	r.statusBlock = ch
+}
+
 func (r *FakeRuntimeServer19) Status(ctx context.Context, in *runtimeapi.StatusRequest) (*runtimeapi.StatusResponse, error) {
+	r.Lock()
+	block := r.statusBlock
+	r.Unlock()
+	if block != nil {
+		select {
+		case <-block:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+
+	r.Lock()
+	defer r.Unlock()
 	r.journal.Record("Status")
-	return &runtimeapi.StatusResponse{Status: r.FakeStatus}, nil
+	resp := &runtimeapi.StatusResponse{Status: r.FakeStatus}
+	if in.Verbose {
+		resp.Info = r.FakeStatusInfo
+	}
+	return resp, nil
 }
 
 func (r *FakeRuntimeServer19) RunPodSandbox(ctx context.Context, in *runtimeapi.RunPodSandboxRequest) (*runtimeapi.RunPodSandboxResponse, error) {
@@ -188,7 +223,7 @@ func (r *FakeRuntimeServer19) StopPodSandbox(ctx context.Context, in *runtimeapi
 	if s, ok := r.Sandboxes[in.PodSandboxId]; ok {
 		s.State = notReadyState
 	} else {
-		return nil, fmt.Errorf("pod sandbox %s not found", in.PodSandboxId)
+		return nil, grpc.Errorf(codes.NotFound, "pod sandbox %s not found", in.PodSandboxId)
 	}
 
 	return &runtimeapi.StopPodSandboxResponse{}, nil
@@ -214,7 +249,7 @@ func (r *FakeRuntimeServer19) PodSandboxStatus(ctx context.Context, in *runtimea
 
 	s, ok := r.Sandboxes[in.PodSandboxId]
 	if !ok {
-		return nil, fmt.Errorf("pod sandbox %q not found", in.PodSandboxId)
+		return nil, grpc.Errorf(codes.NotFound, "pod sandbox %q not found", in.PodSandboxId)
 	}
 
 	return &runtimeapi.PodSandboxStatusResponse{Status: &s.PodSandboxStatus}, nil
@@ -296,7 +331,7 @@ func (r *FakeRuntimeServer19) StartContainer(ctx context.Context, in *runtimeapi
 
 	c, ok := r.Containers[in.ContainerId]
 	if !ok {
-		return nil, fmt.Errorf("container %s not found", in.ContainerId)
+		return nil, grpc.Errorf(codes.NotFound, "container %s not found", in.ContainerId)
 	}
 
 	// Set container to running.
@@ -314,7 +349,7 @@ func (r *FakeRuntimeServer19) StopContainer(ctx context.Context, in *runtimeapi.
 
 	c, ok := r.Containers[in.ContainerId]
 	if !ok {
-		return nil, fmt.Errorf("container %q not found", in.ContainerId)
+		return nil, grpc.Errorf(codes.NotFound, "container %q not found", in.ContainerId)
 	}
 
 	// Set container to exited state.
@@ -391,7 +426,7 @@ func (r *FakeRuntimeServer19) ContainerStatus(ctx context.Context, in *runtimeap
 
 	c, ok := r.Containers[in.ContainerId]
 	if !ok {
-		return nil, fmt.Errorf("container %q not found", in.ContainerId)
+		return nil, grpc.Errorf(codes.NotFound, "container %q not found", in.ContainerId)
 	}
 
 	return &runtimeapi.ContainerStatusResponse{Status: &c.ContainerStatus}, nil
@@ -404,7 +439,7 @@ func (r *FakeRuntimeServer19) UpdateContainerResources(ctx context.Context, in *
 	r.journal.Record("UpdateContainerResources")
 
 	if _, ok := r.Containers[in.ContainerId]; !ok {
-		return nil, fmt.Errorf("container %q not found", in.ContainerId)
+		return nil, grpc.Errorf(codes.NotFound, "container %q not found", in.ContainerId)
 	}
 
 	return &runtimeapi.UpdateContainerResourcesResponse{}, nil
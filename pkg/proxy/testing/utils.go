@@ -36,6 +36,7 @@ package testing
 import (
 	"fmt"
 	"reflect"
+	"sort"
 	"sync"
 	"time"
 )
@@ -116,6 +117,25 @@ func (j *SimpleJournal) Verify(expectedItems []string) error {
 	return nil
 }
 
+// VerifyUnordered verifies that the current contents of the journal
+// is expectedItems, ignoring the order of the items. It returns nil
+// if so or an error otherwise
+func (j *SimpleJournal) VerifyUnordered(expectedItems []string) error {
+	j.Lock()
+	defer j.Unlock()
+
+	actualItems := j.Items
+	j.Items = nil
+	sortedActual := append([]string(nil), actualItems...)
+	sortedExpected := append([]string(nil), expectedItems...)
+	sort.Strings(sortedActual)
+	sort.Strings(sortedExpected)
+	if !reflect.DeepEqual(sortedActual, sortedExpected) {
+		return fmt.Errorf("bad journal items. Expected %v (in any order), got %v", expectedItems, actualItems)
+	}
+	return nil
+}
+
 // PrefixJournal is an implementation of Journal interface that prefixes
 // every item passed to it with the specified prefix before passing it on
 // to the underlying Journal
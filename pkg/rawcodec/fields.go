@@ -0,0 +1,139 @@
+/*
+Copyright 2018 Mirantis
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package rawcodec
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/golang/protobuf/proto"
+)
+
+var errTruncated = errors.New("rawcodec: truncated protobuf data")
+
+// rawField describes a field found in protobuf data. start and
+// end are the offsets of the whole field including its key. For the
+// length-delimited fields, the value doesn't include the length.
+type rawField struct {
+	num        int
+	wireType   int
+	start, end int
+	value      []byte
+}
+
+// walkFields calls fn for each field found in protobuf data.
+func walkFields(data []byte, fn func(f rawField) error) error {
+	for pos := 0; pos < len(data); {
+		start := pos
+		key, n := proto.DecodeVarint(data[pos:])
+		if n == 0 {
+			return errTruncated
+		}
+		pos += n
+		f := rawField{num: int(key >> 3), wireType: int(key & 7), start: start}
+		var size int
+		switch f.wireType {
+		case proto.WireVarint:
+			if _, n = proto.DecodeVarint(data[pos:]); n == 0 {
+				return errTruncated
+			}
+			size = n
+		case proto.WireFixed64:
+			size = 8
+		case proto.WireFixed32:
+			size = 4
+		case proto.WireBytes:
+			l, n := proto.DecodeVarint(data[pos:])
+			if n == 0 || l > uint64(len(data)-pos-n) {
+				return errTruncated
+			}
+			pos += n
+			size = int(l)
+		default:
+			return fmt.Errorf("rawcodec: unsupported wire type %d", f.wireType)
+		}
+		if size > len(data)-pos {
+			return errTruncated
+		}
+		f.value = data[pos : pos+size]
+		pos += size
+		f.end = pos
+		if err := fn(f); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// StringField returns the value of the string field with the
+// specified number. As with the protobuf decoding, the last
+// occurrence of the field wins. An empty string is returned if
+// the field isn't present.
+func StringField(data []byte, num int) (string, error) {
+	var r string
+	err := walkFields(data, func(f rawField) error {
+		if f.num != num {
+			return nil
+		}
+		if f.wireType != proto.WireBytes {
+			return fmt.Errorf("rawcodec: field %d is not a string", num)
+		}
+		r = string(f.value)
+		return nil
+	})
+	return r, err
+}
+
+// RewriteStrings replaces the values of the string fields found
+// at the specified path of field numbers with the values returned
+// by fn. All of the fields in the path except for the last one
+// must be embedded messages. Each occurrence of the repeated
+// fields is rewritten, and the order of the fields is preserved.
+func RewriteStrings(data []byte, path []int, fn func(string) string) ([]byte, error) {
+	if len(path) == 0 {
+		return nil, errors.New("rawcodec: empty field path")
+	}
+	var r []byte
+	last := 0
+	err := walkFields(data, func(f rawField) error {
+		if f.num != path[0] {
+			return nil
+		}
+		if f.wireType != proto.WireBytes {
+			return fmt.Errorf("rawcodec: field %d is not length-delimited", f.num)
+		}
+		var value []byte
+		if len(path) == 1 {
+			value = []byte(fn(string(f.value)))
+		} else {
+			var err error
+			if value, err = RewriteStrings(f.value, path[1:], fn); err != nil {
+				return err
+			}
+		}
+		r = append(r, data[last:f.start]...)
+		r = append(r, proto.EncodeVarint(uint64(f.num<<3|proto.WireBytes))...)
+		r = append(r, proto.EncodeVarint(uint64(len(value)))...)
+		r = append(r, value...)
+		last = f.end
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return append(r, data[last:]...), nil
+}
@@ -0,0 +1,113 @@
+/*
+Copyright 2018 Mirantis
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package rawcodec provides a gRPC codec and method descriptions
+// that make it possible to pass the messages of the methods that
+// have no generated Go types as raw protobuf data.
+package rawcodec
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/golang/protobuf/proto"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+)
+
+// Message holds a protobuf message in its wire format.
+type Message struct {
+	Data []byte
+}
+
+// Codec is a gRPC codec that passes Message data as-is and
+// handles the other messages the same way as the default gRPC
+// codec does.
+type Codec struct{}
+
+var _ grpc.Codec = Codec{}
+
+// Marshal implements Marshal method of grpc.Codec interface.
+func (Codec) Marshal(v interface{}) ([]byte, error) {
+	switch m := v.(type) {
+	case *Message:
+		return m.Data, nil
+	case proto.Message:
+		return proto.Marshal(m)
+	default:
+		return nil, fmt.Errorf("can't marshal %T: not a protobuf message", v)
+	}
+}
+
+// Unmarshal implements Unmarshal method of grpc.Codec interface.
+func (Codec) Unmarshal(data []byte, v interface{}) error {
+	switch m := v.(type) {
+	case *Message:
+		m.Data = append([]byte(nil), data...)
+		return nil
+	case proto.Message:
+		return proto.Unmarshal(data, m)
+	default:
+		return fmt.Errorf("can't unmarshal %T: not a protobuf message", v)
+	}
+}
+
+// String implements String method of grpc.Codec interface.
+func (Codec) String() string {
+	return "proto"
+}
+
+// MethodDescs returns the descriptions of unary methods of the
+// specified service that accept and return raw protobuf data.
+// The methods are specified as Service/Method, e.g.
+// RuntimeService/ListMetricDescriptors, and only the ones that
+// belong to the service are used. serviceName is the full
+// service name including the proto package. The requests for
+// these methods must be handled by a gRPC interceptor, and the
+// server must use Codec.
+func MethodDescs(serviceName string, methods []string) []grpc.MethodDesc {
+	shortName := serviceName[strings.LastIndex(serviceName, ".")+1:]
+	var r []grpc.MethodDesc
+	for _, m := range methods {
+		parts := strings.SplitN(m, "/", 2)
+		if len(parts) != 2 || parts[0] != shortName {
+			continue
+		}
+		r = append(r, methodDesc(serviceName, parts[1]))
+	}
+	return r
+}
+
+func methodDesc(serviceName, methodName string) grpc.MethodDesc {
+	fullMethod := "/" + serviceName + "/" + methodName
+	return grpc.MethodDesc{
+		MethodName: methodName,
+		Handler: func(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+			in := &Message{}
+			if err := dec(in); err != nil {
+				return nil, err
+			}
+			handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+				return nil, grpc.Errorf(codes.Unimplemented, "%s must be handled by an interceptor", fullMethod)
+			}
+			if interceptor == nil {
+				return handler(ctx, in)
+			}
+			return interceptor(ctx, in, &grpc.UnaryServerInfo{Server: srv, FullMethod: fullMethod}, handler)
+		},
+	}
+}
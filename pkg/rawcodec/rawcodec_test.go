@@ -0,0 +1,155 @@
+/*
+Copyright 2018 Mirantis
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package rawcodec
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+
+	runtimeapi "github.com/elotl/criproxy/pkg/runtimeapis/v1"
+)
+
+func TestCodec(t *testing.T) {
+	var codec Codec
+	in := &runtimeapi.VersionRequest{Version: "0.1.0"}
+	data, err := codec.Marshal(in)
+	if err != nil {
+		t.Fatalf("Marshal(): %v", err)
+	}
+	expectedData, err := proto.Marshal(in)
+	if err != nil {
+		t.Fatalf("proto.Marshal(): %v", err)
+	}
+	if !bytes.Equal(data, expectedData) {
+		t.Errorf("bad marshalled data: %v instead of %v", data, expectedData)
+	}
+
+	var m Message
+	if err := codec.Unmarshal(data, &m); err != nil {
+		t.Fatalf("Unmarshal() into Message: %v", err)
+	}
+	if !bytes.Equal(m.Data, data) {
+		t.Errorf("bad raw message data: %v instead of %v", m.Data, data)
+	}
+	data[0] = 0xff
+	if m.Data[0] == 0xff {
+		t.Errorf("Unmarshal() didn't copy the data")
+	}
+
+	rawData, err := codec.Marshal(&m)
+	if err != nil {
+		t.Fatalf("Marshal() of Message: %v", err)
+	}
+	var out runtimeapi.VersionRequest
+	if err := codec.Unmarshal(rawData, &out); err != nil {
+		t.Fatalf("Unmarshal(): %v", err)
+	}
+	if !reflect.DeepEqual(in, &out) {
+		t.Errorf("bad unmarshalled message: %#v instead of %#v", out, in)
+	}
+
+	if _, err := codec.Marshal("foo"); err == nil {
+		t.Errorf("Marshal() didn't fail for a non-protobuf value")
+	}
+}
+
+func TestMethodDescs(t *testing.T) {
+	descs := MethodDescs("runtime.v1.RuntimeService", []string{
+		"RuntimeService/ListMetricDescriptors",
+		"ImageService/ImageFsInfo",
+		"RuntimeService/CheckpointContainer",
+	})
+	var names []string
+	for _, d := range descs {
+		names = append(names, d.MethodName)
+	}
+	expectedNames := []string{"ListMetricDescriptors", "CheckpointContainer"}
+	if !reflect.DeepEqual(names, expectedNames) {
+		t.Fatalf("bad method names: %v instead of %v", names, expectedNames)
+	}
+
+	data := []byte{10, 3, 'f', 'o', 'o'}
+	resp, err := descs[0].Handler(nil, nil, func(v interface{}) error {
+		return Codec{}.Unmarshal(data, v)
+	}, func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		if info.FullMethod != "/runtime.v1.RuntimeService/ListMetricDescriptors" {
+			t.Errorf("bad full method name %q", info.FullMethod)
+		}
+		return req, nil
+	})
+	if err != nil {
+		t.Fatalf("handler failed: %v", err)
+	}
+	if m, ok := resp.(*Message); !ok || !bytes.Equal(m.Data, data) {
+		t.Errorf("bad response %#v", resp)
+	}
+}
+
+func TestStringField(t *testing.T) {
+	data, err := proto.Marshal(&runtimeapi.PodSandboxStatusRequest{PodSandboxId: "alt__pod-1", Verbose: true})
+	if err != nil {
+		t.Fatalf("proto.Marshal(): %v", err)
+	}
+	id, err := StringField(data, 1)
+	if err != nil {
+		t.Fatalf("StringField(): %v", err)
+	}
+	if id != "alt__pod-1" {
+		t.Errorf("bad pod sandbox id %q", id)
+	}
+	if _, err := StringField(data, 2); err == nil {
+		t.Errorf("StringField() didn't fail for a varint field")
+	}
+	if _, err := StringField(data[:len(data)-3], 1); err == nil {
+		t.Errorf("StringField() didn't fail for truncated data")
+	}
+}
+
+func TestRewriteStrings(t *testing.T) {
+	in := &runtimeapi.ListPodSandboxResponse{
+		Items: []*runtimeapi.PodSandbox{
+			{Id: "pod-1", Metadata: &runtimeapi.PodSandboxMetadata{Name: "name-1"}, CreatedAt: 42},
+			{Id: "pod-2", Labels: map[string]string{"foo": "bar"}},
+		},
+	}
+	data, err := proto.Marshal(in)
+	if err != nil {
+		t.Fatalf("proto.Marshal(): %v", err)
+	}
+	data, err = RewriteStrings(data, []int{1, 1}, func(id string) string { return "alt__" + id })
+	if err != nil {
+		t.Fatalf("RewriteStrings(): %v", err)
+	}
+	var out runtimeapi.ListPodSandboxResponse
+	if err := proto.Unmarshal(data, &out); err != nil {
+		t.Fatalf("proto.Unmarshal(): %v", err)
+	}
+	in.Items[0].Id = "alt__pod-1"
+	in.Items[1].Id = "alt__pod-2"
+	if !reflect.DeepEqual(in, &out) {
+		t.Errorf("bad rewritten message: %#v instead of %#v", out, in)
+	}
+
+	if _, err := RewriteStrings(data, []int{1, 4}, func(s string) string { return s }); err == nil {
+		t.Errorf("RewriteStrings() didn't fail for a path to a varint field")
+	}
+}
@@ -19,17 +19,52 @@ package runtimeapis
 import (
 	"fmt"
 	"reflect"
+	"strings"
 
+	// register CRI v1 types
+	_ "github.com/elotl/criproxy/pkg/runtimeapis/v1"
 	v1_9 "github.com/elotl/criproxy/pkg/runtimeapis/v1_9"
 	"github.com/gogo/protobuf/proto"
 )
 
-func convertTo(in interface{}, targetProtoPackage string) (interface{}, error) {
+const (
+	// ProtoPackage19 is the proto package of CRI 1.9.
+	ProtoPackage19 = "runtime"
+	// ProtoPackage112 is the proto package of CRI 1.10 - 1.12 (v1alpha2).
+	ProtoPackage112 = "runtime.v1alpha2"
+	// ProtoPackage1 is the proto package of CRI v1.
+	ProtoPackage1 = "runtime.v1"
+)
+
+func messageType(in interface{}, targetProtoPackage string) (reflect.Type, error) {
 	targetTypeName := fmt.Sprintf("%s.%s", targetProtoPackage, reflect.TypeOf(in).Elem().Name())
 	mtype := proto.MessageType(targetTypeName)
 	if mtype == nil {
 		return nil, fmt.Errorf("target type for %T not found in proto package %q", in, targetProtoPackage)
 	}
+	return mtype, nil
+}
+
+func protoPackageOf(in interface{}) (string, error) {
+	msg, ok := in.(proto.Message)
+	if !ok {
+		return "", fmt.Errorf("%T is not a proto message", in)
+	}
+	name := proto.MessageName(msg)
+	lastDot := strings.LastIndex(name, ".")
+	if lastDot < 0 {
+		return "", fmt.Errorf("can't determine proto package of %T", in)
+	}
+	return name[:lastDot], nil
+}
+
+// convertTo converts between CRI 1.9 and CRI v1alpha2 objects using
+// the generated conversion functions.
+func convertTo(in interface{}, targetProtoPackage string) (interface{}, error) {
+	mtype, err := messageType(in, targetProtoPackage)
+	if err != nil {
+		return nil, err
+	}
 	if reflect.TypeOf(in) == mtype {
 		return in, nil
 	}
@@ -37,14 +72,61 @@ func convertTo(in interface{}, targetProtoPackage string) (interface{}, error) {
 	return out, v1_9.Scheme.Convert(in, out, nil)
 }
 
+// remarshal converts between wire-compatible CRI versions
+// (v1alpha2 and v1) by marshalling the object and unmarshalling
+// it as the target type.
+func remarshal(in interface{}, targetProtoPackage string) (interface{}, error) {
+	mtype, err := messageType(in, targetProtoPackage)
+	if err != nil {
+		return nil, err
+	}
+	data, err := proto.Marshal(in.(proto.Message))
+	if err != nil {
+		return nil, fmt.Errorf("error marshalling %T: %v", in, err)
+	}
+	out := reflect.New(mtype.Elem()).Interface().(proto.Message)
+	if err := proto.Unmarshal(data, out); err != nil {
+		return nil, fmt.Errorf("error unmarshalling %T: %v", out, err)
+	}
+	return out, nil
+}
+
+// Convert converts a CRI object to the CRI version with the
+// specified proto package. It just returns the object if it
+// already belongs to that version.
+func Convert(in interface{}, targetProtoPackage string) (interface{}, error) {
+	sourceProtoPackage, err := protoPackageOf(in)
+	switch {
+	case err != nil:
+		return nil, err
+	case sourceProtoPackage == targetProtoPackage:
+		return in, nil
+	case sourceProtoPackage == ProtoPackage19:
+		out, err := convertTo(in, ProtoPackage112)
+		if err != nil {
+			return nil, err
+		}
+		return Convert(out, targetProtoPackage)
+	case targetProtoPackage == ProtoPackage19:
+		// CRI 1.9 objects can only be converted from v1alpha2 ones
+		in, err = Convert(in, ProtoPackage112)
+		if err != nil {
+			return nil, err
+		}
+		return convertTo(in, ProtoPackage19)
+	default:
+		return remarshal(in, targetProtoPackage)
+	}
+}
+
 // Upgrade converts CRI 1.9 object to CRI 1.12 one. It just returns
 // the object if it's already CRI 1.12.
 func Upgrade(in interface{}) (interface{}, error) {
-	return convertTo(in, "runtime.v1alpha2")
+	return Convert(in, ProtoPackage112)
 }
 
 // Downgrade converts CRI 1.12 object to CRI 1.9 one. It just returns
 // the object if it's already CRI 1.9.
 func Downgrade(in interface{}) (interface{}, error) {
-	return convertTo(in, "runtime")
+	return Convert(in, ProtoPackage19)
 }
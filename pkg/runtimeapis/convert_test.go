@@ -17,12 +17,15 @@ limitations under the License.
 package runtimeapis
 
 import (
+	"bytes"
 	"log"
 	"reflect"
 	"testing"
 
 	"github.com/ghodss/yaml"
+	"github.com/gogo/protobuf/proto"
 
+	v1 "github.com/elotl/criproxy/pkg/runtimeapis/v1"
 	v1_12 "github.com/elotl/criproxy/pkg/runtimeapis/v1_12"
 	v1_9 "github.com/elotl/criproxy/pkg/runtimeapis/v1_9"
 )
@@ -187,3 +190,97 @@ func TestConversion(t *testing.T) {
 		}
 	}
 }
+
+func TestConversionV1(t *testing.T) {
+	for _, tc := range []struct {
+		name         string
+		in           interface{}
+		protoPackage string
+	}{
+		{
+			name: "CRI 1.9",
+			in: &v1_9.RunPodSandboxRequest{
+				Config: podSandboxConfig9(&v1_9.NamespaceOption{HostNetwork: true}),
+			},
+			protoPackage: ProtoPackage19,
+		},
+		{
+			name: "CRI v1alpha2",
+			in: &v1_12.RunPodSandboxRequest{
+				Config: podSandboxConfig10(&v1_12.NamespaceOption{
+					Network: v1_12.NamespaceMode_NODE,
+				}),
+			},
+			protoPackage: ProtoPackage112,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			out, err := Convert(tc.in, ProtoPackage1)
+			if err != nil {
+				t.Fatalf("Convert: %v", err)
+			}
+			req, ok := out.(*v1.RunPodSandboxRequest)
+			switch {
+			case !ok:
+				t.Fatalf("bad conversion result type %T", out)
+			case req.Config.GetMetadata().GetUid() != podUid1:
+				t.Errorf("bad pod uid after conversion:\n%s", mustYaml(req))
+			case req.Config.GetLinux().GetSecurityContext().GetNamespaceOptions().GetNetwork() != v1.NamespaceMode_NODE:
+				t.Errorf("bad network namespace mode after conversion:\n%s", mustYaml(req))
+			}
+
+			switch out1, err := Convert(out, ProtoPackage1); {
+			case err != nil:
+				t.Errorf("Convert (repeated): %v", err)
+			case out1 != out:
+				t.Errorf("Convert is not idempotent")
+			}
+
+			back, err := Convert(out, tc.protoPackage)
+			switch {
+			case err != nil:
+				t.Errorf("Convert (reverse): %v", err)
+			case !reflect.DeepEqual(back, tc.in):
+				t.Errorf("bad reverse conversion: expected:\n%s\nactual:\n%s", mustYaml(tc.in), mustYaml(back))
+			}
+		})
+	}
+}
+
+func TestV1UnknownFields(t *testing.T) {
+	// LinuxContainerSecurityContext with privileged: true and the
+	// seccomp field that's only known to CRI v1 holding
+	// SecurityProfile{ProfileType: Localhost, LocalhostRef: "profile.json"}
+	profileRef := "profile.json"
+	profile := append([]byte{0x08, 0x02, 0x12, byte(len(profileRef))}, profileRef...)
+	data := append([]byte{0x10, 0x01, 0x7a, byte(len(profile))}, profile...)
+
+	var securityContext v1.LinuxContainerSecurityContext
+	if err := proto.Unmarshal(data, &securityContext); err != nil {
+		t.Fatalf("Unmarshal: %v", err)
+	}
+	if !securityContext.Privileged {
+		t.Errorf("privileged flag lost")
+	}
+	in := &v1.CreateContainerRequest{
+		PodSandboxId: podSandboxId1,
+		Config: &v1.ContainerConfig{
+			Linux: &v1.LinuxContainerConfig{SecurityContext: &securityContext},
+		},
+	}
+	reqData, err := proto.Marshal(in)
+	if err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+	var out v1.CreateContainerRequest
+	if err := proto.Unmarshal(reqData, &out); err != nil {
+		t.Fatalf("Unmarshal: %v", err)
+	}
+	outData, err := proto.Marshal(out.Config.GetLinux().GetSecurityContext())
+	switch {
+	case err != nil:
+		t.Fatalf("Marshal: %v", err)
+	case !bytes.Equal(outData, data):
+		t.Errorf("the unknown fields weren't preserved: got % x instead of % x", outData, data)
+	}
+}
@@ -0,0 +1,121 @@
+/*
+Copyright 2018 Mirantis
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1
+
+// This file contains the types used by GetContainerEvents method
+// that was added in CRI v1 and thus isn't present in v1alpha2 schema
+// that's used for the rest of CRI v1 types. They're marshalled
+// using the struct tags as there's no generated code for them.
+
+import (
+	"github.com/gogo/protobuf/proto"
+)
+
+type ContainerEventType int32
+
+const (
+	// Container created
+	ContainerEventType_CONTAINER_CREATED_EVENT ContainerEventType = 0
+	// Container started
+	ContainerEventType_CONTAINER_STARTED_EVENT ContainerEventType = 1
+	// Container stopped
+	ContainerEventType_CONTAINER_STOPPED_EVENT ContainerEventType = 2
+	// Container deleted
+	ContainerEventType_CONTAINER_DELETED_EVENT ContainerEventType = 3
+)
+
+var ContainerEventType_name = map[int32]string{
+	0: "CONTAINER_CREATED_EVENT",
+	1: "CONTAINER_STARTED_EVENT",
+	2: "CONTAINER_STOPPED_EVENT",
+	3: "CONTAINER_DELETED_EVENT",
+}
+var ContainerEventType_value = map[string]int32{
+	"CONTAINER_CREATED_EVENT": 0,
+	"CONTAINER_STARTED_EVENT": 1,
+	"CONTAINER_STOPPED_EVENT": 2,
+	"CONTAINER_DELETED_EVENT": 3,
+}
+
+func (x ContainerEventType) String() string {
+	return proto.EnumName(ContainerEventType_name, int32(x))
+}
+
+type GetEventsRequest struct {
+}
+
+func (m *GetEventsRequest) Reset()         { *m = GetEventsRequest{} }
+func (m *GetEventsRequest) String() string { return proto.CompactTextString(m) }
+func (*GetEventsRequest) ProtoMessage()    {}
+
+type ContainerEventResponse struct {
+	// ID of the container
+	ContainerId string `protobuf:"bytes,1,opt,name=container_id,json=containerId,proto3" json:"container_id,omitempty"`
+	// Type of the container event
+	ContainerEventType ContainerEventType `protobuf:"varint,2,opt,name=container_event_type,json=containerEventType,proto3,enum=runtime.v1.ContainerEventType" json:"container_event_type,omitempty"`
+	// Creation timestamp of this event
+	CreatedAt int64 `protobuf:"varint,3,opt,name=created_at,json=createdAt,proto3" json:"created_at,omitempty"`
+	// Sandbox status
+	PodSandboxStatus *PodSandboxStatus `protobuf:"bytes,4,opt,name=pod_sandbox_status,json=podSandboxStatus" json:"pod_sandbox_status,omitempty"`
+	// Container statuses
+	ContainersStatuses []*ContainerStatus `protobuf:"bytes,5,rep,name=containers_statuses,json=containersStatuses" json:"containers_statuses,omitempty"`
+}
+
+func (m *ContainerEventResponse) Reset()         { *m = ContainerEventResponse{} }
+func (m *ContainerEventResponse) String() string { return proto.CompactTextString(m) }
+func (*ContainerEventResponse) ProtoMessage()    {}
+
+func (m *ContainerEventResponse) GetContainerId() string {
+	if m != nil {
+		return m.ContainerId
+	}
+	return ""
+}
+
+func (m *ContainerEventResponse) GetContainerEventType() ContainerEventType {
+	if m != nil {
+		return m.ContainerEventType
+	}
+	return ContainerEventType_CONTAINER_CREATED_EVENT
+}
+
+func (m *ContainerEventResponse) GetCreatedAt() int64 {
+	if m != nil {
+		return m.CreatedAt
+	}
+	return 0
+}
+
+func (m *ContainerEventResponse) GetPodSandboxStatus() *PodSandboxStatus {
+	if m != nil {
+		return m.PodSandboxStatus
+	}
+	return nil
+}
+
+func (m *ContainerEventResponse) GetContainersStatuses() []*ContainerStatus {
+	if m != nil {
+		return m.ContainersStatuses
+	}
+	return nil
+}
+
+func init() {
+	proto.RegisterType((*GetEventsRequest)(nil), "runtime.v1.GetEventsRequest")
+	proto.RegisterType((*ContainerEventResponse)(nil), "runtime.v1.ContainerEventResponse")
+	proto.RegisterEnum("runtime.v1.ContainerEventType", ContainerEventType_name, ContainerEventType_value)
+}
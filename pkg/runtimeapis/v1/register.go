@@ -0,0 +1,50 @@
+/*
+Copyright 2018 Mirantis
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1
+
+import (
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+)
+
+// CRI Proxy does all the work in its grpc interceptor,
+// wo we don't need real handlers. Let's cheat grpc a bit
+
+// GetContainerEventsStreamDesc describes GetContainerEvents
+// server-streaming method of RuntimeService.
+var GetContainerEventsStreamDesc = grpc.StreamDesc{
+	StreamName: "GetContainerEvents",
+	Handler: func(srv interface{}, stream grpc.ServerStream) error {
+		return grpc.Errorf(codes.Unimplemented, "GetContainerEvents must be handled by an interceptor")
+	},
+	ServerStreams: true,
+}
+
+func RegisterDummyRuntimeServiceServer(s *grpc.Server, extraMethods ...grpc.MethodDesc) {
+	desc := _RuntimeService_serviceDesc
+	desc.HandlerType = (*interface{})(nil)
+	desc.Methods = append(desc.Methods, extraMethods...)
+	desc.Streams = append(desc.Streams, GetContainerEventsStreamDesc)
+	s.RegisterService(&desc, struct{}{})
+}
+
+func RegisterDummyImageServiceServer(s *grpc.Server, extraMethods ...grpc.MethodDesc) {
+	desc := _ImageService_serviceDesc
+	desc.HandlerType = (*interface{})(nil)
+	desc.Methods = append(desc.Methods, extraMethods...)
+	s.RegisterService(&desc, struct{}{})
+}
@@ -23,14 +23,16 @@ import (
 // CRI Proxy does all the work in its grpc interceptor,
 // wo we don't need real handlers. Let's cheat grpc a bit
 
-func RegisterDummyRuntimeServiceServer(s *grpc.Server) {
+func RegisterDummyRuntimeServiceServer(s *grpc.Server, extraMethods ...grpc.MethodDesc) {
 	desc := _RuntimeService_serviceDesc
 	desc.HandlerType = (*interface{})(nil)
+	desc.Methods = append(desc.Methods, extraMethods...)
 	s.RegisterService(&desc, struct{}{})
 }
 
-func RegisterDummyImageServiceServer(s *grpc.Server) {
+func RegisterDummyImageServiceServer(s *grpc.Server, extraMethods ...grpc.MethodDesc) {
 	desc := _ImageService_serviceDesc
 	desc.HandlerType = (*interface{})(nil)
+	desc.Methods = append(desc.Methods, extraMethods...)
 	s.RegisterService(&desc, struct{}{})
 }
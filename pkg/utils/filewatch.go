@@ -0,0 +1,59 @@
+/*
+Copyright 2018 Mirantis
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package utils
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"io/ioutil"
+	"time"
+
+	"github.com/golang/glog"
+)
+
+func fileChecksum(path string) []byte {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		glog.V(1).Infof("can't read %q: %v", path, err)
+		return nil
+	}
+	sum := sha256.Sum256(data)
+	return sum[:]
+}
+
+// WatchFile checks the contents of the file at the specified path
+// each interval and invokes onChange when it changes. The file is
+// considered unchanged while it can't be read, so that the editors
+// that replace the file don't cause spurious calls. WatchFile
+// returns when stopCh is closed.
+func WatchFile(path string, interval time.Duration, stopCh <-chan struct{}, onChange func()) {
+	lastSum := fileChecksum(path)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stopCh:
+			return
+		case <-ticker.C:
+			sum := fileChecksum(path)
+			if sum != nil && !bytes.Equal(sum, lastSum) {
+				lastSum = sum
+				onChange()
+			}
+		}
+	}
+}
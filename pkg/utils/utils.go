@@ -16,10 +16,12 @@ limitations under the License.
 package utils
 
 import (
+	"fmt"
 	"net"
 	"net/url"
 	"os"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/golang/glog"
@@ -33,30 +35,112 @@ const (
 	connectAttemptInterval = 500 * time.Millisecond
 )
 
+const (
+	// EndpointSchemeUnix denotes a unix domain socket endpoint.
+	EndpointSchemeUnix = "unix"
+	// EndpointSchemeTCP denotes a plain TCP endpoint.
+	EndpointSchemeTCP = "tcp"
+	// EndpointSchemeTLS denotes a TCP endpoint that's
+	// connected to using TLS.
+	EndpointSchemeTLS = "tls"
+)
+
+// ParseEndpoint parses a runtime endpoint, which is either a path
+// to a unix domain socket or an URL like unix:///path/to/socket,
+// tcp://host:port or tls://host:port. It returns the scheme of the
+// endpoint and the address to connect to, i.e. the socket path or
+// host:port.
+func ParseEndpoint(endpoint string) (scheme, addr string, err error) {
+	if !strings.Contains(endpoint, "://") {
+		return EndpointSchemeUnix, endpoint, nil
+	}
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return "", "", fmt.Errorf("bad endpoint %q: %v", endpoint, err)
+	}
+	switch u.Scheme {
+	case EndpointSchemeUnix:
+		if u.Host != "" || u.Path == "" {
+			return "", "", fmt.Errorf("bad endpoint %q: must be unix:///path/to/socket", endpoint)
+		}
+		return u.Scheme, u.Path, nil
+	case EndpointSchemeTCP, EndpointSchemeTLS:
+		if _, port, err := net.SplitHostPort(u.Host); err != nil || port == "" || (u.Path != "" && u.Path != "/") {
+			return "", "", fmt.Errorf("bad endpoint %q: must be %s://host:port", endpoint, u.Scheme)
+		}
+		return u.Scheme, u.Host, nil
+	default:
+		return "", "", fmt.Errorf("bad endpoint %q: unknown scheme %q (must be unix, tcp or tls)", endpoint, u.Scheme)
+	}
+}
+
+// EndpointNetwork returns the network ("unix" or "tcp") for
+// the endpoint scheme.
+func EndpointNetwork(scheme string) string {
+	if scheme == EndpointSchemeUnix {
+		return "unix"
+	}
+	return "tcp"
+}
+
 // dial creates a net.Conn by unix socket addr.
 func Dial(addr string, timeout time.Duration) (net.Conn, error) {
 	return net.DialTimeout("unix", addr, timeout)
 }
 
-func WaitForSocket(path string, maxAttempts int, extraCheck func() error) error {
+// Dialer returns a function that connects to an address in the
+// specified network ("unix" or "tcp") and can be used with
+// grpc.WithDialer(). keepAlive is the keep-alive period for TCP
+// connections. Zero means the default period, and negative value
+// disables keep-alives.
+func Dialer(network string, keepAlive time.Duration) func(addr string, timeout time.Duration) (net.Conn, error) {
+	return func(addr string, timeout time.Duration) (net.Conn, error) {
+		d := net.Dialer{Timeout: timeout, KeepAlive: keepAlive}
+		return d.Dial(network, addr)
+	}
+}
+
+// checkSocketFile verifies that the socket file exists if the
+// network is "unix". There's nothing to check for TCP addresses.
+func checkSocketFile(network, addr string) error {
+	if network != "unix" {
+		return nil
+	}
+	_, err := os.Stat(addr)
+	return err
+}
+
+// WaitForSocket waits for the address in the specified network
+// ("unix" or "tcp") to become connectable, making at most maxAttempts
+// attempts (no limit if maxAttempts is negative). If extraCheck is
+// not nil, it's also required to succeed. If onFailedAttempt is not
+// nil, it's invoked with the error of each failed attempt.
+func WaitForSocket(network, addr string, maxAttempts int, extraCheck func() error, onFailedAttempt func(err error)) error {
 	var err error
 	var conn net.Conn
+	dial := Dialer(network, 0)
 	for n := 0; maxAttempts < 0 || n < maxAttempts; n++ {
-		if _, err = os.Stat(path); err != nil {
-			glog.V(1).Infof("attempt %d: %q is not here yet: %v", n, path, err)
-		} else if conn, err = Dial(path, connectWaitTimeout); err != nil {
-			glog.V(1).Infof("attempt %d: can't connect to %q yet: %v", n, path, err)
+		if err = checkSocketFile(network, addr); err != nil {
+			glog.V(1).Infof("attempt %d: %q is not here yet: %v", n, addr, err)
+		} else if conn, err = dial(addr, connectWaitTimeout); err != nil {
+			glog.V(1).Infof("attempt %d: can't connect to %q yet: %v", n, addr, err)
 		} else {
 			conn.Close()
 			if extraCheck != nil {
 				err = extraCheck()
 				if err != nil {
-					glog.V(1).Infof("attempt %d: extra check failed for %q: %v", n, path, err)
+					glog.V(1).Infof("attempt %d: extra check failed for %q: %v", n, addr, err)
+					if onFailedAttempt != nil {
+						onFailedAttempt(err)
+					}
 					continue
 				}
 			}
 			break
 		}
+		if onFailedAttempt != nil {
+			onFailedAttempt(err)
+		}
 		time.Sleep(connectAttemptInterval)
 	}
 	return err
@@ -72,3 +156,43 @@ func GetStreamUrl(port int) (*url.URL, error) {
 		Host:   net.JoinHostPort(bindAddress.String(), strconv.Itoa(port)),
 	}, nil
 }
+
+// ResolveStreamUrl completes the streaming url of a runtime so it
+// can be returned to the clients that connect to the node using the
+// node address chosen by knet.ChooseBindAddress. The unspecified host
+// address (0.0.0.0 or [::]) is replaced with the node address.
+// Only the addresses that can never be reached from other hosts are
+// rejected: loopback addresses, including localhost, unless
+// allowLoopback is true, i.e. if the streaming requests are passed
+// to the runtime by the proxy itself, and link-local addresses.
+// Other addresses and host names are returned as is without checking
+// whether they're actually reachable.
+func ResolveStreamUrl(u *url.URL, allowLoopback bool) (*url.URL, error) {
+	host := u.Hostname()
+	if host == "" {
+		return nil, fmt.Errorf("stream url %q has no host", u)
+	}
+	nodeAddress, err := knet.ChooseBindAddress(net.IP{0, 0, 0, 0})
+	if err != nil {
+		return nil, err
+	}
+	ip := net.ParseIP(host)
+	switch {
+	case ip == nil && host == "localhost", ip != nil && ip.IsLoopback():
+		if !allowLoopback {
+			return nil, fmt.Errorf("stream url %q uses a loopback address that can't be reached from the node address %s", u, nodeAddress)
+		}
+	case ip != nil && ip.IsLinkLocalUnicast():
+		return nil, fmt.Errorf("stream url %q uses a link-local address that can't be reached from the node address %s", u, nodeAddress)
+	case ip != nil && ip.IsUnspecified():
+		resolved := *u
+		resolved.Host = nodeAddress.String()
+		if port := u.Port(); port != "" {
+			resolved.Host = net.JoinHostPort(resolved.Host, port)
+		} else if nodeAddress.To4() == nil {
+			resolved.Host = "[" + resolved.Host + "]"
+		}
+		return &resolved, nil
+	}
+	return u, nil
+}
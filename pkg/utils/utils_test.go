@@ -0,0 +1,185 @@
+/*
+Copyright 2018 Mirantis
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package utils
+
+import (
+	"net"
+	"net/url"
+	"strings"
+	"testing"
+
+	knet "k8s.io/apimachinery/pkg/util/net"
+)
+
+func TestParseEndpoint(t *testing.T) {
+	for _, tc := range []struct {
+		endpoint, scheme, addr string
+		error                  string
+	}{
+		{
+			endpoint: "/run/containerd/containerd.sock",
+			scheme:   EndpointSchemeUnix,
+			addr:     "/run/containerd/containerd.sock",
+		},
+		{
+			endpoint: "unix:///run/containerd/containerd.sock",
+			scheme:   EndpointSchemeUnix,
+			addr:     "/run/containerd/containerd.sock",
+		},
+		{
+			endpoint: "tcp://10.0.0.1:10010",
+			scheme:   EndpointSchemeTCP,
+			addr:     "10.0.0.1:10010",
+		},
+		{
+			endpoint: "tls://runtime.example.com:10010/",
+			scheme:   EndpointSchemeTLS,
+			addr:     "runtime.example.com:10010",
+		},
+		{
+			endpoint: "unix://run/containerd.sock",
+			error:    "must be unix:///path/to/socket",
+		},
+		{
+			endpoint: "unix://",
+			error:    "must be unix:///path/to/socket",
+		},
+		{
+			endpoint: "tcp://10.0.0.1",
+			error:    "must be tcp://host:port",
+		},
+		{
+			endpoint: "tls://runtime.example.com:10010/cri",
+			error:    "must be tls://host:port",
+		},
+		{
+			endpoint: "http://10.0.0.1:10010",
+			error:    `unknown scheme "http"`,
+		},
+		{
+			endpoint: "tcp://10.0.0.1:%zz",
+			error:    "bad endpoint",
+		},
+	} {
+		t.Run(tc.endpoint, func(t *testing.T) {
+			scheme, addr, err := ParseEndpoint(tc.endpoint)
+			switch {
+			case tc.error == "" && err != nil:
+				t.Errorf("ParseEndpoint(): %v", err)
+			case tc.error != "" && err == nil:
+				t.Errorf("ParseEndpoint() didn't fail (expected error containing %q)", tc.error)
+			case tc.error != "" && !strings.Contains(err.Error(), tc.error):
+				t.Errorf("bad error %q (expected it to contain %q)", err, tc.error)
+			case scheme != tc.scheme || addr != tc.addr:
+				t.Errorf("ParseEndpoint() = %q, %q instead of %q, %q", scheme, addr, tc.scheme, tc.addr)
+			}
+		})
+	}
+}
+
+func TestResolveStreamUrl(t *testing.T) {
+	nodeAddress, err := knet.ChooseBindAddress(net.IP{0, 0, 0, 0})
+	if err != nil {
+		t.Skipf("can't choose the node address: %v", err)
+	}
+	nodeHost := nodeAddress.String()
+	if nodeAddress.To4() == nil {
+		nodeHost = "[" + nodeHost + "]"
+	}
+	for _, tc := range []struct {
+		name, url     string
+		allowLoopback bool
+		expectedUrl   string
+		error         string
+	}{
+		{
+			name:  "no host",
+			url:   "/cri",
+			error: "has no host",
+		},
+		{
+			name:  "loopback IPv4 address",
+			url:   "http://127.0.0.1:10010",
+			error: "loopback address",
+		},
+		{
+			name:  "loopback IPv6 address",
+			url:   "http://[::1]:10010",
+			error: "loopback address",
+		},
+		{
+			name:  "localhost",
+			url:   "http://localhost:10010",
+			error: "loopback address",
+		},
+		{
+			name:          "loopback address with the proxy's streaming endpoint",
+			url:           "http://127.0.0.1:10010/cri",
+			allowLoopback: true,
+			expectedUrl:   "http://127.0.0.1:10010/cri",
+		},
+		{
+			name:  "link-local IPv4 address",
+			url:   "http://169.254.1.1:10010",
+			error: "link-local address",
+		},
+		{
+			name:          "link-local IPv6 address",
+			url:           "http://[fe80::1]:10010",
+			allowLoopback: true,
+			error:         "link-local address",
+		},
+		{
+			name:        "unspecified IPv4 address",
+			url:         "https://0.0.0.0:10010/cri",
+			expectedUrl: "https://" + net.JoinHostPort(nodeAddress.String(), "10010") + "/cri",
+		},
+		{
+			name:        "unspecified IPv6 address without port",
+			url:         "http://[::]/cri",
+			expectedUrl: "http://" + nodeHost + "/cri",
+		},
+		{
+			name:        "other address",
+			url:         "http://10.0.0.1:10010/cri",
+			expectedUrl: "http://10.0.0.1:10010/cri",
+		},
+		{
+			name:        "host name",
+			url:         "http://node1.example.com:10010/cri",
+			expectedUrl: "http://node1.example.com:10010/cri",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			u, err := url.Parse(tc.url)
+			if err != nil {
+				t.Fatalf("can't parse url %q: %v", tc.url, err)
+			}
+			resolved, err := ResolveStreamUrl(u, tc.allowLoopback)
+			switch {
+			case tc.error == "" && err != nil:
+				t.Errorf("ResolveStreamUrl(): %v", err)
+			case tc.error != "" && err == nil:
+				t.Errorf("ResolveStreamUrl() didn't fail (expected error containing %q)", tc.error)
+			case tc.error != "" && !strings.Contains(err.Error(), tc.error):
+				t.Errorf("bad error %q (expected it to contain %q)", err, tc.error)
+			case tc.error == "" && resolved.String() != tc.expectedUrl:
+				t.Errorf("bad url %q (expected %q)", resolved, tc.expectedUrl)
+			}
+		})
+	}
+}